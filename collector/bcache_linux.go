@@ -17,12 +17,19 @@ package collector
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/procfs/bcache"
 )
 
+// bcacheBackingStates are the values of /sys/block/<bdev>/bcache/state, with
+// spaces replaced by underscores.
+var bcacheBackingStates = []string{"no_cache", "clean", "dirty", "inconsistent"}
+
 func init() {
 	registerCollector("bcache", defaultEnabled, NewBcacheCollector)
 }
@@ -223,6 +230,22 @@ func (c *bcacheCollector) updateBcacheStats(ch chan<- prometheus.Metric, s *bcac
 				extraLabel:      []string{"backing_device"},
 				extraLabelValue: bdev.Name,
 			},
+			{
+				name:            "writeback_rate_bytes_per_second",
+				desc:            "Current rate at which dirty data of this backing device is written back, in bytes per second.",
+				value:           float64(bdev.WritebackRateDebug.Rate),
+				metricType:      prometheus.GaugeValue,
+				extraLabel:      []string{"backing_device"},
+				extraLabelValue: bdev.Name,
+			},
+			{
+				name:            "cache_hit_ratio",
+				desc:            "Ratio of cache hits to cache hits and misses for this backing device over the last five minutes.",
+				value:           bcacheHitRatio(&bdev.FiveMin),
+				metricType:      prometheus.GaugeValue,
+				extraLabel:      []string{"backing_device"},
+				extraLabelValue: bdev.Name,
+			},
 		}
 		allMetrics = append(allMetrics, metrics...)
 
@@ -302,4 +325,36 @@ func (c *bcacheCollector) updateBcacheStats(ch chan<- prometheus.Metric, s *bcac
 			labelValues...,
 		)
 	}
+
+	stateDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "backing_device_state"),
+		"Indicates the state of the backing device.",
+		[]string{"uuid", "backing_device", "state"},
+		nil,
+	)
+	for _, bdev := range s.Bdevs {
+		state, err := readStringFromFile(sysFilePath(filepath.Join("fs/bcache", s.Name, bdev.Name, "state")))
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't read backing device state", "backing_device", bdev.Name, "err", err)
+			continue
+		}
+		state = strings.ReplaceAll(state, " ", "_")
+		for _, st := range bcacheBackingStates {
+			v := 0.0
+			if st == state {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(stateDesc, prometheus.GaugeValue, v, s.Name, bdev.Name, st)
+		}
+	}
+}
+
+// bcacheHitRatio returns the fraction of cache hits of the IO seen by bcache
+// in the given period.
+func bcacheHitRatio(ps *bcache.PeriodStats) float64 {
+	total := ps.CacheHits + ps.CacheMisses
+	if total == 0 {
+		return 0
+	}
+	return float64(ps.CacheHits) / float64(total)
 }
@@ -0,0 +1,184 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nobdi
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const bdiSubsystem = "bdi"
+
+// bdiStatsMetric describes a field of /sys/kernel/debug/bdi/<bdi>/stats.
+type bdiStatsMetric struct {
+	name      string
+	help      string
+	valueType prometheus.ValueType
+}
+
+// bdiStatsMetrics are the exported fields of the debugfs stats, sizes are
+// converted from kB to bytes.
+var bdiStatsMetrics = map[string]bdiStatsMetric{
+	"BdiWriteback":      {"writeback_bytes", "Amount of data under writeback.", prometheus.GaugeValue},
+	"BdiReclaimable":    {"reclaimable_bytes", "Amount of dirty data not yet under writeback.", prometheus.GaugeValue},
+	"BdiDirtyThresh":    {"dirty_threshold_bytes", "Amount of dirty data above which writers to the device are throttled.", prometheus.GaugeValue},
+	"BdiDirtied":        {"dirtied_bytes_total", "Amount of data dirtied.", prometheus.CounterValue},
+	"BdiWritten":        {"written_bytes_total", "Amount of data written back.", prometheus.CounterValue},
+	"BdiWriteBandwidth": {"write_bandwidth_bytes_per_second", "Estimated writeback bandwidth in bytes per second.", prometheus.GaugeValue},
+	"b_dirty":           {"dirty_inodes", "Number of dirty inodes waiting for writeback.", prometheus.GaugeValue},
+	"b_io":              {"io_inodes", "Number of inodes queued for writeback.", prometheus.GaugeValue},
+	"b_more_io":         {"more_io_inodes", "Number of inodes requeued for further writeback.", prometheus.GaugeValue},
+}
+
+type bdiCollector struct {
+	info        *prometheus.Desc
+	readAhead   *prometheus.Desc
+	minRatio    *prometheus.Desc
+	maxRatio    *prometheus.Desc
+	strictLimit *prometheus.Desc
+	stats       map[string]*prometheus.Desc
+	logger      log.Logger
+}
+
+func init() {
+	registerCollector("bdi", defaultDisabled, NewBDICollector)
+}
+
+// NewBDICollector returns a new Collector exposing writeback statistics of
+// backing devices.
+func NewBDICollector(logger log.Logger) (Collector, error) {
+	labels := []string{"bdi"}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, bdiSubsystem, name),
+			help, labels, nil,
+		)
+	}
+	stats := make(map[string]*prometheus.Desc, len(bdiStatsMetrics))
+	for field, m := range bdiStatsMetrics {
+		stats[field] = desc(m.name, m.help)
+	}
+	return &bdiCollector{
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, bdiSubsystem, "info"),
+			"Non-numeric data from /sys/class/bdi/<bdi>, value is always 1.",
+			[]string{"bdi", "device"}, nil,
+		),
+		readAhead:   desc("read_ahead_bytes", "Maximum amount of data read ahead."),
+		minRatio:    desc("min_ratio", "Minimum share of the global dirty threshold guaranteed to the device."),
+		maxRatio:    desc("max_ratio", "Maximum share of the global dirty threshold the device may use."),
+		strictLimit: desc("strict_limit", "Whether the device is throttled at its share of the dirty threshold even below the global threshold."),
+		stats:       stats,
+		logger:      logger,
+	}, nil
+}
+
+func (c *bdiCollector) Update(ch chan<- prometheus.Metric) error {
+	bdis, err := filepath.Glob(sysFilePath("class/bdi/*"))
+	if err != nil {
+		return err
+	}
+	if len(bdis) == 0 {
+		level.Debug(c.logger).Log("msg", "no backing devices found, skipping")
+		return ErrNoData
+	}
+
+	for _, path := range bdis {
+		bdi := filepath.Base(path)
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, bdi, bdiDeviceName(bdi))
+
+		if v, err := readUintFromFile(filepath.Join(path, "read_ahead_kb")); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.readAhead, prometheus.GaugeValue, float64(v)*1024, bdi)
+		}
+		if v, err := readUintFromFile(filepath.Join(path, "min_ratio")); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.minRatio, prometheus.GaugeValue, float64(v)/100, bdi)
+		}
+		if v, err := readUintFromFile(filepath.Join(path, "max_ratio")); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.maxRatio, prometheus.GaugeValue, float64(v)/100, bdi)
+		}
+		// Added in Linux 6.2.
+		if v, err := readUintFromFile(filepath.Join(path, "strict_limit")); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.strictLimit, prometheus.GaugeValue, float64(v), bdi)
+		}
+
+		stats, err := readBDIStats(sysFilePath(filepath.Join("kernel/debug/bdi", bdi, "stats")))
+		if err != nil {
+			// debugfs is only readable by root and often not mounted.
+			level.Debug(c.logger).Log("msg", "couldn't read writeback stats", "bdi", bdi, "err", err)
+			continue
+		}
+		for field, v := range stats {
+			desc, ok := c.stats[field]
+			if !ok {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(desc, bdiStatsMetrics[field].valueType, v, bdi)
+		}
+	}
+
+	return nil
+}
+
+// bdiDeviceName returns the name of the block device of a backing device,
+// or an empty string for backing devices of other filesystems.
+func bdiDeviceName(bdi string) string {
+	target, err := os.Readlink(sysFilePath(filepath.Join("dev/block", bdi)))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+func readBDIStats(path string) (map[string]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseBDIStats(f)
+}
+
+// parseBDIStats parses lines like "BdiWriteback:   16 kB", converting kB and
+// kBps to bytes.
+func parseBDIStats(r io.Reader) (map[string]float64, error) {
+	stats := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasSuffix(fields[0], ":") {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value in line %q: %w", scanner.Text(), err)
+		}
+		if len(fields) > 2 && (fields[2] == "kB" || fields[2] == "kBps") {
+			v *= 1024
+		}
+		stats[strings.TrimSuffix(fields[0], ":")] = v
+	}
+	return stats, scanner.Err()
+}
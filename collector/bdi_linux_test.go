@@ -0,0 +1,39 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nobdi
+
+package collector
+
+import (
+	"testing"
+)
+
+func TestReadBDIStats(t *testing.T) {
+	stats, err := readBDIStats("fixtures/sys/kernel/debug/bdi/259:0/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for field, want := range map[string]float64{
+		"BdiWriteback":      16 * 1024,
+		"BdiDirtied":        6124100 * 1024,
+		"BdiWriteBandwidth": 1332 * 1024,
+		"b_dirty":           1558,
+		"state":             5,
+	} {
+		if got := stats[field]; got != want {
+			t.Errorf("want %s %f, got %f", field, want, got)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noblk_mq
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const blkMQSubsystem = "blk_mq"
+
+type blkMQCollector struct {
+	info         *prometheus.Desc
+	tags         *prometheus.Desc
+	reservedTags *prometheus.Desc
+	queued       *prometheus.Desc
+	runs         *prometheus.Desc
+	active       *prometheus.Desc
+	dispatched   *prometheus.Desc
+	completed    *prometheus.Desc
+	logger       log.Logger
+}
+
+func init() {
+	registerCollector("blk_mq", defaultDisabled, NewBlkMQCollector)
+}
+
+// NewBlkMQCollector returns a new Collector exposing statistics of the
+// hardware queues of multiqueue block devices.
+func NewBlkMQCollector(logger log.Logger) (Collector, error) {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, blkMQSubsystem, name),
+			help,
+			[]string{"device", "queue"}, nil,
+		)
+	}
+	return &blkMQCollector{
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, blkMQSubsystem, "hw_queue_info"),
+			"Non-numeric data from /sys/block/<device>/mq/<queue>, value is always 1.",
+			[]string{"device", "queue", "cpu_list"}, nil,
+		),
+		tags:         desc("hw_queue_tags", "Number of tags, i.e. the queue depth, of the hardware queue."),
+		reservedTags: desc("hw_queue_reserved_tags", "Number of reserved tags of the hardware queue."),
+		queued:       desc("hw_queue_queued_requests_total", "Number of requests queued to the hardware queue."),
+		runs:         desc("hw_queue_runs_total", "Number of times the hardware queue was run."),
+		active:       desc("hw_queue_active_requests", "Number of requests in flight on the hardware queue of a shared tag set."),
+		dispatched:   desc("hw_queue_dispatched_requests_total", "Number of requests dispatched from the software queues mapped to the hardware queue."),
+		completed:    desc("hw_queue_completed_requests_total", "Number of requests completed on the software queues mapped to the hardware queue."),
+		logger:       logger,
+	}, nil
+}
+
+func (c *blkMQCollector) Update(ch chan<- prometheus.Metric) error {
+	queues, err := filepath.Glob(sysFilePath("block/*/mq/*"))
+	if err != nil {
+		return err
+	}
+	if len(queues) == 0 {
+		level.Debug(c.logger).Log("msg", "no multiqueue block devices found, skipping")
+		return ErrNoData
+	}
+
+	for _, path := range queues {
+		queue := filepath.Base(path)
+		device := filepath.Base(filepath.Dir(filepath.Dir(path)))
+
+		cpuList, _ := readStringFromFile(filepath.Join(path, "cpu_list"))
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, device, queue, cpuList)
+
+		for _, m := range []struct {
+			file string
+			desc *prometheus.Desc
+		}{
+			{"nr_tags", c.tags},
+			{"nr_reserved_tags", c.reservedTags},
+		} {
+			v, err := readUintFromFile(filepath.Join(path, m.file))
+			if err != nil {
+				return fmt.Errorf("couldn't get %s of %s queue %s: %w", m.file, device, queue, err)
+			}
+			ch <- prometheus.MustNewConstMetric(m.desc, prometheus.GaugeValue, float64(v), device, queue)
+		}
+
+		// The request counters are only available in debugfs.
+		debugDir := sysFilePath(filepath.Join("kernel/debug/block", device, "hctx"+queue))
+		if _, err := os.Stat(debugDir); err != nil {
+			level.Debug(c.logger).Log("msg", "hardware queue not found in debugfs", "device", device, "queue", queue, "err", err)
+			continue
+		}
+		for _, m := range []struct {
+			file      string
+			desc      *prometheus.Desc
+			valueType prometheus.ValueType
+		}{
+			{"queued", c.queued, prometheus.CounterValue},
+			{"run", c.runs, prometheus.CounterValue},
+			{"active", c.active, prometheus.GaugeValue},
+		} {
+			v, err := readUintFromFile(filepath.Join(debugDir, m.file))
+			if err != nil {
+				level.Debug(c.logger).Log("msg", "couldn't read hardware queue attribute", "device", device, "queue", queue, "file", m.file, "err", err)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, float64(v), device, queue)
+		}
+
+		for _, m := range []struct {
+			file string
+			desc *prometheus.Desc
+		}{
+			{"dispatched", c.dispatched},
+			{"completed", c.completed},
+		} {
+			v, err := readBlkMQCPUCounters(debugDir, m.file)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					// Removed from newer kernels.
+					continue
+				}
+				return fmt.Errorf("couldn't get %s requests of %s queue %s: %w", m.file, device, queue, err)
+			}
+			ch <- prometheus.MustNewConstMetric(m.desc, prometheus.CounterValue, float64(v), device, queue)
+		}
+	}
+
+	return nil
+}
+
+// readBlkMQCPUCounters sums a counter of the per-CPU software queues of a
+// hardware queue. Each file holds a read and a write counter.
+func readBlkMQCPUCounters(debugDir, name string) (uint64, error) {
+	files, err := filepath.Glob(filepath.Join(debugDir, "cpu*", name))
+	if err != nil {
+		return 0, err
+	}
+	if len(files) == 0 {
+		return 0, os.ErrNotExist
+	}
+
+	var sum uint64
+	for _, file := range files {
+		value, err := readStringFromFile(file)
+		if err != nil {
+			return 0, err
+		}
+		for _, field := range strings.Fields(value) {
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			sum += v
+		}
+	}
+	return sum, nil
+}
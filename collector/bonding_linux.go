@@ -28,9 +28,25 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// bondingPortStateFlags are the bits of the LACP port state from IEEE 802.1AX.
+var bondingPortStateFlags = []string{
+	"activity",
+	"short_timeout",
+	"aggregation",
+	"synchronization",
+	"collecting",
+	"distributing",
+	"defaulted",
+	"expired",
+}
+
 type bondingCollector struct {
-	slaves, active typedDesc
-	logger         log.Logger
+	slaves, active    typedDesc
+	aggregatorID      typedDesc
+	slaveLinkFailures typedDesc
+	slaveAggregatorID typedDesc
+	slavePortState    typedDesc
+	logger            log.Logger
 }
 
 func init() {
@@ -51,6 +67,26 @@ func NewBondingCollector(logger log.Logger) (Collector, error) {
 			"Number of active slaves per bonding interface.",
 			[]string{"master"}, nil,
 		), prometheus.GaugeValue},
+		aggregatorID: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "ad_aggregator_id"),
+			"ID of the active 802.3ad aggregator of the bonding interface.",
+			[]string{"master"}, nil,
+		), prometheus.GaugeValue},
+		slaveLinkFailures: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "slave_link_failures_total"),
+			"Number of link failures of the slave detected by the bonding driver.",
+			[]string{"master", "slave"}, nil,
+		), prometheus.CounterValue},
+		slaveAggregatorID: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "slave_ad_aggregator_id"),
+			"ID of the 802.3ad aggregator the slave belongs to.",
+			[]string{"master", "slave"}, nil,
+		), prometheus.GaugeValue},
+		slavePortState: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "slave_ad_port_state"),
+			"Whether the flag of the LACP port state of the slave is set, as seen by the actor (local) or partner (switch).",
+			[]string{"master", "slave", "side", "flag"}, nil,
+		), prometheus.GaugeValue},
 		logger: logger,
 	}, nil
 }
@@ -69,10 +105,53 @@ func (c *bondingCollector) Update(ch chan<- prometheus.Metric) error {
 	for master, status := range bondingStats {
 		ch <- c.slaves.mustNewConstMetric(float64(status[0]), master)
 		ch <- c.active.mustNewConstMetric(float64(status[1]), master)
+		c.updateAD(ch, statusfile, master)
 	}
 	return nil
 }
 
+// updateAD exports the link failures of the slaves and, in 802.3ad mode,
+// their aggregators and LACP port states.
+func (c *bondingCollector) updateAD(ch chan<- prometheus.Metric, root, master string) {
+	if id, err := readUintFromFile(filepath.Join(root, master, "bonding", "ad_aggregator")); err == nil {
+		ch <- c.aggregatorID.mustNewConstMetric(float64(id), master)
+	}
+
+	slaves, err := ioutil.ReadFile(filepath.Join(root, master, "bonding", "slaves"))
+	if err != nil {
+		return
+	}
+	for _, slave := range strings.Fields(string(slaves)) {
+		dir := bondingSlaveDir(root, master, slave)
+		if v, err := readUintFromFile(filepath.Join(dir, "link_failure_count")); err == nil {
+			ch <- c.slaveLinkFailures.mustNewConstMetric(float64(v), master, slave)
+		}
+		if v, err := readUintFromFile(filepath.Join(dir, "ad_aggregator_id")); err == nil {
+			ch <- c.slaveAggregatorID.mustNewConstMetric(float64(v), master, slave)
+		}
+		for _, side := range []string{"actor", "partner"} {
+			state, err := readUintFromFile(filepath.Join(dir, fmt.Sprintf("ad_%s_oper_port_state", side)))
+			if err != nil {
+				continue
+			}
+			for bit, flag := range bondingPortStateFlags {
+				ch <- c.slavePortState.mustNewConstMetric(float64(state>>uint(bit)&1), master, slave, side, flag)
+			}
+		}
+	}
+}
+
+// bondingSlaveDir returns the directory holding the bonding_slave attributes
+// of a slave.
+func bondingSlaveDir(root, master, slave string) string {
+	dir := filepath.Join(root, master, fmt.Sprintf("lower_%s", slave), "bonding_slave")
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		// some older? kernels use slave_ prefix
+		return filepath.Join(root, master, fmt.Sprintf("slave_%s", slave), "bonding_slave")
+	}
+	return dir
+}
+
 func readBondingStats(root string) (status map[string][2]int, err error) {
 	status = map[string][2]int{}
 	masters, err := ioutil.ReadFile(filepath.Join(root, "bonding_masters"))
@@ -86,11 +165,7 @@ func readBondingStats(root string) (status map[string][2]int, err error) {
 		}
 		sstat := [2]int{0, 0}
 		for _, slave := range strings.Fields(string(slaves)) {
-			state, err := ioutil.ReadFile(filepath.Join(root, master, fmt.Sprintf("lower_%s", slave), "bonding_slave", "mii_status"))
-			if errors.Is(err, os.ErrNotExist) {
-				// some older? kernels use slave_ prefix
-				state, err = ioutil.ReadFile(filepath.Join(root, master, fmt.Sprintf("slave_%s", slave), "bonding_slave", "mii_status"))
-			}
+			state, err := ioutil.ReadFile(filepath.Join(bondingSlaveDir(root, master, slave), "mii_status"))
 			if err != nil {
 				return nil, err
 			}
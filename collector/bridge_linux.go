@@ -0,0 +1,313 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nobridge
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	bridgeSubsystem = "bridge"
+
+	// Size of struct __fdb_entry from <linux/if_bridge.h>.
+	bridgeFDBEntryLen = 16
+
+	// RTM_GETSTATS from <linux/rtnetlink.h>, and the length of struct
+	// if_stats_msg and IFLA_STATS_LINK_XSTATS from <linux/if_link.h>.
+	rtmGetStats         = 94
+	ifStatsMsgLen       = 12
+	iflaStatsLinkXStats = 2
+
+	// LINK_XSTATS_TYPE_BRIDGE from <linux/if_link.h> and
+	// BRIDGE_XSTATS_VLAN from <linux/if_bridge.h>.
+	linkXStatsTypeBridge = 1
+	bridgeXStatsVLAN     = 1
+)
+
+// bridgePortStates are the STP states of bridge ports by their value in
+// /sys/class/net/<bridge>/brif/<port>/state.
+var bridgePortStates = []string{"disabled", "listening", "learning", "forwarding", "blocking"}
+
+// bridgeVLANStats is a struct bridge_vlan_xstats.
+type bridgeVLANStats struct {
+	vid       uint16
+	rxBytes   uint64
+	rxPackets uint64
+	txBytes   uint64
+	txPackets uint64
+}
+
+type bridgeCollector struct {
+	stpEnabled  *prometheus.Desc
+	portState   *prometheus.Desc
+	fdbEntries  *prometheus.Desc
+	vlanRxBytes *prometheus.Desc
+	vlanRxPkts  *prometheus.Desc
+	vlanTxBytes *prometheus.Desc
+	vlanTxPkts  *prometheus.Desc
+	logger      log.Logger
+}
+
+func init() {
+	registerCollector("bridge", defaultDisabled, NewBridgeCollector)
+}
+
+// NewBridgeCollector returns a new Collector exposing the STP state and
+// forwarding database of bridges and their per VLAN statistics.
+func NewBridgeCollector(logger log.Logger) (Collector, error) {
+	vlanLabels := []string{"bridge", "vlan"}
+	vlanDesc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, bridgeSubsystem, name),
+			help, vlanLabels, nil,
+		)
+	}
+	return &bridgeCollector{
+		stpEnabled: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, bridgeSubsystem, "stp_enabled"),
+			"Whether the spanning tree protocol is enabled on the bridge.",
+			[]string{"bridge"}, nil,
+		),
+		portState: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, bridgeSubsystem, "port_stp_state"),
+			"STP state of the bridge port.",
+			[]string{"bridge", "port", "state"}, nil,
+		),
+		fdbEntries: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, bridgeSubsystem, "fdb_learned_entries"),
+			"Number of addresses learned on the bridge port in the forwarding database.",
+			[]string{"bridge", "port"}, nil,
+		),
+		vlanRxBytes: vlanDesc("vlan_receive_bytes_total", "Number of bytes received on the VLAN of the bridge."),
+		vlanRxPkts:  vlanDesc("vlan_receive_packets_total", "Number of packets received on the VLAN of the bridge."),
+		vlanTxBytes: vlanDesc("vlan_transmit_bytes_total", "Number of bytes transmitted on the VLAN of the bridge."),
+		vlanTxPkts:  vlanDesc("vlan_transmit_packets_total", "Number of packets transmitted on the VLAN of the bridge."),
+		logger:      logger,
+	}, nil
+}
+
+func (c *bridgeCollector) Update(ch chan<- prometheus.Metric) error {
+	paths, err := filepath.Glob(sysFilePath("class/net/*/bridge"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		level.Debug(c.logger).Log("msg", "no bridges found, skipping")
+		return ErrNoData
+	}
+
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		bridge := filepath.Base(dir)
+
+		if v, err := readUintFromFile(filepath.Join(path, "stp_state")); err == nil {
+			enabled := 0.0
+			if v != 0 {
+				enabled = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.stpEnabled, prometheus.GaugeValue, enabled, bridge)
+		}
+
+		ports, err := c.updatePorts(ch, dir, bridge)
+		if err != nil {
+			return err
+		}
+
+		fdb, err := ioutil.ReadFile(filepath.Join(dir, "brforward"))
+		if err != nil {
+			return fmt.Errorf("couldn't read forwarding database of %s: %w", bridge, err)
+		}
+		entries, err := parseBridgeFDB(fdb)
+		if err != nil {
+			return fmt.Errorf("couldn't parse forwarding database of %s: %w", bridge, err)
+		}
+		for portNo, port := range ports {
+			ch <- prometheus.MustNewConstMetric(c.fdbEntries, prometheus.GaugeValue, float64(entries[portNo]), bridge, port)
+		}
+
+		c.updateVLANs(ch, bridge)
+	}
+
+	return nil
+}
+
+// updatePorts exports the STP state of the ports of a bridge and returns
+// their names by port number.
+func (c *bridgeCollector) updatePorts(ch chan<- prometheus.Metric, dir, bridge string) (map[uint16]string, error) {
+	brifs, err := ioutil.ReadDir(filepath.Join(dir, "brif"))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't list ports of %s: %w", bridge, err)
+	}
+	ports := make(map[uint16]string, len(brifs))
+	for _, brif := range brifs {
+		port := brif.Name()
+		portDir := filepath.Join(dir, "brif", port)
+
+		s, err := readStringFromFile(filepath.Join(portDir, "port_no"))
+		if err != nil {
+			return nil, err
+		}
+		portNo, err := strconv.ParseUint(s, 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port number of %s: %w", port, err)
+		}
+		ports[uint16(portNo)] = port
+
+		state, err := readUintFromFile(filepath.Join(portDir, "state"))
+		if err != nil {
+			return nil, err
+		}
+		for i, name := range bridgePortStates {
+			isState := 0.0
+			if uint64(i) == state {
+				isState = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.portState, prometheus.GaugeValue, isState, bridge, port, name)
+		}
+	}
+	return ports, nil
+}
+
+// updateVLANs exports the per VLAN statistics of a bridge, which the kernel
+// only counts if vlan_stats_enabled is set.
+func (c *bridgeCollector) updateVLANs(ch chan<- prometheus.Metric, bridge string) {
+	// Bridges are looked up by name in case sysfs is of another network
+	// namespace.
+	iface, err := net.InterfaceByName(bridge)
+	if err != nil {
+		return
+	}
+	vlans, err := getBridgeVLANStats(iface.Index)
+	if err != nil {
+		level.Debug(c.logger).Log("msg", "couldn't get VLAN statistics", "bridge", bridge, "err", err)
+		return
+	}
+	for _, v := range vlans {
+		vid := strconv.Itoa(int(v.vid))
+		ch <- prometheus.MustNewConstMetric(c.vlanRxBytes, prometheus.CounterValue, float64(v.rxBytes), bridge, vid)
+		ch <- prometheus.MustNewConstMetric(c.vlanRxPkts, prometheus.CounterValue, float64(v.rxPackets), bridge, vid)
+		ch <- prometheus.MustNewConstMetric(c.vlanTxBytes, prometheus.CounterValue, float64(v.txBytes), bridge, vid)
+		ch <- prometheus.MustNewConstMetric(c.vlanTxPkts, prometheus.CounterValue, float64(v.txPackets), bridge, vid)
+	}
+}
+
+// parseBridgeFDB counts the learned entries of /sys/class/net/<bridge>/brforward
+// by port number, skipping the addresses of the bridge and its ports.
+func parseBridgeFDB(b []byte) (map[uint16]int, error) {
+	if len(b)%bridgeFDBEntryLen != 0 {
+		return nil, fmt.Errorf("invalid length %d", len(b))
+	}
+	entries := make(map[uint16]int)
+	for i := 0; i < len(b); i += bridgeFDBEntryLen {
+		e := b[i : i+bridgeFDBEntryLen]
+		if e[7] != 0 {
+			continue
+		}
+		entries[uint16(e[12])<<8|uint16(e[6])]++
+	}
+	return entries, nil
+}
+
+func getBridgeVLANStats(ifindex int) ([]bridgeVLANStats, error) {
+	c, err := netlink.Dial(unix.NETLINK_ROUTE, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial netlink: %w", err)
+	}
+	defer c.Close()
+
+	req := netlink.Message{
+		Header: netlink.Header{
+			Flags: netlink.Request,
+			Type:  rtmGetStats,
+		},
+		Data: make([]byte, ifStatsMsgLen),
+	}
+	nlenc.PutUint32(req.Data[4:8], uint32(ifindex))
+	nlenc.PutUint32(req.Data[8:12], 1<<(iflaStatsLinkXStats-1))
+
+	msgs, err := c.Execute(req)
+	if err != nil {
+		return nil, err
+	}
+	var vlans []bridgeVLANStats
+	for _, msg := range msgs {
+		v, err := parseBridgeVLANStats(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		vlans = append(vlans, v...)
+	}
+	return vlans, nil
+}
+
+// parseBridgeVLANStats parses the VLAN statistics nested in the extended
+// statistics of a bridge in an if_stats_msg.
+func parseBridgeVLANStats(b []byte) ([]bridgeVLANStats, error) {
+	if len(b) < ifStatsMsgLen {
+		return nil, fmt.Errorf("short message, len=%d", len(b))
+	}
+	ad, err := netlink.NewAttributeDecoder(b[ifStatsMsgLen:])
+	if err != nil {
+		return nil, err
+	}
+	var vlans []bridgeVLANStats
+	for ad.Next() {
+		if ad.Type() != iflaStatsLinkXStats {
+			continue
+		}
+		ad.Nested(func(xad *netlink.AttributeDecoder) error {
+			for xad.Next() {
+				if xad.Type() != linkXStatsTypeBridge {
+					continue
+				}
+				xad.Nested(func(bad *netlink.AttributeDecoder) error {
+					for bad.Next() {
+						if bad.Type() != bridgeXStatsVLAN {
+							continue
+						}
+						bad.Do(func(b []byte) error {
+							if len(b) < 34 {
+								return fmt.Errorf("short VLAN statistics, len=%d", len(b))
+							}
+							vlans = append(vlans, bridgeVLANStats{
+								rxBytes:   nlenc.Uint64(b[0:8]),
+								rxPackets: nlenc.Uint64(b[8:16]),
+								txBytes:   nlenc.Uint64(b[16:24]),
+								txPackets: nlenc.Uint64(b[24:32]),
+								vid:       nlenc.Uint16(b[32:34]),
+							})
+							return nil
+						})
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+	}
+	return vlans, ad.Err()
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nobridge
+
+package collector
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+)
+
+func TestParseBridgeFDB(t *testing.T) {
+	b, err := ioutil.ReadFile("fixtures/sys/class/net/br0/brforward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := parseBridgeFDB(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint16]int{1: 2, 2: 1}
+	if !reflect.DeepEqual(want, entries) {
+		t.Errorf("want entries %v, got %v", want, entries)
+	}
+
+	if _, err := parseBridgeFDB(b[:len(b)-1]); err == nil {
+		t.Error("expected error for truncated entry")
+	}
+}
+
+func TestParseBridgeVLANStats(t *testing.T) {
+	vlan := func(vid uint16, rxBytes, rxPackets, txBytes, txPackets uint64) []byte {
+		b := make([]byte, 40)
+		nlenc.PutUint64(b[0:8], rxBytes)
+		nlenc.PutUint64(b[8:16], rxPackets)
+		nlenc.PutUint64(b[16:24], txBytes)
+		nlenc.PutUint64(b[24:32], txPackets)
+		nlenc.PutUint16(b[32:34], vid)
+		return b
+	}
+	ae := netlink.NewAttributeEncoder()
+	ae.Nested(iflaStatsLinkXStats, func(nae *netlink.AttributeEncoder) error {
+		nae.Nested(linkXStatsTypeBridge, func(bae *netlink.AttributeEncoder) error {
+			bae.Bytes(bridgeXStatsVLAN, vlan(1, 1000, 10, 2000, 20))
+			bae.Bytes(bridgeXStatsVLAN, vlan(100, 3000, 30, 4000, 40))
+			return nil
+		})
+		return nil
+	})
+	attrs, err := ae.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vlans, err := parseBridgeVLANStats(append(make([]byte, ifStatsMsgLen), attrs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bridgeVLANStats{
+		{vid: 1, rxBytes: 1000, rxPackets: 10, txBytes: 2000, txPackets: 20},
+		{vid: 100, rxBytes: 3000, rxPackets: 30, txBytes: 4000, txPackets: 40},
+	}
+	if !reflect.DeepEqual(want, vlans) {
+		t.Errorf("want VLAN statistics %+v, got %+v", want, vlans)
+	}
+}
@@ -16,7 +16,13 @@
 package collector
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/go-kit/kit/log"
 	"github.com/prometheus/client_golang/prometheus"
@@ -25,8 +31,9 @@ import (
 
 // A btrfsCollector is a Collector which gathers metrics from Btrfs filesystems.
 type btrfsCollector struct {
-	fs     btrfs.FS
-	logger log.Logger
+	fs           btrfs.FS
+	deviceErrors *prometheus.Desc
+	logger       log.Logger
 }
 
 func init() {
@@ -41,7 +48,13 @@ func NewBtrfsCollector(logger log.Logger) (Collector, error) {
 	}
 
 	return &btrfsCollector{
-		fs:     fs,
+		fs: fs,
+		deviceErrors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "btrfs", "device_errors_total"),
+			"Number of errors of a device that is part of the filesystem.",
+			[]string{"uuid", "device_id", "type"},
+			nil,
+		),
 		logger: logger,
 	}, nil
 }
@@ -56,11 +69,65 @@ func (c *btrfsCollector) Update(ch chan<- prometheus.Metric) error {
 
 	for _, s := range stats {
 		c.updateBtrfsStats(ch, s)
+		if err := c.updateBtrfsDeviceErrors(ch, s.UUID); err != nil {
+			return fmt.Errorf("failed to retrieve Btrfs device errors: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// updateBtrfsDeviceErrors collects the error counters of the devices of one
+// filesystem from devinfo/<devid>/error_stats, available since Linux 5.14.
+func (c *btrfsCollector) updateBtrfsDeviceErrors(ch chan<- prometheus.Metric, uuid string) error {
+	paths, err := filepath.Glob(sysFilePath(filepath.Join("fs/btrfs", uuid, "devinfo/*/error_stats")))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		errs, err := readBtrfsErrorStats(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// The device was removed in the meantime.
+				continue
+			}
+			return err
+		}
+		deviceID := filepath.Base(filepath.Dir(path))
+		for typ, v := range errs {
+			ch <- prometheus.MustNewConstMetric(c.deviceErrors, prometheus.CounterValue, v, uuid, deviceID, typ)
+		}
 	}
 
 	return nil
 }
 
+// readBtrfsErrorStats parses lines like "write_errs 0" into a map keyed by
+// the error type without the _errs suffix.
+func readBtrfsErrorStats(path string) (map[string]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	errs := map[string]float64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value in %s: %w", path, err)
+		}
+		errs[strings.TrimSuffix(fields[0], "_errs")] = v
+	}
+	return errs, scanner.Err()
+}
+
 // btrfsMetric represents a single Btrfs metric that is converted into a Prometheus Metric.
 type btrfsMetric struct {
 	name            string
@@ -16,6 +16,7 @@
 package collector
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 
@@ -116,3 +117,15 @@ func TestBtrfs(t *testing.T) {
 		}
 	}
 }
+
+func TestReadBtrfsErrorStats(t *testing.T) {
+	errs, err := readBtrfsErrorStats("fixtures/sys/fs/btrfs/0abb23a9-579b-43e6-ad30-227ef47fcb9d/devinfo/2/error_stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]float64{"write": 3, "read": 12, "flush": 0, "corruption": 1, "generation": 0}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("want %v, got %v", want, errs)
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nocephclient
+
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const cephClientSubsystem = "ceph_client"
+
+type cephClientCollector struct {
+	osdInflight    *prometheus.Desc
+	mdsInflight    *prometheus.Desc
+	caps           *prometheus.Desc
+	requests       *prometheus.Desc
+	requestLatency *prometheus.Desc
+	cacheHits      *prometheus.Desc
+	cacheMisses    *prometheus.Desc
+	logger         log.Logger
+}
+
+// cephClientTable is a table from the debugfs metrics file of a ceph client,
+// indexed by row and column name.
+type cephClientTable map[string]map[string]string
+
+func init() {
+	registerCollector("ceph_client", defaultDisabled, NewCephClientCollector)
+}
+
+// NewCephClientCollector returns a new Collector exposing statistics of
+// kernel ceph clients (krbd and CephFS) from debugfs.
+func NewCephClientCollector(logger log.Logger) (Collector, error) {
+	labels := []string{"fsid", "client"}
+	return &cephClientCollector{
+		osdInflight: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, cephClientSubsystem, "osd_inflight_requests"),
+			"Number of requests sent to OSDs that are not yet completed.",
+			labels, nil,
+		),
+		mdsInflight: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, cephClientSubsystem, "mds_inflight_requests"),
+			"Number of requests sent to MDSs that are not yet completed.",
+			labels, nil,
+		),
+		caps: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, cephClientSubsystem, "caps"),
+			"Number of capabilities held by the client.",
+			append(labels, "state"), nil,
+		),
+		requests: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, cephClientSubsystem, "requests_total"),
+			"Number of completed requests.",
+			append(labels, "type"), nil,
+		),
+		requestLatency: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, cephClientSubsystem, "request_latency_average_seconds"),
+			"Average latency of completed requests.",
+			append(labels, "type"), nil,
+		),
+		cacheHits: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, cephClientSubsystem, "cache_hits_total"),
+			"Number of hits of the dentry lease and capability caches.",
+			append(labels, "item"), nil,
+		),
+		cacheMisses: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, cephClientSubsystem, "cache_misses_total"),
+			"Number of misses of the dentry lease and capability caches.",
+			append(labels, "item"), nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *cephClientCollector) Update(ch chan<- prometheus.Metric) error {
+	clients, err := filepath.Glob(sysFilePath("kernel/debug/ceph/*.client*"))
+	if err != nil {
+		return err
+	}
+	if len(clients) == 0 {
+		level.Debug(c.logger).Log("msg", "no ceph clients found in debugfs, skipping")
+		return ErrNoData
+	}
+
+	for _, client := range clients {
+		i := strings.LastIndex(filepath.Base(client), ".")
+		fsid, name := filepath.Base(client)[:i], filepath.Base(client)[i+1:]
+
+		if n, err := readCephClientOSDRequests(filepath.Join(client, "osdc")); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.osdInflight, prometheus.GaugeValue, n, fsid, name)
+		} else {
+			level.Debug(c.logger).Log("msg", "couldn't read osdc", "client", client, "err", err)
+		}
+
+		// mdsc, caps and metrics only exist for CephFS mounts.
+		if n, err := readCephClientMDSRequests(filepath.Join(client, "mdsc")); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.mdsInflight, prometheus.GaugeValue, n, fsid, name)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("couldn't read mdsc of %s: %w", client, err)
+		}
+
+		caps, err := readCephClientCaps(filepath.Join(client, "caps"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("couldn't read caps of %s: %w", client, err)
+		}
+		for state, v := range caps {
+			ch <- prometheus.MustNewConstMetric(c.caps, prometheus.GaugeValue, v, fsid, name, state)
+		}
+
+		table, err := readCephClientMetrics(filepath.Join(client, "metrics"))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("couldn't read metrics of %s: %w", client, err)
+		}
+		for _, op := range []string{"read", "write", "metadata"} {
+			row, ok := table[op]
+			if !ok {
+				continue
+			}
+			if v, err := strconv.ParseFloat(row["total"], 64); err == nil {
+				ch <- prometheus.MustNewConstMetric(c.requests, prometheus.CounterValue, v, fsid, name, op)
+			}
+			if v, err := strconv.ParseFloat(row["avg_lat(us)"], 64); err == nil {
+				ch <- prometheus.MustNewConstMetric(c.requestLatency, prometheus.GaugeValue, v/1e6, fsid, name, op)
+			}
+		}
+		for _, item := range []string{"d_lease", "caps"} {
+			row, ok := table[item]
+			if !ok {
+				continue
+			}
+			if v, err := strconv.ParseFloat(row["hit"], 64); err == nil {
+				ch <- prometheus.MustNewConstMetric(c.cacheHits, prometheus.CounterValue, v, fsid, name, item)
+			}
+			if v, err := strconv.ParseFloat(row["miss"], 64); err == nil {
+				ch <- prometheus.MustNewConstMetric(c.cacheMisses, prometheus.CounterValue, v, fsid, name, item)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readCephClientOSDRequests returns the number of in-flight requests from
+// the "REQUESTS <n> homeless <n>" header of osdc. Older kernels print one
+// line per request without a header.
+func readCephClientOSDRequests(path string) (float64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if fields := strings.Fields(lines[0]); len(fields) >= 2 && fields[0] == "REQUESTS" {
+		return strconv.ParseFloat(fields[1], 64)
+	}
+	if lines[0] == "" {
+		return 0, nil
+	}
+	return float64(len(lines)), nil
+}
+
+// readCephClientMDSRequests returns the number of in-flight requests in
+// mdsc, one per line.
+func readCephClientMDSRequests(path string) (float64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if s := strings.TrimSpace(string(data)); s != "" {
+		return float64(len(strings.Split(s, "\n"))), nil
+	}
+	return 0, nil
+}
+
+// readCephClientCaps parses the capability counts at the head of caps.
+func readCephClientCaps(path string) (map[string]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	caps := map[string]float64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			// The per inode listing follows the counts.
+			break
+		}
+		switch fields[0] {
+		case "total", "avail", "used", "reserved", "min":
+			v, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				return nil, err
+			}
+			caps[fields[0]] = v
+		}
+	}
+	return caps, scanner.Err()
+}
+
+// readCephClientMetrics parses the tables in metrics. Up to Linux 5.13 this
+// is a single file, later kernels split the tables into files of a metrics
+// directory.
+func readCephClientMetrics(path string) (cephClientTable, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if fi.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*")); err != nil {
+			return nil, err
+		}
+	}
+
+	table := cephClientTable{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		parseCephClientTables(string(data), table)
+	}
+	return table, nil
+}
+
+// parseCephClientTables adds the rows of tables like
+//
+//	item          total       avg_lat(us)     min_lat(us) ...
+//	-----------------------------------------------------------
+//	read          798         32000           4000        ...
+//
+// to table.
+func parseCephClientTables(data string, table cephClientTable) {
+	var header []string
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			header = nil
+		case fields[0] == "item":
+			header = fields
+		case strings.HasPrefix(fields[0], "---"):
+		case header != nil:
+			row := table[fields[0]]
+			if row == nil {
+				row = map[string]string{}
+				table[fields[0]] = row
+			}
+			for i := 1; i < len(fields) && i < len(header); i++ {
+				row[header[i]] = fields[i]
+			}
+		}
+	}
+}
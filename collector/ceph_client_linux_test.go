@@ -0,0 +1,40 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nocephclient
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCephClientTables(t *testing.T) {
+	// Layout of metrics/latency since Linux 5.14.
+	const latency = `item          total       avg_lat(us)     min_lat(us)     max_lat(us)     stdev(us)
+-----------------------------------------------------------------------------------
+read          798         32000           4000            196000          560
+write         0           0               0               0               0
+`
+	table := cephClientTable{}
+	parseCephClientTables(latency, table)
+
+	want := cephClientTable{
+		"read":  {"total": "798", "avg_lat(us)": "32000", "min_lat(us)": "4000", "max_lat(us)": "196000", "stdev(us)": "560"},
+		"write": {"total": "0", "avg_lat(us)": "0", "min_lat(us)": "0", "max_lat(us)": "0", "stdev(us)": "0"},
+	}
+	if !reflect.DeepEqual(table, want) {
+		t.Errorf("want %v, got %v", want, table)
+	}
+}
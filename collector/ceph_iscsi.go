@@ -0,0 +1,168 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nocephiscsi
+
+package collector
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	cephISCSIURL                = kingpin.Flag("collector.ceph_iscsi.url", "rbd-target-api endpoint, credentials may be given as user info.").Default("http://localhost:5000").String()
+	cephISCSIInsecureSkipVerify = kingpin.Flag("collector.ceph_iscsi.insecure-skip-verify", "Skip TLS certificate verification for the rbd-target-api endpoint.").Default("false").Bool()
+)
+
+const cephISCSISubsystem = "ceph_iscsi"
+
+type cephISCSICollector struct {
+	client           *http.Client
+	baseURL          string
+	upDesc           *prometheus.Desc
+	epochDesc        *prometheus.Desc
+	gatewayLUNsDesc  *prometheus.Desc
+	clientLoggedDesc *prometheus.Desc
+	logger           log.Logger
+}
+
+// cephISCSIConfig is the subset of the rbd-target-api /api/config response
+// used by the collector.
+type cephISCSIConfig struct {
+	Epoch    float64                    `json:"epoch"`
+	Gateways map[string]json.RawMessage `json:"gateways"`
+	Targets  map[string]struct {
+		Clients map[string]json.RawMessage `json:"clients"`
+	} `json:"targets"`
+}
+
+type cephISCSIGateway struct {
+	ActiveLUNs float64 `json:"active_luns"`
+}
+
+type cephISCSIClientInfo struct {
+	State string `json:"state"`
+}
+
+func init() {
+	registerCollector("ceph_iscsi", defaultDisabled, NewCephISCSICollector)
+}
+
+// NewCephISCSICollector returns a new Collector exposing the state of a
+// ceph-iscsi gateway as reported by its rbd-target-api.
+func NewCephISCSICollector(logger log.Logger) (Collector, error) {
+	if _, err := url.Parse(*cephISCSIURL); err != nil {
+		return nil, fmt.Errorf("invalid rbd-target-api URL: %w", err)
+	}
+
+	return &cephISCSICollector{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: *cephISCSIInsecureSkipVerify},
+			},
+		},
+		baseURL: strings.TrimSuffix(*cephISCSIURL, "/"),
+		upDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, cephISCSISubsystem, "up"),
+			"Whether the local rbd-target-api answered its health check.",
+			nil, nil,
+		),
+		epochDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, cephISCSISubsystem, "config_epoch"),
+			"Epoch of the gateway configuration object.",
+			nil, nil,
+		),
+		gatewayLUNsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, cephISCSISubsystem, "gateway_active_luns"),
+			"Number of LUNs owned by the gateway.",
+			[]string{"gateway"}, nil,
+		),
+		clientLoggedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, cephISCSISubsystem, "client_logged_in"),
+			"Whether the client is logged in to the target.",
+			[]string{"target", "client"}, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *cephISCSICollector) Update(ch chan<- prometheus.Metric) error {
+	if err := c.get("/api/_ping", nil); err != nil {
+		level.Debug(c.logger).Log("msg", "rbd-target-api health check failed", "err", err)
+		ch <- prometheus.MustNewConstMetric(c.upDesc, prometheus.GaugeValue, 0)
+		return nil
+	}
+	ch <- prometheus.MustNewConstMetric(c.upDesc, prometheus.GaugeValue, 1)
+
+	var config cephISCSIConfig
+	if err := c.get("/api/config", &config); err != nil {
+		return fmt.Errorf("couldn't get gateway config: %w", err)
+	}
+	ch <- prometheus.MustNewConstMetric(c.epochDesc, prometheus.GaugeValue, config.Epoch)
+
+	for name, raw := range config.Gateways {
+		var gw cephISCSIGateway
+		// Older config formats keep non-gateway keys (ip_list, iqn, ...) in
+		// the same object, skip everything that isn't a gateway.
+		if err := json.Unmarshal(raw, &gw); err != nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.gatewayLUNsDesc, prometheus.GaugeValue, gw.ActiveLUNs, name)
+	}
+
+	for target, t := range config.Targets {
+		for client := range t.Clients {
+			var info cephISCSIClientInfo
+			if err := c.get(fmt.Sprintf("/api/clientinfo/%s/%s", target, client), &info); err != nil {
+				return fmt.Errorf("couldn't get client info for %s: %w", client, err)
+			}
+			loggedIn := 0.0
+			if info.State == "LOGGED_IN" {
+				loggedIn = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.clientLoggedDesc, prometheus.GaugeValue, loggedIn, target, client)
+		}
+	}
+
+	return nil
+}
+
+// get fetches path from the rbd-target-api and decodes the JSON response
+// into v, if v is not nil.
+func (c *cephISCSICollector) get(path string, v interface{}) error {
+	resp, err := c.client.Get(c.baseURL + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %q", resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
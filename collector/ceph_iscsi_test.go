@@ -0,0 +1,98 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nocephiscsi
+
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const cephISCSITestConfig = `{
+  "epoch": 12,
+  "gateways": {
+    "ceph-gw-1": {"active_luns": 2, "created": "2020/06/01 10:00:00"},
+    "ceph-gw-2": {"active_luns": 1, "created": "2020/06/01 10:00:00"}
+  },
+  "targets": {
+    "iqn.2003-01.com.redhat.iscsi-gw:ceph-igw": {
+      "clients": {
+        "iqn.1994-05.com.redhat:client1": {},
+        "iqn.1994-05.com.redhat:client2": {}
+      }
+    }
+  }
+}`
+
+func TestCephISCSICollector(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/_ping", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, cephISCSITestConfig)
+	})
+	mux.HandleFunc("/api/clientinfo/iqn.2003-01.com.redhat.iscsi-gw:ceph-igw/iqn.1994-05.com.redhat:client1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"alias": "", "ip_address": ["192.168.1.20"], "state": "LOGGED_IN"}`)
+	})
+	mux.HandleFunc("/api/clientinfo/iqn.2003-01.com.redhat.iscsi-gw:ceph-igw/iqn.1994-05.com.redhat:client2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"alias": "", "ip_address": [], "state": ""}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	*cephISCSIURL = server.URL
+	c, err := NewCephISCSICollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan prometheus.Metric, 100)
+	if err := c.Update(ch); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+
+	got := map[string]float64{}
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		key := m.Desc().String()
+		for _, l := range pb.GetLabel() {
+			key += "," + l.GetValue()
+		}
+		got[key] = pb.GetGauge().GetValue()
+	}
+
+	cc := c.(*cephISCSICollector)
+	for key, want := range map[string]float64{
+		cc.upDesc.String():                         1,
+		cc.epochDesc.String():                      12,
+		cc.gatewayLUNsDesc.String() + ",ceph-gw-1": 2,
+		cc.gatewayLUNsDesc.String() + ",ceph-gw-2": 1,
+		cc.clientLoggedDesc.String() + ",iqn.1994-05.com.redhat:client1,iqn.2003-01.com.redhat.iscsi-gw:ceph-igw": 1,
+		cc.clientLoggedDesc.String() + ",iqn.1994-05.com.redhat:client2,iqn.2003-01.com.redhat.iscsi-gw:ceph-igw": 0,
+	} {
+		if v, ok := got[key]; !ok || v != want {
+			t.Errorf("want %s = %v, got %v", key, want, v)
+		}
+	}
+}
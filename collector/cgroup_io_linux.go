@@ -0,0 +1,172 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nocgroup_io
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const cgroupIOSubsystem = "cgroup_io"
+
+// Services and containers are leaf cgroups named like sshd.service,
+// docker-<id>.scope or cri-containerd-<id>.scope.
+var cgroupIOInclude = kingpin.Flag("collector.cgroup_io.cgroup-include", "Regexp of cgroup paths to collect block I/O statistics for.").Default(`\.(service|scope)$`).String()
+
+type cgroupIOCollector struct {
+	include *regexp.Regexp
+	descs   map[string]*prometheus.Desc
+	logger  log.Logger
+}
+
+func init() {
+	registerCollector("cgroup_io", defaultDisabled, NewCgroupIOCollector)
+}
+
+// NewCgroupIOCollector returns a new Collector exposing the block I/O of
+// cgroups from the io.stat files of the cgroup v2 hierarchy.
+func NewCgroupIOCollector(logger log.Logger) (Collector, error) {
+	pattern, err := regexp.Compile(*cgroupIOInclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cgroup pattern: %w", err)
+	}
+
+	labels := []string{"cgroup", "device"}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, cgroupIOSubsystem, name),
+			help, labels, nil,
+		)
+	}
+	return &cgroupIOCollector{
+		include: pattern,
+		// Keys of io.stat, other keys like those of io.cost are skipped.
+		descs: map[string]*prometheus.Desc{
+			"rbytes": desc("read_bytes_total", "Number of bytes read from the device by the cgroup."),
+			"wbytes": desc("written_bytes_total", "Number of bytes written to the device by the cgroup."),
+			"rios":   desc("reads_completed_total", "Number of reads from the device completed for the cgroup."),
+			"wios":   desc("writes_completed_total", "Number of writes to the device completed for the cgroup."),
+			"dbytes": desc("discarded_bytes_total", "Number of bytes discarded on the device by the cgroup."),
+			"dios":   desc("discards_completed_total", "Number of discards on the device completed for the cgroup."),
+		},
+		logger: logger,
+	}, nil
+}
+
+func (c *cgroupIOCollector) Update(ch chan<- prometheus.Metric) error {
+	root := sysFilePath("fs/cgroup")
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err != nil {
+		level.Debug(c.logger).Log("msg", "cgroup v2 hierarchy not found, skipping", "err", err)
+		return ErrNoData
+	}
+
+	devices := make(map[string]string)
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Cgroups can be removed while walking the hierarchy.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() || path == root {
+			return nil
+		}
+		cgroup := strings.TrimPrefix(path, root)
+		if !c.include.MatchString(cgroup) {
+			return nil
+		}
+
+		stats, err := readCgroupIOStat(filepath.Join(path, "io.stat"))
+		if err != nil {
+			// The io controller may not be enabled for the cgroup.
+			level.Debug(c.logger).Log("msg", "couldn't read io.stat", "cgroup", cgroup, "err", err)
+			return nil
+		}
+		for dev, stat := range stats {
+			device, ok := devices[dev]
+			if !ok {
+				device = cgroupIODeviceName(dev)
+				devices[dev] = device
+			}
+			for key, v := range stat {
+				if desc, ok := c.descs[key]; ok {
+					ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v, cgroup, device)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// cgroupIODeviceName returns the name of the block device with the given
+// major:minor number.
+func cgroupIODeviceName(dev string) string {
+	target, err := os.Readlink(sysFilePath(filepath.Join("dev/block", dev)))
+	if err != nil {
+		return dev
+	}
+	return filepath.Base(target)
+}
+
+func readCgroupIOStat(path string) (map[string]map[string]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseCgroupIOStat(f)
+}
+
+// parseCgroupIOStat parses io.stat with lines like
+// "8:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0"
+// and returns the values by major:minor number and key.
+func parseCgroupIOStat(r io.Reader) (map[string]map[string]float64, error) {
+	stats := make(map[string]map[string]float64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		stat := make(map[string]float64)
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			v, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value in line %q: %w", scanner.Text(), err)
+			}
+			stat[kv[0]] = v
+		}
+		stats[fields[0]] = stat
+	}
+	return stats, scanner.Err()
+}
@@ -0,0 +1,44 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nocgroup_io
+
+package collector
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCgroupIOStat(t *testing.T) {
+	stats, err := parseCgroupIOStat(strings.NewReader(`8:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0
+259:0 rbytes=90112 wbytes=0 rios=22 wios=0 dbytes=0 dios=0 cost.vrate=100.00 cost.usage=55
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		dev, key string
+		want     float64
+	}{
+		{"8:0", "wbytes", 314773504},
+		{"8:0", "rios", 192},
+		{"259:0", "rbytes", 90112},
+		{"259:0", "cost.vrate", 100},
+	} {
+		if got := stats[tc.dev][tc.key]; got != tc.want {
+			t.Errorf("want %s %s %v, got %v", tc.dev, tc.key, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nocifs
+
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const cifsSubsystem = "cifs"
+
+var (
+	cifsShareHeaderPattern    = regexp.MustCompile(`^\d+\) (\\\\\S+)`)
+	cifsReconnectsPattern     = regexp.MustCompile(`^(\d+) session (\d+) share reconnects$`)
+	cifsVFSOperationsPattern  = regexp.MustCompile(`^Total vfs operations: (\d+) maximum at one time: (\d+)$`)
+	cifsBytesPattern          = regexp.MustCompile(`^Bytes read: (\d+)\s+Bytes written: (\d+)$`)
+	cifsOpenFilesPattern      = regexp.MustCompile(`^Open files: (\d+) total \(local\), (\d+) open on server$`)
+	cifsOperationPattern      = regexp.MustCompile(`^(\w+): (\d+) (?:total|sent) (\d+) failed$`)
+	cifsConnectionPattern     = regexp.MustCompile(`^\d+\) ConnectionId: \S+ Hostname: (\S+)`)
+	cifsSessionNamePattern    = regexp.MustCompile(`^\s*\d+\) Name: (\S+)`)
+	cifsCreditsPattern        = regexp.MustCompile(`Number of credits: (\d+)`)
+	cifsUnderscoreBeforeUpper = regexp.MustCompile(`([a-z])([A-Z])`)
+)
+
+// cifsStats holds the client statistics from /proc/fs/cifs/Stats.
+type cifsStats struct {
+	Sessions          uint64
+	Shares            uint64
+	InFlight          uint64
+	SessionReconnects uint64
+	ShareReconnects   uint64
+	VFSOperations     uint64
+	MaxVFSOperations  uint64
+	Tcons             map[string]*cifsShareStats
+}
+
+// cifsShareStats holds the statistics of a mounted share, SMB 1 shares only
+// report the number of SMBs.
+type cifsShareStats struct {
+	SMBs            uint64
+	BytesRead       uint64
+	BytesWritten    uint64
+	OpenFiles       uint64
+	OpenOnServer    uint64
+	Operations      map[string]uint64
+	OperationErrors map[string]uint64
+}
+
+type cifsCollector struct {
+	sessions          *prometheus.Desc
+	shares            *prometheus.Desc
+	inFlight          *prometheus.Desc
+	sessionReconnects *prometheus.Desc
+	shareReconnects   *prometheus.Desc
+	vfsOperations     *prometheus.Desc
+	maxVFSOperations  *prometheus.Desc
+	smbs              *prometheus.Desc
+	readBytes         *prometheus.Desc
+	writtenBytes      *prometheus.Desc
+	openFiles         *prometheus.Desc
+	openOnServer      *prometheus.Desc
+	operations        *prometheus.Desc
+	operationErrors   *prometheus.Desc
+	credits           *prometheus.Desc
+	logger            log.Logger
+}
+
+func init() {
+	registerCollector("cifs", defaultDisabled, NewCIFSCollector)
+}
+
+// NewCIFSCollector returns a new Collector exposing SMB/CIFS client
+// statistics from /proc/fs/cifs.
+func NewCIFSCollector(logger log.Logger) (Collector, error) {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, cifsSubsystem, name),
+			help, labels, nil,
+		)
+	}
+	return &cifsCollector{
+		sessions:          desc("sessions", "Number of SMB sessions."),
+		shares:            desc("shares", "Number of unique mounted shares."),
+		inFlight:          desc("operations_in_flight", "Number of requests waiting for a response."),
+		sessionReconnects: desc("session_reconnects_total", "Number of session reconnects."),
+		shareReconnects:   desc("share_reconnects_total", "Number of share reconnects."),
+		vfsOperations:     desc("vfs_operations", "Number of VFS operations in progress."),
+		maxVFSOperations:  desc("vfs_operations_max", "Maximum number of VFS operations in progress at one time."),
+		smbs:              desc("smbs_total", "Number of SMBs sent for the share.", "share"),
+		readBytes:         desc("read_bytes_total", "Number of bytes read from the share.", "share"),
+		writtenBytes:      desc("written_bytes_total", "Number of bytes written to the share.", "share"),
+		openFiles:         desc("open_files", "Number of files of the share opened locally.", "share"),
+		openOnServer:      desc("server_open_files", "Number of files of the share open on the server.", "share"),
+		operations:        desc("operations_total", "Number of SMB 2+ operations by type.", "share", "operation"),
+		operationErrors:   desc("operation_errors_total", "Number of failed SMB 2+ operations by type.", "share", "operation"),
+		credits:           desc("credits", "Number of SMB 2+ credits granted by the server, summed over connections.", "server"),
+		logger:            logger,
+	}, nil
+}
+
+func (c *cifsCollector) Update(ch chan<- prometheus.Metric) error {
+	f, err := os.Open(procFilePath("fs/cifs/Stats"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "cifs module not loaded, skipping")
+			return ErrNoData
+		}
+		return err
+	}
+	defer f.Close()
+
+	stats, err := parseCIFSStats(f)
+	if err != nil {
+		return fmt.Errorf("couldn't parse cifs stats: %w", err)
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.sessions, prometheus.GaugeValue, float64(stats.Sessions))
+	ch <- prometheus.MustNewConstMetric(c.shares, prometheus.GaugeValue, float64(stats.Shares))
+	ch <- prometheus.MustNewConstMetric(c.inFlight, prometheus.GaugeValue, float64(stats.InFlight))
+	ch <- prometheus.MustNewConstMetric(c.sessionReconnects, prometheus.CounterValue, float64(stats.SessionReconnects))
+	ch <- prometheus.MustNewConstMetric(c.shareReconnects, prometheus.CounterValue, float64(stats.ShareReconnects))
+	ch <- prometheus.MustNewConstMetric(c.vfsOperations, prometheus.GaugeValue, float64(stats.VFSOperations))
+	ch <- prometheus.MustNewConstMetric(c.maxVFSOperations, prometheus.GaugeValue, float64(stats.MaxVFSOperations))
+
+	for share, s := range stats.Tcons {
+		ch <- prometheus.MustNewConstMetric(c.smbs, prometheus.CounterValue, float64(s.SMBs), share)
+		if len(s.Operations) == 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.readBytes, prometheus.CounterValue, float64(s.BytesRead), share)
+		ch <- prometheus.MustNewConstMetric(c.writtenBytes, prometheus.CounterValue, float64(s.BytesWritten), share)
+		ch <- prometheus.MustNewConstMetric(c.openFiles, prometheus.GaugeValue, float64(s.OpenFiles), share)
+		ch <- prometheus.MustNewConstMetric(c.openOnServer, prometheus.GaugeValue, float64(s.OpenOnServer), share)
+		for op, v := range s.Operations {
+			ch <- prometheus.MustNewConstMetric(c.operations, prometheus.CounterValue, float64(v), share, op)
+			ch <- prometheus.MustNewConstMetric(c.operationErrors, prometheus.CounterValue, float64(s.OperationErrors[op]), share, op)
+		}
+	}
+
+	debugData, err := os.Open(procFilePath("fs/cifs/DebugData"))
+	if err != nil {
+		level.Debug(c.logger).Log("msg", "couldn't open cifs debug data", "err", err)
+		return nil
+	}
+	defer debugData.Close()
+
+	credits, err := parseCIFSCredits(debugData)
+	if err != nil {
+		return fmt.Errorf("couldn't parse cifs debug data: %w", err)
+	}
+	for server, v := range credits {
+		ch <- prometheus.MustNewConstMetric(c.credits, prometheus.GaugeValue, float64(v), server)
+	}
+
+	return nil
+}
+
+// parseCIFSStats parses /proc/fs/cifs/Stats. Shares mounted more than once,
+// e.g. by different users, are summed up.
+func parseCIFSStats(r io.Reader) (*cifsStats, error) {
+	stats := &cifsStats{Tcons: make(map[string]*cifsShareStats)}
+	var share *cifsShareStats
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if m := cifsShareHeaderPattern.FindStringSubmatch(line); m != nil {
+			share = stats.Tcons[m[1]]
+			if share == nil {
+				share = &cifsShareStats{
+					Operations:      make(map[string]uint64),
+					OperationErrors: make(map[string]uint64),
+				}
+				stats.Tcons[m[1]] = share
+			}
+			continue
+		}
+
+		if share == nil {
+			var err error
+			switch {
+			case strings.HasPrefix(line, "CIFS Session:"):
+				stats.Sessions, err = cifsParseField(line)
+			case strings.HasPrefix(line, "Share (unique mount targets):"):
+				stats.Shares, err = cifsParseField(line)
+			case strings.HasPrefix(line, "Operations (MIDs):"):
+				stats.InFlight, err = cifsParseField(line)
+			default:
+				if m := cifsReconnectsPattern.FindStringSubmatch(line); m != nil {
+					stats.SessionReconnects, _ = strconv.ParseUint(m[1], 10, 64)
+					stats.ShareReconnects, _ = strconv.ParseUint(m[2], 10, 64)
+				} else if m := cifsVFSOperationsPattern.FindStringSubmatch(line); m != nil {
+					stats.VFSOperations, _ = strconv.ParseUint(m[1], 10, 64)
+					stats.MaxVFSOperations, _ = strconv.ParseUint(m[2], 10, 64)
+				}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid line %q: %w", line, err)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "SMBs:") {
+			v, err := cifsParseField(line)
+			if err != nil {
+				return nil, fmt.Errorf("invalid line %q: %w", line, err)
+			}
+			share.SMBs += v
+		} else if m := cifsBytesPattern.FindStringSubmatch(line); m != nil {
+			read, _ := strconv.ParseUint(m[1], 10, 64)
+			written, _ := strconv.ParseUint(m[2], 10, 64)
+			share.BytesRead += read
+			share.BytesWritten += written
+		} else if m := cifsOpenFilesPattern.FindStringSubmatch(line); m != nil {
+			local, _ := strconv.ParseUint(m[1], 10, 64)
+			server, _ := strconv.ParseUint(m[2], 10, 64)
+			share.OpenFiles += local
+			share.OpenOnServer += server
+		} else if m := cifsOperationPattern.FindStringSubmatch(line); m != nil {
+			op := cifsOperationName(m[1])
+			total, _ := strconv.ParseUint(m[2], 10, 64)
+			failed, _ := strconv.ParseUint(m[3], 10, 64)
+			share.Operations[op] += total
+			share.OperationErrors[op] += failed
+		}
+	}
+
+	return stats, scanner.Err()
+}
+
+// parseCIFSCredits returns the credits per server from
+// /proc/fs/cifs/DebugData. Newer kernels name the server in a "ConnectionId"
+// line, older ones only in the lines of the sessions following the credits.
+func parseCIFSCredits(r io.Reader) (map[string]uint64, error) {
+	type connection struct {
+		name    string
+		credits uint64
+		seen    bool
+	}
+	var (
+		connections []*connection
+		cur         *connection
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := cifsConnectionPattern.FindStringSubmatch(line); m != nil {
+			cur = &connection{name: m[1]}
+			connections = append(connections, cur)
+		} else if m := cifsCreditsPattern.FindStringSubmatch(line); m != nil {
+			if cur == nil || cur.seen {
+				cur = &connection{}
+				connections = append(connections, cur)
+			}
+			v, err := strconv.ParseUint(m[1], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			cur.credits = v
+			cur.seen = true
+		} else if m := cifsSessionNamePattern.FindStringSubmatch(line); m != nil && cur != nil && cur.name == "" {
+			cur.name = m[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	credits := make(map[string]uint64)
+	for _, c := range connections {
+		if c.seen {
+			credits[c.name] += c.credits
+		}
+	}
+	return credits, nil
+}
+
+func cifsParseField(line string) (uint64, error) {
+	fields := strings.Fields(line[strings.Index(line, ":")+1:])
+	if len(fields) == 0 {
+		return 0, errors.New("missing value")
+	}
+	return strconv.ParseUint(fields[0], 10, 64)
+}
+
+// cifsOperationName converts an operation name such as "QueryDirectories"
+// to "query_directories".
+func cifsOperationName(name string) string {
+	return strings.ToLower(cifsUnderscoreBeforeUpper.ReplaceAllString(name, "${1}_${2}"))
+}
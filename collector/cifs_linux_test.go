@@ -0,0 +1,94 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nocifs
+
+package collector
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCIFSStats(t *testing.T) {
+	f, err := os.Open("fixtures/proc/fs/cifs/Stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	stats, err := parseCIFSStats(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Sessions != 1 || stats.Shares != 2 || stats.InFlight != 1 {
+		t.Errorf("want 1 session, 2 shares and 1 operation in flight, got %+v", stats)
+	}
+	if stats.SessionReconnects != 3 || stats.ShareReconnects != 2 {
+		t.Errorf("want 3 session and 2 share reconnects, got %+v", stats)
+	}
+
+	share, ok := stats.Tcons[`\\fileserver\backstores`]
+	if !ok {
+		t.Fatalf("share missing from %v", stats.Tcons)
+	}
+	if share.SMBs != 2471 || share.BytesRead != 8781824 || share.BytesWritten != 4194304 || share.OpenFiles != 2 {
+		t.Errorf("unexpected share stats %+v", share)
+	}
+	if share.Operations["query_directories"] != 4 || share.OperationErrors["query_infos"] != 3 || share.OperationErrors["ioctls"] != 1 {
+		t.Errorf("unexpected operations %v, errors %v", share.Operations, share.OperationErrors)
+	}
+}
+
+func TestParseCIFSCredits(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data string
+		want map[string]uint64
+	}{
+		{
+			name: "connection id",
+			data: `Servers:
+1) ConnectionId: 0x1 Hostname: fileserver
+Number of credits: 8062,1,1 Dialect 0x311
+	1) Address: 192.168.1.20 Uses: 1
+2) ConnectionId: 0x2 Hostname: nas
+Number of credits: 512 Dialect 0x300
+`,
+			want: map[string]uint64{"fileserver": 8062, "nas": 512},
+		},
+		{
+			name: "legacy",
+			data: `Servers:
+Number of credits: 512 Dialect 0x302
+1) Name: 192.168.1.20 Uses: 1 Capability: 0x300067	Session Status: 1 TCP status: 1 Instance: 1
+Number of credits: 20 Dialect 0x210
+1) Name: 192.168.1.21 Uses: 1 Capability: 0x300067	Session Status: 1 TCP status: 1 Instance: 1
+`,
+			want: map[string]uint64{"192.168.1.20": 512, "192.168.1.21": 20},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			credits, err := parseCIFSCredits(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(credits, tt.want) {
+				t.Errorf("want credits %v, got %v", tt.want, credits)
+			}
+		})
+	}
+}
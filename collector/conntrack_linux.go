@@ -16,14 +16,60 @@
 package collector
 
 import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/mdlayher/netlink"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+	"golang.org/x/sys/unix"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// From include/uapi/linux/netfilter/nfnetlink_conntrack.h.
+const (
+	ipctnlMsgCtGetStatsCPU = 4
+
+	ctaStatsFound         = 2
+	ctaStatsInvalid       = 4
+	ctaStatsIgnore        = 5
+	ctaStatsInsert        = 8
+	ctaStatsInsertFailed  = 9
+	ctaStatsDrop          = 10
+	ctaStatsEarlyDrop     = 11
+	ctaStatsSearchRestart = 13
 )
 
+var conntrackEntriesBreakdown = kingpin.Flag("collector.conntrack.entries-breakdown", "Count the connection tracking entries by protocol, state and zone. This reads the whole table on each scrape.").Default("false").Bool()
+
+// conntrackEntryKey is what connection tracking entries are counted by.
+type conntrackEntryKey struct {
+	family   string
+	protocol string
+	state    string
+	zone     string
+}
+
 type conntrackCollector struct {
-	current *prometheus.Desc
-	limit   *prometheus.Desc
-	logger  log.Logger
+	fs            procfs.FS
+	current       *prometheus.Desc
+	limit         *prometheus.Desc
+	entries       *prometheus.Desc
+	found         *prometheus.Desc
+	invalid       *prometheus.Desc
+	ignore        *prometheus.Desc
+	insert        *prometheus.Desc
+	insertFailed  *prometheus.Desc
+	drop          *prometheus.Desc
+	earlyDrop     *prometheus.Desc
+	searchRestart *prometheus.Desc
+	logger        log.Logger
 }
 
 func init() {
@@ -32,7 +78,19 @@ func init() {
 
 // NewConntrackCollector returns a new Collector exposing conntrack stats.
 func NewConntrackCollector(logger log.Logger) (Collector, error) {
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open procfs: %w", err)
+	}
+
+	stat := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "nf_conntrack_stat_"+name+"_total"),
+			help, nil, nil,
+		)
+	}
 	return &conntrackCollector{
+		fs: fs,
 		current: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "nf_conntrack_entries"),
 			"Number of currently allocated flow entries for connection tracking.",
@@ -43,7 +101,20 @@ func NewConntrackCollector(logger log.Logger) (Collector, error) {
 			"Maximum size of connection tracking table.",
 			nil, nil,
 		),
-		logger: logger,
+		entries: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "nf_conntrack_protocol_entries"),
+			"Number of connection tracking entries by protocol, state and zone.",
+			[]string{"family", "protocol", "state", "zone"}, nil,
+		),
+		found:         stat("found", "Number of searched entries which were successful."),
+		invalid:       stat("invalid", "Number of packets seen which can not be tracked."),
+		ignore:        stat("ignore", "Number of packets seen which are already connected to a conntrack entry."),
+		insert:        stat("insert", "Number of entries inserted into the list."),
+		insertFailed:  stat("insert_failed", "Number of entries for which list insertion was attempted but failed."),
+		drop:          stat("drop", "Number of packets dropped due to conntrack failure."),
+		earlyDrop:     stat("early_drop", "Number of dropped conntrack entries to make room for new ones, if maximum table size was reached."),
+		searchRestart: stat("search_restart", "Number of conntrack table lookups which had to be restarted due to hashtable resizes."),
+		logger:        logger,
 	}, nil
 }
 
@@ -63,5 +134,164 @@ func (c *conntrackCollector) Update(ch chan<- prometheus.Metric) error {
 	ch <- prometheus.MustNewConstMetric(
 		c.limit, prometheus.GaugeValue, float64(value))
 
+	if err := c.updateStat(ch); err != nil {
+		return err
+	}
+	if *conntrackEntriesBreakdown {
+		return c.updateEntries(ch)
+	}
+	return nil
+}
+
+// updateStat exports the per CPU conntrack statistics summed over all CPUs.
+// They are read from /proc/net/stat/nf_conntrack, or from ctnetlink, which
+// needs CAP_NET_ADMIN, on kernels built without CONFIG_NF_CONNTRACK_PROCFS.
+func (c *conntrackCollector) updateStat(ch chan<- prometheus.Metric) error {
+	var total procfs.ConntrackStatEntry
+	stats, err := c.fs.ConntrackStat()
+	switch {
+	case err == nil:
+		for _, s := range stats {
+			total.Found += s.Found
+			total.Invalid += s.Invalid
+			total.Ignore += s.Ignore
+			total.Insert += s.Insert
+			total.InsertFailed += s.InsertFailed
+			total.Drop += s.Drop
+			total.EarlyDrop += s.EarlyDrop
+			total.SearchRestart += s.SearchRestart
+		}
+	case os.IsNotExist(err):
+		if total, err = getConntrackStats(); err != nil {
+			level.Debug(c.logger).Log("msg", "conntrack statistics not found in procfs or via netlink", "err", err)
+			return nil
+		}
+	default:
+		return fmt.Errorf("couldn't read conntrack statistics: %w", err)
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.found, prometheus.CounterValue, float64(total.Found))
+	ch <- prometheus.MustNewConstMetric(c.invalid, prometheus.CounterValue, float64(total.Invalid))
+	ch <- prometheus.MustNewConstMetric(c.ignore, prometheus.CounterValue, float64(total.Ignore))
+	ch <- prometheus.MustNewConstMetric(c.insert, prometheus.CounterValue, float64(total.Insert))
+	ch <- prometheus.MustNewConstMetric(c.insertFailed, prometheus.CounterValue, float64(total.InsertFailed))
+	ch <- prometheus.MustNewConstMetric(c.drop, prometheus.CounterValue, float64(total.Drop))
+	ch <- prometheus.MustNewConstMetric(c.earlyDrop, prometheus.CounterValue, float64(total.EarlyDrop))
+	ch <- prometheus.MustNewConstMetric(c.searchRestart, prometheus.CounterValue, float64(total.SearchRestart))
+	return nil
+}
+
+// getConntrackStats dumps the per CPU statistics with
+// IPCTNL_MSG_CT_GET_STATS_CPU and sums them.
+func getConntrackStats() (procfs.ConntrackStatEntry, error) {
+	var total procfs.ConntrackStatEntry
+
+	conn, err := netlink.Dial(unix.NETLINK_NETFILTER, nil)
+	if err != nil {
+		return total, fmt.Errorf("failed to dial netlink: %w", err)
+	}
+	defer conn.Close()
+
+	req := netlink.Message{
+		Header: netlink.Header{
+			Flags: netlink.Request | netlink.Dump,
+			Type:  netlink.HeaderType(unix.NFNL_SUBSYS_CTNETLINK<<8 | ipctnlMsgCtGetStatsCPU),
+		},
+		// struct nfgenmsg with AF_UNSPEC and NFNETLINK_V0.
+		Data: []byte{unix.AF_UNSPEC, unix.NFNETLINK_V0, 0, 0},
+	}
+	msgs, err := conn.Execute(req)
+	if err != nil {
+		return total, err
+	}
+	for _, msg := range msgs {
+		if len(msg.Data) < 4 {
+			return total, fmt.Errorf("short message, len=%d", len(msg.Data))
+		}
+		if err := parseConntrackStats(msg.Data[4:], &total); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// parseConntrackStats adds the CTA_STATS_* attributes of one CPU to total.
+func parseConntrackStats(b []byte, total *procfs.ConntrackStatEntry) error {
+	ad, err := netlink.NewAttributeDecoder(b)
+	if err != nil {
+		return err
+	}
+	ad.ByteOrder = binary.BigEndian
+	for ad.Next() {
+		switch ad.Type() {
+		case ctaStatsFound:
+			total.Found += uint64(ad.Uint32())
+		case ctaStatsInvalid:
+			total.Invalid += uint64(ad.Uint32())
+		case ctaStatsIgnore:
+			total.Ignore += uint64(ad.Uint32())
+		case ctaStatsInsert:
+			total.Insert += uint64(ad.Uint32())
+		case ctaStatsInsertFailed:
+			total.InsertFailed += uint64(ad.Uint32())
+		case ctaStatsDrop:
+			total.Drop += uint64(ad.Uint32())
+		case ctaStatsEarlyDrop:
+			total.EarlyDrop += uint64(ad.Uint32())
+		case ctaStatsSearchRestart:
+			total.SearchRestart += uint64(ad.Uint32())
+		}
+	}
+	return ad.Err()
+}
+
+// updateEntries counts the entries of /proc/net/nf_conntrack.
+func (c *conntrackCollector) updateEntries(ch chan<- prometheus.Metric) error {
+	f, err := os.Open(procFilePath("net/nf_conntrack"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			level.Debug(c.logger).Log("msg", "conntrack table not found", "err", err)
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	counts, err := parseConntrackEntries(f)
+	if err != nil {
+		return fmt.Errorf("couldn't parse conntrack table: %w", err)
+	}
+	for k, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, n, k.family, k.protocol, k.state, k.zone)
+	}
 	return nil
 }
+
+// parseConntrackEntries counts the entries of the conntrack table, with lines
+// like "ipv4 2 tcp 6 431999 ESTABLISHED src=10.0.0.1 ... [ASSURED] zone=0 use=2".
+// Only some protocols like TCP and SCTP have a state.
+func parseConntrackEntries(r io.Reader) (map[conntrackEntryKey]float64, error) {
+	counts := make(map[conntrackEntryKey]float64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			return nil, fmt.Errorf("too few fields in line %q", scanner.Text())
+		}
+		k := conntrackEntryKey{
+			family:   fields[0],
+			protocol: fields[2],
+			zone:     "0",
+		}
+		if !strings.Contains(fields[5], "=") {
+			k.state = fields[5]
+		}
+		for _, field := range fields[5:] {
+			if strings.HasPrefix(field, "zone=") {
+				k.zone = strings.TrimPrefix(field, "zone=")
+			}
+		}
+		counts[k]++
+	}
+	return counts, scanner.Err()
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noconntrack
+
+package collector
+
+import (
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/mdlayher/netlink"
+	"github.com/prometheus/procfs"
+)
+
+func TestParseConntrackEntries(t *testing.T) {
+	f, err := os.Open("fixtures/proc/net/nf_conntrack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	counts, err := parseConntrackEntries(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[conntrackEntryKey]float64{
+		{"ipv4", "tcp", "ESTABLISHED", "0"}: 2,
+		{"ipv4", "tcp", "TIME_WAIT", "0"}:   1,
+		{"ipv4", "udp", "", "0"}:            1,
+		{"ipv4", "udp", "", "1"}:            1,
+		{"ipv6", "icmpv6", "", "0"}:         1,
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("want %v, got %v", want, counts)
+	}
+}
+
+func TestParseConntrackStats(t *testing.T) {
+	var total procfs.ConntrackStatEntry
+	for cpu, v := range []uint32{3, 5} {
+		ae := netlink.NewAttributeEncoder()
+		ae.ByteOrder = binary.BigEndian
+		ae.Uint32(ctaStatsFound, v)
+		ae.Uint32(ctaStatsInsertFailed, v*2)
+		ae.Uint32(ctaStatsDrop, v*3)
+		ae.Uint32(ctaStatsEarlyDrop, v*4)
+		ae.Uint32(ctaStatsSearchRestart, v*5)
+		b, err := ae.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := parseConntrackStats(b, &total); err != nil {
+			t.Fatalf("cpu %d: %v", cpu, err)
+		}
+	}
+	want := procfs.ConntrackStatEntry{
+		Found:         8,
+		InsertFailed:  16,
+		Drop:          24,
+		EarlyDrop:     32,
+		SearchRestart: 40,
+	}
+	if total != want {
+		t.Errorf("want %+v, got %+v", want, total)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nolvm !nomultipath !nodm_integrity !nodm_crypt
+
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// _IOWR(DM_IOCTL, DM_TABLE_STATUS_CMD, struct dm_ioctl)
+	dmIoctlTableStatus = 0xc138fd0c
+	dmIoctlSize        = 312
+	dmTargetSpecSize   = 40
+	dmTargetTypeSize   = 16
+	dmBufferSize       = 16 * 1024
+	dmStatusTableFlag  = 1 << 4
+	dmBufferFullFlag   = 1 << 8
+	dmNoFlushFlag      = 1 << 11
+	dmSecureDataFlag   = 1 << 15
+)
+
+// readDMStatus returns the status line of the first target of the
+// device-mapper device name, like "dmsetup status --noflush" does. With
+// table set the table line is returned instead, like "dmsetup table".
+func readDMStatus(name string, table bool) (string, error) {
+	_, status, err := readDMTarget(name, table)
+	return status, err
+}
+
+// readDMTarget returns the type and the status or table line of the first
+// target of the device-mapper device name.
+func readDMTarget(name string, table bool) (string, string, error) {
+	f, err := os.Open(rootfsFilePath("dev/mapper/control"))
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, dmBufferSize)
+	// Tables of dm-crypt targets hold the key, it is wiped like the kernel
+	// does with the secure data flag.
+	defer func() {
+		for i := range buf {
+			buf[i] = 0
+		}
+	}()
+	nativeEndian.PutUint32(buf[0:], 4) // Interface version 4.0.0.
+	nativeEndian.PutUint32(buf[12:], dmBufferSize)
+	nativeEndian.PutUint32(buf[16:], dmIoctlSize)
+	flags := uint32(dmNoFlushFlag)
+	if table {
+		flags |= dmStatusTableFlag | dmSecureDataFlag
+	}
+	nativeEndian.PutUint32(buf[28:], flags)
+	copy(buf[48:48+127], name)
+
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), dmIoctlTableStatus, uintptr(unsafe.Pointer(&buf[0])))
+	if errno != 0 {
+		return "", "", fmt.Errorf("DM_TABLE_STATUS failed: %w", errno)
+	}
+	if nativeEndian.Uint32(buf[28:])&dmBufferFullFlag != 0 {
+		return "", "", fmt.Errorf("DM_TABLE_STATUS result exceeds %d bytes", dmBufferSize)
+	}
+	if nativeEndian.Uint32(buf[20:]) == 0 {
+		return "", "", fmt.Errorf("device %s has no targets", name)
+	}
+
+	// The target type is the last field of struct dm_target_spec, the
+	// status follows it.
+	spec := int(nativeEndian.Uint32(buf[16:]))
+	targetType := buf[spec+dmTargetSpecSize-dmTargetTypeSize : spec+dmTargetSpecSize]
+	if i := bytes.IndexByte(targetType, 0); i >= 0 {
+		targetType = targetType[:i]
+	}
+	status := buf[spec+dmTargetSpecSize:]
+	if i := bytes.IndexByte(status, 0); i >= 0 {
+		status = status[:i]
+	}
+	if table && string(targetType) == "crypt" {
+		maskDMCryptKey(status)
+	}
+	return string(targetType), string(status), nil
+}
+
+// maskDMCryptKey replaces a hex key in the table line of a dm-crypt target
+// with zeros of the same length, like dmsetup does without --showkeys. Keys
+// in the kernel keyring are referenced as ":<size>:<type>:<description>" and
+// kept.
+func maskDMCryptKey(table []byte) {
+	// <cipher> <key> <iv offset> <device> <offset> [<#opt params> <opt params>]
+	start := bytes.IndexByte(table, ' ')
+	if start < 0 {
+		return
+	}
+	key := table[start+1:]
+	if end := bytes.IndexByte(key, ' '); end >= 0 {
+		key = key[:end]
+	}
+	if len(key) == 0 || key[0] == ':' || key[0] == '-' {
+		return
+	}
+	for i := range key {
+		key[i] = '0'
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nodisk_power
+
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	diskPowerSubsystem = "disk_power"
+
+	// HDIO_DRIVE_CMD and HDIO_GET_IDENTITY from <linux/hdreg.h>.
+	diskPowerIoctlDriveCmd    = 0x031f
+	diskPowerIoctlGetIdentity = 0x030d
+
+	ataCmdCheckPowerMode = 0xe5
+	ataIdentifySize      = 512
+)
+
+// diskPowerStates are the power modes reported by CHECK POWER MODE, modes
+// not listed are reported as unknown.
+var diskPowerStates = map[uint8]string{
+	0x00: "standby",
+	0x80: "idle",
+	0xff: "active",
+}
+
+// diskPowerManagement holds the APM and AAM settings from the IDENTIFY DEVICE
+// data of a disk.
+type diskPowerManagement struct {
+	APMSupported bool
+	APMEnabled   bool
+	APMLevel     uint8
+	AAMSupported bool
+	AAMEnabled   bool
+	AAMLevel     uint8
+}
+
+type diskPowerCollector struct {
+	state      *prometheus.Desc
+	apmEnabled *prometheus.Desc
+	apmLevel   *prometheus.Desc
+	aamEnabled *prometheus.Desc
+	aamLevel   *prometheus.Desc
+	logger     log.Logger
+}
+
+func init() {
+	registerCollector("disk_power", defaultDisabled, NewDiskPowerCollector)
+}
+
+// NewDiskPowerCollector returns a new Collector exposing the power mode and
+// power management settings of rotational ATA disks.
+func NewDiskPowerCollector(logger log.Logger) (Collector, error) {
+	labels := []string{"device"}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, diskPowerSubsystem, name),
+			help, labels, nil,
+		)
+	}
+	return &diskPowerCollector{
+		state: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, diskPowerSubsystem, "state"),
+			"Power mode of the disk, standby means spun down.",
+			[]string{"device", "state"}, nil,
+		),
+		apmEnabled: desc("apm_enabled", "Whether Advanced Power Management is enabled."),
+		apmLevel:   desc("apm_level", "Advanced Power Management level, levels below 128 allow spinning down."),
+		aamEnabled: desc("aam_enabled", "Whether Automatic Acoustic Management is enabled."),
+		aamLevel:   desc("aam_level", "Automatic Acoustic Management level, lower levels are quieter and slower."),
+		logger:     logger,
+	}, nil
+}
+
+func (c *diskPowerCollector) Update(ch chan<- prometheus.Metric) error {
+	disks, err := filepath.Glob(sysFilePath("block/sd*"))
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, disk := range disks {
+		device := filepath.Base(disk)
+		vendor, err := readStringFromFile(filepath.Join(disk, "device/vendor"))
+		if err != nil || vendor != "ATA" {
+			continue
+		}
+		rotational, err := readUintFromFile(filepath.Join(disk, "queue/rotational"))
+		if err != nil || rotational == 0 {
+			continue
+		}
+		found = true
+
+		path := rootfsFilePath(filepath.Join("dev", device))
+		// CHECK POWER MODE doesn't spin up disks in standby.
+		mode, err := readDiskPowerMode(path)
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't check power mode", "device", device, "err", err)
+			continue
+		}
+		state, ok := diskPowerStates[mode]
+		if !ok {
+			state = "unknown"
+		}
+		for _, s := range []string{"active", "idle", "standby", "unknown"} {
+			v := 0.0
+			if s == state {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, v, device, s)
+		}
+
+		pm, err := readDiskPowerManagement(path)
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't read identify data", "device", device, "err", err)
+			continue
+		}
+		if pm.APMSupported {
+			enabled := 0.0
+			if pm.APMEnabled {
+				enabled = 1
+				ch <- prometheus.MustNewConstMetric(c.apmLevel, prometheus.GaugeValue, float64(pm.APMLevel), device)
+			}
+			ch <- prometheus.MustNewConstMetric(c.apmEnabled, prometheus.GaugeValue, enabled, device)
+		}
+		if pm.AAMSupported {
+			enabled := 0.0
+			if pm.AAMEnabled {
+				enabled = 1
+				ch <- prometheus.MustNewConstMetric(c.aamLevel, prometheus.GaugeValue, float64(pm.AAMLevel), device)
+			}
+			ch <- prometheus.MustNewConstMetric(c.aamEnabled, prometheus.GaugeValue, enabled, device)
+		}
+	}
+	if !found {
+		level.Debug(c.logger).Log("msg", "no rotational ATA disks found, skipping")
+		return ErrNoData
+	}
+
+	return nil
+}
+
+// readDiskPowerMode issues CHECK POWER MODE and returns the sector count
+// register holding the power mode.
+func readDiskPowerMode(path string) (uint8, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 4)
+	buf[0] = ataCmdCheckPowerMode
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), diskPowerIoctlDriveCmd, uintptr(unsafe.Pointer(&buf[0])))
+	if errno != 0 {
+		return 0, fmt.Errorf("CHECK POWER MODE failed: %w", errno)
+	}
+	return buf[2], nil
+}
+
+// readDiskPowerManagement returns the power management settings from the
+// IDENTIFY DEVICE data cached by the kernel.
+func readDiskPowerManagement(path string) (*diskPowerManagement, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, ataIdentifySize)
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), diskPowerIoctlGetIdentity, uintptr(unsafe.Pointer(&buf[0])))
+	if errno != 0 {
+		return nil, fmt.Errorf("HDIO_GET_IDENTITY failed: %w", errno)
+	}
+
+	return parseDiskPowerManagement(buf)
+}
+
+func parseDiskPowerManagement(b []byte) (*diskPowerManagement, error) {
+	if len(b) < ataIdentifySize {
+		return nil, fmt.Errorf("identify data too short: %d bytes", len(b))
+	}
+	word := func(n int) uint16 {
+		return binary.LittleEndian.Uint16(b[2*n : 2*n+2])
+	}
+	// Words 83 and 86 are the supported and enabled command sets, bit 3
+	// is APM and bit 9 is AAM. Word 91 holds the current APM level, the low
+	// byte of word 94 the current AAM level.
+	return &diskPowerManagement{
+		APMSupported: word(83)&(1<<3) != 0,
+		APMEnabled:   word(86)&(1<<3) != 0,
+		APMLevel:     uint8(word(91)),
+		AAMSupported: word(83)&(1<<9) != 0,
+		AAMEnabled:   word(86)&(1<<9) != 0,
+		AAMLevel:     uint8(word(94)),
+	}, nil
+}
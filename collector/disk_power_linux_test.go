@@ -0,0 +1,49 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nodisk_power
+
+package collector
+
+import (
+	"testing"
+)
+
+func TestParseDiskPowerManagement(t *testing.T) {
+	b := make([]byte, ataIdentifySize)
+	// APM and AAM supported, only APM enabled at level 127.
+	b[2*83] = 1 << 3
+	b[2*83+1] = 1 << 1
+	b[2*86] = 1 << 3
+	b[2*91] = 127
+	b[2*94] = 0xfe
+
+	pm, err := parseDiskPowerManagement(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := diskPowerManagement{
+		APMSupported: true,
+		APMEnabled:   true,
+		APMLevel:     127,
+		AAMSupported: true,
+		AAMLevel:     0xfe,
+	}
+	if *pm != want {
+		t.Errorf("want %+v, got %+v", want, *pm)
+	}
+
+	if _, err := parseDiskPowerManagement(b[:100]); err == nil {
+		t.Error("expected error for truncated data")
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -36,7 +37,9 @@ const (
 )
 
 var (
-	ignoredDevices = kingpin.Flag("collector.diskstats.ignored-devices", "Regexp of devices to ignore for diskstats.").Default("^(ram|loop|fd|(h|s|v|xv)d[a-z]|nvme\\d+n\\d+p)\\d+$").String()
+	ignoredDevices           = kingpin.Flag("collector.diskstats.ignored-devices", "Regexp of devices to ignore for diskstats.").Default("^(ram|loop|fd|(h|s|v|xv)d[a-z]|nvme\\d+n\\d+p)\\d+$").String()
+	diskstatsUdevProperties  = kingpin.Flag("collector.diskstats.udev-properties", "Enables node_disk_info, node_disk_device_mapper_info and the partition and filesystem info metrics, read from sysfs and the udev database. The info metrics include the ignored partitions of reported devices.").Bool()
+	diskstatsQueueAttributes = kingpin.Flag("collector.diskstats.queue-attributes", "Enables the I/O scheduler, queue, read ahead, rotational and discard settings of block devices from /sys/block/<device>/queue.").Bool()
 )
 
 type typedFactorDesc struct {
@@ -55,6 +58,17 @@ func (d *typedFactorDesc) mustNewConstMetric(value float64, labels ...string) pr
 type diskstatsCollector struct {
 	ignoredDevicesPattern *regexp.Regexp
 	descs                 []typedFactorDesc
+	info                  *prometheus.Desc
+	deviceMapperInfo      *prometheus.Desc
+	partitionTableInfo    *prometheus.Desc
+	partitionInfo         *prometheus.Desc
+	filesystemInfo        *prometheus.Desc
+	discardMaxBytes       *prometheus.Desc
+	discardGranularity    *prometheus.Desc
+	schedulerInfo         *prometheus.Desc
+	queueRequests         *prometheus.Desc
+	readAhead             *prometheus.Desc
+	rotational            *prometheus.Desc
 	logger                log.Logger
 }
 
@@ -165,7 +179,7 @@ func NewDiskstatsCollector(logger log.Logger) (Collector, error) {
 			{
 				desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, diskSubsystem, "flush_requests_total"),
-					"The total number of flush requests completed successfully",
+					"The total number of flush requests completed successfully.",
 					diskLabelNames,
 					nil,
 				), valueType: prometheus.CounterValue,
@@ -180,6 +194,72 @@ func NewDiskstatsCollector(logger log.Logger) (Collector, error) {
 				factor: .001,
 			},
 		},
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, diskSubsystem, "info"),
+			"Non-numeric data from /sys/block/<device> and the udev database, value is always 1.",
+			[]string{"device", "model", "serial", "wwn", "firmware"},
+			nil,
+		),
+		deviceMapperInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, diskSubsystem, "device_mapper_info"),
+			"Non-numeric data from /sys/block/<device>/dm, value is always 1.",
+			[]string{"device", "name", "uuid"},
+			nil,
+		),
+		partitionTableInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, diskSubsystem, "partition_table_info"),
+			"Partition table of the device from the udev database, value is always 1.",
+			[]string{"device", "type", "uuid"},
+			nil,
+		),
+		partitionInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, diskSubsystem, "partition_info"),
+			"Partition table entry of the partition from the udev database, value is always 1.",
+			[]string{"device", "number", "uuid", "name", "type"},
+			nil,
+		),
+		filesystemInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, diskSubsystem, "filesystem_info"),
+			"Filesystem or other content found on the device by udev, value is always 1.",
+			[]string{"device", "type", "usage", "uuid", "label", "version"},
+			nil,
+		),
+		discardMaxBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, diskSubsystem, "discard_max_bytes"),
+			"Maximum number of bytes discarded by a single request, 0 if the device doesn't support discards.",
+			diskLabelNames,
+			nil,
+		),
+		discardGranularity: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, diskSubsystem, "discard_granularity_bytes"),
+			"Size of the internal allocation unit of the device, smaller discards don't free space.",
+			diskLabelNames,
+			nil,
+		),
+		schedulerInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, diskSubsystem, "scheduler_info"),
+			"Active I/O scheduler of the device from /sys/block/<device>/queue/scheduler, value is always 1.",
+			[]string{"device", "scheduler"},
+			nil,
+		),
+		queueRequests: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, diskSubsystem, "queue_requests"),
+			"Maximum number of requests allocated in the request queue of the device.",
+			diskLabelNames,
+			nil,
+		),
+		readAhead: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, diskSubsystem, "read_ahead_bytes"),
+			"Maximum amount of data read ahead by filesystems on the device.",
+			diskLabelNames,
+			nil,
+		),
+		rotational: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, diskSubsystem, "rotational"),
+			"Whether the device is rotational.",
+			diskLabelNames,
+			nil,
+		),
 		logger: logger,
 	}, nil
 }
@@ -207,10 +287,195 @@ func (c *diskstatsCollector) Update(ch chan<- prometheus.Metric) error {
 			}
 			ch <- c.descs[i].mustNewConstMetric(v, dev)
 		}
+
+		if *diskstatsUdevProperties {
+			c.updateDeviceMapperInfo(ch, dev)
+			props := readDiskUdevProperties(dev)
+			if info := readDiskInfo(dev, props); info != nil {
+				ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, dev, info.model, info.serial, info.wwn, info.firmware)
+			}
+			c.updateDiskLabels(ch, dev, props)
+			// Partitions are ignored by default, but users know their
+			// filesystems by them.
+			for _, part := range c.ignoredPartitions(dev) {
+				c.updateDiskLabels(ch, part, readDiskUdevProperties(part))
+			}
+		}
+
+		if *diskstatsQueueAttributes {
+			c.updateQueueAttributes(ch, dev)
+		}
 	}
 	return nil
 }
 
+// updateQueueAttributes exports the settings of the request queue, which are
+// only available for whole devices.
+func (c *diskstatsCollector) updateQueueAttributes(ch chan<- prometheus.Metric, dev string) {
+	queue := sysFilePath(filepath.Join("block", dev, "queue"))
+	if v, err := readUintFromFile(filepath.Join(queue, "discard_max_bytes")); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.discardMaxBytes, prometheus.GaugeValue, float64(v), dev)
+	}
+	if v, err := readUintFromFile(filepath.Join(queue, "discard_granularity")); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.discardGranularity, prometheus.GaugeValue, float64(v), dev)
+	}
+	if scheduler, err := readStringFromFile(filepath.Join(queue, "scheduler")); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.schedulerInfo, prometheus.GaugeValue, 1, dev, parseDiskScheduler(scheduler))
+	}
+	if v, err := readUintFromFile(filepath.Join(queue, "nr_requests")); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.queueRequests, prometheus.GaugeValue, float64(v), dev)
+	}
+	if v, err := readUintFromFile(filepath.Join(queue, "read_ahead_kb")); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.readAhead, prometheus.GaugeValue, float64(v)*1024, dev)
+	}
+	if v, err := readUintFromFile(filepath.Join(queue, "rotational")); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.rotational, prometheus.GaugeValue, float64(v), dev)
+	}
+}
+
+// updateDeviceMapperInfo exports the device mapper name of a block device.
+func (c *diskstatsCollector) updateDeviceMapperInfo(ch chan<- prometheus.Metric, dev string) {
+	if name, err := readStringFromFile(sysFilePath(filepath.Join("block", dev, "dm/name"))); err == nil {
+		uuid, _ := readStringFromFile(sysFilePath(filepath.Join("block", dev, "dm/uuid")))
+		ch <- prometheus.MustNewConstMetric(c.deviceMapperInfo, prometheus.GaugeValue, 1, dev, name, uuid)
+	}
+}
+
+// updateDiskLabels exports the names users know a block device by from its
+// udev properties: partition and filesystem labels.
+func (c *diskstatsCollector) updateDiskLabels(ch chan<- prometheus.Metric, dev string, props map[string]string) {
+	// Partitions carry the table properties of their disk as well.
+	if props["ID_PART_ENTRY_NUMBER"] != "" {
+		ch <- prometheus.MustNewConstMetric(c.partitionInfo, prometheus.GaugeValue, 1, dev,
+			props["ID_PART_ENTRY_NUMBER"], props["ID_PART_ENTRY_UUID"], props["ID_PART_ENTRY_NAME"], props["ID_PART_ENTRY_TYPE"])
+	} else if props["ID_PART_TABLE_TYPE"] != "" {
+		ch <- prometheus.MustNewConstMetric(c.partitionTableInfo, prometheus.GaugeValue, 1, dev,
+			props["ID_PART_TABLE_TYPE"], props["ID_PART_TABLE_UUID"])
+	}
+
+	if props["ID_FS_TYPE"] != "" {
+		ch <- prometheus.MustNewConstMetric(c.filesystemInfo, prometheus.GaugeValue, 1, dev,
+			props["ID_FS_TYPE"], props["ID_FS_USAGE"], props["ID_FS_UUID"], props["ID_FS_LABEL"], props["ID_FS_VERSION"])
+	}
+}
+
+// ignoredPartitions returns the partitions of a block device that are
+// excluded from diskstats by the ignored devices pattern.
+func (c *diskstatsCollector) ignoredPartitions(dev string) []string {
+	files, err := filepath.Glob(sysFilePath(filepath.Join("block", dev, "*", "partition")))
+	if err != nil {
+		return nil
+	}
+	var parts []string
+	for _, file := range files {
+		if part := filepath.Base(filepath.Dir(file)); c.ignoredDevicesPattern.MatchString(part) {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// parseDiskScheduler returns the active scheduler from the list of available
+// schedulers, like "mq-deadline kyber [bfq] none". Devices without a choice
+// only list "none".
+func parseDiskScheduler(schedulers string) string {
+	for _, s := range strings.Fields(schedulers) {
+		if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+			return strings.Trim(s, "[]")
+		}
+	}
+	return strings.TrimSpace(schedulers)
+}
+
+// diskInfo identifies the physical device of a whole block device.
+type diskInfo struct {
+	model    string
+	serial   string
+	wwn      string
+	firmware string
+}
+
+// readDiskUdevProperties returns the udev database entry of a block device,
+// or nil if udev isn't running.
+func readDiskUdevProperties(dev string) map[string]string {
+	// Partitions are only listed in /sys/class/block.
+	majorMinor, err := readStringFromFile(sysFilePath(filepath.Join("class/block", dev, "dev")))
+	if err != nil {
+		return nil
+	}
+	props, err := readUdevProperties(udevDataFilePath("b" + majorMinor))
+	if err != nil {
+		return nil
+	}
+	return props
+}
+
+// readDiskInfo returns the identity of a whole block device from its udev
+// properties, falling back to sysfs attributes when udev isn't running. It
+// returns nil for partitions and devices without identity.
+func readDiskInfo(dev string, props map[string]string) *diskInfo {
+	block := sysFilePath(filepath.Join("block", dev))
+	if _, err := os.Stat(block); err != nil {
+		return nil
+	}
+
+	info := diskInfo{
+		model:    props["ID_MODEL"],
+		serial:   props["ID_SERIAL_SHORT"],
+		wwn:      props["ID_WWN"],
+		firmware: props["ID_REVISION"],
+	}
+	firstOf := func(v string, names ...string) string {
+		for _, name := range names {
+			if v != "" {
+				break
+			}
+			v, _ = readStringFromFile(filepath.Join(block, name))
+		}
+		return v
+	}
+	// SCSI disks have rev and wwid below device, NVMe namespaces have the
+	// controller below device.
+	info.model = firstOf(info.model, "device/model")
+	info.serial = firstOf(info.serial, "device/serial")
+	info.wwn = firstOf(info.wwn, "wwid", "device/wwid")
+	info.firmware = firstOf(info.firmware, "device/rev", "device/firmware_rev")
+
+	if info == (diskInfo{}) {
+		return nil
+	}
+	return &info
+}
+
+func readUdevProperties(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseUdevProperties(f)
+}
+
+// parseUdevProperties returns the properties of a udev database entry, stored
+// in lines like "E:ID_MODEL=ST4000NM0035".
+func parseUdevProperties(r io.Reader) (map[string]string, error) {
+	props := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "E:") {
+			continue
+		}
+		kv := strings.SplitN(line[2:], "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		props[kv[0]] = kv[1]
+	}
+	return props, scanner.Err()
+}
+
 func getDiskStats() (map[string][]string, error) {
 	file, err := os.Open(procFilePath(diskstatsFilename))
 	if err != nil {
@@ -50,3 +50,38 @@ func TestDiskStats(t *testing.T) {
 		t.Errorf("want diskstats sdc %s, got %s", want, got)
 	}
 }
+
+func TestParseUdevProperties(t *testing.T) {
+	file, err := os.Open("fixtures/udev/data/b259:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	props, err := parseUdevProperties(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]string{
+		"ID_MODEL":        "Samsung SSD 970 EVO Plus 1TB",
+		"ID_SERIAL_SHORT": "S4EWNX0R123456",
+		"ID_WWN":          "eui.0025385b91b12345",
+	} {
+		if got := props[key]; got != want {
+			t.Errorf("want udev property %s %q, got %q", key, want, got)
+		}
+	}
+}
+
+func TestParseDiskScheduler(t *testing.T) {
+	for in, want := range map[string]string{
+		"mq-deadline kyber [bfq] none": "bfq",
+		"[none] mq-deadline":           "none",
+		"none":                         "none",
+	} {
+		if got := parseDiskScheduler(in); got != want {
+			t.Errorf("want scheduler of %q %q, got %q", in, want, got)
+		}
+	}
+}
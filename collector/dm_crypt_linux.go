@@ -0,0 +1,230 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nodm_crypt
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dmCryptSubsystem = "dm_crypt"
+
+// dmCryptTable holds the settings of a dm-crypt target from its table line.
+type dmCryptTable struct {
+	Cipher         string
+	KeySizeBits    uint64
+	Device         string
+	SectorSize     uint64
+	AllowDiscards  bool
+	SameCPUCrypt   bool
+	ReadWorkqueue  bool
+	WriteWorkqueue bool
+}
+
+type dmCryptCollector struct {
+	info           *prometheus.Desc
+	keySize        *prometheus.Desc
+	sectorSize     *prometheus.Desc
+	allowDiscards  *prometheus.Desc
+	sameCPUCrypt   *prometheus.Desc
+	readWorkqueue  *prometheus.Desc
+	writeWorkqueue *prometheus.Desc
+	inflight       *prometheus.Desc
+	logger         log.Logger
+}
+
+func init() {
+	registerCollector("dm_crypt", defaultDisabled, NewDMCryptCollector)
+}
+
+// NewDMCryptCollector returns a new Collector exposing the settings and
+// in-flight I/O of dm-crypt devices.
+func NewDMCryptCollector(logger log.Logger) (Collector, error) {
+	labels := []string{"device"}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, dmCryptSubsystem, name),
+			help, labels, nil,
+		)
+	}
+	return &dmCryptCollector{
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, dmCryptSubsystem, "info"),
+			"Non-numeric data from the dm-crypt table, value is always 1.",
+			[]string{"device", "cipher", "backing_device"}, nil,
+		),
+		keySize:        desc("key_size_bits", "Size of the encryption key."),
+		sectorSize:     desc("sector_size_bytes", "Size of the encryption sectors."),
+		allowDiscards:  desc("discards_allowed", "Whether discards are passed to the backing device."),
+		sameCPUCrypt:   desc("same_cpu_crypt", "Whether I/O is encrypted on the CPU that submitted it."),
+		readWorkqueue:  desc("read_workqueue", "Whether reads are decrypted in the kcryptd workqueue instead of inline."),
+		writeWorkqueue: desc("write_workqueue", "Whether writes are encrypted in the kcryptd workqueue instead of inline."),
+		inflight: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, dmCryptSubsystem, "inflight_requests"),
+			"Number of requests in flight on the encrypted device, including those waiting for encryption.",
+			[]string{"device", "direction"}, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *dmCryptCollector) Update(ch chan<- prometheus.Metric) error {
+	paths, err := filepath.Glob(sysFilePath("block/dm-*"))
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, path := range paths {
+		device, err := readStringFromFile(filepath.Join(path, "dm/name"))
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't read device-mapper name", "path", path, "err", err)
+			continue
+		}
+		targetType, line, err := readDMTarget(device, true)
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't read device-mapper table", "device", device, "err", err)
+			continue
+		}
+		if targetType != "crypt" {
+			continue
+		}
+		found = true
+
+		table, err := parseDMCryptTable(line)
+		if err != nil {
+			return fmt.Errorf("couldn't parse table of %s: %w", device, err)
+		}
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, device, table.Cipher, dmCryptBackingDevice(table.Device))
+		ch <- prometheus.MustNewConstMetric(c.keySize, prometheus.GaugeValue, float64(table.KeySizeBits), device)
+		ch <- prometheus.MustNewConstMetric(c.sectorSize, prometheus.GaugeValue, float64(table.SectorSize), device)
+		for desc, enabled := range map[*prometheus.Desc]bool{
+			c.allowDiscards:  table.AllowDiscards,
+			c.sameCPUCrypt:   table.SameCPUCrypt,
+			c.readWorkqueue:  table.ReadWorkqueue,
+			c.writeWorkqueue: table.WriteWorkqueue,
+		} {
+			v := 0.0
+			if enabled {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, device)
+		}
+
+		inflight, err := readStringFromFile(filepath.Join(path, "inflight"))
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't read in-flight requests", "device", device, "err", err)
+			continue
+		}
+		fields := strings.Fields(inflight)
+		if len(fields) != 2 {
+			return fmt.Errorf("invalid in-flight requests of %s: %q", device, inflight)
+		}
+		for i, direction := range []string{"read", "write"} {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return fmt.Errorf("invalid in-flight requests of %s: %w", device, err)
+			}
+			ch <- prometheus.MustNewConstMetric(c.inflight, prometheus.GaugeValue, v, device, direction)
+		}
+	}
+	if !found {
+		level.Debug(c.logger).Log("msg", "no dm-crypt devices found, skipping")
+		return ErrNoData
+	}
+
+	return nil
+}
+
+// dmCryptBackingDevice returns the name of the block device with the given
+// major:minor number.
+func dmCryptBackingDevice(dev string) string {
+	target, err := os.Readlink(sysFilePath(filepath.Join("dev/block", dev)))
+	if err != nil {
+		return dev
+	}
+	return filepath.Base(target)
+}
+
+// parseDMCryptTable parses the table line of a dm-crypt target:
+//
+//	<cipher> <key> <iv offset> <device> <offset> [<#opt params> <opt params>]
+//
+// The key is either hex encoded or a reference to the kernel keyring like
+// ":32:logon:cryptsetup:<uuid>", holding the key size in bytes.
+func parseDMCryptTable(line string) (*dmCryptTable, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return nil, fmt.Errorf("too few fields in dm-crypt table")
+	}
+	table := &dmCryptTable{
+		Cipher:         fields[0],
+		Device:         fields[3],
+		SectorSize:     512,
+		ReadWorkqueue:  true,
+		WriteWorkqueue: true,
+	}
+
+	switch key := fields[1]; {
+	case key == "-":
+	case strings.HasPrefix(key, ":"):
+		parts := strings.SplitN(key[1:], ":", 2)
+		size, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key size %q: %w", parts[0], err)
+		}
+		table.KeySizeBits = size * 8
+	default:
+		table.KeySizeBits = uint64(len(key)) * 4
+	}
+
+	if len(fields) == 5 {
+		return table, nil
+	}
+	n, err := strconv.Atoi(fields[5])
+	if err != nil {
+		return nil, fmt.Errorf("invalid number of optional parameters %q: %w", fields[5], err)
+	}
+	if len(fields) < 6+n {
+		return nil, fmt.Errorf("too few optional parameters in dm-crypt table")
+	}
+	for _, param := range fields[6 : 6+n] {
+		switch {
+		case param == "allow_discards":
+			table.AllowDiscards = true
+		case param == "same_cpu_crypt":
+			table.SameCPUCrypt = true
+		case param == "no_read_workqueue":
+			table.ReadWorkqueue = false
+		case param == "no_write_workqueue":
+			table.WriteWorkqueue = false
+		case strings.HasPrefix(param, "sector_size:"):
+			size, err := strconv.ParseUint(strings.TrimPrefix(param, "sector_size:"), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sector size %q: %w", param, err)
+			}
+			table.SectorSize = size
+		}
+	}
+	return table, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nodm_crypt
+
+package collector
+
+import (
+	"testing"
+)
+
+func TestParseDMCryptTable(t *testing.T) {
+	for line, want := range map[string]dmCryptTable{
+		"aes-xts-plain64 :64:logon:cryptsetup:3e1a04f8-ea1a-4c6e-b7b4-6f9c2c2b1a2d-d0 0 259:2 32768 3 allow_discards sector_size:4096 no_read_workqueue": {
+			Cipher:         "aes-xts-plain64",
+			KeySizeBits:    512,
+			Device:         "259:2",
+			SectorSize:     4096,
+			AllowDiscards:  true,
+			WriteWorkqueue: true,
+		},
+		"aes-cbc-essiv:sha256 00000000000000000000000000000000 0 8:2 0": {
+			Cipher:         "aes-cbc-essiv:sha256",
+			KeySizeBits:    128,
+			Device:         "8:2",
+			SectorSize:     512,
+			ReadWorkqueue:  true,
+			WriteWorkqueue: true,
+		},
+	} {
+		got, err := parseDMCryptTable(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != want {
+			t.Errorf("%s: want %+v, got %+v", line, want, *got)
+		}
+	}
+}
+
+func TestMaskDMCryptKey(t *testing.T) {
+	for line, want := range map[string]string{
+		"aes-xts-plain64 a1b2c3d4e5f60718 0 8:2 4096":                  "aes-xts-plain64 0000000000000000 0 8:2 4096",
+		"aes-xts-plain64 :64:logon:cryptsetup:uuid 0 8:2 4096":         "aes-xts-plain64 :64:logon:cryptsetup:uuid 0 8:2 4096",
+		"aes-xts-plain64 a1b2c3d4e5f60718 0 8:2 4096 1 allow_discards": "aes-xts-plain64 0000000000000000 0 8:2 4096 1 allow_discards",
+	} {
+		b := []byte(line)
+		maskDMCryptKey(b)
+		if string(b) != want {
+			t.Errorf("want %q, got %q", want, string(b))
+		}
+	}
+}
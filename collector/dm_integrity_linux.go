@@ -0,0 +1,167 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nodm_integrity
+
+package collector
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dmSubsystem = "dm"
+
+// dmIntegrityStatus is the status of a dm-integrity target.
+type dmIntegrityStatus struct {
+	Mismatches        uint64
+	ProvidedDataBytes uint64
+	Recalculating     bool
+	RecalculatedBytes uint64
+}
+
+type dmIntegrityCollector struct {
+	verityCorrupted     *prometheus.Desc
+	integrityMismatches *prometheus.Desc
+	integrityData       *prometheus.Desc
+	integrityRecalc     *prometheus.Desc
+	logger              log.Logger
+}
+
+func init() {
+	registerCollector("dm_integrity", defaultDisabled, NewDMIntegrityCollector)
+}
+
+// NewDMIntegrityCollector returns a new Collector exposing the corruption
+// detected by dm-verity and dm-integrity targets.
+func NewDMIntegrityCollector(logger log.Logger) (Collector, error) {
+	labels := []string{"device"}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, dmSubsystem, name),
+			help, labels, nil,
+		)
+	}
+	return &dmIntegrityCollector{
+		verityCorrupted:     desc("verity_corrupted", "Whether the dm-verity target detected a corrupted block."),
+		integrityMismatches: desc("integrity_mismatches_total", "Number of integrity mismatches detected by the dm-integrity target."),
+		integrityData:       desc("integrity_provided_data_bytes", "Size of the data provided by the dm-integrity target."),
+		integrityRecalc:     desc("integrity_recalculated_bytes", "Amount of data with recalculated checksums while the dm-integrity target recalculates them."),
+		logger:              logger,
+	}, nil
+}
+
+func (c *dmIntegrityCollector) Update(ch chan<- prometheus.Metric) error {
+	paths, err := filepath.Glob(sysFilePath("block/dm-*"))
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, path := range paths {
+		device, err := readStringFromFile(filepath.Join(path, "dm/name"))
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't read device-mapper name", "path", path, "err", err)
+			continue
+		}
+		targetType, status, err := readDMTarget(device, false)
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't read device-mapper status", "device", device, "err", err)
+			continue
+		}
+
+		switch targetType {
+		case "verity":
+			found = true
+			corrupted, err := parseDMVerityStatus(status)
+			if err != nil {
+				return fmt.Errorf("couldn't parse status of %s: %w", device, err)
+			}
+			v := 0.0
+			if corrupted {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.verityCorrupted, prometheus.GaugeValue, v, device)
+		case "integrity":
+			found = true
+			s, err := parseDMIntegrityStatus(status)
+			if err != nil {
+				return fmt.Errorf("couldn't parse status of %s: %w", device, err)
+			}
+			ch <- prometheus.MustNewConstMetric(c.integrityMismatches, prometheus.CounterValue, float64(s.Mismatches), device)
+			ch <- prometheus.MustNewConstMetric(c.integrityData, prometheus.GaugeValue, float64(s.ProvidedDataBytes), device)
+			if s.Recalculating {
+				ch <- prometheus.MustNewConstMetric(c.integrityRecalc, prometheus.GaugeValue, float64(s.RecalculatedBytes), device)
+			}
+		}
+	}
+	if !found {
+		level.Debug(c.logger).Log("msg", "no dm-verity or dm-integrity devices found, skipping")
+		return ErrNoData
+	}
+
+	return nil
+}
+
+// parseDMVerityStatus parses the status of a dm-verity target, "C" once a
+// corrupted block was detected and "V" otherwise.
+func parseDMVerityStatus(status string) (bool, error) {
+	fields := strings.Fields(status)
+	if len(fields) == 0 {
+		return false, fmt.Errorf("empty dm-verity status")
+	}
+	switch fields[0] {
+	case "V":
+		return false, nil
+	case "C":
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown dm-verity status %q", fields[0])
+}
+
+// parseDMIntegrityStatus parses the status of a dm-integrity target, like
+// "3 2097152 -". The last field is the sector up to which checksums were
+// recalculated, or "-" if they aren't being recalculated.
+func parseDMIntegrityStatus(status string) (*dmIntegrityStatus, error) {
+	fields := strings.Fields(status)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("too few fields in dm-integrity status %q", status)
+	}
+	var (
+		s   dmIntegrityStatus
+		err error
+	)
+	if s.Mismatches, err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid mismatches %q: %w", fields[0], err)
+	}
+	sectors, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid provided data sectors %q: %w", fields[1], err)
+	}
+	s.ProvidedDataBytes = sectors * 512
+	if fields[2] != "-" {
+		recalc, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recalculate sector %q: %w", fields[2], err)
+		}
+		s.Recalculating = true
+		s.RecalculatedBytes = recalc * 512
+	}
+	return &s, nil
+}
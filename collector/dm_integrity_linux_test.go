@@ -0,0 +1,50 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nodm_integrity
+
+package collector
+
+import (
+	"testing"
+)
+
+func TestParseDMVerityStatus(t *testing.T) {
+	for status, want := range map[string]bool{"V": false, "C": true} {
+		got, err := parseDMVerityStatus(status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: want %t, got %t", status, want, got)
+		}
+	}
+	if _, err := parseDMVerityStatus("X"); err == nil {
+		t.Error("expected error for unknown status")
+	}
+}
+
+func TestParseDMIntegrityStatus(t *testing.T) {
+	for status, want := range map[string]dmIntegrityStatus{
+		"0 2093064 -":       {ProvidedDataBytes: 2093064 * 512},
+		"3 2093064 1048576": {Mismatches: 3, ProvidedDataBytes: 2093064 * 512, Recalculating: true, RecalculatedBytes: 1048576 * 512},
+	} {
+		got, err := parseDMIntegrityStatus(status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != want {
+			t.Errorf("%s: want %+v, got %+v", status, want, *got)
+		}
+	}
+}
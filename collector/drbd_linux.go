@@ -19,7 +19,9 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -35,12 +37,12 @@ type drbdNumericalMetric struct {
 	multiplier float64
 }
 
-func newDRBDNumericalMetric(name, desc string, valueType prometheus.ValueType, multiplier float64) drbdNumericalMetric {
+func newDRBDNumericalMetric(name, desc string, valueType prometheus.ValueType, multiplier float64, labels []string) drbdNumericalMetric {
 	return drbdNumericalMetric{
 		desc: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "drbd", name),
 			desc,
-			[]string{"device"},
+			labels,
 			nil,
 		),
 		valueType:  valueType,
@@ -62,23 +64,36 @@ func (m *drbdStringPairMetric) isOkay(v string) float64 {
 	return 0
 }
 
-func newDRBDStringPairMetric(name, desc, valueOK string) drbdStringPairMetric {
+func newDRBDStringPairMetric(name, desc, valueOK string, labels []string) drbdStringPairMetric {
 	return drbdStringPairMetric{
 		desc: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "drbd", name),
 			desc,
-			[]string{"device", "node"},
+			append(labels, "node"),
 			nil,
 		),
 		valueOK: valueOK,
 	}
 }
 
+// drbdMetrics holds the descriptors for one set of device labels.
+type drbdMetrics struct {
+	numerical       map[string]drbdNumericalMetric
+	stringPair      map[string]drbdStringPairMetric
+	connected       *prometheus.Desc
+	connectionState *prometheus.Desc
+	diskState       *prometheus.Desc
+	resyncDone      *prometheus.Desc
+	resyncRemaining *prometheus.Desc
+	resyncSpeed     *prometheus.Desc
+}
+
 type drbdCollector struct {
-	numerical  map[string]drbdNumericalMetric
-	stringPair map[string]drbdStringPairMetric
-	connected  *prometheus.Desc
-	logger     log.Logger
+	// proc is labelled by device only, debugfs additionally by the peer
+	// of the connection as DRBD 9 reports each device once per peer.
+	proc    drbdMetrics
+	debugfs drbdMetrics
+	logger  log.Logger
 }
 
 func init() {
@@ -87,78 +102,104 @@ func init() {
 
 func newDRBDCollector(logger log.Logger) (Collector, error) {
 	return &drbdCollector{
+		proc:    newDRBDMetrics([]string{"device"}),
+		debugfs: newDRBDMetrics([]string{"device", "peer"}),
+		logger:  logger,
+	}, nil
+}
+
+func newDRBDMetrics(labels []string) drbdMetrics {
+	// withLabels returns a copy of labels followed by extra, so the
+	// descriptors don't share a backing array.
+	withLabels := func(extra ...string) []string {
+		return append(append([]string{}, labels...), extra...)
+	}
+
+	return drbdMetrics{
 		numerical: map[string]drbdNumericalMetric{
 			"ns": newDRBDNumericalMetric(
 				"network_sent_bytes_total",
 				"Total number of bytes sent via the network.",
 				prometheus.CounterValue,
 				1024,
+				withLabels(),
 			),
 			"nr": newDRBDNumericalMetric(
 				"network_received_bytes_total",
 				"Total number of bytes received via the network.",
 				prometheus.CounterValue,
 				1,
+				withLabels(),
 			),
 			"dw": newDRBDNumericalMetric(
 				"disk_written_bytes_total",
 				"Net data written on local hard disk; in bytes.",
 				prometheus.CounterValue,
 				1024,
+				withLabels(),
 			),
 			"dr": newDRBDNumericalMetric(
 				"disk_read_bytes_total",
 				"Net data read from local hard disk; in bytes.",
 				prometheus.CounterValue,
 				1024,
+				withLabels(),
 			),
 			"al": newDRBDNumericalMetric(
 				"activitylog_writes_total",
 				"Number of updates of the activity log area of the meta data.",
 				prometheus.CounterValue,
 				1,
+				withLabels(),
 			),
 			"bm": newDRBDNumericalMetric(
 				"bitmap_writes_total",
 				"Number of updates of the bitmap area of the meta data.",
 				prometheus.CounterValue,
 				1,
+				withLabels(),
 			),
 			"lo": newDRBDNumericalMetric(
 				"local_pending",
 				"Number of open requests to the local I/O sub-system.",
 				prometheus.GaugeValue,
 				1,
+				withLabels(),
 			),
 			"pe": newDRBDNumericalMetric(
 				"remote_pending",
 				"Number of requests sent to the peer, but that have not yet been answered by the latter.",
 				prometheus.GaugeValue,
 				1,
+				withLabels(),
 			),
 			"ua": newDRBDNumericalMetric(
 				"remote_unacknowledged",
 				"Number of requests received by the peer via the network connection, but that have not yet been answered.",
 				prometheus.GaugeValue,
 				1,
+				withLabels(),
 			),
 			"ap": newDRBDNumericalMetric(
 				"application_pending",
 				"Number of block I/O requests forwarded to DRBD, but not yet answered by DRBD.",
 				prometheus.GaugeValue,
 				1,
+				withLabels(),
 			),
 			"ep": newDRBDNumericalMetric(
 				"epochs",
 				"Number of Epochs currently on the fly.",
 				prometheus.GaugeValue,
 				1,
+				withLabels(),
 			),
 			"oos": newDRBDNumericalMetric(
 				"out_of_sync_bytes",
 				"Amount of data known to be out of sync; in bytes.",
 				prometheus.GaugeValue,
 				1024,
+				withLabels(),
 			),
 		},
 
@@ -167,22 +208,53 @@ func newDRBDCollector(logger log.Logger) (Collector, error) {
 				"node_role_is_primary",
 				"Whether the role of the node is in the primary state.",
 				"Primary",
+				withLabels(),
 			),
 			"ds": newDRBDStringPairMetric(
 				"disk_state_is_up_to_date",
 				"Whether the disk of the node is up to date.",
 				"UpToDate",
+				withLabels(),
 			),
 		},
 
 		connected: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "drbd", "connected"),
 			"Whether DRBD is connected to the peer.",
-			[]string{"device"},
+			withLabels(),
 			nil,
 		),
-		logger: logger,
-	}, nil
+		connectionState: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "drbd", "connection_state"),
+			"Connection state of the device, value is always 1.",
+			withLabels("state"),
+			nil,
+		),
+		diskState: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "drbd", "disk_state"),
+			"Disk state of the node, value is always 1.",
+			withLabels("node", "state"),
+			nil,
+		),
+		resyncDone: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "drbd", "resync_done_ratio"),
+			"Fraction of the running resynchronization that is done.",
+			withLabels(),
+			nil,
+		),
+		resyncRemaining: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "drbd", "resync_remaining_seconds"),
+			"Estimated time until the running resynchronization finishes.",
+			withLabels(),
+			nil,
+		),
+		resyncSpeed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "drbd", "resync_speed_bytes_per_second"),
+			"Current speed of the running resynchronization in bytes per second.",
+			withLabels(),
+			nil,
+		),
+	}
 }
 
 func (c *drbdCollector) Update(ch chan<- prometheus.Metric) error {
@@ -198,13 +270,66 @@ func (c *drbdCollector) Update(ch chan<- prometheus.Metric) error {
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	found, err := c.updateStats(file, &c.proc, nil, ch)
+	if err != nil || found {
+		return err
+	}
+
+	// DRBD 9 only reports the version in /proc/drbd, the per device
+	// statistics moved to debugfs. There is one file per volume and peer,
+	// resources/<resource>/connections/<peer>/<volume>/proc_drbd.
+	debugFiles, err := filepath.Glob(sysFilePath("kernel/debug/drbd/resources/*/connections/*/*/proc_drbd"))
+	if err != nil {
+		return err
+	}
+	for _, debugFile := range debugFiles {
+		f, err := os.Open(debugFile)
+		if err != nil {
+			return err
+		}
+		peer := filepath.Base(filepath.Dir(filepath.Dir(debugFile)))
+		_, err = c.updateStats(f, &c.debugfs, []string{peer}, ch)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateStats parses the per device statistics in the /proc/drbd format from
+// r and reports whether any device was found. The labels are added after the
+// device label of each metric.
+func (c *drbdCollector) updateStats(r io.Reader, m *drbdMetrics, labels []string, ch chan<- prometheus.Metric) (bool, error) {
+	scanner := bufio.NewScanner(r)
 	scanner.Split(bufio.ScanWords)
 	device := "unknown"
+	found := false
+	labelValues := func(extra ...string) []string {
+		return append(append([]string{device}, labels...), extra...)
+	}
+	// Resync progress is reported as "sync'ed: 15.3% (6520/7688)M
+	// finish: 0:04:12 speed: 26,300 (25,560) K/sec", the value follows
+	// the key as a separate word.
+	resyncKey := ""
 
 	for scanner.Scan() {
 		field := scanner.Text()
 
+		if resyncKey != "" {
+			if err := updateDRBDResync(resyncKey, field, m, labelValues(), ch); err != nil {
+				level.Debug(c.logger).Log("msg", "skipping invalid resync value", "key", resyncKey, "value", field, "err", err)
+			}
+			resyncKey = ""
+			continue
+		}
+		switch field {
+		case "sync'ed:", "finish:", "speed:":
+			resyncKey = strings.TrimSuffix(field, ":")
+			continue
+		}
+
 		kv := strings.Split(field, ":")
 		if len(kv) != 2 {
 			level.Debug(c.logger).Log("msg", "skipping invalid key:value pair", "field", field)
@@ -214,45 +339,49 @@ func (c *drbdCollector) Update(ch chan<- prometheus.Metric) error {
 		if id, err := strconv.ParseUint(kv[0], 10, 64); err == nil && kv[1] == "" {
 			// New DRBD device encountered.
 			device = fmt.Sprintf("drbd%d", id)
+			found = true
 			continue
 		}
 
-		if m, ok := c.numerical[kv[0]]; ok {
+		if n, ok := m.numerical[kv[0]]; ok {
 			// Numerical value.
 			v, err := strconv.ParseFloat(kv[1], 64)
 			if err != nil {
-				return err
+				return found, err
 			}
 
 			ch <- prometheus.MustNewConstMetric(
-				m.desc,
-				m.valueType,
-				v*m.multiplier,
-				device,
+				n.desc,
+				n.valueType,
+				v*n.multiplier,
+				labelValues()...,
 			)
 
 			continue
 		}
 
-		if m, ok := c.stringPair[kv[0]]; ok {
+		if p, ok := m.stringPair[kv[0]]; ok {
 			// String pair value.
 			values := strings.Split(kv[1], "/")
 			ch <- prometheus.MustNewConstMetric(
-				m.desc,
+				p.desc,
 				prometheus.GaugeValue,
-				m.isOkay(values[0]),
-				device,
-				"local",
+				p.isOkay(values[0]),
+				labelValues("local")...,
 			)
 
 			ch <- prometheus.MustNewConstMetric(
-				m.desc,
+				p.desc,
 				prometheus.GaugeValue,
-				m.isOkay(values[1]),
-				device,
-				"remote",
+				p.isOkay(values[1]),
+				labelValues("remote")...,
 			)
 
+			if kv[0] == "ds" {
+				ch <- prometheus.MustNewConstMetric(m.diskState, prometheus.GaugeValue, 1, labelValues("local", values[0])...)
+				ch <- prometheus.MustNewConstMetric(m.diskState, prometheus.GaugeValue, 1, labelValues("remote", values[1])...)
+			}
+
 			continue
 		}
 
@@ -264,11 +393,12 @@ func (c *drbdCollector) Update(ch chan<- prometheus.Metric) error {
 			}
 
 			ch <- prometheus.MustNewConstMetric(
-				c.connected,
+				m.connected,
 				prometheus.GaugeValue,
 				connected,
-				device,
+				labelValues()...,
 			)
+			ch <- prometheus.MustNewConstMetric(m.connectionState, prometheus.GaugeValue, 1, labelValues(kv[1])...)
 
 			continue
 		}
@@ -276,5 +406,34 @@ func (c *drbdCollector) Update(ch chan<- prometheus.Metric) error {
 		level.Debug(c.logger).Log("msg", "unhandled key-value pair", "key", kv[0], "value", kv[1])
 	}
 
-	return scanner.Err()
+	return found, scanner.Err()
+}
+
+func updateDRBDResync(key, value string, m *drbdMetrics, labels []string, ch chan<- prometheus.Metric) error {
+	switch key {
+	case "sync'ed":
+		v, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return err
+		}
+		ch <- prometheus.MustNewConstMetric(m.resyncDone, prometheus.GaugeValue, v/100, labels...)
+	case "finish":
+		var seconds float64
+		for _, part := range strings.Split(value, ":") {
+			v, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return err
+			}
+			seconds = seconds*60 + v
+		}
+		ch <- prometheus.MustNewConstMetric(m.resyncRemaining, prometheus.GaugeValue, seconds, labels...)
+	case "speed":
+		// Reported in K/sec with thousands separators.
+		v, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64)
+		if err != nil {
+			return err
+		}
+		ch <- prometheus.MustNewConstMetric(m.resyncSpeed, prometheus.GaugeValue, v*1024, labels...)
+	}
+	return nil
 }
@@ -0,0 +1,21 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build armbe arm64be mips mips64 mips64p32 ppc ppc64 s390 s390x sparc sparc64
+
+package collector
+
+import "encoding/binary"
+
+// nativeEndian is the byte order of structs shared with the kernel.
+var nativeEndian binary.ByteOrder = binary.BigEndian
@@ -0,0 +1,116 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noext4
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const ext4Subsystem = "ext4"
+
+type ext4Collector struct {
+	errors         *prometheus.Desc
+	firstErrorTime *prometheus.Desc
+	lastErrorTime  *prometheus.Desc
+	writtenBytes   *prometheus.Desc
+	logger         log.Logger
+}
+
+func init() {
+	registerCollector("ext4", defaultDisabled, NewExt4Collector)
+}
+
+// NewExt4Collector returns a new Collector exposing ext4 error and lifetime
+// write counters.
+func NewExt4Collector(logger log.Logger) (Collector, error) {
+	labels := []string{"device"}
+	return &ext4Collector{
+		errors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, ext4Subsystem, "errors_total"),
+			"Number of errors detected on the filesystem.",
+			labels, nil,
+		),
+		firstErrorTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, ext4Subsystem, "first_error_time_seconds"),
+			"Time of the first error detected on the filesystem, 0 if there was none.",
+			labels, nil,
+		),
+		lastErrorTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, ext4Subsystem, "last_error_time_seconds"),
+			"Time of the last error detected on the filesystem, 0 if there was none.",
+			labels, nil,
+		),
+		writtenBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, ext4Subsystem, "lifetime_written_bytes_total"),
+			"Number of bytes written to the filesystem over its lifetime.",
+			labels, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *ext4Collector) Update(ch chan<- prometheus.Metric) error {
+	paths, err := filepath.Glob(sysFilePath("fs/ext4/*/lifetime_write_kbytes"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		level.Debug(c.logger).Log("msg", "no ext4 filesystems found, skipping")
+		return ErrNoData
+	}
+
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		device := filepath.Base(dir)
+
+		written, err := readUintFromFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// The filesystem was unmounted in the meantime.
+				continue
+			}
+			return fmt.Errorf("couldn't get lifetime writes of %s: %w", device, err)
+		}
+		ch <- prometheus.MustNewConstMetric(c.writtenBytes, prometheus.CounterValue, float64(written*1024), device)
+
+		for _, m := range []struct {
+			file      string
+			desc      *prometheus.Desc
+			valueType prometheus.ValueType
+		}{
+			{"errors_count", c.errors, prometheus.CounterValue},
+			{"first_error_time", c.firstErrorTime, prometheus.GaugeValue},
+			{"last_error_time", c.lastErrorTime, prometheus.GaugeValue},
+		} {
+			v, err := readUintFromFile(filepath.Join(dir, m.file))
+			if err != nil {
+				// The error attributes were added in Linux 3.6.
+				level.Debug(c.logger).Log("msg", "couldn't read ext4 attribute", "device", device, "file", m.file, "err", err)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, float64(v), device)
+		}
+	}
+
+	return nil
+}
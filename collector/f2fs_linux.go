@@ -0,0 +1,102 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nof2fs
+
+package collector
+
+import (
+	"path/filepath"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const f2fsSubsystem = "f2fs"
+
+// f2fsMetric is a numeric attribute of /sys/fs/f2fs/<device>.
+type f2fsMetric struct {
+	file       string
+	desc       *prometheus.Desc
+	valueType  prometheus.ValueType
+	multiplier float64
+}
+
+type f2fsCollector struct {
+	metrics []f2fsMetric
+	logger  log.Logger
+}
+
+func init() {
+	registerCollector("f2fs", defaultDisabled, NewF2FSCollector)
+}
+
+// NewF2FSCollector returns a new Collector exposing f2fs statistics.
+func NewF2FSCollector(logger log.Logger) (Collector, error) {
+	metric := func(file, name, help string, valueType prometheus.ValueType, multiplier float64) f2fsMetric {
+		return f2fsMetric{
+			file: file,
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, f2fsSubsystem, name),
+				help,
+				[]string{"device"}, nil,
+			),
+			valueType:  valueType,
+			multiplier: multiplier,
+		}
+	}
+	return &f2fsCollector{
+		metrics: []f2fsMetric{
+			metric("dirty_segments", "dirty_segments", "Number of dirty segments.", prometheus.GaugeValue, 1),
+			metric("free_segments", "free_segments", "Number of free segments.", prometheus.GaugeValue, 1),
+			metric("lifetime_write_kbytes", "lifetime_written_bytes_total", "Number of bytes written to the filesystem over its lifetime.", prometheus.CounterValue, 1024),
+			metric("gc_foreground_calls", "gc_foreground_calls_total", "Number of foreground garbage collection calls.", prometheus.CounterValue, 1),
+			metric("gc_background_calls", "gc_background_calls_total", "Number of background garbage collection calls.", prometheus.CounterValue, 1),
+			metric("moved_blocks_foreground", "gc_foreground_moved_blocks", "Number of blocks moved by foreground garbage collection in the last round.", prometheus.GaugeValue, 1),
+			metric("moved_blocks_background", "gc_background_moved_blocks", "Number of blocks moved by background garbage collection in the last round.", prometheus.GaugeValue, 1),
+			metric("avg_vblocks", "average_valid_blocks", "Average number of valid blocks in dirty segments.", prometheus.GaugeValue, 1),
+			metric("unusable", "unusable_blocks", "Number of blocks unusable in checkpoint=disable mode.", prometheus.GaugeValue, 1),
+		},
+		logger: logger,
+	}, nil
+}
+
+func (c *f2fsCollector) Update(ch chan<- prometheus.Metric) error {
+	// /sys/fs/f2fs also contains a features directory, only consider
+	// directories of mounted filesystems.
+	paths, err := filepath.Glob(sysFilePath("fs/f2fs/*/dirty_segments"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		level.Debug(c.logger).Log("msg", "no f2fs filesystems found, skipping")
+		return ErrNoData
+	}
+
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		device := filepath.Base(dir)
+		for _, m := range c.metrics {
+			// Available attributes depend on the kernel version.
+			v, err := readUintFromFile(filepath.Join(dir, m.file))
+			if err != nil {
+				level.Debug(c.logger).Log("msg", "couldn't read f2fs attribute", "device", device, "file", m.file, "err", err)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(m.desc, m.valueType, float64(v)*m.multiplier, device)
+		}
+	}
+
+	return nil
+}
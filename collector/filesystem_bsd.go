@@ -37,6 +37,9 @@ const (
 	readOnly              = 0x1 // MNT_RDONLY
 )
 
+// The freeze state of filesystems isn't detected.
+func filesystemFreezeDetection() bool { return false }
+
 // Expose filesystem fullness.
 func (c *filesystemCollector) GetStats() (stats []filesystemStats, err error) {
 	var mntbuf *C.struct_statfs
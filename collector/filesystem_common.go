@@ -29,6 +29,7 @@ import (
 // * defIgnoredMountPoints
 // * defIgnoredFSTypes
 // * filesystemLabelNames
+// * filesystemFreezeDetection
 // * filesystemCollector.GetStats
 
 var (
@@ -50,11 +51,12 @@ type filesystemCollector struct {
 	sizeDesc, freeDesc, availDesc *prometheus.Desc
 	filesDesc, filesFreeDesc      *prometheus.Desc
 	roDesc, deviceErrorDesc       *prometheus.Desc
+	mountInfoDesc, frozenDesc     *prometheus.Desc
 	logger                        log.Logger
 }
 
 type filesystemLabels struct {
-	device, mountPoint, fsType, options string
+	device, mountPoint, fsType, options, propagation string
 }
 
 type filesystemStats struct {
@@ -62,6 +64,7 @@ type filesystemStats struct {
 	size, free, avail float64
 	files, filesFree  float64
 	ro, deviceError   float64
+	frozen            float64
 }
 
 func init() {
@@ -118,6 +121,18 @@ func NewFilesystemCollector(logger log.Logger) (Collector, error) {
 		filesystemLabelNames, nil,
 	)
 
+	frozenDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "frozen"),
+		"Whether the filesystem is frozen and blocks writes.",
+		filesystemLabelNames, nil,
+	)
+
+	mountInfoDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "mount_info"),
+		"Mount options and propagation type of the filesystem, value is always 1.",
+		append(filesystemLabelNames, "options", "propagation"), nil,
+	)
+
 	return &filesystemCollector{
 		ignoredMountPointsPattern: mountPointPattern,
 		ignoredFSTypesPattern:     filesystemsTypesPattern,
@@ -128,6 +143,8 @@ func NewFilesystemCollector(logger log.Logger) (Collector, error) {
 		filesFreeDesc:             filesFreeDesc,
 		roDesc:                    roDesc,
 		deviceErrorDesc:           deviceErrorDesc,
+		mountInfoDesc:             mountInfoDesc,
+		frozenDesc:                frozenDesc,
 		logger:                    logger,
 	}, nil
 }
@@ -145,6 +162,10 @@ func (c *filesystemCollector) Update(ch chan<- prometheus.Metric) error {
 		}
 		seen[s.labels] = true
 
+		ch <- prometheus.MustNewConstMetric(
+			c.mountInfoDesc, prometheus.GaugeValue,
+			1, s.labels.device, s.labels.mountPoint, s.labels.fsType, s.labels.options, s.labels.propagation,
+		)
 		ch <- prometheus.MustNewConstMetric(
 			c.deviceErrorDesc, prometheus.GaugeValue,
 			s.deviceError, s.labels.device, s.labels.mountPoint, s.labels.fsType,
@@ -177,6 +198,12 @@ func (c *filesystemCollector) Update(ch chan<- prometheus.Metric) error {
 			c.roDesc, prometheus.GaugeValue,
 			s.ro, s.labels.device, s.labels.mountPoint, s.labels.fsType,
 		)
+		if filesystemFreezeDetection() {
+			ch <- prometheus.MustNewConstMetric(
+				c.frozenDesc, prometheus.GaugeValue,
+				s.frozen, s.labels.device, s.labels.mountPoint, s.labels.fsType,
+			)
+		}
 	}
 	return nil
 }
@@ -27,6 +27,9 @@ const (
 	noWait                = 0x2 // MNT_NOWAIT
 )
 
+// The freeze state of filesystems isn't detected.
+func filesystemFreezeDetection() bool { return false }
+
 // Expose filesystem fullness.
 func (c *filesystemCollector) GetStats() ([]filesystemStats, error) {
 	n, err := unix.Getfsstat(nil, noWait)
@@ -27,6 +27,7 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/procfs"
 	"golang.org/x/sys/unix"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
@@ -42,12 +43,29 @@ var mountTimeout = kingpin.Flag("collector.filesystem.mount-timeout",
 var stuckMounts = make(map[string]struct{})
 var stuckMountsMtx = &sync.Mutex{}
 
+var freezeDetection = kingpin.Flag("collector.filesystem.freeze-detection",
+	"Enable node_filesystem_frozen, probes whether filesystems on block devices admit writes.").
+	Default("false").Bool()
+var freezeTimeout = kingpin.Flag("collector.filesystem.freeze-timeout",
+	"how long to wait for writes to the mounts to be admitted before marking them as frozen").
+	Hidden().Default("1s").Duration()
+var frozenMounts = make(map[string]struct{})
+var frozenMountsMtx = &sync.Mutex{}
+
+// filesystemFreezeProbeXattr is the extended attribute the freeze probe
+// tries to replace, it is never set.
+const filesystemFreezeProbeXattr = "user.node_exporter.freeze_probe"
+
 // GetStats returns filesystem stats.
 func (c *filesystemCollector) GetStats() ([]filesystemStats, error) {
 	mps, err := mountPointDetails(c.logger)
 	if err != nil {
 		return nil, err
 	}
+	var frozenState map[string]bool
+	if *freezeDetection {
+		frozenState = frozenMountPoints(c.blockDeviceMountPoints(mps), c.logger)
+	}
 	stats := []filesystemStats{}
 	for _, labels := range mps {
 		if c.ignoredMountPointsPattern.MatchString(labels.mountPoint) {
@@ -104,6 +122,11 @@ func (c *filesystemCollector) GetStats() ([]filesystemStats, error) {
 			}
 		}
 
+		var frozen float64
+		if frozenState[labels.mountPoint] {
+			frozen = 1
+		}
+
 		stats = append(stats, filesystemStats{
 			labels:    labels,
 			size:      float64(buf.Blocks) * float64(buf.Bsize),
@@ -112,11 +135,99 @@ func (c *filesystemCollector) GetStats() ([]filesystemStats, error) {
 			files:     float64(buf.Files),
 			filesFree: float64(buf.Ffree),
 			ro:        ro,
+			frozen:    frozen,
 		})
 	}
 	return stats, nil
 }
 
+// filesystemFreezeDetection enables node_filesystem_frozen.
+func filesystemFreezeDetection() bool {
+	return *freezeDetection
+}
+
+// blockDeviceMountPoints returns the mount points which aren't ignored and
+// are backed by block devices, only those filesystems can be frozen.
+func (c *filesystemCollector) blockDeviceMountPoints(mps []filesystemLabels) []string {
+	var mountPoints []string
+	for _, labels := range mps {
+		if c.ignoredMountPointsPattern.MatchString(labels.mountPoint) ||
+			c.ignoredFSTypesPattern.MatchString(labels.fsType) ||
+			!strings.HasPrefix(labels.device, "/dev/") {
+			continue
+		}
+		mountPoints = append(mountPoints, labels.mountPoint)
+	}
+	return mountPoints
+}
+
+// frozenMountPoints reports which mount points block writes, as they do
+// while the filesystem is frozen. The kernel doesn't expose the freeze state,
+// so a probe replaces an extended attribute which doesn't exist. This fails
+// without modifying the filesystem, but only after write access to it was
+// granted. The probes run concurrently and share a single timeout. A probe
+// blocking until the filesystem is thawed is kept running and no new probe
+// is started for that mount point in the meantime, so at most one goroutine
+// per frozen mount point is pending.
+func frozenMountPoints(mountPoints []string, logger log.Logger) map[string]bool {
+	frozen := make(map[string]bool)
+	probes := make(map[string]chan struct{})
+
+	frozenMountsMtx.Lock()
+	for _, mountPoint := range mountPoints {
+		if _, ok := probes[mountPoint]; ok {
+			continue
+		}
+		if _, ok := frozenMounts[mountPoint]; ok {
+			level.Debug(logger).Log("msg", "Mount point is still frozen", "mountpoint", mountPoint)
+			frozen[mountPoint] = true
+			continue
+		}
+		done := make(chan struct{})
+		probes[mountPoint] = done
+		go freezeProbe(mountPoint, done, logger)
+	}
+	frozenMountsMtx.Unlock()
+
+	timer := time.NewTimer(*freezeTimeout)
+	defer timer.Stop()
+wait:
+	for _, done := range probes {
+		select {
+		case <-done:
+		case <-timer.C:
+			break wait
+		}
+	}
+
+	frozenMountsMtx.Lock()
+	defer frozenMountsMtx.Unlock()
+	for mountPoint, done := range probes {
+		select {
+		case <-done:
+		default:
+			level.Debug(logger).Log("msg", "Mount point blocks writes, it is being labeled as frozen", "mountpoint", mountPoint)
+			frozenMounts[mountPoint] = struct{}{}
+			frozen[mountPoint] = true
+		}
+	}
+	return frozen
+}
+
+// freezeProbe closes done once writes to the mount point were admitted and
+// unmarks the mount point as frozen.
+func freezeProbe(mountPoint string, done chan struct{}, logger log.Logger) {
+	// Any error but blocking means writes were admitted.
+	unix.Setxattr(rootfsFilePath(mountPoint), filesystemFreezeProbeXattr, nil, unix.XATTR_REPLACE)
+	frozenMountsMtx.Lock()
+	defer frozenMountsMtx.Unlock()
+	if _, ok := frozenMounts[mountPoint]; ok {
+		level.Debug(logger).Log("msg", "Mount point was thawed", "mountpoint", mountPoint)
+		delete(frozenMounts, mountPoint)
+	}
+	close(done)
+}
+
 // stuckMountWatcher listens on the given success channel and if the channel closes
 // then the watcher does nothing. If instead the timeout is reached, the
 // mount point that is being watched is marked as stuck.
@@ -150,7 +261,60 @@ func mountPointDetails(logger log.Logger) ([]filesystemLabels, error) {
 	}
 	defer file.Close()
 
-	return parseFilesystemLabels(file)
+	filesystems, err := parseFilesystemLabels(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Propagation types are only listed in mountinfo.
+	propagation, err := mountPointPropagation()
+	if err != nil {
+		level.Debug(logger).Log("msg", "Reading mount propagation failed", "err", err)
+		return filesystems, nil
+	}
+	for i := range filesystems {
+		filesystems[i].propagation = propagation[filesystems[i].mountPoint]
+	}
+	return filesystems, nil
+}
+
+// mountPointPropagation returns the propagation type of each mount point,
+// the last mount wins for stacked mounts like in /proc/1/mounts.
+func mountPointPropagation() (map[string]string, error) {
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return nil, err
+	}
+	proc, err := fs.Proc(1)
+	if err != nil {
+		// Fallback to our own mount namespace if /proc/1 is hidden.
+		if proc, err = fs.Self(); err != nil {
+			return nil, err
+		}
+	}
+	mounts, err := proc.MountInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	propagation := make(map[string]string, len(mounts))
+	for _, m := range mounts {
+		var types []string
+		if _, ok := m.OptionalFields["shared"]; ok {
+			types = append(types, "shared")
+		}
+		if _, ok := m.OptionalFields["master"]; ok {
+			types = append(types, "slave")
+		}
+		if _, ok := m.OptionalFields["unbindable"]; ok {
+			types = append(types, "unbindable")
+		}
+		if len(types) == 0 {
+			types = append(types, "private")
+		}
+		propagation[rootfsStripPrefix(unescapeMountPoint(m.MountPoint))] = strings.Join(types, ",")
+	}
+	return propagation, nil
 }
 
 func parseFilesystemLabels(r io.Reader) ([]filesystemLabels, error) {
@@ -164,14 +328,9 @@ func parseFilesystemLabels(r io.Reader) ([]filesystemLabels, error) {
 			return nil, fmt.Errorf("malformed mount point information: %q", scanner.Text())
 		}
 
-		// Ensure we handle the translation of \040 and \011
-		// as per fstab(5).
-		parts[1] = strings.Replace(parts[1], "\\040", " ", -1)
-		parts[1] = strings.Replace(parts[1], "\\011", "\t", -1)
-
 		filesystems = append(filesystems, filesystemLabels{
 			device:     parts[0],
-			mountPoint: rootfsStripPrefix(parts[1]),
+			mountPoint: rootfsStripPrefix(unescapeMountPoint(parts[1])),
 			fsType:     parts[2],
 			options:    parts[3],
 		})
@@ -179,3 +338,10 @@ func parseFilesystemLabels(r io.Reader) ([]filesystemLabels, error) {
 
 	return filesystems, scanner.Err()
 }
+
+// unescapeMountPoint handles the translation of \040 and \011 as per
+// fstab(5).
+func unescapeMountPoint(mountPoint string) string {
+	mountPoint = strings.Replace(mountPoint, "\\040", " ", -1)
+	return strings.Replace(mountPoint, "\\011", "\t", -1)
+}
@@ -139,3 +139,33 @@ func TestPathRootfs(t *testing.T) {
 		}
 	}
 }
+
+func TestMountPointPropagation(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--path.procfs", "./fixtures/proc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"/":               "shared",
+		"/boot":           "shared,slave",
+		"/dev/shm":        "shared",
+		"/run/lock":       "",
+		"/run/rpc_pipefs": "private",
+		"/var/lib/kubelet/plugins/kubernetes.io/vsphere-volume/mounts/[vsanDatastore] bafb9e5a-8856-7e6c-699c-801844e77a4a/kubernetes-dynamic-pvc-3eba5bba-48a3-11e8-89ab-005056b92113.vmdk": "unbindable",
+	}
+
+	filesystems, err := mountPointDetails(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fs := range filesystems {
+		want, ok := expected[fs.mountPoint]
+		if !ok {
+			continue
+		}
+		if fs.propagation != want {
+			t.Errorf("want propagation %q for %s, got %q", want, fs.mountPoint, fs.propagation)
+		}
+	}
+}
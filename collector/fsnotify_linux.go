@@ -0,0 +1,210 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nofsnotify
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+const (
+	fsnotifySubsystem = "fsnotify"
+
+	// Link targets of inotify and fanotify file descriptors in
+	// /proc/<pid>/fd.
+	inotifyFileTarget  = "anon_inode:inotify"
+	fanotifyFileTarget = "anon_inode:[fanotify]"
+)
+
+// fsnotifyUsage is the number of inotify instances and fanotify groups of a
+// process or user, and the watches or marks they hold.
+type fsnotifyUsage struct {
+	InotifyInstances uint64
+	InotifyWatches   uint64
+	FanotifyGroups   uint64
+	FanotifyMarks    uint64
+}
+
+type fsnotifyCollector struct {
+	fs                  procfs.FS
+	inotifyInstances    *prometheus.Desc
+	inotifyWatches      *prometheus.Desc
+	inotifyMaxInstances *prometheus.Desc
+	inotifyMaxWatches   *prometheus.Desc
+	fanotifyGroups      *prometheus.Desc
+	fanotifyMarks       *prometheus.Desc
+	fanotifyMaxGroups   *prometheus.Desc
+	fanotifyMaxMarks    *prometheus.Desc
+	logger              log.Logger
+}
+
+func init() {
+	registerCollector("fsnotify", defaultDisabled, NewFsnotifyCollector)
+}
+
+// NewFsnotifyCollector returns a new Collector exposing inotify and fanotify
+// usage per user and the per user limits.
+func NewFsnotifyCollector(logger log.Logger) (Collector, error) {
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open procfs: %w", err)
+	}
+
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, fsnotifySubsystem, name),
+			help, labels, nil,
+		)
+	}
+	return &fsnotifyCollector{
+		fs:                  fs,
+		inotifyInstances:    desc("inotify_instances", "Number of inotify instances held by processes of the user.", "uid"),
+		inotifyWatches:      desc("inotify_watches", "Number of inotify watches held by processes of the user.", "uid"),
+		inotifyMaxInstances: desc("inotify_max_user_instances", "Maximum number of inotify instances per user."),
+		inotifyMaxWatches:   desc("inotify_max_user_watches", "Maximum number of inotify watches per user."),
+		fanotifyGroups:      desc("fanotify_groups", "Number of fanotify groups held by processes of the user.", "uid"),
+		fanotifyMarks:       desc("fanotify_marks", "Number of fanotify marks held by processes of the user.", "uid"),
+		fanotifyMaxGroups:   desc("fanotify_max_user_groups", "Maximum number of fanotify groups per user."),
+		fanotifyMaxMarks:    desc("fanotify_max_user_marks", "Maximum number of fanotify marks per user."),
+		logger:              logger,
+	}, nil
+}
+
+func (c *fsnotifyCollector) Update(ch chan<- prometheus.Metric) error {
+	for path, desc := range map[string]*prometheus.Desc{
+		"sys/fs/inotify/max_user_instances": c.inotifyMaxInstances,
+		"sys/fs/inotify/max_user_watches":   c.inotifyMaxWatches,
+		// Added in Linux 5.13.
+		"sys/fs/fanotify/max_user_groups": c.fanotifyMaxGroups,
+		"sys/fs/fanotify/max_user_marks":  c.fanotifyMaxMarks,
+	} {
+		v, err := readUintFromFile(procFilePath(path))
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't read limit", "path", path, "err", err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(v))
+	}
+
+	procs, err := c.fs.AllProcs()
+	if err != nil {
+		return fmt.Errorf("unable to list processes: %w", err)
+	}
+
+	// The kernel accounts instances to the real user ID of the creating
+	// process, file descriptors passed on to other processes are counted
+	// once per process.
+	usage := make(map[string]*fsnotifyUsage)
+	for _, p := range procs {
+		u, err := readFsnotifyUsage(procFilePath(strconv.Itoa(p.PID)))
+		if err != nil {
+			// Processes can vanish and file descriptors of other
+			// users' processes are not readable without privileges.
+			level.Debug(c.logger).Log("msg", "couldn't read fsnotify usage", "pid", p.PID, "err", err)
+			continue
+		}
+		if *u == (fsnotifyUsage{}) {
+			continue
+		}
+
+		status, err := p.NewStatus()
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't read process status", "pid", p.PID, "err", err)
+			continue
+		}
+		uid := status.UIDs[0]
+		total, ok := usage[uid]
+		if !ok {
+			total = &fsnotifyUsage{}
+			usage[uid] = total
+		}
+		total.InotifyInstances += u.InotifyInstances
+		total.InotifyWatches += u.InotifyWatches
+		total.FanotifyGroups += u.FanotifyGroups
+		total.FanotifyMarks += u.FanotifyMarks
+	}
+
+	for uid, u := range usage {
+		ch <- prometheus.MustNewConstMetric(c.inotifyInstances, prometheus.GaugeValue, float64(u.InotifyInstances), uid)
+		ch <- prometheus.MustNewConstMetric(c.inotifyWatches, prometheus.GaugeValue, float64(u.InotifyWatches), uid)
+		ch <- prometheus.MustNewConstMetric(c.fanotifyGroups, prometheus.GaugeValue, float64(u.FanotifyGroups), uid)
+		ch <- prometheus.MustNewConstMetric(c.fanotifyMarks, prometheus.GaugeValue, float64(u.FanotifyMarks), uid)
+	}
+
+	return nil
+}
+
+// readFsnotifyUsage returns the inotify and fanotify usage of the process
+// with the given /proc/<pid> directory.
+func readFsnotifyUsage(procDir string) (*fsnotifyUsage, error) {
+	var usage fsnotifyUsage
+	err := walkProcFds(procDir, func(f procFd) error {
+		if f.target != inotifyFileTarget && f.target != fanotifyFileTarget {
+			return nil
+		}
+		var marks uint64
+		err := f.readFdinfo(func(r io.Reader) (err error) {
+			marks, err = countFsnotifyMarks(r)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if f.target == inotifyFileTarget {
+			usage.InotifyInstances++
+			usage.InotifyWatches += marks
+		} else {
+			usage.FanotifyGroups++
+			usage.FanotifyMarks += marks
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// countFsnotifyMarks counts the "inotify wd:" and "fanotify ino:", "mnt_id:"
+// or "sdev:" lines of an inotify or fanotify fdinfo.
+func countFsnotifyMarks(r io.Reader) (uint64, error) {
+	var marks uint64
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "inotify":
+			marks++
+		case "fanotify":
+			// The first line holds the flags of the group.
+			if !strings.HasPrefix(fields[1], "flags:") {
+				marks++
+			}
+		}
+	}
+	return marks, scanner.Err()
+}
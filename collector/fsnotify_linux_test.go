@@ -0,0 +1,36 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nofsnotify
+
+package collector
+
+import (
+	"testing"
+)
+
+func TestReadFsnotifyUsage(t *testing.T) {
+	for dir, want := range map[string]fsnotifyUsage{
+		"fixtures/proc/4243": {InotifyInstances: 2, InotifyWatches: 3},
+		"fixtures/proc/4244": {FanotifyGroups: 1, FanotifyMarks: 2},
+		"fixtures/proc/4242": {},
+	} {
+		got, err := readFsnotifyUsage(dir)
+		if err != nil {
+			t.Fatalf("%s: %v", dir, err)
+		}
+		if *got != want {
+			t.Errorf("%s: want %+v, got %+v", dir, want, *got)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nofuse
+
+package collector
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+const fuseSubsystem = "fuse"
+
+type fuseCollector struct {
+	info                *prometheus.Desc
+	waiting             *prometheus.Desc
+	maxBackground       *prometheus.Desc
+	congestionThreshold *prometheus.Desc
+	logger              log.Logger
+}
+
+func init() {
+	registerCollector("fuse", defaultDisabled, NewFUSECollector)
+}
+
+// NewFUSECollector returns a new Collector exposing FUSE connection
+// statistics from /sys/fs/fuse/connections.
+func NewFUSECollector(logger log.Logger) (Collector, error) {
+	labels := []string{"connection"}
+	return &fuseCollector{
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, fuseSubsystem, "connection_info"),
+			"Mount point and filesystem type of the FUSE connection, value is always 1.",
+			[]string{"connection", "mountpoint", "fstype"}, nil,
+		),
+		waiting: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, fuseSubsystem, "connection_waiting_requests"),
+			"Number of requests waiting for an answer from the userspace filesystem.",
+			labels, nil,
+		),
+		maxBackground: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, fuseSubsystem, "connection_max_background_requests"),
+			"Maximum number of outstanding background requests.",
+			labels, nil,
+		),
+		congestionThreshold: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, fuseSubsystem, "connection_congestion_threshold_requests"),
+			"Number of outstanding background requests above which the connection is considered congested.",
+			labels, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *fuseCollector) Update(ch chan<- prometheus.Metric) error {
+	connections, err := filepath.Glob(sysFilePath("fs/fuse/connections/*"))
+	if err != nil {
+		return err
+	}
+	if len(connections) == 0 {
+		level.Debug(c.logger).Log("msg", "no FUSE connections found, skipping")
+		return ErrNoData
+	}
+
+	mounts, err := fuseMounts()
+	if err != nil {
+		level.Debug(c.logger).Log("msg", "couldn't read mount points", "err", err)
+	}
+
+	for _, path := range connections {
+		// The connection is named after the device number of the
+		// filesystem, its major number is always 0.
+		connection := filepath.Base(path)
+		waiting, err := readUintFromFile(filepath.Join(path, "waiting"))
+		if err != nil {
+			return fmt.Errorf("couldn't get waiting requests of connection %s: %w", connection, err)
+		}
+
+		if m, ok := mounts["0:"+connection]; ok {
+			ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, connection, rootfsStripPrefix(m.MountPoint), m.FSType)
+		}
+		ch <- prometheus.MustNewConstMetric(c.waiting, prometheus.GaugeValue, float64(waiting), connection)
+
+		for _, m := range []struct {
+			file string
+			desc *prometheus.Desc
+		}{
+			{"max_background", c.maxBackground},
+			{"congestion_threshold", c.congestionThreshold},
+		} {
+			v, err := readUintFromFile(filepath.Join(path, m.file))
+			if err != nil {
+				level.Debug(c.logger).Log("msg", "couldn't read FUSE connection attribute", "connection", connection, "file", m.file, "err", err)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(m.desc, prometheus.GaugeValue, float64(v), connection)
+		}
+	}
+
+	return nil
+}
+
+// fuseMounts returns the mounts by "major:minor" device number.
+func fuseMounts() (map[string]*procfs.MountInfo, error) {
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return nil, err
+	}
+	proc, err := fs.Self()
+	if err != nil {
+		return nil, err
+	}
+	mounts, err := proc.MountInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	byDevice := make(map[string]*procfs.MountInfo, len(mounts))
+	for _, m := range mounts {
+		if _, ok := byDevice[m.MajorMinorVer]; !ok {
+			byDevice[m.MajorMinorVer] = m
+		}
+	}
+	return byDevice, nil
+}
@@ -32,6 +32,14 @@ func readUintFromFile(path string) (uint64, error) {
 	return value, nil
 }
 
+func readStringFromFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
 // Take a []byte{} and return a string based on null termination.
 // This is useful for situations where the OS has returned a null terminated
 // string to use.
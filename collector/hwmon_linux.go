@@ -35,6 +35,7 @@ var (
 	hwmonFilenameFormat     = regexp.MustCompile(`^(?P<type>[^0-9]+)(?P<id>[0-9]*)?(_(?P<property>.+))?$`)
 	hwmonLabelDesc          = []string{"chip", "sensor"}
 	hwmonChipNameLabelDesc  = []string{"chip", "chip_name"}
+	hwmonBlockDeviceDesc    = []string{"chip", "device"}
 	hwmonSensorTypes        = []string{
 		"vrm", "beep_enable", "update_interval", "in", "cpu", "fan",
 		"pwm", "temp", "curr", "power", "energy", "humidity",
@@ -185,6 +186,24 @@ func (c *hwMonCollector) updateHwmon(ch chan<- prometheus.Metric, dir string) er
 		)
 	}
 
+	// block devices monitored by the chip, like disks with drivetemp
+	for _, device := range hwmonBlockDevices(dir) {
+		desc := prometheus.NewDesc(
+			"node_hwmon_chip_block_devices",
+			"Annotation metric for block devices monitored by the chip",
+			hwmonBlockDeviceDesc,
+			nil,
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			desc,
+			prometheus.GaugeValue,
+			1.0,
+			hwmonName,
+			device,
+		)
+	}
+
 	// Format all sensors.
 	for sensor, sensorData := range data {
 
@@ -416,6 +435,39 @@ func (c *hwMonCollector) hwmonHumanReadableChipName(dir string) (string, error)
 	return "", errors.New("Could not derive a human-readable chip type for " + dir)
 }
 
+// hwmonBlockDevices returns the names of the block devices of the device a
+// chip belongs to. The drivetemp driver registers a chip for each SCSI disk
+// and NVMe controllers register one for all their namespaces.
+func hwmonBlockDevices(dir string) []string {
+	// SCSI disks have their block device below the SCSI device.
+	names, err := filepath.Glob(filepath.Join(dir, "device", "block", "*"))
+	if err != nil {
+		return nil
+	}
+	var devices []string
+	for _, name := range names {
+		devices = append(devices, filepath.Base(name))
+	}
+	if len(devices) > 0 {
+		return devices
+	}
+
+	// NVMe namespaces are directly below the controller.
+	entries, err := ioutil.ReadDir(filepath.Join(dir, "device"))
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "nvme") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, "device", entry.Name(), "dev")); err == nil {
+			devices = append(devices, entry.Name())
+		}
+	}
+	return devices
+}
+
 func (c *hwMonCollector) Update(ch chan<- prometheus.Metric) error {
 	// Step 1: scan /sys/class/hwmon, resolve all symlinks and call
 	//         updatesHwmon for each folder
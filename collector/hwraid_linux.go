@@ -0,0 +1,604 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nohwraid
+
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	hwraidSubsystem = "hwraid"
+
+	// Output of the tools is discarded above this size.
+	hwraidMaxOutput = 16 << 20
+)
+
+var (
+	hwraidStorcli = kingpin.Flag("collector.hwraid.storcli", "Absolute path of the storcli or perccli binary to query MegaRAID controllers with, disabled if empty.").Default("").String()
+	hwraidSsacli  = kingpin.Flag("collector.hwraid.ssacli", "Absolute path of the ssacli binary to query Smart Array controllers with, disabled if empty.").Default("").String()
+	hwraidTimeout = kingpin.Flag("collector.hwraid.timeout", "Timeout for each invocation of a RAID controller tool.").Default("30s").Duration()
+	hwraidRefresh = kingpin.Flag("collector.hwraid.refresh-interval", "Interval between queries of the RAID controllers in the background, scrapes return the results of the last query.").Default("5m").Duration()
+
+	// Healthy states in the storcli drive lists.
+	storcliHealthyVirtualDriveStates  = map[string]bool{"Optl": true}
+	storcliHealthyPhysicalDriveStates = map[string]bool{"Onln": true, "JBOD": true, "UGood": true, "GHS": true, "DHS": true}
+
+	ssacliControllerRE = regexp.MustCompile(`^(.+) in Slot (\S+)`)
+	storcliDriveRE     = regexp.MustCompile(`^Drive /c\d+(?:/e(\d+))?/s(\d+) - Detailed Information$`)
+
+	// The tools are started once and shared by all instances of the
+	// collector.
+	hwraidToolsOnce sync.Once
+	hwraidTools     []*hwraidTool
+)
+
+// hwraidTool is a RAID controller tool queried in the background, the
+// controllers of the last successful query are kept until the next query.
+type hwraidTool struct {
+	name  string
+	query func() ([]*hwraidController, error)
+
+	mtx         sync.Mutex
+	refreshed   bool
+	success     bool
+	lastRefresh time.Time
+	controllers []*hwraidController
+}
+
+// hwraidController is a RAID controller with its virtual and physical
+// drives as reported by storcli or ssacli.
+type hwraidController struct {
+	ID             string
+	Tool           string
+	Model          string
+	Serial         string
+	Status         string
+	Healthy        bool
+	Battery        string
+	BatteryHealthy bool
+	VirtualDrives  []*hwraidVirtualDrive
+	PhysicalDrives []*hwraidPhysicalDrive
+}
+
+type hwraidVirtualDrive struct {
+	ID        string
+	RAIDLevel string
+	State     string
+	Healthy   bool
+}
+
+type hwraidPhysicalDrive struct {
+	ID      string
+	Model   string
+	State   string
+	Healthy bool
+	// Error counters are only reported by storcli.
+	HasErrorCounts     bool
+	MediaErrors        uint64
+	OtherErrors        uint64
+	PredictiveFailures uint64
+}
+
+type hwraidCollector struct {
+	controllerInfo       *prometheus.Desc
+	controllerHealthy    *prometheus.Desc
+	batteryInfo          *prometheus.Desc
+	batteryHealthy       *prometheus.Desc
+	virtualDriveInfo     *prometheus.Desc
+	virtualDriveHealthy  *prometheus.Desc
+	physicalDriveInfo    *prometheus.Desc
+	physicalDriveHealthy *prometheus.Desc
+	mediaErrors          *prometheus.Desc
+	otherErrors          *prometheus.Desc
+	predictiveFailures   *prometheus.Desc
+	toolSuccess          *prometheus.Desc
+	toolLastRefresh      *prometheus.Desc
+	tools                []*hwraidTool
+	logger               log.Logger
+}
+
+func init() {
+	registerCollector("hwraid", defaultDisabled, NewHWRAIDCollector)
+}
+
+// NewHWRAIDCollector returns a new Collector exposing the state of hardware
+// RAID controllers queried with their vendor tools.
+func NewHWRAIDCollector(logger log.Logger) (Collector, error) {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, hwraidSubsystem, name),
+			help, labels, nil,
+		)
+	}
+	return &hwraidCollector{
+		controllerInfo:       desc("controller_info", "Non-numeric data of the RAID controller, value is always 1.", "controller", "tool", "model", "serial", "status"),
+		controllerHealthy:    desc("controller_healthy", "Whether the RAID controller reports an optimal status.", "controller"),
+		batteryInfo:          desc("battery_info", "Non-numeric data of the battery or capacitor backing the controller cache, value is always 1.", "controller", "status"),
+		batteryHealthy:       desc("battery_healthy", "Whether the battery or capacitor backing the controller cache reports an optimal status.", "controller"),
+		virtualDriveInfo:     desc("virtual_drive_info", "Non-numeric data of the virtual drive, value is always 1.", "controller", "virtual_drive", "raid_level", "state"),
+		virtualDriveHealthy:  desc("virtual_drive_healthy", "Whether the virtual drive is in optimal state.", "controller", "virtual_drive"),
+		physicalDriveInfo:    desc("physical_drive_info", "Non-numeric data of the physical drive, value is always 1.", "controller", "drive", "model", "state"),
+		physicalDriveHealthy: desc("physical_drive_healthy", "Whether the physical drive is online, a hot spare or unconfigured good.", "controller", "drive"),
+		mediaErrors:          desc("physical_drive_media_errors_total", "Number of media errors reported by the physical drive.", "controller", "drive"),
+		otherErrors:          desc("physical_drive_other_errors_total", "Number of other errors reported for the physical drive.", "controller", "drive"),
+		predictiveFailures:   desc("physical_drive_predictive_failures_total", "Number of predictive failures reported by the physical drive.", "controller", "drive"),
+		toolSuccess:          desc("tool_success", "Whether the last query of the RAID controllers with the tool succeeded.", "tool"),
+		toolLastRefresh:      desc("tool_last_refresh_timestamp_seconds", "Unix time of the last query of the RAID controllers with the tool.", "tool"),
+		tools:                startHWRAIDTools(logger),
+		logger:               logger,
+	}, nil
+}
+
+// startHWRAIDTools starts querying the configured tools in the background.
+// The tools can take many seconds to query the controllers and can stall
+// them, so they aren't run on scrapes.
+func startHWRAIDTools(logger log.Logger) []*hwraidTool {
+	hwraidToolsOnce.Do(func() {
+		if *hwraidStorcli != "" {
+			path := *hwraidStorcli
+			hwraidTools = append(hwraidTools, &hwraidTool{
+				name:  "storcli",
+				query: func() ([]*hwraidController, error) { return readStorcliControllers(path) },
+			})
+		}
+		if *hwraidSsacli != "" {
+			path := *hwraidSsacli
+			hwraidTools = append(hwraidTools, &hwraidTool{
+				name:  "ssacli",
+				query: func() ([]*hwraidController, error) { return readSsacliControllers(path) },
+			})
+		}
+		for _, t := range hwraidTools {
+			go t.run(*hwraidRefresh, logger)
+		}
+	})
+	return hwraidTools
+}
+
+func (t *hwraidTool) run(interval time.Duration, logger log.Logger) {
+	for {
+		controllers, err := t.query()
+		if err != nil {
+			level.Error(logger).Log("msg", "couldn't query RAID controllers", "tool", t.name, "err", err)
+		}
+		t.mtx.Lock()
+		t.refreshed = true
+		t.success = err == nil
+		t.lastRefresh = time.Now()
+		if err == nil {
+			t.controllers = controllers
+		}
+		t.mtx.Unlock()
+		time.Sleep(interval)
+	}
+}
+
+func (c *hwraidCollector) Update(ch chan<- prometheus.Metric) error {
+	if len(c.tools) == 0 {
+		level.Debug(c.logger).Log("msg", "no RAID controller tools configured, skipping")
+		return ErrNoData
+	}
+
+	for _, t := range c.tools {
+		t.mtx.Lock()
+		refreshed, success, lastRefresh, controllers := t.refreshed, t.success, t.lastRefresh, t.controllers
+		t.mtx.Unlock()
+		if !refreshed {
+			level.Debug(c.logger).Log("msg", "RAID controllers not queried yet", "tool", t.name)
+			continue
+		}
+
+		var value float64
+		if success {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.toolSuccess, prometheus.GaugeValue, value, t.name)
+		ch <- prometheus.MustNewConstMetric(c.toolLastRefresh, prometheus.GaugeValue, float64(lastRefresh.UnixNano())/1e9, t.name)
+		for _, ctrl := range controllers {
+			c.updateController(ch, ctrl)
+		}
+	}
+	return nil
+}
+
+func (c *hwraidCollector) updateController(ch chan<- prometheus.Metric, ctrl *hwraidController) {
+	healthy := func(ok bool) float64 {
+		if ok {
+			return 1
+		}
+		return 0
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.controllerInfo, prometheus.GaugeValue, 1, ctrl.ID, ctrl.Tool, ctrl.Model, ctrl.Serial, ctrl.Status)
+	ch <- prometheus.MustNewConstMetric(c.controllerHealthy, prometheus.GaugeValue, healthy(ctrl.Healthy), ctrl.ID)
+	if ctrl.Battery != "" {
+		ch <- prometheus.MustNewConstMetric(c.batteryInfo, prometheus.GaugeValue, 1, ctrl.ID, ctrl.Battery)
+		ch <- prometheus.MustNewConstMetric(c.batteryHealthy, prometheus.GaugeValue, healthy(ctrl.BatteryHealthy), ctrl.ID)
+	}
+	for _, vd := range ctrl.VirtualDrives {
+		ch <- prometheus.MustNewConstMetric(c.virtualDriveInfo, prometheus.GaugeValue, 1, ctrl.ID, vd.ID, vd.RAIDLevel, vd.State)
+		ch <- prometheus.MustNewConstMetric(c.virtualDriveHealthy, prometheus.GaugeValue, healthy(vd.Healthy), ctrl.ID, vd.ID)
+	}
+	for _, pd := range ctrl.PhysicalDrives {
+		ch <- prometheus.MustNewConstMetric(c.physicalDriveInfo, prometheus.GaugeValue, 1, ctrl.ID, pd.ID, pd.Model, pd.State)
+		ch <- prometheus.MustNewConstMetric(c.physicalDriveHealthy, prometheus.GaugeValue, healthy(pd.Healthy), ctrl.ID, pd.ID)
+		if !pd.HasErrorCounts {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.mediaErrors, prometheus.CounterValue, float64(pd.MediaErrors), ctrl.ID, pd.ID)
+		ch <- prometheus.MustNewConstMetric(c.otherErrors, prometheus.CounterValue, float64(pd.OtherErrors), ctrl.ID, pd.ID)
+		ch <- prometheus.MustNewConstMetric(c.predictiveFailures, prometheus.CounterValue, float64(pd.PredictiveFailures), ctrl.ID, pd.ID)
+	}
+}
+
+// hwraidOutput is a buffer failing writes above hwraidMaxOutput.
+type hwraidOutput struct {
+	bytes.Buffer
+}
+
+func (o *hwraidOutput) Write(p []byte) (int, error) {
+	if o.Len()+len(p) > hwraidMaxOutput {
+		return 0, fmt.Errorf("output exceeds %d bytes", hwraidMaxOutput)
+	}
+	return o.Buffer.Write(p)
+}
+
+// runHWRAIDTool runs a RAID controller tool and returns its output. The
+// tool is run without a shell, with an empty environment and a bounded
+// runtime and output size, and is killed if the exporter exits. It runs
+// with the privileges of the exporter, which the tools need to access the
+// controllers.
+func runHWRAIDTool(path string, args ...string) ([]byte, error) {
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("%q isn't an absolute path", path)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *hwraidTimeout)
+	defer cancel()
+
+	var out hwraidOutput
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = []string{"LC_ALL=C"}
+	cmd.Dir = "/"
+	cmd.Stdout = &out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("%s timed out after %s", path, *hwraidTimeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && out.Len() > 0 {
+		// storcli exits non-zero if a command fails on any of the
+		// controllers, the output holds the status of each.
+		return out.Bytes(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func readSsacliControllers(path string) ([]*hwraidController, error) {
+	out, err := runHWRAIDTool(path, "ctrl", "all", "show", "config", "detail")
+	if err != nil {
+		return nil, err
+	}
+	controllers, err := parseSsacliConfig(out)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse ssacli output: %w", err)
+	}
+	return controllers, nil
+}
+
+// storcliOutput is the JSON output of storcli commands on all controllers.
+type storcliOutput struct {
+	Controllers []struct {
+		CommandStatus struct {
+			Controller int    `json:"Controller"`
+			Status     string `json:"Status"`
+		} `json:"Command Status"`
+		ResponseData json.RawMessage `json:"Response Data"`
+	} `json:"Controllers"`
+}
+
+// storcliShowAll is the response of "show all" on a controller.
+type storcliShowAll struct {
+	Basics struct {
+		Model        string `json:"Model"`
+		SerialNumber string `json:"Serial Number"`
+	} `json:"Basics"`
+	Status struct {
+		ControllerStatus string `json:"Controller Status"`
+	} `json:"Status"`
+	VDList []struct {
+		DGVD  string `json:"DG/VD"`
+		Type  string `json:"TYPE"`
+		State string `json:"State"`
+	} `json:"VD LIST"`
+	PDList []struct {
+		EIDSlt string `json:"EID:Slt"`
+		State  string `json:"State"`
+		Model  string `json:"Model"`
+	} `json:"PD LIST"`
+	BBUInfo []struct {
+		State string `json:"State"`
+	} `json:"BBU_Info"`
+	CachevaultInfo []struct {
+		State string `json:"State"`
+	} `json:"Cachevault_Info"`
+}
+
+// storcliDriveState holds the error counters from the detailed information
+// of a physical drive.
+type storcliDriveState struct {
+	MediaErrors        uint64 `json:"Media Error Count"`
+	OtherErrors        uint64 `json:"Other Error Count"`
+	PredictiveFailures uint64 `json:"Predictive Failure Count"`
+}
+
+func readStorcliControllers(path string) ([]*hwraidController, error) {
+	showAll, err := runHWRAIDTool(path, "/call", "show", "all", "J")
+	if err != nil {
+		return nil, err
+	}
+	controllers, err := parseStorcliShowAll(showAll)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse storcli output: %w", err)
+	}
+
+	drives, err := runHWRAIDTool(path, "/call/eall/sall", "show", "all", "J")
+	if err != nil {
+		return nil, err
+	}
+	if err := parseStorcliDrives(drives, controllers); err != nil {
+		return nil, fmt.Errorf("couldn't parse storcli output: %w", err)
+	}
+	return controllers, nil
+}
+
+// parseStorcliShowAll parses the output of "storcli /call show all J".
+func parseStorcliShowAll(b []byte) ([]*hwraidController, error) {
+	var out storcliOutput
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+
+	var controllers []*hwraidController
+	for _, c := range out.Controllers {
+		if c.CommandStatus.Status != "Success" {
+			continue
+		}
+		var data storcliShowAll
+		if err := json.Unmarshal(c.ResponseData, &data); err != nil {
+			return nil, err
+		}
+
+		ctrl := &hwraidController{
+			ID:      fmt.Sprintf("c%d", c.CommandStatus.Controller),
+			Tool:    "storcli",
+			Model:   strings.TrimSpace(data.Basics.Model),
+			Serial:  strings.TrimSpace(data.Basics.SerialNumber),
+			Status:  data.Status.ControllerStatus,
+			Healthy: data.Status.ControllerStatus == "Optimal",
+		}
+		// Controllers have either a battery or a supercapacitor.
+		for _, b := range append(data.BBUInfo, data.CachevaultInfo...) {
+			ctrl.Battery = b.State
+			ctrl.BatteryHealthy = b.State == "Optimal"
+		}
+		for _, vd := range data.VDList {
+			ctrl.VirtualDrives = append(ctrl.VirtualDrives, &hwraidVirtualDrive{
+				ID:        vd.DGVD,
+				RAIDLevel: vd.Type,
+				State:     vd.State,
+				Healthy:   storcliHealthyVirtualDriveStates[vd.State],
+			})
+		}
+		for _, pd := range data.PDList {
+			ctrl.PhysicalDrives = append(ctrl.PhysicalDrives, &hwraidPhysicalDrive{
+				ID:      strings.TrimSpace(pd.EIDSlt),
+				Model:   strings.TrimSpace(pd.Model),
+				State:   pd.State,
+				Healthy: storcliHealthyPhysicalDriveStates[pd.State],
+			})
+		}
+		controllers = append(controllers, ctrl)
+	}
+	return controllers, nil
+}
+
+// parseStorcliDrives adds the error counters from the output of
+// "storcli /call/eall/sall show all J" to the physical drives of the
+// controllers.
+func parseStorcliDrives(b []byte, controllers []*hwraidController) error {
+	var out storcliOutput
+	if err := json.Unmarshal(b, &out); err != nil {
+		return err
+	}
+
+	for _, c := range out.Controllers {
+		if c.CommandStatus.Status != "Success" {
+			continue
+		}
+		var (
+			id   = fmt.Sprintf("c%d", c.CommandStatus.Controller)
+			ctrl *hwraidController
+		)
+		for _, candidate := range controllers {
+			if candidate.ID == id {
+				ctrl = candidate
+			}
+		}
+		if ctrl == nil {
+			continue
+		}
+
+		var data map[string]json.RawMessage
+		if err := json.Unmarshal(c.ResponseData, &data); err != nil {
+			return err
+		}
+		for key, value := range data {
+			m := storcliDriveRE.FindStringSubmatch(key)
+			if m == nil {
+				continue
+			}
+			// The drive list names drives "<enclosure>:<slot>", the
+			// enclosure is empty for directly attached drives.
+			id := m[1] + ":" + m[2]
+			var info map[string]json.RawMessage
+			if err := json.Unmarshal(value, &info); err != nil {
+				return err
+			}
+			stateJSON, ok := info[strings.TrimSuffix(key, " - Detailed Information")+" State"]
+			if !ok {
+				continue
+			}
+			var state storcliDriveState
+			if err := json.Unmarshal(stateJSON, &state); err != nil {
+				return fmt.Errorf("invalid state of drive %s: %w", id, err)
+			}
+			for _, pd := range ctrl.PhysicalDrives {
+				if pd.ID != id {
+					continue
+				}
+				pd.HasErrorCounts = true
+				pd.MediaErrors = state.MediaErrors
+				pd.OtherErrors = state.OtherErrors
+				pd.PredictiveFailures = state.PredictiveFailures
+			}
+		}
+	}
+	return nil
+}
+
+// parseSsacliConfig parses the output of "ssacli ctrl all show config
+// detail". The output is a tree of sections and "key: value" lines nested by
+// indentation.
+func parseSsacliConfig(b []byte) ([]*hwraidController, error) {
+	type section struct {
+		indent int
+		ctrl   *hwraidController
+		vd     *hwraidVirtualDrive
+		pd     *hwraidPhysicalDrive
+	}
+
+	var (
+		controllers []*hwraidController
+		stack       []section
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		text := strings.TrimLeft(line, " ")
+		if text == "" {
+			continue
+		}
+		indent := len(line) - len(text)
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+
+		if indent == 0 {
+			m := ssacliControllerRE.FindStringSubmatch(text)
+			if m == nil {
+				continue
+			}
+			ctrl := &hwraidController{
+				ID:    "slot" + m[2],
+				Tool:  "ssacli",
+				Model: m[1],
+			}
+			controllers = append(controllers, ctrl)
+			stack = append(stack, section{indent: indent, ctrl: ctrl})
+			continue
+		}
+		if len(stack) == 0 {
+			continue
+		}
+		top := stack[len(stack)-1]
+		ctrl := stack[0].ctrl
+
+		kv := strings.SplitN(text, ": ", 2)
+		fields := strings.Fields(text)
+		switch {
+		case kv[0] == "Logical Drive" && len(kv) == 2:
+			vd := &hwraidVirtualDrive{ID: kv[1]}
+			ctrl.VirtualDrives = append(ctrl.VirtualDrives, vd)
+			stack = append(stack, section{indent: indent, vd: vd})
+		case fields[0] == "physicaldrive" && len(fields) == 2:
+			// Drives are also listed on a single line in the mirror
+			// groups of logical drives, those aren't sections.
+			pd := &hwraidPhysicalDrive{ID: fields[1]}
+			ctrl.PhysicalDrives = append(ctrl.PhysicalDrives, pd)
+			stack = append(stack, section{indent: indent, pd: pd})
+		case len(kv) != 2:
+			// Sections like arrays and enclosures aren't exported,
+			// their keys are ignored.
+			stack = append(stack, section{indent: indent})
+		case kv[0] == "Array":
+			stack = append(stack, section{indent: indent})
+		default:
+			key, value := kv[0], strings.Join(strings.Fields(kv[1]), " ")
+			switch {
+			case top.vd != nil:
+				switch key {
+				case "Fault Tolerance":
+					top.vd.RAIDLevel = "RAID" + value
+				case "Status":
+					top.vd.State = value
+					top.vd.Healthy = value == "OK"
+				}
+			case top.pd != nil:
+				switch key {
+				case "Model":
+					top.pd.Model = value
+				case "Status":
+					top.pd.State = value
+					top.pd.Healthy = value == "OK"
+				}
+			case top.ctrl != nil:
+				switch key {
+				case "Serial Number":
+					top.ctrl.Serial = value
+				case "Controller Status":
+					top.ctrl.Status = value
+					top.ctrl.Healthy = value == "OK"
+				case "Battery/Capacitor Status":
+					top.ctrl.Battery = value
+					top.ctrl.BatteryHealthy = value == "OK"
+				}
+			}
+		}
+	}
+	return controllers, scanner.Err()
+}
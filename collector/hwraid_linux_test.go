@@ -0,0 +1,98 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nohwraid
+
+package collector
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestParseStorcli(t *testing.T) {
+	showAll, err := ioutil.ReadFile("fixtures/hwraid/storcli_show_all.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	drives, err := ioutil.ReadFile("fixtures/hwraid/storcli_drives.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	controllers, err := parseStorcliShowAll(showAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parseStorcliDrives(drives, controllers); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*hwraidController{{
+		ID:             "c0",
+		Tool:           "storcli",
+		Model:          "PERC H730P Mini",
+		Serial:         "5AF01GS",
+		Status:         "Optimal",
+		Healthy:        true,
+		Battery:        "Optimal",
+		BatteryHealthy: true,
+		VirtualDrives: []*hwraidVirtualDrive{
+			{ID: "0/0", RAIDLevel: "RAID1", State: "Optl", Healthy: true},
+			{ID: "1/1", RAIDLevel: "RAID5", State: "Dgrd"},
+		},
+		PhysicalDrives: []*hwraidPhysicalDrive{
+			{ID: "32:0", Model: "ST300MM0008", State: "Onln", Healthy: true, HasErrorCounts: true},
+			{ID: "32:1", Model: "ST300MM0008", State: "Onln", Healthy: true},
+			{ID: "32:2", Model: "ST1200MM0088", State: "Onln", Healthy: true},
+			{ID: "32:3", Model: "ST1200MM0088", State: "Offln", HasErrorCounts: true, MediaErrors: 117, OtherErrors: 5, PredictiveFailures: 1},
+			{ID: "32:4", Model: "ST1200MM0088", State: "Onln", Healthy: true},
+		},
+	}}
+	if !reflect.DeepEqual(want, controllers) {
+		t.Errorf("want %+v, got %+v", want[0], controllers[0])
+	}
+}
+
+func TestParseSsacliConfig(t *testing.T) {
+	config, err := ioutil.ReadFile("fixtures/hwraid/ssacli_config_detail.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	controllers, err := parseSsacliConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*hwraidController{{
+		ID:      "slot0",
+		Tool:    "ssacli",
+		Model:   "Smart Array P440ar",
+		Serial:  "PDNLH0BRH7V9KR",
+		Status:  "OK",
+		Healthy: true,
+		Battery: "Failed (Replace Batteries/Capacitors)",
+		VirtualDrives: []*hwraidVirtualDrive{
+			{ID: "1", RAIDLevel: "RAID1", State: "OK", Healthy: true},
+		},
+		PhysicalDrives: []*hwraidPhysicalDrive{
+			{ID: "1I:1:1", Model: "HP EG0600FBVFP", State: "OK", Healthy: true},
+			{ID: "1I:1:2", Model: "HP EG0600FBVFP", State: "Failed"},
+		},
+	}}
+	if !reflect.DeepEqual(want, controllers) {
+		t.Errorf("want %+v, got %+v", want[0], controllers[0])
+	}
+}
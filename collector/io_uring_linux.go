@@ -0,0 +1,204 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noio_uring
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+const (
+	ioUringSubsystem = "io_uring"
+
+	// Link target of io_uring file descriptors in /proc/<pid>/fd.
+	ioUringFileTarget = "anon_inode:[io_uring]"
+)
+
+// ioUringInstance holds the fields of an io_uring fdinfo exported by the
+// collector.
+type ioUringInstance struct {
+	RegisteredFiles   uint64
+	RegisteredBuffers uint64
+	SQPollThread      bool
+}
+
+// ioUringUsage is the io_uring usage of all processes with the same name.
+type ioUringUsage struct {
+	instances         uint64
+	registeredFiles   uint64
+	registeredBuffers uint64
+	sqPollThreads     uint64
+}
+
+type ioUringCollector struct {
+	fs                procfs.FS
+	instances         *prometheus.Desc
+	registeredFiles   *prometheus.Desc
+	registeredBuffers *prometheus.Desc
+	sqPollThreads     *prometheus.Desc
+	logger            log.Logger
+}
+
+func init() {
+	registerCollector("io_uring", defaultDisabled, NewIOUringCollector)
+}
+
+// NewIOUringCollector returns a new Collector exposing io_uring usage by
+// process name.
+func NewIOUringCollector(logger log.Logger) (Collector, error) {
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open procfs: %w", err)
+	}
+
+	labels := []string{"comm"}
+	return &ioUringCollector{
+		fs: fs,
+		instances: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, ioUringSubsystem, "instances"),
+			"Number of open io_uring file descriptors.",
+			labels, nil,
+		),
+		registeredFiles: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, ioUringSubsystem, "registered_files"),
+			"Number of files registered with io_uring instances.",
+			labels, nil,
+		),
+		registeredBuffers: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, ioUringSubsystem, "registered_buffers"),
+			"Number of buffers registered with io_uring instances.",
+			labels, nil,
+		),
+		sqPollThreads: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, ioUringSubsystem, "sq_poll_threads"),
+			"Number of io_uring instances with a submission queue polling thread.",
+			labels, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *ioUringCollector) Update(ch chan<- prometheus.Metric) error {
+	procs, err := c.fs.AllProcs()
+	if err != nil {
+		return fmt.Errorf("unable to list processes: %w", err)
+	}
+
+	usage := make(map[string]*ioUringUsage)
+	for _, p := range procs {
+		instances, err := readIOUringInstances(procFilePath(strconv.Itoa(p.PID)))
+		if err != nil {
+			// Processes can vanish and file descriptors of other
+			// users' processes are not readable without privileges.
+			level.Debug(c.logger).Log("msg", "couldn't read io_uring instances", "pid", p.PID, "err", err)
+			continue
+		}
+		if len(instances) == 0 {
+			continue
+		}
+
+		comm, err := p.Comm()
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't read process name", "pid", p.PID, "err", err)
+			continue
+		}
+		u, ok := usage[comm]
+		if !ok {
+			u = &ioUringUsage{}
+			usage[comm] = u
+		}
+		for _, i := range instances {
+			u.instances++
+			u.registeredFiles += i.RegisteredFiles
+			u.registeredBuffers += i.RegisteredBuffers
+			if i.SQPollThread {
+				u.sqPollThreads++
+			}
+		}
+	}
+
+	for comm, u := range usage {
+		ch <- prometheus.MustNewConstMetric(c.instances, prometheus.GaugeValue, float64(u.instances), comm)
+		ch <- prometheus.MustNewConstMetric(c.registeredFiles, prometheus.GaugeValue, float64(u.registeredFiles), comm)
+		ch <- prometheus.MustNewConstMetric(c.registeredBuffers, prometheus.GaugeValue, float64(u.registeredBuffers), comm)
+		ch <- prometheus.MustNewConstMetric(c.sqPollThreads, prometheus.GaugeValue, float64(u.sqPollThreads), comm)
+	}
+
+	return nil
+}
+
+// readIOUringInstances returns the io_uring instances of the process with
+// the given /proc/<pid> directory.
+func readIOUringInstances(procDir string) ([]ioUringInstance, error) {
+	var instances []ioUringInstance
+	err := walkProcFds(procDir, func(f procFd) error {
+		if f.target != ioUringFileTarget {
+			return nil
+		}
+		return f.readFdinfo(func(r io.Reader) error {
+			instance, err := parseIOUringFdinfo(r)
+			if err != nil {
+				return err
+			}
+			instances = append(instances, *instance)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+// parseIOUringFdinfo parses the fdinfo of an io_uring file descriptor.
+// Registered files and buffers are followed by one line per entry, which are
+// skipped.
+func parseIOUringFdinfo(r io.Reader) (*ioUringInstance, error) {
+	var instance ioUringInstance
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+
+		var err error
+		switch parts[0] {
+		case "UserFiles":
+			instance.RegisteredFiles, err = strconv.ParseUint(value, 10, 64)
+		case "UserBufs":
+			instance.RegisteredBuffers, err = strconv.ParseUint(value, 10, 64)
+		case "SqThread":
+			// The PID of the polling thread, or -1.
+			var pid int64
+			pid, err = strconv.ParseInt(value, 10, 64)
+			instance.SQPollThread = pid > 0
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid line %q: %w", scanner.Text(), err)
+		}
+	}
+	return &instance, scanner.Err()
+}
@@ -0,0 +1,36 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noio_uring
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadIOUringInstances(t *testing.T) {
+	instances, err := readIOUringInstances("fixtures/proc/4242")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ioUringInstance{
+		{RegisteredFiles: 2, RegisteredBuffers: 1, SQPollThread: true},
+		{},
+	}
+	if !reflect.DeepEqual(instances, want) {
+		t.Errorf("want io_uring instances %+v, got %+v", want, instances)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noiscsihost
+
+package collector
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const iscsiHostSubsystem = "iscsi_host"
+
+type iscsiHostCollector struct {
+	info             *prometheus.Desc
+	portUp           *prometheus.Desc
+	portSpeed        *prometheus.Desc
+	sessions         *prometheus.Desc
+	loggedInSessions *prometheus.Desc
+	logger           log.Logger
+}
+
+func init() {
+	registerCollector("iscsi_host", defaultDisabled, NewISCSIHostCollector)
+}
+
+// NewISCSIHostCollector returns a new Collector exposing iSCSI host adapters,
+// including hardware offload HBAs, from /sys/class/iscsi_host.
+func NewISCSIHostCollector(logger log.Logger) (Collector, error) {
+	hostLabels := []string{"host"}
+	return &iscsiHostCollector{
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiHostSubsystem, "info"),
+			"Non-numeric data from /sys/class/iscsi_host/<host>, value is always 1.",
+			[]string{"host", "driver", "netdev", "hwaddress", "ipaddress", "initiator"}, nil,
+		),
+		portUp: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiHostSubsystem, "port_up"),
+			"Whether the link of the iSCSI host port is up.",
+			hostLabels, nil,
+		),
+		portSpeed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiHostSubsystem, "port_speed_bytes_per_second"),
+			"Link speed of the iSCSI host port in bytes per second.",
+			hostLabels, nil,
+		),
+		sessions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiHostSubsystem, "sessions"),
+			"Number of iSCSI sessions on the host.",
+			hostLabels, nil,
+		),
+		loggedInSessions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiHostSubsystem, "logged_in_sessions"),
+			"Number of iSCSI sessions on the host that are logged in.",
+			hostLabels, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *iscsiHostCollector) Update(ch chan<- prometheus.Metric) error {
+	hosts, err := filepath.Glob(sysFilePath("class/iscsi_host/host*"))
+	if err != nil {
+		return err
+	}
+	if len(hosts) == 0 {
+		level.Debug(c.logger).Log("msg", "no iSCSI hosts found, skipping")
+		return ErrNoData
+	}
+
+	for _, path := range hosts {
+		host := filepath.Base(path)
+		// Software initiators do not expose all attributes, missing ones
+		// are left empty.
+		driver, _ := readStringFromFile(sysFilePath(filepath.Join("class/scsi_host", host, "proc_name")))
+		netdev, _ := readStringFromFile(filepath.Join(path, "netdev"))
+		hwaddress, _ := readStringFromFile(filepath.Join(path, "hwaddress"))
+		ipaddress, _ := readStringFromFile(filepath.Join(path, "ipaddress"))
+		initiator, _ := readStringFromFile(filepath.Join(path, "initiatorname"))
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, host, driver, netdev, hwaddress, ipaddress, initiator)
+
+		if state, err := readStringFromFile(filepath.Join(path, "port_state")); err == nil && state != "Unknown" {
+			up := 0.0
+			if state == "LINK UP" {
+				up = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.portUp, prometheus.GaugeValue, up, host)
+		}
+		if speed, err := readStringFromFile(filepath.Join(path, "port_speed")); err == nil {
+			if v, err := parseISCSIPortSpeed(speed); err == nil {
+				ch <- prometheus.MustNewConstMetric(c.portSpeed, prometheus.GaugeValue, v, host)
+			} else {
+				level.Debug(c.logger).Log("msg", "couldn't parse port speed", "host", host, "err", err)
+			}
+		}
+
+		states, err := readISCSIHostSessionStates(filepath.Join(path, "device"))
+		if err != nil {
+			return fmt.Errorf("couldn't get sessions of %s: %w", host, err)
+		}
+		loggedIn := 0
+		for _, state := range states {
+			if state == "LOGGED_IN" {
+				loggedIn++
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(c.sessions, prometheus.GaugeValue, float64(len(states)), host)
+		ch <- prometheus.MustNewConstMetric(c.loggedInSessions, prometheus.GaugeValue, float64(loggedIn), host)
+	}
+
+	return nil
+}
+
+// readISCSIHostSessionStates returns the state of each session below the
+// host device directory.
+func readISCSIHostSessionStates(hostDevice string) ([]string, error) {
+	sessions, err := filepath.Glob(filepath.Join(hostDevice, "session*"))
+	if err != nil {
+		return nil, err
+	}
+	states := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		name := filepath.Base(session)
+		state, err := readStringFromFile(filepath.Join(session, "iscsi_session", name, "state"))
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// parseISCSIPortSpeed converts a port speed such as "10 Gbps" to bytes per
+// second.
+func parseISCSIPortSpeed(speed string) (float64, error) {
+	fields := strings.Fields(speed)
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("unexpected port speed %q", speed)
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	switch fields[1] {
+	case "Mbps":
+		v *= 1e6
+	case "Gbps":
+		v *= 1e9
+	default:
+		return 0, fmt.Errorf("unexpected port speed unit %q", fields[1])
+	}
+	return v / 8, nil
+}
@@ -0,0 +1,276 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noiscsisession
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const iscsiSessionSubsystem = "iscsi_session"
+
+// iSCSI session states as reported by the scsi_transport_iscsi class.
+var iscsiSessionStates = []string{"LOGGED_IN", "FAILED", "FREE"}
+
+type iscsiSessionCollector struct {
+	info              *prometheus.Desc
+	state             *prometheus.Desc
+	recoveryTimeout   *prometheus.Desc
+	firstBurstLength  *prometheus.Desc
+	maxBurstLength    *prometheus.Desc
+	immediateData     *prometheus.Desc
+	initialR2T        *prometheus.Desc
+	ioRequests        *prometheus.Desc
+	ioErrors          *prometheus.Desc
+	ioTimeouts        *prometheus.Desc
+	connectionInfo    *prometheus.Desc
+	connectionMaxRecv *prometheus.Desc
+	connectionMaxXmit *prometheus.Desc
+	connectionPingTmo *prometheus.Desc
+	connectionRecvTmo *prometheus.Desc
+	logger            log.Logger
+}
+
+func init() {
+	registerCollector("iscsi_session", defaultDisabled, NewISCSISessionCollector)
+}
+
+// NewISCSISessionCollector returns a new Collector exposing iSCSI initiator
+// session statistics from /sys/class/iscsi_session and /sys/class/iscsi_connection.
+func NewISCSISessionCollector(logger log.Logger) (Collector, error) {
+	sessionLabels := []string{"session"}
+	connectionLabels := []string{"session", "connection"}
+	return &iscsiSessionCollector{
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiSessionSubsystem, "info"),
+			"Non-numeric data from /sys/class/iscsi_session/<session>, value is always 1.",
+			[]string{"session", "target", "tpgt", "initiator", "iface"}, nil,
+		),
+		state: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiSessionSubsystem, "state"),
+			"Indicates the state of the iSCSI session.",
+			[]string{"session", "state"}, nil,
+		),
+		recoveryTimeout: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiSessionSubsystem, "recovery_timeout_seconds"),
+			"Time to wait for a failed session to recover before failing I/O.",
+			sessionLabels, nil,
+		),
+		firstBurstLength: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiSessionSubsystem, "first_burst_length_bytes"),
+			"Negotiated FirstBurstLength of the session.",
+			sessionLabels, nil,
+		),
+		maxBurstLength: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiSessionSubsystem, "max_burst_length_bytes"),
+			"Negotiated MaxBurstLength of the session.",
+			sessionLabels, nil,
+		),
+		immediateData: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiSessionSubsystem, "immediate_data"),
+			"Whether ImmediateData was negotiated for the session.",
+			sessionLabels, nil,
+		),
+		initialR2T: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiSessionSubsystem, "initial_r2t"),
+			"Whether InitialR2T was negotiated for the session.",
+			sessionLabels, nil,
+		),
+		ioRequests: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiSessionSubsystem, "io_requests_total"),
+			"Number of I/O requests issued to the SCSI devices of the session.",
+			sessionLabels, nil,
+		),
+		ioErrors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiSessionSubsystem, "io_errors_total"),
+			"Number of I/O requests completed with an error on the SCSI devices of the session.",
+			sessionLabels, nil,
+		),
+		ioTimeouts: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiSessionSubsystem, "io_timeouts_total"),
+			"Number of I/O requests that timed out on the SCSI devices of the session.",
+			sessionLabels, nil,
+		),
+		connectionInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiSessionSubsystem, "connection_info"),
+			"Non-numeric data from /sys/class/iscsi_connection/<connection>, value is always 1.",
+			[]string{"session", "connection", "address", "port", "header_digest", "data_digest"}, nil,
+		),
+		connectionMaxRecv: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiSessionSubsystem, "connection_max_recv_data_segment_length_bytes"),
+			"Negotiated MaxRecvDataSegmentLength of the connection.",
+			connectionLabels, nil,
+		),
+		connectionMaxXmit: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiSessionSubsystem, "connection_max_xmit_data_segment_length_bytes"),
+			"Negotiated MaxXmitDataSegmentLength of the connection.",
+			connectionLabels, nil,
+		),
+		connectionPingTmo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiSessionSubsystem, "connection_ping_timeout_seconds"),
+			"Time to wait for a NOP-Out response before failing the connection.",
+			connectionLabels, nil,
+		),
+		connectionRecvTmo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, iscsiSessionSubsystem, "connection_recv_timeout_seconds"),
+			"Time without receiving data before a NOP-Out is sent on the connection.",
+			connectionLabels, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *iscsiSessionCollector) Update(ch chan<- prometheus.Metric) error {
+	sessions, err := filepath.Glob(sysFilePath("class/iscsi_session/session*"))
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		level.Debug(c.logger).Log("msg", "no iSCSI sessions found, skipping")
+		return ErrNoData
+	}
+
+	for _, path := range sessions {
+		session := strings.TrimPrefix(filepath.Base(path), "session")
+
+		state, err := readStringFromFile(filepath.Join(path, "state"))
+		if err != nil {
+			return fmt.Errorf("couldn't get state for session %s: %w", session, err)
+		}
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1,
+			session,
+			readISCSISessionAttr(path, "targetname"),
+			readISCSISessionAttr(path, "tpgt"),
+			readISCSISessionAttr(path, "initiatorname"),
+			readISCSISessionAttr(path, "ifacename"),
+		)
+		for _, s := range iscsiSessionStates {
+			v := 0.0
+			if s == state {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, v, session, strings.ToLower(s))
+		}
+
+		c.pushUint(ch, c.recoveryTimeout, prometheus.GaugeValue, filepath.Join(path, "recovery_tmo"), session)
+		c.pushUint(ch, c.firstBurstLength, prometheus.GaugeValue, filepath.Join(path, "first_burst_len"), session)
+		c.pushUint(ch, c.maxBurstLength, prometheus.GaugeValue, filepath.Join(path, "max_burst_len"), session)
+		c.pushUint(ch, c.immediateData, prometheus.GaugeValue, filepath.Join(path, "immediate_data"), session)
+		c.pushUint(ch, c.initialR2T, prometheus.GaugeValue, filepath.Join(path, "initial_r2t"), session)
+
+		counters, err := readISCSISessionDeviceCounters(path)
+		if err != nil {
+			return fmt.Errorf("couldn't get device counters for session %s: %w", session, err)
+		}
+		ch <- prometheus.MustNewConstMetric(c.ioRequests, prometheus.CounterValue, float64(counters["iorequest_cnt"]), session)
+		ch <- prometheus.MustNewConstMetric(c.ioErrors, prometheus.CounterValue, float64(counters["ioerr_cnt"]), session)
+		ch <- prometheus.MustNewConstMetric(c.ioTimeouts, prometheus.CounterValue, float64(counters["iotmo_cnt"]), session)
+
+		connections, err := filepath.Glob(sysFilePath(fmt.Sprintf("class/iscsi_connection/connection%s:*", session)))
+		if err != nil {
+			return err
+		}
+		for _, connPath := range connections {
+			connection := strings.TrimPrefix(filepath.Base(connPath), "connection")
+
+			address := readISCSISessionAttr(connPath, "persistent_address")
+			if address == "" {
+				address = readISCSISessionAttr(connPath, "address")
+			}
+			port := readISCSISessionAttr(connPath, "persistent_port")
+			if port == "" {
+				port = readISCSISessionAttr(connPath, "port")
+			}
+			ch <- prometheus.MustNewConstMetric(c.connectionInfo, prometheus.GaugeValue, 1,
+				session,
+				connection,
+				address,
+				port,
+				readISCSISessionAttr(connPath, "header_digest"),
+				readISCSISessionAttr(connPath, "data_digest"),
+			)
+
+			c.pushUint(ch, c.connectionMaxRecv, prometheus.GaugeValue, filepath.Join(connPath, "max_recv_dlength"), session, connection)
+			c.pushUint(ch, c.connectionMaxXmit, prometheus.GaugeValue, filepath.Join(connPath, "max_xmit_dlength"), session, connection)
+			c.pushUint(ch, c.connectionPingTmo, prometheus.GaugeValue, filepath.Join(connPath, "ping_tmo"), session, connection)
+			c.pushUint(ch, c.connectionRecvTmo, prometheus.GaugeValue, filepath.Join(connPath, "recv_tmo"), session, connection)
+		}
+	}
+
+	return nil
+}
+
+// pushUint emits the value of an optional sysfs attribute. Attributes that
+// are missing or not set by the transport (e.g. "<NULL>") are skipped.
+func (c *iscsiSessionCollector) pushUint(ch chan<- prometheus.Metric, desc *prometheus.Desc, valueType prometheus.ValueType, path string, labels ...string) {
+	value, err := readUintFromFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "couldn't parse iSCSI attribute", "file", path, "err", err)
+		}
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(desc, valueType, float64(value), labels...)
+}
+
+// readISCSISessionDeviceCounters sums the SCSI midlayer I/O counters of all
+// devices attached to the session.
+func readISCSISessionDeviceCounters(sessionPath string) (map[string]uint64, error) {
+	counters := map[string]uint64{}
+	devices, err := filepath.Glob(filepath.Join(sessionPath, "device", "target*", "*:*:*:*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		for _, name := range []string{"iorequest_cnt", "ioerr_cnt", "iotmo_cnt"} {
+			value, err := readISCSISessionAttrUint(filepath.Join(device, name))
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				return nil, err
+			}
+			counters[name] += value
+		}
+	}
+	return counters, nil
+}
+
+// readISCSISessionAttrUint parses the hexadecimal ("0x1f") counters exposed
+// by the SCSI midlayer.
+func readISCSISessionAttrUint(path string) (uint64, error) {
+	value, err := readStringFromFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(value, 0, 64)
+}
+
+func readISCSISessionAttr(dir, name string) string {
+	value, err := readStringFromFile(filepath.Join(dir, name))
+	if err != nil || value == "<NULL>" {
+		return ""
+	}
+	return value
+}
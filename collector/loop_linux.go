@@ -0,0 +1,154 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noloop
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs/blockdevice"
+)
+
+const (
+	loopSubsystem  = "loop"
+	loopSectorSize = 512
+)
+
+type loopCollector struct {
+	fs              blockdevice.FS
+	info            *prometheus.Desc
+	offset          *prometheus.Desc
+	sizeLimit       *prometheus.Desc
+	readsCompleted  *prometheus.Desc
+	writesCompleted *prometheus.Desc
+	readBytes       *prometheus.Desc
+	writtenBytes    *prometheus.Desc
+	logger          log.Logger
+}
+
+func init() {
+	registerCollector("loop", defaultDisabled, NewLoopCollector)
+}
+
+// NewLoopCollector returns a new Collector exposing the configuration and
+// statistics of attached loop devices.
+func NewLoopCollector(logger log.Logger) (Collector, error) {
+	fs, err := blockdevice.NewFS(*procPath, *sysPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sysfs: %w", err)
+	}
+
+	labels := []string{"device", "backing_file"}
+	return &loopCollector{
+		fs: fs,
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, loopSubsystem, "info"),
+			"Non-numeric data from /sys/block/<device>/loop, value is always 1.",
+			[]string{"device", "backing_file", "autoclear", "partscan", "dio"}, nil,
+		),
+		offset: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, loopSubsystem, "offset_bytes"),
+			"Offset of the loop device into the backing file.",
+			labels, nil,
+		),
+		sizeLimit: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, loopSubsystem, "size_limit_bytes"),
+			"Size limit of the loop device, 0 if it extends to the end of the backing file.",
+			labels, nil,
+		),
+		readsCompleted: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, loopSubsystem, "reads_completed_total"),
+			"The total number of reads completed successfully.",
+			labels, nil,
+		),
+		writesCompleted: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, loopSubsystem, "writes_completed_total"),
+			"The total number of writes completed successfully.",
+			labels, nil,
+		),
+		readBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, loopSubsystem, "read_bytes_total"),
+			"The total number of bytes read successfully.",
+			labels, nil,
+		),
+		writtenBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, loopSubsystem, "written_bytes_total"),
+			"The total number of bytes written successfully.",
+			labels, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *loopCollector) Update(ch chan<- prometheus.Metric) error {
+	// The loop directory only exists while a backing file is attached.
+	paths, err := filepath.Glob(sysFilePath("block/loop*/loop"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		level.Debug(c.logger).Log("msg", "no attached loop devices found, skipping")
+		return ErrNoData
+	}
+
+	for _, path := range paths {
+		device := filepath.Base(filepath.Dir(path))
+
+		backingFile, err := readStringFromFile(filepath.Join(path, "backing_file"))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// The device was detached in the meantime.
+				continue
+			}
+			return fmt.Errorf("couldn't get backing file of %s: %w", device, err)
+		}
+		flags := []string{device, backingFile}
+		for _, attr := range []string{"autoclear", "partscan", "dio"} {
+			// dio was added in Linux 4.4.
+			v, _ := readStringFromFile(filepath.Join(path, attr))
+			flags = append(flags, v)
+		}
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, flags...)
+
+		offset, err := readUintFromFile(filepath.Join(path, "offset"))
+		if err != nil {
+			return fmt.Errorf("couldn't get offset of %s: %w", device, err)
+		}
+		ch <- prometheus.MustNewConstMetric(c.offset, prometheus.GaugeValue, float64(offset), device, backingFile)
+
+		sizeLimit, err := readUintFromFile(filepath.Join(path, "sizelimit"))
+		if err != nil {
+			return fmt.Errorf("couldn't get size limit of %s: %w", device, err)
+		}
+		ch <- prometheus.MustNewConstMetric(c.sizeLimit, prometheus.GaugeValue, float64(sizeLimit), device, backingFile)
+
+		stats, _, err := c.fs.SysBlockDeviceStat(device)
+		if err != nil {
+			return fmt.Errorf("couldn't get block device statistics of %s: %w", device, err)
+		}
+		ch <- prometheus.MustNewConstMetric(c.readsCompleted, prometheus.CounterValue, float64(stats.ReadIOs), device, backingFile)
+		ch <- prometheus.MustNewConstMetric(c.readBytes, prometheus.CounterValue, float64(stats.ReadSectors*loopSectorSize), device, backingFile)
+		ch <- prometheus.MustNewConstMetric(c.writesCompleted, prometheus.CounterValue, float64(stats.WriteIOs), device, backingFile)
+		ch <- prometheus.MustNewConstMetric(c.writtenBytes, prometheus.CounterValue, float64(stats.WriteSectors*loopSectorSize), device, backingFile)
+	}
+
+	return nil
+}
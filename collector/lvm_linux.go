@@ -0,0 +1,199 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nolvm
+
+package collector
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const lvmSubsystem = "lvm"
+
+// lvmLogicalVolume is an LVM volume found in /sys/block/dm-*/dm.
+type lvmLogicalVolume struct {
+	Name      string
+	VG        string
+	LV        string
+	SizeBytes uint64
+	// Layer is the suffix of the UUID of LVM internal devices, e.g.
+	// "tpool" for the thin-pool target of a thin pool LV.
+	Layer string
+}
+
+type lvmCollector struct {
+	size             *prometheus.Desc
+	thinDataUsed     *prometheus.Desc
+	thinMetadataUsed *prometheus.Desc
+	logger           log.Logger
+}
+
+func init() {
+	registerCollector("lvm", defaultDisabled, NewLVMCollector)
+}
+
+// NewLVMCollector returns a new Collector exposing LVM logical volume sizes
+// and thin pool usage.
+func NewLVMCollector(logger log.Logger) (Collector, error) {
+	labels := []string{"vg", "lv"}
+	return &lvmCollector{
+		size: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, lvmSubsystem, "lv_size_bytes"),
+			"Size of the logical volume.",
+			labels, nil,
+		),
+		thinDataUsed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, lvmSubsystem, "thin_pool_data_used_ratio"),
+			"Fraction of the thin pool data blocks that are allocated.",
+			labels, nil,
+		),
+		thinMetadataUsed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, lvmSubsystem, "thin_pool_metadata_used_ratio"),
+			"Fraction of the thin pool metadata blocks that are allocated.",
+			labels, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *lvmCollector) Update(ch chan<- prometheus.Metric) error {
+	volumes, err := readLVMVolumes(sysFilePath("block"))
+	if err != nil {
+		return fmt.Errorf("couldn't get LVM volumes: %w", err)
+	}
+	if len(volumes) == 0 {
+		level.Debug(c.logger).Log("msg", "no LVM volumes found, skipping")
+		return ErrNoData
+	}
+
+	for _, v := range volumes {
+		switch v.Layer {
+		case "":
+			ch <- prometheus.MustNewConstMetric(c.size, prometheus.GaugeValue, float64(v.SizeBytes), v.VG, v.LV)
+		case "tpool":
+			status, err := readDMStatus(v.Name, false)
+			if err != nil {
+				level.Debug(c.logger).Log("msg", "couldn't get thin pool status", "device", v.Name, "err", err)
+				continue
+			}
+			data, metadata, err := parseThinPoolStatus(status)
+			if err != nil {
+				level.Debug(c.logger).Log("msg", "couldn't parse thin pool status", "device", v.Name, "err", err)
+				continue
+			}
+			lv := strings.TrimSuffix(v.LV, "-tpool")
+			ch <- prometheus.MustNewConstMetric(c.thinDataUsed, prometheus.GaugeValue, data, v.VG, lv)
+			ch <- prometheus.MustNewConstMetric(c.thinMetadataUsed, prometheus.GaugeValue, metadata, v.VG, lv)
+		}
+	}
+
+	return nil
+}
+
+// readLVMVolumes returns the device-mapper devices below root that are
+// managed by LVM.
+func readLVMVolumes(root string) ([]lvmLogicalVolume, error) {
+	paths, err := filepath.Glob(filepath.Join(root, "dm-*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var volumes []lvmLogicalVolume
+	for _, path := range paths {
+		uuid, err := readStringFromFile(filepath.Join(path, "dm/uuid"))
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(uuid, "LVM-") {
+			continue
+		}
+		v := lvmLogicalVolume{}
+		if i := strings.Index(uuid[4:], "-"); i >= 0 {
+			v.Layer = uuid[4+i+1:]
+		}
+		if v.Name, err = readStringFromFile(filepath.Join(path, "dm/name")); err != nil {
+			return nil, err
+		}
+		v.VG, v.LV = splitDMName(v.Name)
+		sectors, err := readUintFromFile(filepath.Join(path, "size"))
+		if err != nil {
+			return nil, err
+		}
+		v.SizeBytes = sectors * 512
+		volumes = append(volumes, v)
+	}
+	return volumes, nil
+}
+
+// splitDMName splits a device-mapper name created by LVM into volume group
+// and logical volume name. LVM escapes dashes in both names by doubling
+// them.
+func splitDMName(name string) (string, string) {
+	for i := 0; i < len(name); i++ {
+		if name[i] != '-' {
+			continue
+		}
+		if i+1 < len(name) && name[i+1] == '-' {
+			i++
+			continue
+		}
+		return strings.ReplaceAll(name[:i], "--", "-"), strings.ReplaceAll(name[i+1:], "--", "-")
+	}
+	return strings.ReplaceAll(name, "--", "-"), ""
+}
+
+// parseThinPoolStatus returns the used fraction of data and metadata blocks
+// from the status of a thin-pool target, see
+// Documentation/admin-guide/device-mapper/thin-provisioning.rst.
+func parseThinPoolStatus(status string) (float64, float64, error) {
+	fields := strings.Fields(status)
+	if len(fields) < 3 {
+		return 0, 0, fmt.Errorf("unexpected thin-pool status %q", status)
+	}
+	metadata, err := parseDMBlockUsage(fields[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	data, err := parseDMBlockUsage(fields[2])
+	if err != nil {
+		return 0, 0, err
+	}
+	return data, metadata, nil
+}
+
+func parseDMBlockUsage(s string) (float64, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("unexpected block usage %q", s)
+	}
+	used, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	total, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	if total == 0 {
+		return 0, nil
+	}
+	return used / total, nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nolvm
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadLVMVolumes(t *testing.T) {
+	volumes, err := readLVMVolumes("fixtures/sys/block")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []lvmLogicalVolume{
+		{Name: "vg0-root", VG: "vg0", LV: "root", SizeBytes: 21474836480},
+		{Name: "vg--data-thin--pool-tpool", VG: "vg-data", LV: "thin-pool-tpool", SizeBytes: 107374182400, Layer: "tpool"},
+		{Name: "vg--data-thin--pool_tdata", VG: "vg-data", LV: "thin-pool_tdata", SizeBytes: 107374182400, Layer: "tdata"},
+	}
+	if !reflect.DeepEqual(volumes, want) {
+		t.Errorf("want %+v, got %+v", want, volumes)
+	}
+}
+
+func TestParseThinPoolStatus(t *testing.T) {
+	data, metadata, err := parseThinPoolStatus("0 141/4161600 409600/1638400 - rw discard_passdown queue_if_no_space - 1024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 0.25; data != want {
+		t.Errorf("want data used %v, got %v", want, data)
+	}
+	if want := 141.0 / 4161600; metadata != want {
+		t.Errorf("want metadata used %v, got %v", want, metadata)
+	}
+
+	if _, _, err := parseThinPoolStatus("Fail"); err == nil {
+		t.Error("expected error for failed pool")
+	}
+}
@@ -19,6 +19,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -92,8 +95,59 @@ var (
 		[]string{"device"},
 		nil,
 	)
+
+	syncActionDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "md", "sync_action"),
+		"Current sync action of md-device.",
+		[]string{"device", "action"},
+		nil,
+	)
+
+	syncCompletedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "md", "sync_completed_ratio"),
+		"Fraction of the current sync action that is completed.",
+		[]string{"device"},
+		nil,
+	)
+
+	syncSpeedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "md", "sync_speed_bytes_per_second"),
+		"Current speed of the sync action in bytes per second.",
+		[]string{"device"},
+		nil,
+	)
+
+	mismatchDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "md", "mismatch_sectors"),
+		"Number of sectors found mismatched by the last check or repair.",
+		[]string{"device"},
+		nil,
+	)
+
+	memberStateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "md", "member_state"),
+		"Indicates the state of a member device of md-device.",
+		[]string{"device", "member", "state"},
+		nil,
+	)
+
+	// Values of md/sync_action and md/dev-*/state, see
+	// Documentation/admin-guide/md.rst.
+	mdSyncActions  = []string{"idle", "frozen", "resync", "recover", "check", "repair", "reshape"}
+	mdMemberStates = []string{"faulty", "in_sync", "write_mostly", "blocked", "spare", "write_error", "want_replacement", "replacement"}
 )
 
+// mdSysfsStats holds the sync and member state of an md-device from
+// /sys/block/<device>/md.
+type mdSysfsStats struct {
+	HasSync       bool
+	SyncAction    string
+	SyncCompleted float64
+	SyncSpeed     float64
+	MismatchCount uint64
+	Members       map[string][]string
+}
+
 func (c *mdadmCollector) Update(ch chan<- prometheus.Metric) error {
 	fs, err := procfs.NewFS(*procPath)
 
@@ -186,7 +240,114 @@ func (c *mdadmCollector) Update(ch chan<- prometheus.Metric) error {
 			float64(mdStat.BlocksSynced),
 			mdStat.Name,
 		)
+
+		md, err := readMdSysfsStats(sysFilePath(filepath.Join("block", mdStat.Name, "md")))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				level.Debug(c.logger).Log("msg", "Not collecting md sysfs stats, directory does not exist", "device", mdStat.Name)
+				continue
+			}
+			return fmt.Errorf("error reading md sysfs stats of %s: %w", mdStat.Name, err)
+		}
+
+		if md.HasSync {
+			for _, action := range mdSyncActions {
+				v := 0.0
+				if md.SyncAction == action {
+					v = 1
+				}
+				ch <- prometheus.MustNewConstMetric(syncActionDesc, prometheus.GaugeValue, v, mdStat.Name, action)
+			}
+			ch <- prometheus.MustNewConstMetric(syncCompletedDesc, prometheus.GaugeValue, md.SyncCompleted, mdStat.Name)
+			ch <- prometheus.MustNewConstMetric(syncSpeedDesc, prometheus.GaugeValue, md.SyncSpeed, mdStat.Name)
+			ch <- prometheus.MustNewConstMetric(mismatchDesc, prometheus.GaugeValue, float64(md.MismatchCount), mdStat.Name)
+		}
+
+		for member, states := range md.Members {
+			for _, state := range mdMemberStates {
+				v := 0.0
+				for _, s := range states {
+					if s == state {
+						v = 1
+					}
+				}
+				ch <- prometheus.MustNewConstMetric(memberStateDesc, prometheus.GaugeValue, v, mdStat.Name, member, state)
+			}
+		}
 	}
 
 	return nil
 }
+
+func readMdSysfsStats(path string) (*mdSysfsStats, error) {
+	var (
+		md  = mdSysfsStats{Members: map[string][]string{}}
+		err error
+	)
+
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	// Arrays without redundancy (raid0, linear) have no sync_action and
+	// friends, but still have member devices.
+	md.SyncAction, err = readStringFromFile(filepath.Join(path, "sync_action"))
+	switch {
+	case err == nil:
+		md.HasSync = true
+		if err := readMdSyncStats(path, &md); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	members, err := filepath.Glob(filepath.Join(path, "dev-*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		state, err := readStringFromFile(filepath.Join(member, "state"))
+		if err != nil {
+			return nil, err
+		}
+		md.Members[strings.TrimPrefix(filepath.Base(member), "dev-")] = strings.Split(state, ",")
+	}
+
+	return &md, nil
+}
+
+// readMdSyncStats reads the sync state of an md-device with redundancy.
+func readMdSyncStats(path string, md *mdSysfsStats) error {
+	// sync_completed is "none" when idle, "delayed" when waiting for
+	// another array on the same disks and "<done> / <total>" otherwise.
+	completed, err := readStringFromFile(filepath.Join(path, "sync_completed"))
+	if err != nil {
+		return err
+	}
+	if parts := strings.Split(completed, " / "); len(parts) == 2 {
+		done, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return err
+		}
+		total, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return err
+		}
+		if total > 0 {
+			md.SyncCompleted = done / total
+		}
+	}
+
+	// sync_speed is in KiB/s, or "none" when no sync is running.
+	speed, err := readStringFromFile(filepath.Join(path, "sync_speed"))
+	if err != nil {
+		return err
+	}
+	if v, err := strconv.ParseFloat(speed, 64); err == nil {
+		md.SyncSpeed = v * 1024
+	}
+
+	md.MismatchCount, err = readUintFromFile(filepath.Join(path, "mismatch_cnt"))
+	return err
+}
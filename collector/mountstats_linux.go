@@ -17,16 +17,25 @@ package collector
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/procfs"
+	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 var (
 	// 64-bit float mantissa: https://en.wikipedia.org/wiki/Double-precision_floating-point_format
 	float64Mantissa uint64 = 9007199254740992
+
+	mountStatsLatencyOperations = kingpin.Flag("collector.mountstats.latency-operations", "Comma separated list of NFS operations to export latency histograms for.").Default("READ,WRITE,GETATTR").String()
+
+	// Upper bounds of the NFS operation latency histograms, the kernel
+	// accounts latencies in milliseconds.
+	nfsLatencyBuckets = prometheus.ExponentialBuckets(0.001, 2, 13)
 )
 
 type mountStatsCollector struct {
@@ -52,6 +61,8 @@ type mountStatsCollector struct {
 	NFSOperationsQueueTimeSecondsTotal    *prometheus.Desc
 	NFSOperationsResponseTimeSecondsTotal *prometheus.Desc
 	NFSOperationsRequestTimeSecondsTotal  *prometheus.Desc
+	NFSOperationsResponseTimeSeconds      *prometheus.Desc
+	NFSOperationsRequestTimeSeconds       *prometheus.Desc
 
 	// Transport statistics
 	NFSTransportBindTotal              *prometheus.Desc
@@ -95,6 +106,11 @@ type mountStatsCollector struct {
 
 	proc procfs.Proc
 
+	latencyOperations map[string]bool
+	latencyMtx        sync.Mutex
+	responseLatency   map[nfsOperationIdentifier]*nfsLatencyHistogram
+	requestLatency    map[nfsOperationIdentifier]*nfsLatencyHistogram
+
 	logger log.Logger
 }
 
@@ -105,6 +121,55 @@ type nfsDeviceIdentifier struct {
 	MountAddress string
 }
 
+// used to track the latency histograms of an operation on an NFS mount
+type nfsOperationIdentifier struct {
+	nfsDeviceIdentifier
+	Operation string
+}
+
+// nfsLatencyHistogram approximates the latency distribution of an NFS
+// operation. The kernel only keeps cumulative totals, so the requests
+// completed between two scrapes are accounted at their average latency.
+// Count and sum are exact.
+type nfsLatencyHistogram struct {
+	requests     uint64
+	milliseconds uint64
+	buckets      []uint64
+}
+
+func newNFSLatencyHistogram() *nfsLatencyHistogram {
+	return &nfsLatencyHistogram{buckets: make([]uint64, len(nfsLatencyBuckets))}
+}
+
+// observe updates the histogram from the current cumulative number of
+// requests and their total latency.
+func (h *nfsLatencyHistogram) observe(requests, milliseconds uint64) {
+	if requests < h.requests || milliseconds < h.milliseconds {
+		// The mount was re-established, start over.
+		*h = *newNFSLatencyHistogram()
+	}
+
+	n := requests - h.requests
+	if n > 0 {
+		mean := float64(milliseconds-h.milliseconds) / float64(n) / 1000
+		for i, bound := range nfsLatencyBuckets {
+			if mean <= bound {
+				h.buckets[i] += n
+			}
+		}
+	}
+	h.requests = requests
+	h.milliseconds = milliseconds
+}
+
+func (h *nfsLatencyHistogram) metric(desc *prometheus.Desc, labelValues ...string) prometheus.Metric {
+	buckets := make(map[float64]uint64, len(nfsLatencyBuckets))
+	for i, bound := range nfsLatencyBuckets {
+		buckets[bound] = h.buckets[i]
+	}
+	return prometheus.MustNewConstHistogram(desc, h.requests, float64(h.milliseconds)/1000.0, buckets, labelValues...)
+}
+
 func init() {
 	registerCollector("mountstats", defaultDisabled, NewMountStatsCollector)
 }
@@ -131,6 +196,13 @@ func NewMountStatsCollector(logger log.Logger) (Collector, error) {
 		opLabels = []string{"export", "protocol", "mountaddr", "operation"}
 	)
 
+	latencyOperations := make(map[string]bool)
+	for _, op := range strings.Split(*mountStatsLatencyOperations, ",") {
+		if op = strings.TrimSpace(op); op != "" {
+			latencyOperations[strings.ToUpper(op)] = true
+		}
+	}
+
 	return &mountStatsCollector{
 		NFSAgeSecondsTotal: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, subsystem, "age_seconds_total"),
@@ -321,6 +393,20 @@ func NewMountStatsCollector(logger log.Logger) (Collector, error) {
 			nil,
 		),
 
+		NFSOperationsResponseTimeSeconds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "operations_response_time_seconds"),
+			"Approximate distribution of the time requests took to get a reply back after a request for a given operation was transmitted, based on the average per scrape interval.",
+			opLabels,
+			nil,
+		),
+
+		NFSOperationsRequestTimeSeconds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "operations_request_time_seconds"),
+			"Approximate distribution of the time requests took from when a request was enqueued to when it was completely handled for a given operation, based on the average per scrape interval.",
+			opLabels,
+			nil,
+		),
+
 		NFSEventInodeRevalidateTotal: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, subsystem, "event_inode_revalidate_total"),
 			"Number of times cached inode attributes are re-validated from the server.",
@@ -503,8 +589,11 @@ func NewMountStatsCollector(logger log.Logger) (Collector, error) {
 			nil,
 		),
 
-		proc:   proc,
-		logger: logger,
+		proc:              proc,
+		latencyOperations: latencyOperations,
+		responseLatency:   make(map[nfsOperationIdentifier]*nfsLatencyHistogram),
+		requestLatency:    make(map[nfsOperationIdentifier]*nfsLatencyHistogram),
+		logger:            logger,
 	}, nil
 }
 
@@ -522,6 +611,10 @@ func (c *mountStatsCollector) Update(ch chan<- prometheus.Metric) error {
 	// store all seen nfsDeviceIdentifiers for deduplication
 	deviceList := make(map[nfsDeviceIdentifier]bool)
 
+	c.latencyMtx.Lock()
+	defer c.latencyMtx.Unlock()
+	seenOperations := make(map[nfsOperationIdentifier]bool)
+
 	for idx, m := range mounts {
 		// For the time being, only NFS statistics are available via this mechanism
 		stats, ok := m.Stats.(*procfs.MountStatsNFS)
@@ -545,13 +638,21 @@ func (c *mountStatsCollector) Update(ch chan<- prometheus.Metric) error {
 		}
 
 		deviceList[deviceIdentifier] = true
-		c.updateNFSStats(ch, stats, m.Device, stats.Transport.Protocol, mountAddress)
+		c.updateNFSStats(ch, stats, m.Device, stats.Transport.Protocol, mountAddress, seenOperations)
+	}
+
+	// Drop the histograms of unmounted filesystems.
+	for id := range c.responseLatency {
+		if !seenOperations[id] {
+			delete(c.responseLatency, id)
+			delete(c.requestLatency, id)
+		}
 	}
 
 	return nil
 }
 
-func (c *mountStatsCollector) updateNFSStats(ch chan<- prometheus.Metric, s *procfs.MountStatsNFS, export, protocol, mountAddress string) {
+func (c *mountStatsCollector) updateNFSStats(ch chan<- prometheus.Metric, s *procfs.MountStatsNFS, export, protocol, mountAddress string, seenOperations map[nfsOperationIdentifier]bool) {
 	labelValues := []string{export, protocol, mountAddress}
 	ch <- prometheus.MustNewConstMetric(
 		c.NFSAgeSecondsTotal,
@@ -744,6 +845,20 @@ func (c *mountStatsCollector) updateNFSStats(ch chan<- prometheus.Metric, s *pro
 			float64(op.CumulativeTotalRequestMilliseconds%float64Mantissa)/1000.0,
 			opLabelValues...,
 		)
+
+		if !c.latencyOperations[op.Operation] {
+			continue
+		}
+		id := nfsOperationIdentifier{nfsDeviceIdentifier{export, protocol, mountAddress}, op.Operation}
+		seenOperations[id] = true
+		if _, ok := c.responseLatency[id]; !ok {
+			c.responseLatency[id] = newNFSLatencyHistogram()
+			c.requestLatency[id] = newNFSLatencyHistogram()
+		}
+		c.responseLatency[id].observe(op.Requests, op.CumulativeTotalResponseMilliseconds)
+		c.requestLatency[id].observe(op.Requests, op.CumulativeTotalRequestMilliseconds)
+		ch <- c.responseLatency[id].metric(c.NFSOperationsResponseTimeSeconds, opLabelValues...)
+		ch <- c.requestLatency[id].metric(c.NFSOperationsRequestTimeSeconds, opLabelValues...)
 	}
 
 	ch <- prometheus.MustNewConstMetric(
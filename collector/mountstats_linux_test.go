@@ -0,0 +1,44 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nomountstats
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNFSLatencyHistogram(t *testing.T) {
+	h := newNFSLatencyHistogram()
+
+	// 10 requests at 3ms on average, then 5 requests at 100ms.
+	h.observe(10, 30)
+	h.observe(15, 530)
+
+	want := []uint64{0, 0, 10, 10, 10, 10, 10, 15, 15, 15, 15, 15, 15}
+	if !reflect.DeepEqual(h.buckets, want) {
+		t.Errorf("want buckets %v, got %v", want, h.buckets)
+	}
+	if h.requests != 15 || h.milliseconds != 530 {
+		t.Errorf("want 15 requests taking 530ms, got %d requests taking %dms", h.requests, h.milliseconds)
+	}
+
+	// Counters going backwards mean the mount was re-established.
+	h.observe(2, 2)
+	want = []uint64{2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2}
+	if !reflect.DeepEqual(h.buckets, want) {
+		t.Errorf("want buckets %v after reset, got %v", want, h.buckets)
+	}
+}
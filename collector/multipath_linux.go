@@ -0,0 +1,281 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nomultipath
+
+package collector
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const multipathSubsystem = "multipath"
+
+var multipathGroupStates = map[string]string{
+	"A": "active",
+	"E": "enabled",
+	"D": "disabled",
+}
+
+// multipathPathGroup is a path group from the status of a dm-multipath
+// target.
+type multipathPathGroup struct {
+	State string
+	Paths []multipathPath
+}
+
+type multipathPath struct {
+	Dev       string
+	Active    bool
+	FailCount uint64
+}
+
+type multipathCollector struct {
+	paths         *prometheus.Desc
+	pathFailures  *prometheus.Desc
+	groupState    *prometheus.Desc
+	queueIfNoPath *prometheus.Desc
+	logger        log.Logger
+}
+
+func init() {
+	registerCollector("multipath", defaultDisabled, NewMultipathCollector)
+}
+
+// NewMultipathCollector returns a new Collector exposing path states of
+// device-mapper multipath devices.
+func NewMultipathCollector(logger log.Logger) (Collector, error) {
+	return &multipathCollector{
+		paths: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, multipathSubsystem, "paths"),
+			"Number of active/failed paths of the multipath device.",
+			[]string{"device", "state"}, nil,
+		),
+		pathFailures: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, multipathSubsystem, "path_failures_total"),
+			"Number of times the path has failed.",
+			[]string{"device", "path"}, nil,
+		),
+		groupState: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, multipathSubsystem, "path_group_state"),
+			"Indicates the state of a path group of the multipath device.",
+			[]string{"device", "group", "state"}, nil,
+		),
+		queueIfNoPath: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, multipathSubsystem, "queue_if_no_path"),
+			"Whether I/O is queued when no path is available.",
+			[]string{"device"}, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *multipathCollector) Update(ch chan<- prometheus.Metric) error {
+	paths, err := filepath.Glob(sysFilePath("block/dm-*"))
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, path := range paths {
+		uuid, err := readStringFromFile(filepath.Join(path, "dm/uuid"))
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(uuid, "mpath-") {
+			continue
+		}
+		found = true
+
+		device, err := readStringFromFile(filepath.Join(path, "dm/name"))
+		if err != nil {
+			return err
+		}
+		// Paths are reported as major:minor, map them to the names of the
+		// underlying devices.
+		slaves, err := readDMSlaves(filepath.Join(path, "slaves"))
+		if err != nil {
+			return fmt.Errorf("couldn't get slaves of %s: %w", device, err)
+		}
+
+		status, err := readDMStatus(device, false)
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't get multipath status", "device", device, "err", err)
+			continue
+		}
+		groups, err := parseMultipathStatus(status)
+		if err != nil {
+			return fmt.Errorf("couldn't parse multipath status of %s: %w", device, err)
+		}
+
+		var active, failed float64
+		for i, g := range groups {
+			group := strconv.Itoa(i + 1)
+			for _, state := range []string{"active", "enabled", "disabled"} {
+				v := 0.0
+				if multipathGroupStates[g.State] == state {
+					v = 1
+				}
+				ch <- prometheus.MustNewConstMetric(c.groupState, prometheus.GaugeValue, v, device, group, state)
+			}
+			for _, p := range g.Paths {
+				if p.Active {
+					active++
+				} else {
+					failed++
+				}
+				name := p.Dev
+				if n, ok := slaves[p.Dev]; ok {
+					name = n
+				}
+				ch <- prometheus.MustNewConstMetric(c.pathFailures, prometheus.CounterValue, float64(p.FailCount), device, name)
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(c.paths, prometheus.GaugeValue, active, device, "active")
+		ch <- prometheus.MustNewConstMetric(c.paths, prometheus.GaugeValue, failed, device, "failed")
+
+		table, err := readDMStatus(device, true)
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't get multipath table", "device", device, "err", err)
+			continue
+		}
+		queue := 0.0
+		if parseMultipathQueueIfNoPath(table) {
+			queue = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.queueIfNoPath, prometheus.GaugeValue, queue, device)
+	}
+	if !found {
+		level.Debug(c.logger).Log("msg", "no multipath devices found, skipping")
+		return ErrNoData
+	}
+
+	return nil
+}
+
+// readDMSlaves maps the major:minor numbers of the devices below a
+// device-mapper device to their names.
+func readDMSlaves(path string) (map[string]string, error) {
+	slaves, err := filepath.Glob(filepath.Join(path, "*"))
+	if err != nil {
+		return nil, err
+	}
+	devs := make(map[string]string, len(slaves))
+	for _, slave := range slaves {
+		dev, err := readStringFromFile(filepath.Join(slave, "dev"))
+		if err != nil {
+			return nil, err
+		}
+		devs[dev] = filepath.Base(slave)
+	}
+	return devs, nil
+}
+
+// parseMultipathStatus parses the status of a dm-multipath target:
+//
+//	<#features> <features...> <#handler args> <handler args...>
+//	<#groups> <next group> (<state> <#selector args> <selector args...>
+//	<#paths> <#selector path args> (<dev> <A|F> <fail count> <args...>)...)...
+func parseMultipathStatus(status string) ([]multipathPathGroup, error) {
+	fields := strings.Fields(status)
+	pos := 0
+	next := func() (int, error) {
+		if pos >= len(fields) {
+			return 0, fmt.Errorf("unexpected end of multipath status %q", status)
+		}
+		v, err := strconv.Atoi(fields[pos])
+		pos++
+		return v, err
+	}
+
+	// Skip feature and hardware handler arguments.
+	for i := 0; i < 2; i++ {
+		n, err := next()
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+	}
+	nGroups, err := next()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := next(); err != nil {
+		return nil, err
+	}
+
+	groups := make([]multipathPathGroup, 0, nGroups)
+	for i := 0; i < nGroups; i++ {
+		if pos >= len(fields) {
+			return nil, fmt.Errorf("unexpected end of multipath status %q", status)
+		}
+		g := multipathPathGroup{State: fields[pos]}
+		pos++
+		n, err := next()
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+		nPaths, err := next()
+		if err != nil {
+			return nil, err
+		}
+		nArgs, err := next()
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < nPaths; j++ {
+			if pos+3 > len(fields) {
+				return nil, fmt.Errorf("unexpected end of multipath status %q", status)
+			}
+			failCount, err := strconv.ParseUint(fields[pos+2], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			g.Paths = append(g.Paths, multipathPath{
+				Dev:       fields[pos],
+				Active:    fields[pos+1] == "A",
+				FailCount: failCount,
+			})
+			pos += 3 + nArgs
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// parseMultipathQueueIfNoPath reports whether the queue_if_no_path feature
+// is set in the table of a dm-multipath target.
+func parseMultipathQueueIfNoPath(table string) bool {
+	fields := strings.Fields(table)
+	if len(fields) == 0 {
+		return false
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n >= len(fields) {
+		return false
+	}
+	for _, f := range fields[1 : n+1] {
+		if f == "queue_if_no_path" {
+			return true
+		}
+	}
+	return false
+}
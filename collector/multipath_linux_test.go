@@ -0,0 +1,57 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nomultipath
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMultipathStatus(t *testing.T) {
+	groups, err := parseMultipathStatus("2 0 0 0 2 1 A 0 2 2 8:16 A 0 0 1 8:32 F 3 0 1 E 0 1 2 8:48 A 1 0 1 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []multipathPathGroup{
+		{State: "A", Paths: []multipathPath{
+			{Dev: "8:16", Active: true},
+			{Dev: "8:32", FailCount: 3},
+		}},
+		{State: "E", Paths: []multipathPath{
+			{Dev: "8:48", Active: true, FailCount: 1},
+		}},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("want %+v, got %+v", want, groups)
+	}
+
+	if _, err := parseMultipathStatus("2 0 0 0 2 1 A 0 2 2 8:16 A"); err == nil {
+		t.Error("expected error for truncated status")
+	}
+}
+
+func TestParseMultipathQueueIfNoPath(t *testing.T) {
+	for table, want := range map[string]bool{
+		"1 queue_if_no_path 1 alua 2 1 service-time 0 1 2 8:16 1 1": true,
+		"2 pg_init_retries 50 0 1 1 round-robin 0 1 1 8:16 1000":    false,
+		"0 0 1 1 service-time 0 1 2 8:16 1 1":                       false,
+	} {
+		if got := parseMultipathQueueIfNoPath(table); got != want {
+			t.Errorf("%q: want %v, got %v", table, want, got)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nonbd
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const nbdSubsystem = "nbd"
+
+// rbdNBDFlags are the rbd-nbd and Ceph options which don't take a value.
+var rbdNBDFlags = map[string]bool{
+	"--exclusive":     true,
+	"--no-mon-config": true,
+	"--notrace":       true,
+	"--quiesce":       true,
+	"--read-only":     true,
+	"--show-cookie":   true,
+	"--try-netlink":   true,
+}
+
+type nbdCollector struct {
+	connected *prometheus.Desc
+	info      *prometheus.Desc
+	timeout   *prometheus.Desc
+	inflight  *prometheus.Desc
+	logger    log.Logger
+}
+
+func init() {
+	registerCollector("nbd", defaultDisabled, NewNBDCollector)
+}
+
+// NewNBDCollector returns a new Collector exposing the state of network
+// block devices.
+func NewNBDCollector(logger log.Logger) (Collector, error) {
+	return &nbdCollector{
+		connected: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nbdSubsystem, "connected"),
+			"Whether the network block device is connected to a server.",
+			[]string{"device"}, nil,
+		),
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nbdSubsystem, "info"),
+			"Non-numeric data of connected network block devices, value is always 1.",
+			[]string{"device", "backend", "client", "image"}, nil,
+		),
+		timeout: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nbdSubsystem, "io_timeout_seconds"),
+			"Time after which requests to the server time out.",
+			[]string{"device"}, nil,
+		),
+		inflight: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nbdSubsystem, "inflight_requests"),
+			"Number of requests in flight on the network block device.",
+			[]string{"device", "direction"}, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *nbdCollector) Update(ch chan<- prometheus.Metric) error {
+	paths, err := filepath.Glob(sysFilePath("block/nbd*"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		level.Debug(c.logger).Log("msg", "no network block devices found, skipping")
+		return ErrNoData
+	}
+
+	for _, path := range paths {
+		device := filepath.Base(path)
+		// The pid attribute of the client only exists while connected.
+		pid, err := readUintFromFile(filepath.Join(path, "pid"))
+		if err != nil {
+			ch <- prometheus.MustNewConstMetric(c.connected, prometheus.GaugeValue, 0, device)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.connected, prometheus.GaugeValue, 1, device)
+
+		// The backend is only set by clients using the netlink interface.
+		backend, _ := readStringFromFile(filepath.Join(path, "backend"))
+		client, image := readNBDClient(pid)
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, device, backend, client, image)
+
+		if v, err := readUintFromFile(filepath.Join(path, "queue/io_timeout")); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.timeout, prometheus.GaugeValue, float64(v)/1000, device)
+		}
+
+		inflight, err := readStringFromFile(filepath.Join(path, "inflight"))
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't read in-flight requests", "device", device, "err", err)
+			continue
+		}
+		fields := strings.Fields(inflight)
+		if len(fields) != 2 {
+			return fmt.Errorf("invalid in-flight requests of %s: %q", device, inflight)
+		}
+		for i, direction := range []string{"read", "write"} {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return fmt.Errorf("invalid in-flight requests of %s: %w", device, err)
+			}
+			ch <- prometheus.MustNewConstMetric(c.inflight, prometheus.GaugeValue, v, device, direction)
+		}
+	}
+
+	return nil
+}
+
+// readNBDClient returns the name of the client process serving a network
+// block device and, for rbd-nbd, the mapped RBD image.
+func readNBDClient(pid uint64) (string, string) {
+	procDir := procFilePath(strconv.FormatUint(pid, 10))
+	client, err := readStringFromFile(filepath.Join(procDir, "comm"))
+	if err != nil {
+		return "", ""
+	}
+	if client != "rbd-nbd" {
+		return client, ""
+	}
+	cmdline, err := ioutil.ReadFile(filepath.Join(procDir, "cmdline"))
+	if err != nil {
+		return client, ""
+	}
+	return client, parseRBDNBDImage(strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00"))
+}
+
+// parseRBDNBDImage returns the image spec from the command line of rbd-nbd,
+// like "rbd-nbd --device /dev/nbd0 map rbd/vm-disk-1". It is the first
+// argument after the map or attach command which isn't an option.
+func parseRBDNBDImage(args []string) string {
+	command := false
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case strings.HasPrefix(arg, "-"):
+			// Skip the value of options like "--device /dev/nbd0".
+			if !strings.Contains(arg, "=") && !rbdNBDFlags[arg] {
+				i++
+			}
+		case !command:
+			command = arg == "map" || arg == "attach"
+		default:
+			return arg
+		}
+	}
+	return ""
+}
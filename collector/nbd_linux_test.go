@@ -0,0 +1,36 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nonbd
+
+package collector
+
+import (
+	"testing"
+)
+
+func TestParseRBDNBDImage(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"rbd-nbd", "map", "rbd/vm-disk-1"}, "rbd/vm-disk-1"},
+		{[]string{"rbd-nbd", "--device", "/dev/nbd0", "map", "--read-only", "rbd/vm-disk-1@snap"}, "rbd/vm-disk-1@snap"},
+		{[]string{"rbd-nbd", "attach", "--id=admin", "--device", "/dev/nbd1", "images/base"}, "images/base"},
+		{[]string{"rbd-nbd", "list-mapped"}, ""},
+	} {
+		if got := parseRBDNBDImage(tc.args); got != tc.want {
+			t.Errorf("%q: want image %q, got %q", tc.args, tc.want, got)
+		}
+	}
+}
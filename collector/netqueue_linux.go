@@ -0,0 +1,286 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nonetqueue
+
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	netQueueSubsystem = "network_queue"
+
+	// Commands and string sets from <linux/ethtool.h>.
+	ethtoolGStrings  = 0x1b
+	ethtoolGStats    = 0x1d
+	ethtoolGSSetInfo = 0x37
+	ethSSStats       = 1
+	ethGStringLen    = 32
+)
+
+var (
+	netQueueIgnoredDevices = kingpin.Flag("collector.netqueue.ignored-devices", "Regexp of net devices to ignore for netqueue collector.").Default("^lo$").String()
+
+	// Drivers name their per-queue statistics differently, like
+	// rx_queue_0_packets (virtio_net, ixgbe, ice), rx-0.bytes (i40e) or
+	// tx0_dropped (mlx5).
+	netQueueStatPattern = regexp.MustCompile(`^(rx|tx)(?:_queue_|-)?(\d+)[._](packets|bytes|drops|dropped)$`)
+)
+
+// netQueueStats are the statistics of the queues of a device by direction,
+// queue and counter.
+type netQueueStats map[string]map[string]map[string]uint64
+
+// ifreqData mirrors struct ifreq from <linux/if.h> with a pointer to the
+// ethtool command, padded to the size of the union.
+type ifreqData struct {
+	name [unix.IFNAMSIZ]byte
+	data unsafe.Pointer
+	_    [24 - unsafe.Sizeof(uintptr(0))]byte
+}
+
+type netQueueCollector struct {
+	ignoredDevicesPattern *regexp.Regexp
+	packets               map[string]*prometheus.Desc
+	bytes                 map[string]*prometheus.Desc
+	drops                 map[string]*prometheus.Desc
+	rpsCPUs               *prometheus.Desc
+	rpsFlows              *prometheus.Desc
+	xpsCPUs               *prometheus.Desc
+	logger                log.Logger
+}
+
+func init() {
+	registerCollector("netqueue", defaultDisabled, NewNetQueueCollector)
+}
+
+// NewNetQueueCollector returns a new Collector exposing statistics and
+// steering settings of the queues of network devices.
+func NewNetQueueCollector(logger log.Logger) (Collector, error) {
+	pattern, err := regexp.Compile(*netQueueIgnoredDevices)
+	if err != nil {
+		return nil, fmt.Errorf("invalid device pattern: %w", err)
+	}
+
+	labels := []string{"device", "queue"}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, netQueueSubsystem, name),
+			help, labels, nil,
+		)
+	}
+	return &netQueueCollector{
+		ignoredDevicesPattern: pattern,
+		packets: map[string]*prometheus.Desc{
+			"rx": desc("receive_packets_total", "Number of packets received on the queue."),
+			"tx": desc("transmit_packets_total", "Number of packets transmitted on the queue."),
+		},
+		bytes: map[string]*prometheus.Desc{
+			"rx": desc("receive_bytes_total", "Number of bytes received on the queue."),
+			"tx": desc("transmit_bytes_total", "Number of bytes transmitted on the queue."),
+		},
+		drops: map[string]*prometheus.Desc{
+			"rx": desc("receive_drop_total", "Number of packets dropped on the receive queue."),
+			"tx": desc("transmit_drop_total", "Number of packets dropped on the transmit queue."),
+		},
+		rpsCPUs:  desc("rps_cpus", "Number of CPUs receive packet steering distributes packets of the queue to, 0 if disabled."),
+		rpsFlows: desc("rps_flows", "Size of the flow table of receive flow steering for the queue."),
+		xpsCPUs:  desc("xps_cpus", "Number of CPUs transmit packet steering maps to the queue, 0 if disabled."),
+		logger:   logger,
+	}, nil
+}
+
+func (c *netQueueCollector) Update(ch chan<- prometheus.Metric) error {
+	paths, err := filepath.Glob(sysFilePath("class/net/*/queues"))
+	if err != nil {
+		return err
+	}
+
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		return fmt.Errorf("couldn't open socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	for _, path := range paths {
+		device := filepath.Base(filepath.Dir(path))
+		if c.ignoredDevicesPattern.MatchString(device) {
+			continue
+		}
+		c.updateSteering(ch, device, path)
+
+		names, values, err := readEthtoolStats(fd, device)
+		if err != nil {
+			// Many virtual devices don't support ethtool statistics.
+			level.Debug(c.logger).Log("msg", "couldn't read ethtool statistics", "device", device, "err", err)
+			continue
+		}
+		for direction, queues := range parseNetQueueStats(names, values) {
+			for queue, stats := range queues {
+				if v, ok := stats["packets"]; ok {
+					ch <- prometheus.MustNewConstMetric(c.packets[direction], prometheus.CounterValue, float64(v), device, queue)
+				}
+				if v, ok := stats["bytes"]; ok {
+					ch <- prometheus.MustNewConstMetric(c.bytes[direction], prometheus.CounterValue, float64(v), device, queue)
+				}
+				if v, ok := stats["drops"]; ok {
+					ch <- prometheus.MustNewConstMetric(c.drops[direction], prometheus.CounterValue, float64(v), device, queue)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// updateSteering exports the receive and transmit packet steering settings
+// of the queues in /sys/class/net/<device>/queues.
+func (c *netQueueCollector) updateSteering(ch chan<- prometheus.Metric, device, path string) {
+	queues, err := filepath.Glob(filepath.Join(path, "[rt]x-*"))
+	if err != nil {
+		return
+	}
+	for _, q := range queues {
+		name := filepath.Base(q)
+		queue := name[3:]
+		if strings.HasPrefix(name, "rx-") {
+			if mask, err := readStringFromFile(filepath.Join(q, "rps_cpus")); err == nil {
+				ch <- prometheus.MustNewConstMetric(c.rpsCPUs, prometheus.GaugeValue, float64(countCPUMask(mask)), device, queue)
+			}
+			if v, err := readUintFromFile(filepath.Join(q, "rps_flow_cnt")); err == nil {
+				ch <- prometheus.MustNewConstMetric(c.rpsFlows, prometheus.GaugeValue, float64(v), device, queue)
+			}
+			continue
+		}
+		// xps_cpus can't be read for devices with a single queue.
+		if mask, err := readStringFromFile(filepath.Join(q, "xps_cpus")); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.xpsCPUs, prometheus.GaugeValue, float64(countCPUMask(mask)), device, queue)
+		}
+	}
+}
+
+// countCPUMask returns the number of CPUs in a mask like "00000000,000000ff".
+func countCPUMask(mask string) int {
+	n := 0
+	for _, word := range strings.Split(mask, ",") {
+		v, err := strconv.ParseUint(word, 16, 64)
+		if err != nil {
+			continue
+		}
+		n += bits.OnesCount64(v)
+	}
+	return n
+}
+
+// parseNetQueueStats picks the per-queue statistics from the names and
+// values of the ethtool statistics of a device.
+func parseNetQueueStats(names []string, values []uint64) netQueueStats {
+	stats := make(netQueueStats)
+	for i, name := range names {
+		if i >= len(values) {
+			break
+		}
+		m := netQueueStatPattern.FindStringSubmatch(name)
+		if m == nil {
+			continue
+		}
+		direction, queue, counter := m[1], m[2], m[3]
+		if counter == "dropped" {
+			counter = "drops"
+		}
+		if stats[direction] == nil {
+			stats[direction] = make(map[string]map[string]uint64)
+		}
+		if stats[direction][queue] == nil {
+			stats[direction][queue] = make(map[string]uint64)
+		}
+		stats[direction][queue][counter] = values[i]
+	}
+	return stats
+}
+
+// readEthtoolStats returns the names and values of the statistics of the
+// driver of a device using the SIOCETHTOOL ioctl.
+func readEthtoolStats(fd int, device string) ([]string, []uint64, error) {
+	// struct ethtool_sset_info with room for the size of one string set.
+	sset := struct {
+		cmd      uint32
+		reserved uint32
+		mask     uint64
+		data     [1]uint32
+	}{cmd: ethtoolGSSetInfo, mask: 1 << ethSSStats}
+	if err := ethtoolIoctl(fd, device, unsafe.Pointer(&sset)); err != nil {
+		return nil, nil, err
+	}
+	if sset.mask == 0 || sset.data[0] == 0 {
+		return nil, nil, os.ErrNotExist
+	}
+	n := int(sset.data[0])
+
+	// struct ethtool_gstrings followed by the names.
+	strs := make([]byte, 12+n*ethGStringLen)
+	*(*uint32)(unsafe.Pointer(&strs[0])) = ethtoolGStrings
+	*(*uint32)(unsafe.Pointer(&strs[4])) = ethSSStats
+	*(*uint32)(unsafe.Pointer(&strs[8])) = uint32(n)
+	if err := ethtoolIoctl(fd, device, unsafe.Pointer(&strs[0])); err != nil {
+		return nil, nil, err
+	}
+
+	// struct ethtool_stats followed by the values.
+	stats := make([]uint64, 1+n)
+	*(*uint32)(unsafe.Pointer(&stats[0])) = ethtoolGStats
+	*(*uint32)(unsafe.Pointer(uintptr(unsafe.Pointer(&stats[0])) + 4)) = uint32(n)
+	if err := ethtoolIoctl(fd, device, unsafe.Pointer(&stats[0])); err != nil {
+		return nil, nil, err
+	}
+
+	names := make([]string, n)
+	for i := range names {
+		name := strs[12+i*ethGStringLen : 12+(i+1)*ethGStringLen]
+		if j := bytes.IndexByte(name, 0); j >= 0 {
+			name = name[:j]
+		}
+		names[i] = string(name)
+	}
+	return names, stats[1:], nil
+}
+
+func ethtoolIoctl(fd int, device string, data unsafe.Pointer) error {
+	var ifr ifreqData
+	if len(device) >= len(ifr.name) {
+		return fmt.Errorf("device name too long: %s", device)
+	}
+	copy(ifr.name[:], device)
+	ifr.data = data
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SIOCETHTOOL, uintptr(unsafe.Pointer(&ifr)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
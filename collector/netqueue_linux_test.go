@@ -0,0 +1,50 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nonetqueue
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNetQueueStats(t *testing.T) {
+	names := []string{
+		"rx_packets", "rx_queue_0_packets", "rx_queue_0_bytes", "rx_queue_0_drops",
+		"tx-1.packets", "tx-1.bytes", "rx0_xdp_packets", "tx0_dropped", "tx0_kicks",
+	}
+	values := []uint64{100, 60, 6000, 2, 40, 4000, 7, 3, 9}
+
+	want := netQueueStats{
+		"rx": {"0": {"packets": 60, "bytes": 6000, "drops": 2}},
+		"tx": {"0": {"drops": 3}, "1": {"packets": 40, "bytes": 4000}},
+	}
+	if got := parseNetQueueStats(names, values); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestCountCPUMask(t *testing.T) {
+	for mask, want := range map[string]int{
+		"0":                 0,
+		"f":                 4,
+		"00000000,000000ff": 8,
+		"00000001,80000000": 2,
+	} {
+		if got := countCPUMask(mask); got != want {
+			t.Errorf("want %d CPUs in %q, got %d", want, mask, got)
+		}
+	}
+}
@@ -16,16 +16,41 @@
 package collector
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
 	"github.com/prometheus/procfs/nfs"
+	"gopkg.in/alecthomas/kingpin.v2"
 )
 
+var (
+	nfsdClients = kingpin.Flag("collector.nfsd.clients", "Enables metrics about NFSv4 clients and their states from /proc/fs/nfsd/clients.").Bool()
+
+	// Types of the NFSv4 states listed in /proc/fs/nfsd/clients/<id>/states.
+	nfsdStateTypes = []string{"open", "lock", "deleg", "layout"}
+
+	nfsdStateTypePattern       = regexp.MustCompile(`type: (\w+)`)
+	nfsdStateSuperblockPattern = regexp.MustCompile(`superblock: "([0-9a-f]+):([0-9a-f]+):`)
+)
+
+// nfsdState is an NFSv4 state held by a client, the device identifies the
+// exported filesystem the state belongs to.
+type nfsdState struct {
+	Type   string
+	Device string
+}
+
 // A nfsdCollector is a Collector which gathers metrics from /proc/net/rpc/nfsd.
 // See: https://www.svennd.be/nfsd-stats-explained-procnetrpcnfsd/
 type nfsdCollector struct {
@@ -82,9 +107,191 @@ func (c *nfsdCollector) Update(ch chan<- prometheus.Metric) error {
 	c.updateNFSdRequestsv3Stats(ch, &stats.V3Stats)
 	c.updateNFSdRequestsv4Stats(ch, &stats.V4Ops)
 
+	if *nfsdClients {
+		if err := c.updateNFSdClients(ch); err != nil {
+			return fmt.Errorf("failed to retrieve nfsd clients: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// updateNFSdClients collects the NFSv4 clients and their states, both per
+// client and per exported filesystem.
+func (c *nfsdCollector) updateNFSdClients(ch chan<- prometheus.Metric) error {
+	clients, err := filepath.Glob(procFilePath("fs/nfsd/clients/*"))
+	if err != nil {
+		return err
+	}
+	if len(clients) == 0 {
+		level.Debug(c.logger).Log("msg", "no NFSv4 clients found")
+		return nil
+	}
+
+	mountPoints, err := nfsdMountPoints()
+	if err != nil {
+		level.Debug(c.logger).Log("msg", "couldn't read mount points, using device numbers", "err", err)
+	}
+
+	infoDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, nfsdSubsystem, "client_info"),
+		"Non-numeric data from /proc/fs/nfsd/clients/<id>/info, value is always 1.",
+		[]string{"client_id", "address", "name", "minor_version"}, nil,
+	)
+	clientStatesDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, nfsdSubsystem, "client_states"),
+		"Number of NFSv4 states held by the client by type.",
+		[]string{"client_id", "type"}, nil,
+	)
+	exportStatesDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, nfsdSubsystem, "export_states"),
+		"Number of NFSv4 states held by all clients on an exported filesystem by type.",
+		[]string{"mountpoint", "type"}, nil,
+	)
+
+	exportStates := make(map[string]map[string]int)
+	for _, dir := range clients {
+		info, err := readNFSdClientInfo(filepath.Join(dir, "info"))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// The client went away.
+				continue
+			}
+			return err
+		}
+		clientID := info["clientid"]
+		ch <- prometheus.MustNewConstMetric(infoDesc, prometheus.GaugeValue, 1,
+			clientID, info["address"], info["name"], info["minor version"])
+
+		states, err := readNFSdClientStates(filepath.Join(dir, "states"))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		clientStates := make(map[string]int)
+		for _, state := range states {
+			clientStates[state.Type]++
+
+			mountPoint, ok := mountPoints[state.Device]
+			if !ok {
+				mountPoint = state.Device
+			}
+			if exportStates[mountPoint] == nil {
+				exportStates[mountPoint] = make(map[string]int)
+			}
+			exportStates[mountPoint][state.Type]++
+		}
+		for _, t := range nfsdStateTypes {
+			ch <- prometheus.MustNewConstMetric(clientStatesDesc, prometheus.GaugeValue, float64(clientStates[t]), clientID, t)
+		}
+	}
+
+	for mountPoint, states := range exportStates {
+		for _, t := range nfsdStateTypes {
+			ch <- prometheus.MustNewConstMetric(exportStatesDesc, prometheus.GaugeValue, float64(states[t]), mountPoint, t)
+		}
+	}
+
 	return nil
 }
 
+// nfsdMountPoints maps "major:minor" device numbers to mount points.
+func nfsdMountPoints() (map[string]string, error) {
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return nil, err
+	}
+	proc, err := fs.Self()
+	if err != nil {
+		return nil, err
+	}
+	mounts, err := proc.MountInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	mountPoints := make(map[string]string, len(mounts))
+	for _, m := range mounts {
+		if _, ok := mountPoints[m.MajorMinorVer]; !ok {
+			mountPoints[m.MajorMinorVer] = rootfsStripPrefix(m.MountPoint)
+		}
+	}
+	return mountPoints, nil
+}
+
+func readNFSdClientInfo(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseNFSdClientInfo(f)
+}
+
+// parseNFSdClientInfo parses the "key: value" lines of a client info file.
+func parseNFSdClientInfo(r io.Reader) (map[string]string, error) {
+	info := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		info[strings.TrimSpace(parts[0])] = value
+	}
+	return info, scanner.Err()
+}
+
+func readNFSdClientStates(path string) ([]nfsdState, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseNFSdClientStates(f)
+}
+
+// parseNFSdClientStates parses a client states file, which has one line per
+// state:
+//   - 0x...: { type: open, access: rw, deny: --, superblock: "fd:00:1187", ... }
+func parseNFSdClientStates(r io.Reader) ([]nfsdState, error) {
+	var states []nfsdState
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "- ") {
+			continue
+		}
+		m := nfsdStateTypePattern.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("missing state type: %q", line)
+		}
+		state := nfsdState{Type: m[1]}
+		// The device numbers are printed in hexadecimal.
+		if m := nfsdStateSuperblockPattern.FindStringSubmatch(line); m != nil {
+			major, err := strconv.ParseUint(m[1], 16, 32)
+			if err != nil {
+				return nil, err
+			}
+			minor, err := strconv.ParseUint(m[2], 16, 32)
+			if err != nil {
+				return nil, err
+			}
+			state.Device = fmt.Sprintf("%d:%d", major, minor)
+		}
+		states = append(states, state)
+	}
+	return states, scanner.Err()
+}
+
 // updateNFSdReplyCacheStats collects statistics for the reply cache.
 func (c *nfsdCollector) updateNFSdReplyCacheStats(ch chan<- prometheus.Metric, s *nfs.ReplyCache) {
 	ch <- prometheus.MustNewConstMetric(
@@ -0,0 +1,60 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nonfsd
+
+package collector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNFSdClientStates(t *testing.T) {
+	states, err := parseNFSdClientStates(strings.NewReader(`- 0x00000001d0960564708dd2a201000000: { type: open, access: rw, deny: --, superblock: "fd:01:1187", filename: "/srv/disk0.img", owner: "open id:\x00\x00\x00\x2c" }
+- 0x00000002d0960564708dd2a201000000: { type: lock, superblock: "08:11:1187", filename: "/srv/disk0.img", owner: "lock id:\x00\x00\x00\x2c" }
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []nfsdState{
+		{Type: "open", Device: "253:1"},
+		{Type: "lock", Device: "8:17"},
+	}
+	if !reflect.DeepEqual(states, want) {
+		t.Errorf("want states %v, got %v", want, states)
+	}
+}
+
+func TestParseNFSdClientInfo(t *testing.T) {
+	info, err := parseNFSdClientInfo(strings.NewReader(`clientid: 0x6d0596d0a2d28d70
+address: "192.168.1.10:876"
+name: "Linux NFSv4.2 client1"
+minor version: 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"clientid":      "0x6d0596d0a2d28d70",
+		"address":       "192.168.1.10:876",
+		"name":          "Linux NFSv4.2 client1",
+		"minor version": "2",
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("want info %v, got %v", want, info)
+	}
+}
@@ -0,0 +1,339 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nonvme
+
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unsafe"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	nvmeSubsystem = "nvme"
+
+	// _IOWR('N', 0x41, struct nvme_admin_cmd)
+	nvmeIoctlAdminCmd = 0xC0484E41
+
+	nvmeAdminGetLogPage = 0x02
+	nvmeLogSMART        = 0x02
+	nvmeSMARTLogSize    = 512
+
+	// Data units are reported in thousands of 512 byte units.
+	nvmeDataUnitBytes = 512 * 1000
+)
+
+// nvmeAdminCmd mirrors struct nvme_admin_cmd from <linux/nvme_ioctl.h>.
+type nvmeAdminCmd struct {
+	Opcode      uint8
+	Flags       uint8
+	Rsvd1       uint16
+	NSID        uint32
+	Cdw2        uint32
+	Cdw3        uint32
+	Metadata    uint64
+	Addr        uint64
+	MetadataLen uint32
+	DataLen     uint32
+	Cdw10       uint32
+	Cdw11       uint32
+	Cdw12       uint32
+	Cdw13       uint32
+	Cdw14       uint32
+	Cdw15       uint32
+	TimeoutMs   uint32
+	Result      uint32
+}
+
+// nvmeControllerStates are the values of /sys/class/nvme/<device>/state.
+var nvmeControllerStates = []string{"new", "live", "resetting", "connecting", "deleting", "dead"}
+
+// nvmeController holds the controller attributes from sysfs exported by the
+// collector. Fabrics options are nil for PCIe controllers or when disabled.
+type nvmeController struct {
+	State           string
+	Transport       string
+	Address         string
+	SubsystemNQN    string
+	QueueCount      uint64
+	SQSize          uint64
+	ReconnectDelay  *uint64
+	CtrlLossTimeout *uint64
+}
+
+// nvmeSMARTLog holds the fields of the SMART / Health Information log page
+// (log identifier 02h) exported by the collector.
+type nvmeSMARTLog struct {
+	CriticalWarning         uint8
+	TemperatureKelvin       uint16
+	AvailableSpare          uint8
+	AvailableSpareThreshold uint8
+	PercentageUsed          uint8
+	DataUnitsRead           float64
+	DataUnitsWritten        float64
+	HostReadCommands        float64
+	HostWriteCommands       float64
+	PowerCycles             float64
+	PowerOnHours            float64
+	UnsafeShutdowns         float64
+	MediaErrors             float64
+	ErrorLogEntries         float64
+}
+
+type nvmeCollector struct {
+	info                    *prometheus.Desc
+	controllerInfo          *prometheus.Desc
+	state                   *prometheus.Desc
+	ioQueues                *prometheus.Desc
+	queueSize               *prometheus.Desc
+	reconnectDelay          *prometheus.Desc
+	ctrlLossTimeout         *prometheus.Desc
+	criticalWarning         *prometheus.Desc
+	temperature             *prometheus.Desc
+	availableSpare          *prometheus.Desc
+	availableSpareThreshold *prometheus.Desc
+	enduranceUsed           *prometheus.Desc
+	readBytes               *prometheus.Desc
+	writtenBytes            *prometheus.Desc
+	hostReads               *prometheus.Desc
+	hostWrites              *prometheus.Desc
+	powerCycles             *prometheus.Desc
+	powerOnSeconds          *prometheus.Desc
+	unsafeShutdowns         *prometheus.Desc
+	mediaErrors             *prometheus.Desc
+	errorLogEntries         *prometheus.Desc
+	logger                  log.Logger
+}
+
+func init() {
+	registerCollector("nvme", defaultDisabled, NewNVMeCollector)
+}
+
+// NewNVMeCollector returns a new Collector exposing the SMART / health
+// information of NVMe controllers.
+func NewNVMeCollector(logger log.Logger) (Collector, error) {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nvmeSubsystem, name),
+			help,
+			[]string{"device"}, nil,
+		)
+	}
+	return &nvmeCollector{
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nvmeSubsystem, "info"),
+			"Non-numeric data from /sys/class/nvme/<device>, value is always 1.",
+			[]string{"device", "model", "serial", "firmware_revision"}, nil,
+		),
+		controllerInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nvmeSubsystem, "controller_info"),
+			"Transport information of the controller, value is always 1.",
+			[]string{"device", "transport", "address", "subsystem_nqn"}, nil,
+		),
+		state: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nvmeSubsystem, "controller_state"),
+			"State of the controller, connecting means the host is reconnecting to a fabrics controller.",
+			[]string{"device", "state"}, nil,
+		),
+		ioQueues:                desc("io_queues", "Number of I/O queues of the controller."),
+		queueSize:               desc("io_queue_size", "Number of entries of each I/O submission queue."),
+		reconnectDelay:          desc("reconnect_delay_seconds", "Delay between reconnect attempts to a fabrics controller."),
+		ctrlLossTimeout:         desc("ctrl_loss_timeout_seconds", "Time after which the host stops reconnecting to a fabrics controller and removes it."),
+		criticalWarning:         desc("critical_warning", "Critical warning bit field of the SMART / health log."),
+		temperature:             desc("temperature_celsius", "Composite temperature of the controller."),
+		availableSpare:          desc("available_spare_ratio", "Remaining spare capacity that is available."),
+		availableSpareThreshold: desc("available_spare_threshold_ratio", "Available spare threshold below which a critical warning is raised."),
+		enduranceUsed:           desc("endurance_used_ratio", "Vendor estimate of the life of the device that is used, may exceed 1."),
+		readBytes:               desc("read_bytes_total", "Number of bytes read by the host."),
+		writtenBytes:            desc("written_bytes_total", "Number of bytes written by the host."),
+		hostReads:               desc("host_read_commands_total", "Number of read commands completed by the controller."),
+		hostWrites:              desc("host_write_commands_total", "Number of write commands completed by the controller."),
+		powerCycles:             desc("power_cycles_total", "Number of power cycles."),
+		powerOnSeconds:          desc("power_on_seconds_total", "Power-on time of the controller, with hour resolution."),
+		unsafeShutdowns:         desc("unsafe_shutdowns_total", "Number of unsafe shutdowns."),
+		mediaErrors:             desc("media_errors_total", "Number of unrecovered data integrity errors."),
+		errorLogEntries:         desc("error_log_entries_total", "Number of error information log entries over the life of the controller."),
+		logger:                  logger,
+	}, nil
+}
+
+func (c *nvmeCollector) Update(ch chan<- prometheus.Metric) error {
+	controllers, err := filepath.Glob(sysFilePath("class/nvme/nvme[0-9]*"))
+	if err != nil {
+		return err
+	}
+	if len(controllers) == 0 {
+		level.Debug(c.logger).Log("msg", "no NVMe controllers found, skipping")
+		return ErrNoData
+	}
+
+	for _, controller := range controllers {
+		device := filepath.Base(controller)
+		model, _ := readStringFromFile(filepath.Join(controller, "model"))
+		serial, _ := readStringFromFile(filepath.Join(controller, "serial"))
+		firmware, _ := readStringFromFile(filepath.Join(controller, "firmware_rev"))
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, device, model, serial, firmware)
+
+		ctrl, err := readNVMeController(controller)
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't read controller attributes", "device", device, "err", err)
+		} else {
+			c.updateController(ch, device, ctrl)
+		}
+
+		smart, err := readNVMeSMARTLog(rootfsFilePath(filepath.Join("dev", device)))
+		if err != nil {
+			// Reading the log page needs CAP_SYS_ADMIN, fabrics
+			// controllers may also refuse it.
+			level.Debug(c.logger).Log("msg", "couldn't read SMART log", "device", device, "err", err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.criticalWarning, prometheus.GaugeValue, float64(smart.CriticalWarning), device)
+		ch <- prometheus.MustNewConstMetric(c.temperature, prometheus.GaugeValue, float64(smart.TemperatureKelvin)-273.15, device)
+		ch <- prometheus.MustNewConstMetric(c.availableSpare, prometheus.GaugeValue, float64(smart.AvailableSpare)/100, device)
+		ch <- prometheus.MustNewConstMetric(c.availableSpareThreshold, prometheus.GaugeValue, float64(smart.AvailableSpareThreshold)/100, device)
+		ch <- prometheus.MustNewConstMetric(c.enduranceUsed, prometheus.GaugeValue, float64(smart.PercentageUsed)/100, device)
+		ch <- prometheus.MustNewConstMetric(c.readBytes, prometheus.CounterValue, smart.DataUnitsRead*nvmeDataUnitBytes, device)
+		ch <- prometheus.MustNewConstMetric(c.writtenBytes, prometheus.CounterValue, smart.DataUnitsWritten*nvmeDataUnitBytes, device)
+		ch <- prometheus.MustNewConstMetric(c.hostReads, prometheus.CounterValue, smart.HostReadCommands, device)
+		ch <- prometheus.MustNewConstMetric(c.hostWrites, prometheus.CounterValue, smart.HostWriteCommands, device)
+		ch <- prometheus.MustNewConstMetric(c.powerCycles, prometheus.CounterValue, smart.PowerCycles, device)
+		ch <- prometheus.MustNewConstMetric(c.powerOnSeconds, prometheus.CounterValue, smart.PowerOnHours*3600, device)
+		ch <- prometheus.MustNewConstMetric(c.unsafeShutdowns, prometheus.CounterValue, smart.UnsafeShutdowns, device)
+		ch <- prometheus.MustNewConstMetric(c.mediaErrors, prometheus.CounterValue, smart.MediaErrors, device)
+		ch <- prometheus.MustNewConstMetric(c.errorLogEntries, prometheus.CounterValue, smart.ErrorLogEntries, device)
+	}
+
+	return nil
+}
+
+func (c *nvmeCollector) updateController(ch chan<- prometheus.Metric, device string, ctrl *nvmeController) {
+	ch <- prometheus.MustNewConstMetric(c.controllerInfo, prometheus.GaugeValue, 1, device, ctrl.Transport, ctrl.Address, ctrl.SubsystemNQN)
+	for _, s := range nvmeControllerStates {
+		v := 0.0
+		if s == ctrl.State {
+			v = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, v, device, s)
+	}
+	// The queue count includes the admin queue.
+	if ctrl.QueueCount > 0 {
+		ch <- prometheus.MustNewConstMetric(c.ioQueues, prometheus.GaugeValue, float64(ctrl.QueueCount-1), device)
+	}
+	ch <- prometheus.MustNewConstMetric(c.queueSize, prometheus.GaugeValue, float64(ctrl.SQSize+1), device)
+	if ctrl.ReconnectDelay != nil {
+		ch <- prometheus.MustNewConstMetric(c.reconnectDelay, prometheus.GaugeValue, float64(*ctrl.ReconnectDelay), device)
+	}
+	if ctrl.CtrlLossTimeout != nil {
+		ch <- prometheus.MustNewConstMetric(c.ctrlLossTimeout, prometheus.GaugeValue, float64(*ctrl.CtrlLossTimeout), device)
+	}
+}
+
+// readNVMeController reads the attributes of the controller in
+// /sys/class/nvme/<device>.
+func readNVMeController(path string) (*nvmeController, error) {
+	var (
+		ctrl nvmeController
+		err  error
+	)
+	if ctrl.State, err = readStringFromFile(filepath.Join(path, "state")); err != nil {
+		return nil, err
+	}
+	// Controllers being deleted report "deleting (no IO)" once their
+	// queues are shut down.
+	ctrl.State = strings.TrimSuffix(ctrl.State, " (no IO)")
+	if ctrl.Transport, err = readStringFromFile(filepath.Join(path, "transport")); err != nil {
+		return nil, err
+	}
+	ctrl.Address, _ = readStringFromFile(filepath.Join(path, "address"))
+	ctrl.SubsystemNQN, _ = readStringFromFile(filepath.Join(path, "subsysnqn"))
+	ctrl.QueueCount, _ = readUintFromFile(filepath.Join(path, "queue_count"))
+	ctrl.SQSize, _ = readUintFromFile(filepath.Join(path, "sqsize"))
+	// Only fabrics controllers have these, ctrl_loss_tmo is "off" when
+	// the host reconnects forever.
+	if v, err := readUintFromFile(filepath.Join(path, "reconnect_delay")); err == nil {
+		ctrl.ReconnectDelay = &v
+	}
+	if v, err := readUintFromFile(filepath.Join(path, "ctrl_loss_tmo")); err == nil {
+		ctrl.CtrlLossTimeout = &v
+	}
+	return &ctrl, nil
+}
+
+// readNVMeSMARTLog fetches the SMART / health log page of a controller with
+// a Get Log Page admin command.
+func readNVMeSMARTLog(path string) (*nvmeSMARTLog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, nvmeSMARTLogSize)
+	cmd := nvmeAdminCmd{
+		Opcode:  nvmeAdminGetLogPage,
+		NSID:    0xffffffff,
+		Addr:    uint64(uintptr(unsafe.Pointer(&buf[0]))),
+		DataLen: nvmeSMARTLogSize,
+		// Number of dwords to read minus one, and the log page identifier.
+		Cdw10: (nvmeSMARTLogSize/4-1)<<16 | nvmeLogSMART,
+	}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), nvmeIoctlAdminCmd, uintptr(unsafe.Pointer(&cmd)))
+	runtime.KeepAlive(buf)
+	if errno != 0 {
+		return nil, fmt.Errorf("NVMe admin command failed: %w", errno)
+	}
+
+	return parseNVMeSMARTLog(buf)
+}
+
+func parseNVMeSMARTLog(b []byte) (*nvmeSMARTLog, error) {
+	if len(b) < nvmeSMARTLogSize {
+		return nil, fmt.Errorf("SMART log too short: %d bytes", len(b))
+	}
+	// 128-bit little endian counters.
+	u128 := func(offset int) float64 {
+		lo := binary.LittleEndian.Uint64(b[offset : offset+8])
+		hi := binary.LittleEndian.Uint64(b[offset+8 : offset+16])
+		return float64(hi)*math.Pow(2, 64) + float64(lo)
+	}
+	return &nvmeSMARTLog{
+		CriticalWarning:         b[0],
+		TemperatureKelvin:       binary.LittleEndian.Uint16(b[1:3]),
+		AvailableSpare:          b[3],
+		AvailableSpareThreshold: b[4],
+		PercentageUsed:          b[5],
+		DataUnitsRead:           u128(32),
+		DataUnitsWritten:        u128(48),
+		HostReadCommands:        u128(64),
+		HostWriteCommands:       u128(80),
+		PowerCycles:             u128(112),
+		PowerOnHours:            u128(128),
+		UnsafeShutdowns:         u128(144),
+		MediaErrors:             u128(160),
+		ErrorLogEntries:         u128(176),
+	}, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nonvme
+
+package collector
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseNVMeSMARTLog(t *testing.T) {
+	b := make([]byte, nvmeSMARTLogSize)
+	b[0] = 0x04
+	binary.LittleEndian.PutUint16(b[1:3], 310)
+	b[3] = 100
+	b[4] = 10
+	b[5] = 3
+	binary.LittleEndian.PutUint64(b[32:], 1234)
+	binary.LittleEndian.PutUint64(b[48:], 5678)
+	binary.LittleEndian.PutUint64(b[112:], 42)
+	binary.LittleEndian.PutUint64(b[128:], 9000)
+	binary.LittleEndian.PutUint64(b[144:], 7)
+	binary.LittleEndian.PutUint64(b[168:], 1)
+
+	smart, err := parseNVMeSMARTLog(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct{ got, want float64 }{
+		"critical warning":  {float64(smart.CriticalWarning), 4},
+		"temperature":       {float64(smart.TemperatureKelvin), 310},
+		"available spare":   {float64(smart.AvailableSpare), 100},
+		"spare threshold":   {float64(smart.AvailableSpareThreshold), 10},
+		"percentage used":   {float64(smart.PercentageUsed), 3},
+		"data units read":   {smart.DataUnitsRead, 1234},
+		"data units write":  {smart.DataUnitsWritten, 5678},
+		"power cycles":      {smart.PowerCycles, 42},
+		"power on hours":    {smart.PowerOnHours, 9000},
+		"unsafe shutdowns":  {smart.UnsafeShutdowns, 7},
+		"media errors":      {smart.MediaErrors, math.Pow(2, 64)},
+		"error log entries": {smart.ErrorLogEntries, 0},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s: want %v, got %v", name, tc.want, tc.got)
+		}
+	}
+
+	if _, err := parseNVMeSMARTLog(b[:100]); err == nil {
+		t.Error("expected error for truncated log")
+	}
+}
+
+func TestReadNVMeController(t *testing.T) {
+	ctrl, err := readNVMeController("fixtures/sys/class/nvme/nvme1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reconnectDelay, ctrlLossTimeout := uint64(10), uint64(600)
+	want := nvmeController{
+		State:           "connecting",
+		Transport:       "tcp",
+		Address:         "traddr=192.168.1.10,trsvcid=4420,src_addr=192.168.1.20",
+		SubsystemNQN:    "nqn.2020-06.io.example:storage1",
+		QueueCount:      5,
+		SQSize:          127,
+		ReconnectDelay:  &reconnectDelay,
+		CtrlLossTimeout: &ctrlLossTimeout,
+	}
+	if !reflect.DeepEqual(*ctrl, want) {
+		t.Errorf("want controller %+v, got %+v", want, *ctrl)
+	}
+}
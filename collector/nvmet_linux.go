@@ -0,0 +1,336 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nonvmet
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	nvmetSubsystem = "nvmet"
+
+	// The block layer always accounts in 512-byte sectors, regardless of
+	// the logical block size of the underlying device.
+	nvmetSectorSize = 512
+)
+
+type nvmetCollector struct {
+	portInfo         *prometheus.Desc
+	allowedHosts     *prometheus.Desc
+	connectedHosts   *prometheus.Desc
+	namespaceEnabled *prometheus.Desc
+	readsCompleted   *prometheus.Desc
+	writesCompleted  *prometheus.Desc
+	readBytes        *prometheus.Desc
+	writtenBytes     *prometheus.Desc
+	logger           log.Logger
+}
+
+// nvmetNamespace is a namespace exported by an NVMe-oF target subsystem.
+type nvmetNamespace struct {
+	ID         string
+	DevicePath string
+	Enabled    bool
+}
+
+// nvmetSubsys is an NVMe-oF target subsystem from the nvmet configfs tree.
+type nvmetSubsys struct {
+	NQN            string
+	AllowedHosts   int
+	ConnectedHosts int
+	// HasDebugfs is set when the per-controller debugfs entries were found,
+	// meaning ConnectedHosts holds a valid value.
+	HasDebugfs bool
+	Namespaces []nvmetNamespace
+}
+
+// nvmetPort is an NVMe-oF target port from the nvmet configfs tree.
+type nvmetPort struct {
+	ID        string
+	Transport string
+	Address   string
+	Service   string
+}
+
+func init() {
+	registerCollector("nvmet", defaultDisabled, NewNVMetCollector)
+}
+
+// NewNVMetCollector returns a new Collector exposing NVMe-oF target statistics.
+func NewNVMetCollector(logger log.Logger) (Collector, error) {
+	namespaceLabels := []string{"subsystem", "namespace", "device"}
+	return &nvmetCollector{
+		portInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nvmetSubsystem, "port_info"),
+			"Non-numeric data from /sys/kernel/config/nvmet/ports/<port>, value is always 1.",
+			[]string{"port", "transport", "address", "service"}, nil,
+		),
+		allowedHosts: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nvmetSubsystem, "subsystem_allowed_hosts"),
+			"Number of hosts allowed to connect to the subsystem.",
+			[]string{"subsystem"}, nil,
+		),
+		connectedHosts: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nvmetSubsystem, "subsystem_connected_hosts"),
+			"Number of host controllers currently connected to the subsystem.",
+			[]string{"subsystem"}, nil,
+		),
+		namespaceEnabled: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nvmetSubsystem, "namespace_enabled"),
+			"Whether the namespace is enabled (1) or not (0).",
+			namespaceLabels, nil,
+		),
+		readsCompleted: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nvmetSubsystem, "namespace_reads_completed_total"),
+			"The total number of reads completed successfully by the namespace backing device.",
+			namespaceLabels, nil,
+		),
+		writesCompleted: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nvmetSubsystem, "namespace_writes_completed_total"),
+			"The total number of writes completed successfully by the namespace backing device.",
+			namespaceLabels, nil,
+		),
+		readBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nvmetSubsystem, "namespace_read_bytes_total"),
+			"The total number of bytes read successfully by the namespace backing device.",
+			namespaceLabels, nil,
+		),
+		writtenBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nvmetSubsystem, "namespace_written_bytes_total"),
+			"The total number of bytes written successfully by the namespace backing device.",
+			namespaceLabels, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *nvmetCollector) Update(ch chan<- prometheus.Metric) error {
+	root := sysFilePath("kernel/config/nvmet")
+	if _, err := os.Stat(root); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "nvmet configfs not found, skipping", "path", root)
+			return ErrNoData
+		}
+		return err
+	}
+
+	ports, err := readNVMetPorts(c.logger, root)
+	if err != nil {
+		return fmt.Errorf("couldn't get nvmet ports: %w", err)
+	}
+	for _, p := range ports {
+		ch <- prometheus.MustNewConstMetric(c.portInfo, prometheus.GaugeValue, 1, p.ID, p.Transport, p.Address, p.Service)
+	}
+
+	subsystems, err := readNVMetSubsystems(c.logger, root, sysFilePath("kernel/debug/nvmet"))
+	if err != nil {
+		return fmt.Errorf("couldn't get nvmet subsystems: %w", err)
+	}
+	for _, s := range subsystems {
+		ch <- prometheus.MustNewConstMetric(c.allowedHosts, prometheus.GaugeValue, float64(s.AllowedHosts), s.NQN)
+		if s.HasDebugfs {
+			ch <- prometheus.MustNewConstMetric(c.connectedHosts, prometheus.GaugeValue, float64(s.ConnectedHosts), s.NQN)
+		}
+
+		for _, ns := range s.Namespaces {
+			device := filepath.Base(ns.DevicePath)
+			enabled := 0.0
+			if ns.Enabled {
+				enabled = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.namespaceEnabled, prometheus.GaugeValue, enabled, s.NQN, ns.ID, device)
+
+			stats, err := readNVMetDeviceStats(ns.DevicePath)
+			if err != nil {
+				// File backed namespaces have no block device statistics.
+				level.Debug(c.logger).Log("msg", "couldn't get block device statistics", "subsystem", s.NQN, "namespace", ns.ID, "device_path", ns.DevicePath, "err", err)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(c.readsCompleted, prometheus.CounterValue, float64(stats[0]), s.NQN, ns.ID, device)
+			ch <- prometheus.MustNewConstMetric(c.readBytes, prometheus.CounterValue, float64(stats[2]*nvmetSectorSize), s.NQN, ns.ID, device)
+			ch <- prometheus.MustNewConstMetric(c.writesCompleted, prometheus.CounterValue, float64(stats[4]), s.NQN, ns.ID, device)
+			ch <- prometheus.MustNewConstMetric(c.writtenBytes, prometheus.CounterValue, float64(stats[6]*nvmetSectorSize), s.NQN, ns.ID, device)
+		}
+	}
+
+	return nil
+}
+
+// readNVMetPorts returns the ports of the target. A port that can't be read
+// is logged and left out.
+func readNVMetPorts(logger log.Logger, root string) ([]nvmetPort, error) {
+	dirs, err := ioutil.ReadDir(filepath.Join(root, "ports"))
+	if err != nil {
+		return nil, err
+	}
+
+	ports := make([]nvmetPort, 0, len(dirs))
+	for _, d := range dirs {
+		p, err := readNVMetPort(filepath.Join(root, "ports", d.Name()))
+		if err != nil {
+			level.Debug(logger).Log("msg", "couldn't read nvmet port", "port", d.Name(), "err", err)
+			continue
+		}
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
+
+func readNVMetPort(path string) (nvmetPort, error) {
+	transport, err := readNVMetAttr(path, "addr_trtype")
+	if err != nil {
+		return nvmetPort{}, err
+	}
+	address, err := readNVMetAttr(path, "addr_traddr")
+	if err != nil {
+		return nvmetPort{}, err
+	}
+	service, err := readNVMetAttr(path, "addr_trsvcid")
+	if err != nil {
+		return nvmetPort{}, err
+	}
+	return nvmetPort{
+		ID:        filepath.Base(path),
+		Transport: transport,
+		Address:   address,
+		Service:   service,
+	}, nil
+}
+
+// readNVMetSubsystems returns the subsystems of the target. A subsystem or
+// namespace that can't be read is logged and left out.
+func readNVMetSubsystems(logger log.Logger, root, debugRoot string) ([]nvmetSubsys, error) {
+	dirs, err := ioutil.ReadDir(filepath.Join(root, "subsystems"))
+	if err != nil {
+		return nil, err
+	}
+
+	subsystems := make([]nvmetSubsys, 0, len(dirs))
+	for _, d := range dirs {
+		s, err := readNVMetSubsys(logger, filepath.Join(root, "subsystems", d.Name()), debugRoot)
+		if err != nil {
+			level.Debug(logger).Log("msg", "couldn't read nvmet subsystem", "subsystem", d.Name(), "err", err)
+			continue
+		}
+		subsystems = append(subsystems, s)
+	}
+	return subsystems, nil
+}
+
+func readNVMetSubsys(logger log.Logger, path, debugRoot string) (nvmetSubsys, error) {
+	s := nvmetSubsys{NQN: filepath.Base(path)}
+
+	hosts, err := ioutil.ReadDir(filepath.Join(path, "allowed_hosts"))
+	if err != nil {
+		return nvmetSubsys{}, err
+	}
+	s.AllowedHosts = len(hosts)
+
+	// Connected controllers are only exposed through debugfs on recent kernels.
+	if _, err := os.Stat(filepath.Join(debugRoot, s.NQN)); err == nil {
+		ctrls, err := filepath.Glob(filepath.Join(debugRoot, s.NQN, "ctrl*"))
+		if err != nil {
+			return nvmetSubsys{}, err
+		}
+		s.HasDebugfs = true
+		s.ConnectedHosts = len(ctrls)
+	}
+
+	namespaces, err := ioutil.ReadDir(filepath.Join(path, "namespaces"))
+	if err != nil {
+		return nvmetSubsys{}, err
+	}
+	for _, n := range namespaces {
+		ns, err := readNVMetNamespace(filepath.Join(path, "namespaces", n.Name()))
+		if err != nil {
+			level.Debug(logger).Log("msg", "couldn't read nvmet namespace", "subsystem", s.NQN, "namespace", n.Name(), "err", err)
+			continue
+		}
+		s.Namespaces = append(s.Namespaces, ns)
+	}
+	return s, nil
+}
+
+func readNVMetNamespace(path string) (nvmetNamespace, error) {
+	devicePath, err := readNVMetAttr(path, "device_path")
+	if err != nil {
+		return nvmetNamespace{}, err
+	}
+	enable, err := readNVMetAttr(path, "enable")
+	if err != nil {
+		return nvmetNamespace{}, err
+	}
+	switch enable {
+	case "", "0", "1":
+	default:
+		return nvmetNamespace{}, fmt.Errorf("invalid enable value %q", enable)
+	}
+	return nvmetNamespace{
+		ID:         filepath.Base(path),
+		DevicePath: devicePath,
+		Enabled:    enable == "1",
+	}, nil
+}
+
+// readNVMetDeviceStats returns the fields of /sys/block/<dev>/stat for the
+// block device backing a namespace.
+func readNVMetDeviceStats(devicePath string) ([]uint64, error) {
+	if devicePath == "" {
+		return nil, errors.New("namespace has no device_path")
+	}
+	// Resolve /dev/mapper and /dev/disk/by-* links to the kernel device name.
+	if resolved, err := filepath.EvalSymlinks(rootfsFilePath(devicePath)); err == nil {
+		devicePath = resolved
+	}
+
+	data, err := ioutil.ReadFile(sysFilePath(filepath.Join("block", filepath.Base(devicePath), "stat")))
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 7 {
+		return nil, fmt.Errorf("invalid block device stat line: %q", string(data))
+	}
+
+	stats := make([]uint64, len(fields))
+	for i, f := range fields {
+		stats[i], err = strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// readNVMetAttr reads an attribute, which is empty if the kernel doesn't
+// have it.
+func readNVMetAttr(dir, name string) (string, error) {
+	value, err := readStringFromFile(filepath.Join(dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return value, nil
+}
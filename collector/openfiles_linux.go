@@ -0,0 +1,231 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noopenfiles
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+const (
+	openFilesSubsystem = "openfiles"
+
+	// Suffix of /proc/<pid>/fd link targets of unlinked files.
+	openFilesDeletedSuffix = " (deleted)"
+)
+
+// openFilesInode identifies a file by its device and inode number.
+type openFilesInode struct {
+	dev uint64
+	ino uint64
+}
+
+// openFilesMounts is the set of mount points.
+type openFilesMounts map[string]bool
+
+// openFilesUsage is the number of files open on a mount point and the
+// space pinned by open files which were deleted.
+type openFilesUsage struct {
+	processes    uint64
+	files        uint64
+	deletedFiles uint64
+	deletedBytes uint64
+}
+
+type openFilesCollector struct {
+	fs           procfs.FS
+	processes    *prometheus.Desc
+	files        *prometheus.Desc
+	deletedFiles *prometheus.Desc
+	deletedBytes *prometheus.Desc
+	logger       log.Logger
+}
+
+func init() {
+	registerCollector("openfiles", defaultDisabled, NewOpenFilesCollector)
+}
+
+// NewOpenFilesCollector returns a new Collector exposing open file
+// descriptors by mount point.
+func NewOpenFilesCollector(logger log.Logger) (Collector, error) {
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open procfs: %w", err)
+	}
+
+	labels := []string{"mountpoint"}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, openFilesSubsystem, name),
+			help, labels, nil,
+		)
+	}
+	return &openFilesCollector{
+		fs:           fs,
+		processes:    desc("processes", "Number of processes with files open on the mount point."),
+		files:        desc("files", "Number of file descriptors open on the mount point."),
+		deletedFiles: desc("deleted_files", "Number of file descriptors open on the mount point referring to deleted files."),
+		deletedBytes: desc("deleted_bytes", "Size of deleted files kept open on the mount point."),
+		logger:       logger,
+	}, nil
+}
+
+func (c *openFilesCollector) Update(ch chan<- prometheus.Metric) error {
+	root, err := c.fs.Proc(1)
+	if err != nil {
+		// Fallback to our own mount namespace if /proc/1 is hidden.
+		if root, err = c.fs.Self(); err != nil {
+			return fmt.Errorf("couldn't open root process: %w", err)
+		}
+	}
+	mounts, err := root.MountInfo()
+	if err != nil {
+		return fmt.Errorf("couldn't read mountinfo: %w", err)
+	}
+	mountPoints := make(openFilesMounts, len(mounts))
+	for _, m := range mounts {
+		mountPoints[unescapeMountPoint(m.MountPoint)] = true
+	}
+	rootNS := openFilesMountNamespace(procFilePath(strconv.Itoa(root.PID)))
+
+	procs, err := c.fs.AllProcs()
+	if err != nil {
+		return fmt.Errorf("unable to list processes: %w", err)
+	}
+
+	usage := make(map[string]*openFilesUsage)
+	// Deleted files open in several processes pin their space once.
+	deleted := make(map[openFilesInode]bool)
+	for _, p := range procs {
+		procDir := procFilePath(strconv.Itoa(p.PID))
+		// Paths of processes in other mount namespaces can't be
+		// resolved against the mount points of the root process.
+		if openFilesMountNamespace(procDir) != rootNS {
+			continue
+		}
+		files, err := readOpenFiles(procDir, mountPoints, deleted)
+		if err != nil {
+			// Processes can vanish and file descriptors of other
+			// users' processes are not readable without privileges.
+			level.Debug(c.logger).Log("msg", "couldn't read open files", "pid", p.PID, "err", err)
+			continue
+		}
+		for mountPoint, f := range files {
+			u, ok := usage[mountPoint]
+			if !ok {
+				u = &openFilesUsage{}
+				usage[mountPoint] = u
+			}
+			u.processes++
+			u.files += f.files
+			u.deletedFiles += f.deletedFiles
+			u.deletedBytes += f.deletedBytes
+		}
+	}
+
+	for mountPoint, u := range usage {
+		mountPoint = rootfsStripPrefix(mountPoint)
+		ch <- prometheus.MustNewConstMetric(c.processes, prometheus.GaugeValue, float64(u.processes), mountPoint)
+		ch <- prometheus.MustNewConstMetric(c.files, prometheus.GaugeValue, float64(u.files), mountPoint)
+		ch <- prometheus.MustNewConstMetric(c.deletedFiles, prometheus.GaugeValue, float64(u.deletedFiles), mountPoint)
+		ch <- prometheus.MustNewConstMetric(c.deletedBytes, prometheus.GaugeValue, float64(u.deletedBytes), mountPoint)
+	}
+
+	return nil
+}
+
+// openFilesMountNamespace returns the mount namespace of the process with
+// the given /proc/<pid> directory, or an empty string if it is unknown.
+func openFilesMountNamespace(procDir string) string {
+	ns, err := os.Readlink(filepath.Join(procDir, "ns/mnt"))
+	if err != nil {
+		return ""
+	}
+	return ns
+}
+
+// readOpenFiles returns the files opened by the process with the given
+// /proc/<pid> directory by mount point. The processes field of the returned
+// usage is not set. The size of deleted files is only accounted if they
+// aren't in deleted yet, they are added to it.
+func readOpenFiles(procDir string, mountPoints openFilesMounts, deleted map[openFilesInode]bool) (map[string]*openFilesUsage, error) {
+	files := make(map[string]*openFilesUsage)
+	err := walkProcFds(procDir, func(f procFd) error {
+		// Sockets, pipes and anonymous inodes don't have a path.
+		if !strings.HasPrefix(f.target, "/") {
+			return nil
+		}
+		isDeleted := strings.HasSuffix(f.target, openFilesDeletedSuffix)
+		mountPoint := mountPoints.mountPoint(strings.TrimSuffix(f.target, openFilesDeletedSuffix))
+		if mountPoint == "" {
+			return nil
+		}
+
+		u, ok := files[mountPoint]
+		if !ok {
+			u = &openFilesUsage{}
+			files[mountPoint] = u
+		}
+		u.files++
+		if !isDeleted {
+			return nil
+		}
+		u.deletedFiles++
+		// The link can be followed even though the file was deleted.
+		fi, err := os.Stat(f.path())
+		if err != nil || !fi.Mode().IsRegular() {
+			return nil
+		}
+		st, ok := fi.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		inode := openFilesInode{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+		if !deleted[inode] {
+			deleted[inode] = true
+			u.deletedBytes += uint64(fi.Size())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// mountPoint returns the longest of the mount points containing path, by
+// looking up path and its parent directories.
+func (m openFilesMounts) mountPoint(path string) string {
+	for {
+		if m[path] {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return ""
+		}
+		path = parent
+	}
+}
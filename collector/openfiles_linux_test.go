@@ -0,0 +1,91 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noopenfiles
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadOpenFiles(t *testing.T) {
+	mountPoints := openFilesMounts{"/": true, "/dev": true, "/dev/shm": true, "/boot": true, "/var/log/syslog": true}
+	files, err := readOpenFiles("fixtures/proc/4245", mountPoints, map[openFilesInode]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]openFilesUsage{
+		"/":        {files: 1, deletedFiles: 1},
+		"/dev":     {files: 1},
+		"/dev/shm": {files: 1, deletedFiles: 1},
+		"/boot":    {files: 1},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("want %d mount points, got %d", len(want), len(files))
+	}
+	for mountPoint, w := range want {
+		got, ok := files[mountPoint]
+		if !ok {
+			t.Errorf("missing mount point %s", mountPoint)
+			continue
+		}
+		if *got != w {
+			t.Errorf("%s: want %+v, got %+v", mountPoint, w, *got)
+		}
+	}
+}
+
+func TestReadOpenFilesDeletedOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "openfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The link target of a deleted file, which still resolves.
+	file := filepath.Join(dir, "log"+openFilesDeletedSuffix)
+	if err := ioutil.WriteFile(file, make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, pid := range []string{"1", "2"} {
+		if err := os.MkdirAll(filepath.Join(dir, pid, "fd"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, fd := range []string{"3", "4"} {
+			if err := os.Symlink(file, filepath.Join(dir, pid, "fd", fd)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	mountPoints := openFilesMounts{"/": true}
+	deleted := map[openFilesInode]bool{}
+	var total openFilesUsage
+	for _, pid := range []string{"1", "2"} {
+		files, err := readOpenFiles(filepath.Join(dir, pid), mountPoints, deleted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total.files += files["/"].files
+		total.deletedFiles += files["/"].deletedFiles
+		total.deletedBytes += files["/"].deletedBytes
+	}
+	if want := (openFilesUsage{files: 4, deletedFiles: 4, deletedBytes: 4096}); total != want {
+		t.Errorf("want %+v, got %+v", want, total)
+	}
+}
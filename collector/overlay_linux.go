@@ -0,0 +1,187 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nooverlay
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const overlaySubsystem = "overlay"
+
+var overlayRefreshInterval = kingpin.Flag("collector.overlay.refresh-interval", "Minimum interval between walks of the upper directory of an overlay mount, scrapes in between return the last usage.").Default("5m").Duration()
+
+// The usage of the upper directories is shared by all instances of the
+// collector.
+var (
+	overlayUsageCache    = make(map[string]overlayUsage)
+	overlayUsageCacheMtx sync.Mutex
+)
+
+// overlayUsage is the usage of an upper directory at the time of the walk.
+type overlayUsage struct {
+	used   uint64
+	inodes uint64
+	time   time.Time
+}
+
+type overlayCollector struct {
+	info      *prometheus.Desc
+	usedBytes *prometheus.Desc
+	inodes    *prometheus.Desc
+	logger    log.Logger
+}
+
+func init() {
+	registerCollector("overlay", defaultDisabled, NewOverlayCollector)
+}
+
+// NewOverlayCollector returns a new Collector exposing the usage of the
+// upper (writable) layer of overlay mounts.
+func NewOverlayCollector(logger log.Logger) (Collector, error) {
+	return &overlayCollector{
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, overlaySubsystem, "info"),
+			"Layer directories of the overlay mount, value is always 1.",
+			[]string{"mountpoint", "upperdir", "workdir"}, nil,
+		),
+		usedBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, overlaySubsystem, "upper_used_bytes"),
+			"Disk space used by the upper layer of the overlay mount.",
+			[]string{"mountpoint"}, nil,
+		),
+		inodes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, overlaySubsystem, "upper_inodes"),
+			"Number of inodes used by the upper layer of the overlay mount.",
+			[]string{"mountpoint"}, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *overlayCollector) Update(ch chan<- prometheus.Metric) error {
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return fmt.Errorf("failed to open procfs: %w", err)
+	}
+	proc, err := fs.Self()
+	if err != nil {
+		return fmt.Errorf("failed to open /proc/self: %w", err)
+	}
+	mounts, err := proc.MountInfo()
+	if err != nil {
+		return fmt.Errorf("failed to parse mountinfo: %w", err)
+	}
+
+	overlayUsageCacheMtx.Lock()
+	defer overlayUsageCacheMtx.Unlock()
+
+	seen := make(map[string]bool)
+	upperDirs := make(map[string]bool)
+	for _, m := range mounts {
+		upperDir := m.SuperOptions["upperdir"]
+		if m.FSType != "overlay" || upperDir == "" {
+			continue
+		}
+		mountPoint := rootfsStripPrefix(m.MountPoint)
+		if seen[mountPoint] {
+			continue
+		}
+		seen[mountPoint] = true
+
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, mountPoint, upperDir, m.SuperOptions["workdir"])
+
+		upperDirs[upperDir] = true
+		usage, ok := overlayUsageCache[upperDir]
+		if !ok || time.Since(usage.time) >= *overlayRefreshInterval {
+			used, inodes, err := overlayDirUsage(rootfsFilePath(upperDir))
+			if err != nil {
+				level.Debug(c.logger).Log("msg", "couldn't get usage of upper directory", "mountpoint", mountPoint, "upperdir", upperDir, "err", err)
+				delete(overlayUsageCache, upperDir)
+				continue
+			}
+			usage = overlayUsage{used: used, inodes: inodes, time: time.Now()}
+			overlayUsageCache[upperDir] = usage
+		}
+		ch <- prometheus.MustNewConstMetric(c.usedBytes, prometheus.GaugeValue, float64(usage.used), mountPoint)
+		ch <- prometheus.MustNewConstMetric(c.inodes, prometheus.GaugeValue, float64(usage.inodes), mountPoint)
+	}
+	// Forget the usage of unmounted overlays.
+	for upperDir := range overlayUsageCache {
+		if !upperDirs[upperDir] {
+			delete(overlayUsageCache, upperDir)
+		}
+	}
+
+	if len(seen) == 0 {
+		level.Debug(c.logger).Log("msg", "no overlay mounts found, skipping")
+		return ErrNoData
+	}
+	return nil
+}
+
+// overlayDirUsage returns the disk space and the number of inodes used below
+// dir, like du(1) hard links are counted once. Like du -x, mounts below dir
+// aren't walked.
+func overlayDirUsage(dir string) (uint64, uint64, error) {
+	var (
+		used, inodes uint64
+		dev          uint64
+		links        = make(map[uint64]bool)
+	)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files come and go while containers are running.
+			if os.IsNotExist(err) && path != dir {
+				return nil
+			}
+			return err
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return fmt.Errorf("unexpected file info for %s", path)
+		}
+		if path == dir {
+			dev = uint64(st.Dev)
+		} else if uint64(st.Dev) != dev {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if st.Nlink > 1 && !info.IsDir() {
+			if links[st.Ino] {
+				return nil
+			}
+			links[st.Ino] = true
+		}
+		used += uint64(st.Blocks) * 512
+		inodes++
+		return nil
+	})
+	return used, inodes, err
+}
@@ -0,0 +1,53 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nooverlay
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOverlayDirUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overlay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.Mkdir(filepath.Join(dir, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "etc", "hosts"), make([]byte, 8192), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(dir, "etc", "hosts"), filepath.Join(dir, "hosts")); err != nil {
+		t.Fatal(err)
+	}
+
+	used, inodes, err := overlayDirUsage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The upper directory itself, etc and the hard linked file.
+	if inodes != 3 {
+		t.Errorf("want 3 inodes, got %d", inodes)
+	}
+	if used < 8192 {
+		t.Errorf("want at least 8192 bytes used, got %d", used)
+	}
+}
@@ -26,6 +26,7 @@ var (
 	procPath   = kingpin.Flag("path.procfs", "procfs mountpoint.").Default(procfs.DefaultMountPoint).String()
 	sysPath    = kingpin.Flag("path.sysfs", "sysfs mountpoint.").Default("/sys").String()
 	rootfsPath = kingpin.Flag("path.rootfs", "rootfs mountpoint.").Default("/").String()
+	udevPath   = kingpin.Flag("path.udev.data", "udev data path.").Default("/run/udev/data").String()
 )
 
 func procFilePath(name string) string {
@@ -40,6 +41,10 @@ func rootfsFilePath(name string) string {
 	return filepath.Join(*rootfsPath, name)
 }
 
+func udevDataFilePath(name string) string {
+	return filepath.Join(*udevPath, name)
+}
+
 func rootfsStripPrefix(path string) string {
 	if *rootfsPath == "/" {
 		return path
@@ -0,0 +1,84 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// procFd is an open file descriptor of a process.
+type procFd struct {
+	procDir string
+	fd      string
+	// Target of the /proc/<pid>/fd/<fd> link.
+	target string
+}
+
+// path returns the /proc/<pid>/fd/<fd> link, which can be followed even if
+// the file was deleted.
+func (f procFd) path() string {
+	return filepath.Join(f.procDir, "fd", f.fd)
+}
+
+// readFdinfo parses /proc/<pid>/fdinfo/<fd>.
+func (f procFd) readFdinfo(parse func(io.Reader) error) error {
+	file, err := os.Open(filepath.Join(f.procDir, "fdinfo", f.fd))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := parse(file); err != nil {
+		return fmt.Errorf("couldn't parse fdinfo of fd %s: %w", f.fd, err)
+	}
+	return nil
+}
+
+// walkProcFds calls fn for each file descriptor of the process with the
+// given /proc/<pid> directory, in the order of their numbers as strings.
+// File descriptors closed while walking are skipped, including those for
+// which fn returns an error wrapping os.ErrNotExist.
+func walkProcFds(procDir string, fn func(procFd) error) error {
+	d, err := os.Open(filepath.Join(procDir, "fd"))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	fds, err := d.Readdirnames(-1)
+	if err != nil {
+		return err
+	}
+	sort.Strings(fds)
+
+	for _, fd := range fds {
+		target, err := os.Readlink(filepath.Join(procDir, "fd", fd))
+		if err != nil {
+			continue
+		}
+		err = fn(procFd{procDir: procDir, fd: fd, target: target})
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
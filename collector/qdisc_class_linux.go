@@ -0,0 +1,317 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noqdisc
+
+package collector
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+
+	"github.com/ema/qdisc"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+)
+
+const (
+	// Message types from <linux/rtnetlink.h>.
+	rtmGetQdisc  = 38
+	rtmGetClass  = 42
+	rtmGetFilter = 46
+
+	// Length of struct tcmsg preceding the attributes.
+	tcMsgLen = 20
+
+	// TCA_ACT_STATS and TCA_U32_PCNT from <linux/pkt_cls.h>.
+	tcaActStats = 4
+	tcaU32Pcnt  = 9
+)
+
+// tcFilterActions are the attributes holding the actions in the options of
+// the filter kinds from <linux/pkt_cls.h>.
+var tcFilterActions = map[string]uint16{
+	"basic":    3, // TCA_BASIC_ACT
+	"bpf":      1, // TCA_BPF_ACT
+	"cgroup":   1, // TCA_CGROUP_ACT
+	"flower":   3, // TCA_FLOWER_ACT
+	"fw":       4, // TCA_FW_ACT
+	"matchall": 2, // TCA_MATCHALL_ACT
+	"route":    6, // TCA_ROUTE4_ACT
+	"u32":      7, // TCA_U32_ACT
+}
+
+// tcStats are the statistics of a traffic control class or action.
+type tcStats struct {
+	bytes      uint64
+	packets    uint64
+	drops      uint64
+	overlimits uint64
+	requeues   uint64
+	qlen       uint64
+	backlog    uint64
+}
+
+// tcObject is a qdisc, class or filter from a tcmsg.
+type tcObject struct {
+	ifindex int
+	handle  uint32
+	parent  uint32
+	info    uint32
+	kind    string
+	stats   tcStats
+	// Statistics of the actions of a filter in the order they are run.
+	actions []tcStats
+	// Number of packets matched by a u32 filter, if the kernel counts
+	// them.
+	hits *uint64
+}
+
+// tcHandle formats a handle the way tc does, like "1:10".
+func tcHandle(h uint32) string {
+	if h == math.MaxUint32 {
+		return "root"
+	}
+	return fmt.Sprintf("%x:%x", h>>16, h&0xffff)
+}
+
+// getTCClassesAndFilters returns the classes and filters of all devices.
+// Filters are attached to qdiscs or classes and are dumped for each of them.
+func getTCClassesAndFilters() (map[string][]tcObject, map[string][]tcObject, error) {
+	const familyRoute = 0
+
+	c, err := netlink.Dial(familyRoute, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to dial netlink: %w", err)
+	}
+	defer c.Close()
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, nil, err
+	}
+	qdiscs, err := dumpTCObjects(c, rtmGetQdisc, 0, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	classes := make(map[string][]tcObject)
+	filters := make(map[string][]tcObject)
+	for _, iface := range ifaces {
+		// Children of multiqueue qdiscs share the handle 0 of the root.
+		parents := make(map[uint32]struct{})
+		for _, q := range qdiscs {
+			if q.ifindex == iface.Index {
+				parents[q.handle] = struct{}{}
+			}
+		}
+		if len(parents) == 0 {
+			continue
+		}
+
+		cls, err := dumpTCObjects(c, rtmGetClass, iface.Index, 0)
+		if err != nil {
+			return nil, nil, fmt.Errorf("couldn't dump classes of %s: %w", iface.Name, err)
+		}
+		classes[iface.Name] = cls
+		for _, cl := range cls {
+			parents[cl.handle] = struct{}{}
+		}
+
+		for parent := range parents {
+			fs, err := dumpTCObjects(c, rtmGetFilter, iface.Index, parent)
+			if err != nil {
+				return nil, nil, fmt.Errorf("couldn't dump filters of %s: %w", iface.Name, err)
+			}
+			filters[iface.Name] = append(filters[iface.Name], fs...)
+		}
+	}
+	return classes, filters, nil
+}
+
+func dumpTCObjects(c *netlink.Conn, typ netlink.HeaderType, ifindex int, parent uint32) ([]tcObject, error) {
+	req := netlink.Message{
+		Header: netlink.Header{
+			Flags: netlink.Request | netlink.Dump,
+			Type:  typ,
+		},
+		Data: make([]byte, tcMsgLen),
+	}
+	nlenc.PutUint32(req.Data[4:8], uint32(ifindex))
+	nlenc.PutUint32(req.Data[12:16], parent)
+
+	msgs, err := c.Execute(req)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]tcObject, 0, len(msgs))
+	for _, msg := range msgs {
+		o, err := parseTCObject(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, *o)
+	}
+	return objects, nil
+}
+
+// parseTCObject parses a tcmsg followed by its attributes.
+func parseTCObject(b []byte) (*tcObject, error) {
+	if len(b) < tcMsgLen {
+		return nil, fmt.Errorf("short message, len=%d", len(b))
+	}
+	o := tcObject{
+		ifindex: int(int32(nlenc.Uint32(b[4:8]))),
+		handle:  nlenc.Uint32(b[8:12]),
+		parent:  nlenc.Uint32(b[12:16]),
+		info:    nlenc.Uint32(b[16:20]),
+	}
+
+	ad, err := netlink.NewAttributeDecoder(b[tcMsgLen:])
+	if err != nil {
+		return nil, err
+	}
+	var options []byte
+	for ad.Next() {
+		switch ad.Type() {
+		case qdisc.TCA_KIND:
+			o.kind = ad.String()
+		case qdisc.TCA_OPTIONS:
+			options = ad.Bytes()
+		case qdisc.TCA_STATS2:
+			ad.Do(func(b []byte) error {
+				return parseTCStats(b, &o.stats)
+			})
+		}
+	}
+	if err := ad.Err(); err != nil {
+		return nil, err
+	}
+
+	if typ, ok := tcFilterActions[o.kind]; ok && options != nil {
+		actions, err := parseTCFilterActions(options, typ)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse actions of %s filter: %w", o.kind, err)
+		}
+		o.actions = actions
+	}
+	if o.kind == "u32" && options != nil {
+		hits, err := parseTCU32Hits(options)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse counters of u32 filter: %w", err)
+		}
+		o.hits = hits
+	}
+	return &o, nil
+}
+
+// parseTCU32Hits returns the hits of the struct tc_u32_pcnt of a u32 filter,
+// only available with CONFIG_CLS_U32_PERF.
+func parseTCU32Hits(options []byte) (*uint64, error) {
+	ad, err := netlink.NewAttributeDecoder(options)
+	if err != nil {
+		return nil, err
+	}
+	var hits *uint64
+	for ad.Next() {
+		if ad.Type() != tcaU32Pcnt {
+			continue
+		}
+		ad.Do(func(b []byte) error {
+			if len(b) < 16 {
+				return fmt.Errorf("short u32 counters, len=%d", len(b))
+			}
+			v := nlenc.Uint64(b[8:16])
+			hits = &v
+			return nil
+		})
+	}
+	return hits, ad.Err()
+}
+
+// parseTCFilterActions returns the statistics of the actions nested in the
+// options of a filter.
+func parseTCFilterActions(options []byte, typ uint16) ([]tcStats, error) {
+	ad, err := netlink.NewAttributeDecoder(options)
+	if err != nil {
+		return nil, err
+	}
+	var actions []tcStats
+	for ad.Next() {
+		if ad.Type() != typ {
+			continue
+		}
+		// Actions are nested by their position, starting at 1.
+		ad.Nested(func(nad *netlink.AttributeDecoder) error {
+			for nad.Next() {
+				var s tcStats
+				nad.Nested(func(act *netlink.AttributeDecoder) error {
+					for act.Next() {
+						if act.Type() == tcaActStats {
+							act.Do(func(b []byte) error {
+								return parseTCStats(b, &s)
+							})
+						}
+					}
+					return nil
+				})
+				actions = append(actions, s)
+			}
+			return nil
+		})
+	}
+	return actions, ad.Err()
+}
+
+// parseTCStats parses the nested struct gnet_stats_basic and
+// gnet_stats_queue from <linux/gen_stats.h>.
+func parseTCStats(b []byte, s *tcStats) error {
+	ad, err := netlink.NewAttributeDecoder(b)
+	if err != nil {
+		return err
+	}
+	for ad.Next() {
+		switch ad.Type() {
+		case qdisc.TCA_STATS_BASIC:
+			ad.Do(func(b []byte) error {
+				if len(b) < 12 {
+					return fmt.Errorf("short basic stats, len=%d", len(b))
+				}
+				s.bytes = nlenc.Uint64(b[0:8])
+				s.packets = uint64(nlenc.Uint32(b[8:12]))
+				return nil
+			})
+		case qdisc.TCA_STATS_QUEUE:
+			ad.Do(func(b []byte) error {
+				if len(b) < 20 {
+					return fmt.Errorf("short queue stats, len=%d", len(b))
+				}
+				s.qlen = uint64(nlenc.Uint32(b[0:4]))
+				s.backlog = uint64(nlenc.Uint32(b[4:8]))
+				s.drops = uint64(nlenc.Uint32(b[8:12]))
+				s.requeues = uint64(nlenc.Uint32(b[12:16]))
+				s.overlimits = uint64(nlenc.Uint32(b[16:20]))
+				return nil
+			})
+		}
+	}
+	return ad.Err()
+}
+
+// tcFilterPrio returns the priority of a filter, stored in the upper half of
+// tcm_info.
+func tcFilterPrio(info uint32) string {
+	return strconv.Itoa(int(info >> 16))
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noqdisc
+
+package collector
+
+import (
+	"testing"
+
+	"github.com/ema/qdisc"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+)
+
+func TestParseTCObject(t *testing.T) {
+	stats := func(bytes uint64, packets, drops uint32) func(*netlink.AttributeEncoder) error {
+		return func(ae *netlink.AttributeEncoder) error {
+			basic := make([]byte, 16)
+			nlenc.PutUint64(basic[0:8], bytes)
+			nlenc.PutUint32(basic[8:12], packets)
+			ae.Bytes(qdisc.TCA_STATS_BASIC, basic)
+			queue := make([]byte, 20)
+			nlenc.PutUint32(queue[8:12], drops)
+			ae.Bytes(qdisc.TCA_STATS_QUEUE, queue)
+			return nil
+		}
+	}
+	action := func(kind string, s func(*netlink.AttributeEncoder) error) func(*netlink.AttributeEncoder) error {
+		return func(ae *netlink.AttributeEncoder) error {
+			ae.String(1, kind)
+			ae.Nested(tcaActStats, s)
+			return nil
+		}
+	}
+
+	ae := netlink.NewAttributeEncoder()
+	ae.String(qdisc.TCA_KIND, "u32")
+	ae.Nested(qdisc.TCA_OPTIONS, func(ae *netlink.AttributeEncoder) error {
+		ae.Uint32(1, 0x10010) // TCA_U32_CLASSID
+		ae.Nested(tcFilterActions["u32"], func(ae *netlink.AttributeEncoder) error {
+			ae.Nested(1, action("police", stats(15000, 10, 4)))
+			ae.Nested(2, action("mirred", stats(9000, 6, 1)))
+			return nil
+		})
+		pcnt := make([]byte, 24)
+		nlenc.PutUint64(pcnt[8:16], 10)
+		ae.Bytes(tcaU32Pcnt, pcnt)
+		return nil
+	})
+	attrs, err := ae.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := make([]byte, tcMsgLen)
+	nlenc.PutUint32(msg[4:8], 3)
+	nlenc.PutUint32(msg[8:12], 0x80000800)
+	nlenc.PutUint32(msg[12:16], 0x10000)
+	nlenc.PutUint32(msg[16:20], 1<<16|0x0008)
+
+	o, err := parseTCObject(append(msg, attrs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.ifindex != 3 || o.kind != "u32" || tcHandle(o.parent) != "1:0" || tcFilterPrio(o.info) != "1" {
+		t.Errorf("unexpected filter %+v", o)
+	}
+	if len(o.actions) != 2 {
+		t.Fatalf("want 2 actions, got %d", len(o.actions))
+	}
+	if a := o.actions[0]; a.bytes != 15000 || a.packets != 10 || a.drops != 4 {
+		t.Errorf("unexpected first action %+v", a)
+	}
+	if a := o.actions[1]; a.bytes != 9000 || a.packets != 6 || a.drops != 1 {
+		t.Errorf("unexpected second action %+v", a)
+	}
+	if o.hits == nil || *o.hits != 10 {
+		t.Errorf("want 10 hits, got %v", o.hits)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"path/filepath"
+	"strconv"
 
 	"github.com/ema/qdisc"
 	"github.com/go-kit/kit/log"
@@ -34,10 +35,24 @@ type qdiscStatCollector struct {
 	overlimits typedDesc
 	qlength    typedDesc
 	backlog    typedDesc
-	logger     log.Logger
+
+	classBytes      typedDesc
+	classPackets    typedDesc
+	classDrops      typedDesc
+	classOverlimits typedDesc
+	classQlength    typedDesc
+	classBacklog    typedDesc
+	filterBytes     typedDesc
+	filterPackets   typedDesc
+	filterDrops     typedDesc
+
+	logger log.Logger
 }
 
 var (
+	qdiscClassLabels  = []string{"device", "kind", "class", "parent"}
+	qdiscFilterLabels = []string{"device", "kind", "parent", "prio", "handle"}
+
 	collectorQdisc = kingpin.Flag("collector.qdisc.fixtures", "test fixtures to use for qdisc collector end-to-end testing").Default("").String()
 )
 
@@ -83,6 +98,51 @@ func NewQdiscStatCollector(logger log.Logger) (Collector, error) {
 			"Number of bytes currently in queue to be sent.",
 			[]string{"device", "kind"}, nil,
 		), prometheus.GaugeValue},
+		classBytes: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "qdisc", "class_bytes_total"),
+			"Number of bytes sent by the class.",
+			qdiscClassLabels, nil,
+		), prometheus.CounterValue},
+		classPackets: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "qdisc", "class_packets_total"),
+			"Number of packets sent by the class.",
+			qdiscClassLabels, nil,
+		), prometheus.CounterValue},
+		classDrops: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "qdisc", "class_drops_total"),
+			"Number of packets dropped by the class.",
+			qdiscClassLabels, nil,
+		), prometheus.CounterValue},
+		classOverlimits: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "qdisc", "class_overlimits_total"),
+			"Number of overlimit packets of the class.",
+			qdiscClassLabels, nil,
+		), prometheus.CounterValue},
+		classQlength: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "qdisc", "class_current_queue_length"),
+			"Number of packets currently in queue of the class to be sent.",
+			qdiscClassLabels, nil,
+		), prometheus.GaugeValue},
+		classBacklog: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "qdisc", "class_backlog"),
+			"Number of bytes currently in queue of the class to be sent.",
+			qdiscClassLabels, nil,
+		), prometheus.GaugeValue},
+		filterBytes: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "qdisc", "filter_bytes_total"),
+			"Number of bytes matched by the filter.",
+			qdiscFilterLabels, nil,
+		), prometheus.CounterValue},
+		filterPackets: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "qdisc", "filter_packets_total"),
+			"Number of packets matched by the filter.",
+			qdiscFilterLabels, nil,
+		), prometheus.CounterValue},
+		filterDrops: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "qdisc", "filter_drops_total"),
+			"Number of packets dropped by the actions of the filter.",
+			qdiscFilterLabels, nil,
+		), prometheus.CounterValue},
 		logger: logger,
 	}, nil
 }
@@ -130,5 +190,52 @@ func (c *qdiscStatCollector) Update(ch chan<- prometheus.Metric) error {
 		ch <- c.backlog.mustNewConstMetric(float64(msg.Backlog), msg.IfaceName, msg.Kind)
 	}
 
+	// Classes and filters aren't part of the fixtures.
+	if fixtures != "" {
+		return nil
+	}
+	classes, filters, err := getTCClassesAndFilters()
+	if err != nil {
+		return err
+	}
+	c.updateClassesAndFilters(ch, classes, filters)
+
 	return nil
 }
+
+func (c *qdiscStatCollector) updateClassesAndFilters(ch chan<- prometheus.Metric, classes, filters map[string][]tcObject) {
+	for device, cls := range classes {
+		for _, cl := range cls {
+			class, parent := tcHandle(cl.handle), tcHandle(cl.parent)
+			ch <- c.classBytes.mustNewConstMetric(float64(cl.stats.bytes), device, cl.kind, class, parent)
+			ch <- c.classPackets.mustNewConstMetric(float64(cl.stats.packets), device, cl.kind, class, parent)
+			ch <- c.classDrops.mustNewConstMetric(float64(cl.stats.drops), device, cl.kind, class, parent)
+			ch <- c.classOverlimits.mustNewConstMetric(float64(cl.stats.overlimits), device, cl.kind, class, parent)
+			ch <- c.classQlength.mustNewConstMetric(float64(cl.stats.qlen), device, cl.kind, class, parent)
+			ch <- c.classBacklog.mustNewConstMetric(float64(cl.stats.backlog), device, cl.kind, class, parent)
+		}
+	}
+
+	for device, fs := range filters {
+		for _, f := range fs {
+			labels := []string{device, f.kind, tcHandle(f.parent), tcFilterPrio(f.info), strconv.FormatUint(uint64(f.handle), 16)}
+			// Filters mostly count packets through their actions. Hash
+			// tables of u32 and chain heads don't have any.
+			if len(f.actions) == 0 {
+				if f.hits != nil {
+					ch <- c.filterPackets.mustNewConstMetric(float64(*f.hits), labels...)
+				}
+				continue
+			}
+			// The first action sees all matched packets, any action
+			// can drop them.
+			var drops uint64
+			for _, a := range f.actions {
+				drops += a.drops
+			}
+			ch <- c.filterBytes.mustNewConstMetric(float64(f.actions[0].bytes), labels...)
+			ch <- c.filterPackets.mustNewConstMetric(float64(f.actions[0].packets), labels...)
+			ch <- c.filterDrops.mustNewConstMetric(float64(drops), labels...)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noquota
+
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	quotaSubsystem = "quota"
+
+	// Q_GETNEXTQUOTA from <linux/quota.h>, available since Linux 4.6.
+	qGetNextQuota = 0x800009
+	// Block limits are reported in units of QIF_DQBLKSIZE.
+	quotaBlockSize = 1024
+)
+
+var quotaMountPointsInclude = kingpin.Flag("collector.quota.mount-points-include", "Regexp of mount points with quotas enabled to collect quota usage for.").Default(".*").String()
+
+// quotaTypes maps the quota types of quotactl(2) to the mount options that
+// enable them.
+var quotaTypes = []struct {
+	name    string
+	id      int
+	options []string
+}{
+	{"user", 0, []string{"usrquota", "usrjquota", "quota", "uquota", "uqnoenforce"}},
+	{"group", 1, []string{"grpquota", "grpjquota", "gquota", "gqnoenforce"}},
+	{"project", 2, []string{"prjquota", "pquota", "pqnoenforce"}},
+}
+
+// ifNextDqblk mirrors struct if_nextdqblk from <linux/quota.h>.
+type ifNextDqblk struct {
+	BHardLimit uint64
+	BSoftLimit uint64
+	CurSpace   uint64
+	IHardLimit uint64
+	ISoftLimit uint64
+	CurInodes  uint64
+	BTime      uint64
+	ITime      uint64
+	Valid      uint32
+	ID         uint32
+}
+
+// quotaMount is a mounted filesystem with quota accounting enabled.
+type quotaMount struct {
+	device     string
+	mountPoint string
+	types      []string
+}
+
+type quotaCollector struct {
+	mountPointsInclude *regexp.Regexp
+	usedBytes          *prometheus.Desc
+	softLimitBytes     *prometheus.Desc
+	hardLimitBytes     *prometheus.Desc
+	usedInodes         *prometheus.Desc
+	softLimitInodes    *prometheus.Desc
+	hardLimitInodes    *prometheus.Desc
+	logger             log.Logger
+}
+
+func init() {
+	registerCollector("quota", defaultDisabled, NewQuotaCollector)
+}
+
+// NewQuotaCollector returns a new Collector exposing user, group and project
+// quota usage and limits.
+func NewQuotaCollector(logger log.Logger) (Collector, error) {
+	pattern, err := regexp.Compile(*quotaMountPointsInclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mount point pattern: %w", err)
+	}
+
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, quotaSubsystem, name),
+			help,
+			[]string{"device", "mountpoint", "type", "id"}, nil,
+		)
+	}
+	return &quotaCollector{
+		mountPointsInclude: pattern,
+		usedBytes:          desc("used_bytes", "Space used by the quota id."),
+		softLimitBytes:     desc("soft_limit_bytes", "Space soft limit of the quota id, 0 if unlimited."),
+		hardLimitBytes:     desc("hard_limit_bytes", "Space hard limit of the quota id, 0 if unlimited."),
+		usedInodes:         desc("used_inodes", "Number of inodes used by the quota id."),
+		softLimitInodes:    desc("soft_limit_inodes", "Inode soft limit of the quota id, 0 if unlimited."),
+		hardLimitInodes:    desc("hard_limit_inodes", "Inode hard limit of the quota id, 0 if unlimited."),
+		logger:             logger,
+	}, nil
+}
+
+func (c *quotaCollector) Update(ch chan<- prometheus.Metric) error {
+	file, err := os.Open(procFilePath("1/mounts"))
+	if errors.Is(err, os.ErrNotExist) {
+		// Fallback to `/proc/mounts` if `/proc/1/mounts` is missing due hidepid.
+		level.Debug(c.logger).Log("msg", "Reading root mounts failed, falling back to system mounts", "err", err)
+		file, err = os.Open(procFilePath("mounts"))
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	mounts, err := parseQuotaMounts(file)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, m := range mounts {
+		if !c.mountPointsInclude.MatchString(m.mountPoint) {
+			continue
+		}
+		found = true
+		for _, t := range quotaTypes {
+			enabled := false
+			for _, typ := range m.types {
+				enabled = enabled || typ == t.name
+			}
+			if !enabled {
+				continue
+			}
+			if err := c.updateQuota(ch, m, t.name, t.id); err != nil {
+				level.Debug(c.logger).Log("msg", "couldn't get quotas", "mountpoint", m.mountPoint, "type", t.name, "err", err)
+			}
+		}
+	}
+	if !found {
+		level.Debug(c.logger).Log("msg", "no mount points with quotas found, skipping")
+		return ErrNoData
+	}
+
+	return nil
+}
+
+// updateQuota iterates over all ids with a quota of the given type using
+// Q_GETNEXTQUOTA.
+func (c *quotaCollector) updateQuota(ch chan<- prometheus.Metric, m quotaMount, typ string, typeID int) error {
+	device, err := unix.BytePtrFromString(rootfsFilePath(m.device))
+	if err != nil {
+		return err
+	}
+
+	cmd := uint32(qGetNextQuota)<<8 | uint32(typeID)&0xff
+	for id := uint32(0); ; {
+		var dq ifNextDqblk
+		_, _, errno := unix.Syscall6(unix.SYS_QUOTACTL, uintptr(cmd), uintptr(unsafe.Pointer(device)), uintptr(id), uintptr(unsafe.Pointer(&dq)), 0, 0)
+		if errno == unix.ENOENT {
+			// No more ids with a quota.
+			return nil
+		}
+		if errno != 0 {
+			return fmt.Errorf("Q_GETNEXTQUOTA failed: %w", errno)
+		}
+
+		labels := []string{m.device, m.mountPoint, typ, strconv.FormatUint(uint64(dq.ID), 10)}
+		ch <- prometheus.MustNewConstMetric(c.usedBytes, prometheus.GaugeValue, float64(dq.CurSpace), labels...)
+		ch <- prometheus.MustNewConstMetric(c.softLimitBytes, prometheus.GaugeValue, float64(dq.BSoftLimit*quotaBlockSize), labels...)
+		ch <- prometheus.MustNewConstMetric(c.hardLimitBytes, prometheus.GaugeValue, float64(dq.BHardLimit*quotaBlockSize), labels...)
+		ch <- prometheus.MustNewConstMetric(c.usedInodes, prometheus.GaugeValue, float64(dq.CurInodes), labels...)
+		ch <- prometheus.MustNewConstMetric(c.softLimitInodes, prometheus.GaugeValue, float64(dq.ISoftLimit), labels...)
+		ch <- prometheus.MustNewConstMetric(c.hardLimitInodes, prometheus.GaugeValue, float64(dq.IHardLimit), labels...)
+
+		if dq.ID == ^uint32(0) {
+			return nil
+		}
+		id = dq.ID + 1
+	}
+}
+
+// parseQuotaMounts returns the mounts from r that have quota accounting
+// enabled in their mount options.
+func parseQuotaMounts(r io.Reader) ([]quotaMount, error) {
+	var mounts []quotaMount
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) < 4 {
+			return nil, fmt.Errorf("malformed mount point information: %q", scanner.Text())
+		}
+
+		m := quotaMount{
+			device:     parts[0],
+			mountPoint: rootfsStripPrefix(strings.NewReplacer("\\040", " ", "\\011", "\t").Replace(parts[1])),
+		}
+		for _, option := range strings.Split(parts[3], ",") {
+			// Journaled quota options carry the quota file name.
+			option = strings.SplitN(option, "=", 2)[0]
+			for _, t := range quotaTypes {
+				for _, o := range t.options {
+					if option == o {
+						m.types = appendQuotaType(m.types, t.name)
+					}
+				}
+			}
+		}
+		if len(m.types) > 0 {
+			mounts = append(mounts, m)
+		}
+	}
+
+	return mounts, scanner.Err()
+}
+
+func appendQuotaType(types []string, typ string) []string {
+	for _, t := range types {
+		if t == typ {
+			return types
+		}
+	}
+	return append(types, typ)
+}
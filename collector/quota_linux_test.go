@@ -0,0 +1,50 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noquota
+
+package collector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestParseQuotaMounts(t *testing.T) {
+	const mounts = `/dev/sda1 / ext4 rw,relatime 0 0
+/dev/sda2 /home ext4 rw,relatime,usrjquota=aquota.user,grpjquota=aquota.group,jqfmt=vfsv0 0 0
+/dev/sdb1 /srv/export xfs rw,relatime,attr2,inode64,usrquota,prjquota 0 0
+/dev/sdc1 /mnt/with\040space ext4 rw,quota,usrquota 0 0
+`
+	got, err := parseQuotaMounts(strings.NewReader(mounts))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []quotaMount{
+		{device: "/dev/sda2", mountPoint: "/home", types: []string{"user", "group"}},
+		{device: "/dev/sdb1", mountPoint: "/srv/export", types: []string{"user", "project"}},
+		{device: "/dev/sdc1", mountPoint: "/mnt/with space", types: []string{"user"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
+
+func TestIfNextDqblkSize(t *testing.T) {
+	if size := unsafe.Sizeof(ifNextDqblk{}); size != 72 {
+		t.Errorf("want struct if_nextdqblk to be 72 bytes, got %d", size)
+	}
+}
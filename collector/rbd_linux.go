@@ -0,0 +1,165 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !norbd
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs/blockdevice"
+)
+
+const (
+	rbdSubsystem  = "rbd"
+	rbdSectorSize = 512
+)
+
+type rbdCollector struct {
+	fs              blockdevice.FS
+	info            *prometheus.Desc
+	size            *prometheus.Desc
+	readsCompleted  *prometheus.Desc
+	writesCompleted *prometheus.Desc
+	readBytes       *prometheus.Desc
+	writtenBytes    *prometheus.Desc
+	logger          log.Logger
+}
+
+// rbdDevice is a kernel RBD mapping from /sys/devices/rbd/<id>.
+type rbdDevice struct {
+	ID          string
+	Pool        string
+	Image       string
+	Snapshot    string
+	ClusterFSID string
+}
+
+func init() {
+	registerCollector("rbd", defaultDisabled, NewRBDCollector)
+}
+
+// NewRBDCollector returns a new Collector exposing statistics of kernel
+// mapped RBD images.
+func NewRBDCollector(logger log.Logger) (Collector, error) {
+	fs, err := blockdevice.NewFS(*procPath, *sysPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sysfs: %w", err)
+	}
+
+	deviceLabels := []string{"device"}
+	return &rbdCollector{
+		fs: fs,
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, rbdSubsystem, "info"),
+			"Non-numeric data from /sys/devices/rbd/<id>, value is always 1.",
+			[]string{"device", "pool", "image", "snapshot", "cluster_fsid"}, nil,
+		),
+		size: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, rbdSubsystem, "size_bytes"),
+			"Size of the mapped RBD image.",
+			deviceLabels, nil,
+		),
+		readsCompleted: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, rbdSubsystem, "reads_completed_total"),
+			"The total number of reads completed successfully.",
+			deviceLabels, nil,
+		),
+		writesCompleted: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, rbdSubsystem, "writes_completed_total"),
+			"The total number of writes completed successfully.",
+			deviceLabels, nil,
+		),
+		readBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, rbdSubsystem, "read_bytes_total"),
+			"The total number of bytes read successfully.",
+			deviceLabels, nil,
+		),
+		writtenBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, rbdSubsystem, "written_bytes_total"),
+			"The total number of bytes written successfully.",
+			deviceLabels, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *rbdCollector) Update(ch chan<- prometheus.Metric) error {
+	devices, err := readRBDDevices(sysFilePath("devices/rbd"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "rbd devices not found, skipping")
+			return ErrNoData
+		}
+		return fmt.Errorf("couldn't get rbd devices: %w", err)
+	}
+
+	for _, d := range devices {
+		device := "rbd" + d.ID
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, device, d.Pool, d.Image, d.Snapshot, d.ClusterFSID)
+
+		size, err := readUintFromFile(sysFilePath(filepath.Join("devices/rbd", d.ID, "size")))
+		if err != nil {
+			return fmt.Errorf("couldn't get size of %s: %w", device, err)
+		}
+		ch <- prometheus.MustNewConstMetric(c.size, prometheus.GaugeValue, float64(size), device)
+
+		stats, _, err := c.fs.SysBlockDeviceStat(device)
+		if err != nil {
+			return fmt.Errorf("couldn't get block device statistics of %s: %w", device, err)
+		}
+		ch <- prometheus.MustNewConstMetric(c.readsCompleted, prometheus.CounterValue, float64(stats.ReadIOs), device)
+		ch <- prometheus.MustNewConstMetric(c.readBytes, prometheus.CounterValue, float64(stats.ReadSectors*rbdSectorSize), device)
+		ch <- prometheus.MustNewConstMetric(c.writesCompleted, prometheus.CounterValue, float64(stats.WriteIOs), device)
+		ch <- prometheus.MustNewConstMetric(c.writtenBytes, prometheus.CounterValue, float64(stats.WriteSectors*rbdSectorSize), device)
+	}
+
+	return nil
+}
+
+func readRBDDevices(root string) ([]rbdDevice, error) {
+	if _, err := os.Stat(root); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(root, "[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]rbdDevice, 0, len(paths))
+	for _, path := range paths {
+		d := rbdDevice{ID: filepath.Base(path)}
+		if d.Pool, err = readStringFromFile(filepath.Join(path, "pool")); err != nil {
+			return nil, err
+		}
+		if d.Image, err = readStringFromFile(filepath.Join(path, "name")); err != nil {
+			return nil, err
+		}
+		if d.Snapshot, err = readStringFromFile(filepath.Join(path, "current_snap")); err != nil {
+			return nil, err
+		}
+		// cluster_fsid is not available on older kernels.
+		if d.ClusterFSID, err = readStringFromFile(filepath.Join(path, "cluster_fsid")); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
@@ -0,0 +1,34 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadRBDDevices(t *testing.T) {
+	devices, err := readRBDDevices("fixtures/sys/devices/rbd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []rbdDevice{
+		{ID: "0", Pool: "iscsi-images", Image: "demo", Snapshot: "-", ClusterFSID: "c6bd0b6c-2f3b-4e3a-b3a4-4d2bb1c8a2b1"},
+		{ID: "1", Pool: "iscsi-images", Image: "backup", Snapshot: "snap1", ClusterFSID: "c6bd0b6c-2f3b-4e3a-b3a4-4d2bb1c8a2b1"},
+	}
+	if !reflect.DeepEqual(devices, want) {
+		t.Errorf("want rbd devices %v, got %v", want, devices)
+	}
+}
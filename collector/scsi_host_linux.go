@@ -0,0 +1,155 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noscsi_host
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const scsiHostSubsystem = "scsi_host"
+
+var scsiDeviceNamePattern = regexp.MustCompile(`^\d+:\d+:\d+:\d+$`)
+
+type scsiHostCollector struct {
+	info       *prometheus.Desc
+	busy       *prometheus.Desc
+	canQueue   *prometheus.Desc
+	cmdPerLUN  *prometheus.Desc
+	ioRequests *prometheus.Desc
+	ioErrors   *prometheus.Desc
+	ioTimeouts *prometheus.Desc
+	logger     log.Logger
+}
+
+func init() {
+	registerCollector("scsi_host", defaultDisabled, NewSCSIHostCollector)
+}
+
+// NewSCSIHostCollector returns a new Collector exposing the state and error
+// counters of SCSI host adapters.
+func NewSCSIHostCollector(logger log.Logger) (Collector, error) {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, scsiHostSubsystem, name),
+			help,
+			[]string{"host"}, nil,
+		)
+	}
+	return &scsiHostCollector{
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, scsiHostSubsystem, "info"),
+			"Non-numeric data from /sys/class/scsi_host/<host>, value is always 1.",
+			[]string{"host", "proc_name", "state"}, nil,
+		),
+		busy:       desc("busy_commands", "Number of commands the host adapter is currently processing."),
+		canQueue:   desc("can_queue", "Maximum number of commands the host adapter can queue."),
+		cmdPerLUN:  desc("cmd_per_lun", "Maximum number of commands that can be queued per LUN."),
+		ioRequests: desc("io_requests_total", "Number of I/O requests issued to devices attached to the host."),
+		ioErrors:   desc("io_errors_total", "Number of I/O requests to devices attached to the host that completed with an error."),
+		ioTimeouts: desc("io_timeouts_total", "Number of I/O requests to devices attached to the host that timed out."),
+		logger:     logger,
+	}, nil
+}
+
+func (c *scsiHostCollector) Update(ch chan<- prometheus.Metric) error {
+	hosts, err := filepath.Glob(sysFilePath("class/scsi_host/host*"))
+	if err != nil {
+		return err
+	}
+	if len(hosts) == 0 {
+		level.Debug(c.logger).Log("msg", "no SCSI hosts found, skipping")
+		return ErrNoData
+	}
+
+	for _, path := range hosts {
+		host := filepath.Base(path)
+		procName, _ := readStringFromFile(filepath.Join(path, "proc_name"))
+		state, _ := readStringFromFile(filepath.Join(path, "state"))
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, host, procName, state)
+
+		for _, m := range []struct {
+			file string
+			desc *prometheus.Desc
+		}{
+			{"host_busy", c.busy},
+			{"can_queue", c.canQueue},
+			{"cmd_per_lun", c.cmdPerLUN},
+		} {
+			v, err := readUintFromFile(filepath.Join(path, m.file))
+			if err != nil {
+				level.Debug(c.logger).Log("msg", "couldn't read SCSI host attribute", "host", host, "file", m.file, "err", err)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(m.desc, prometheus.GaugeValue, float64(v), host)
+		}
+
+		counters, err := readSCSIHostDeviceCounters(filepath.Join(path, "device"))
+		if err != nil {
+			return fmt.Errorf("couldn't get device counters of %s: %w", host, err)
+		}
+		ch <- prometheus.MustNewConstMetric(c.ioRequests, prometheus.CounterValue, float64(counters["iorequest_cnt"]), host)
+		ch <- prometheus.MustNewConstMetric(c.ioErrors, prometheus.CounterValue, float64(counters["ioerr_cnt"]), host)
+		ch <- prometheus.MustNewConstMetric(c.ioTimeouts, prometheus.CounterValue, float64(counters["iotmo_cnt"]), host)
+	}
+
+	return nil
+}
+
+// readSCSIHostDeviceCounters sums the SCSI midlayer I/O counters of all
+// devices below the host device directory. Depending on the transport,
+// devices are nested in session, port or target directories.
+func readSCSIHostDeviceCounters(hostDevice string) (map[string]uint64, error) {
+	root, err := filepath.EvalSymlinks(hostDevice)
+	if err != nil {
+		return nil, err
+	}
+
+	counters := map[string]uint64{}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || !scsiDeviceNamePattern.MatchString(info.Name()) {
+			return nil
+		}
+		for _, name := range []string{"iorequest_cnt", "ioerr_cnt", "iotmo_cnt"} {
+			value, err := readStringFromFile(filepath.Join(path, name))
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return err
+			}
+			// The counters are printed in hexadecimal ("0x1f").
+			v, err := strconv.ParseUint(strings.TrimSpace(value), 0, 64)
+			if err != nil {
+				return err
+			}
+			counters[name] += v
+		}
+		return filepath.SkipDir
+	})
+	return counters, err
+}
@@ -0,0 +1,211 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nosmart
+
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"unsafe"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	smartSubsystem = "smart"
+
+	// HDIO_DRIVE_CMD from <linux/hdreg.h>, translated to an ATA
+	// pass-through command by libata.
+	smartIoctlDriveCmd = 0x031f
+
+	ataCmdSMART           = 0xb0
+	ataSMARTReadValues    = 0xd0
+	ataSMARTSectorSize    = 512
+	ataSMARTAttributes    = 30
+	ataSMARTAttributeSize = 12
+)
+
+// smartAttributeNames maps well known ATA SMART attribute IDs to the names
+// used by smartctl.
+var smartAttributeNames = map[uint8]string{
+	1:   "Raw_Read_Error_Rate",
+	3:   "Spin_Up_Time",
+	4:   "Start_Stop_Count",
+	5:   "Reallocated_Sector_Ct",
+	7:   "Seek_Error_Rate",
+	9:   "Power_On_Hours",
+	10:  "Spin_Retry_Count",
+	12:  "Power_Cycle_Count",
+	177: "Wear_Leveling_Count",
+	184: "End-to-End_Error",
+	187: "Reported_Uncorrect",
+	188: "Command_Timeout",
+	190: "Airflow_Temperature_Cel",
+	192: "Power-Off_Retract_Count",
+	193: "Load_Cycle_Count",
+	194: "Temperature_Celsius",
+	196: "Reallocated_Event_Count",
+	197: "Current_Pending_Sector",
+	198: "Offline_Uncorrectable",
+	199: "UDMA_CRC_Error_Count",
+	241: "Total_LBAs_Written",
+	242: "Total_LBAs_Read",
+}
+
+// smartAttribute is an entry of the ATA SMART attribute table.
+type smartAttribute struct {
+	ID    uint8
+	Flags uint16
+	Value uint8
+	Worst uint8
+	Raw   uint64
+}
+
+type smartCollector struct {
+	value  *prometheus.Desc
+	worst  *prometheus.Desc
+	raw    *prometheus.Desc
+	logger log.Logger
+}
+
+func init() {
+	registerCollector("smart", defaultDisabled, NewSMARTCollector)
+}
+
+// NewSMARTCollector returns a new Collector exposing the ATA SMART
+// attributes of SATA disks.
+func NewSMARTCollector(logger log.Logger) (Collector, error) {
+	labels := []string{"device", "attribute_id", "attribute_name"}
+	return &smartCollector{
+		value: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, smartSubsystem, "attribute_value"),
+			"Normalized value of the SMART attribute.",
+			labels, nil,
+		),
+		worst: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, smartSubsystem, "attribute_worst"),
+			"Worst normalized value of the SMART attribute.",
+			labels, nil,
+		),
+		raw: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, smartSubsystem, "attribute_raw_value"),
+			"Vendor specific raw value of the SMART attribute.",
+			labels, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *smartCollector) Update(ch chan<- prometheus.Metric) error {
+	disks, err := filepath.Glob(sysFilePath("block/sd*"))
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, disk := range disks {
+		device := filepath.Base(disk)
+		// Only disks attached through libata understand ATA SMART
+		// commands, SAS and USB disks report a different vendor.
+		vendor, err := readStringFromFile(filepath.Join(disk, "device/vendor"))
+		if err != nil || vendor != "ATA" {
+			continue
+		}
+		found = true
+
+		attrs, err := readSMARTAttributes(rootfsFilePath(filepath.Join("dev", device)))
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't read SMART attributes", "device", device, "err", err)
+			continue
+		}
+		for _, a := range attrs {
+			id := strconv.Itoa(int(a.ID))
+			name := smartAttributeNames[a.ID]
+			if name == "" {
+				name = "Unknown_Attribute"
+			}
+			ch <- prometheus.MustNewConstMetric(c.value, prometheus.GaugeValue, float64(a.Value), device, id, name)
+			ch <- prometheus.MustNewConstMetric(c.worst, prometheus.GaugeValue, float64(a.Worst), device, id, name)
+			ch <- prometheus.MustNewConstMetric(c.raw, prometheus.GaugeValue, float64(a.Raw), device, id, name)
+		}
+	}
+	if !found {
+		level.Debug(c.logger).Log("msg", "no ATA disks found, skipping")
+		return ErrNoData
+	}
+
+	return nil
+}
+
+// readSMARTAttributes issues SMART READ DATA to the disk at path and returns
+// the populated entries of the attribute table.
+func readSMARTAttributes(path string) ([]smartAttribute, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// The first four bytes hold command, sector number, feature and sector
+	// count, the sector read is returned after them.
+	buf := make([]byte, 4+ataSMARTSectorSize)
+	buf[0] = ataCmdSMART
+	buf[2] = ataSMARTReadValues
+	buf[3] = 1
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), smartIoctlDriveCmd, uintptr(unsafe.Pointer(&buf[0])))
+	if errno != 0 {
+		return nil, fmt.Errorf("SMART READ DATA failed: %w", errno)
+	}
+
+	return parseSMARTAttributes(buf[4:])
+}
+
+func parseSMARTAttributes(b []byte) ([]smartAttribute, error) {
+	if len(b) < ataSMARTSectorSize {
+		return nil, fmt.Errorf("SMART data too short: %d bytes", len(b))
+	}
+
+	var attrs []smartAttribute
+	// The table starts after the two byte data structure revision.
+	for i := 0; i < ataSMARTAttributes; i++ {
+		e := b[2+i*ataSMARTAttributeSize : 2+(i+1)*ataSMARTAttributeSize]
+		if e[0] == 0 {
+			continue
+		}
+		raw := make([]byte, 8)
+		copy(raw, e[5:11])
+		a := smartAttribute{
+			ID:    e[0],
+			Flags: binary.LittleEndian.Uint16(e[1:3]),
+			Value: e[3],
+			Worst: e[4],
+			Raw:   binary.LittleEndian.Uint64(raw),
+		}
+		switch a.ID {
+		case 190, 194:
+			// The temperature is in the lowest byte, most drives put
+			// the lifetime minimum and maximum into the higher bytes.
+			a.Raw &= 0xff
+		}
+		attrs = append(attrs, a)
+	}
+	return attrs, nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nosmart
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSMARTAttributes(t *testing.T) {
+	b := make([]byte, ataSMARTSectorSize)
+	b[0] = 0x10
+	// Reallocated_Sector_Ct, 8 sectors.
+	copy(b[2:], []byte{5, 0x33, 0x00, 100, 99, 8, 0, 0, 0, 0, 0, 0})
+	// Skip an empty slot, then Temperature_Celsius with min/max in the
+	// upper raw bytes.
+	copy(b[2+2*ataSMARTAttributeSize:], []byte{194, 0x22, 0x00, 64, 45, 36, 0, 20, 0, 45, 0, 0})
+
+	attrs, err := parseSMARTAttributes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []smartAttribute{
+		{ID: 5, Flags: 0x33, Value: 100, Worst: 99, Raw: 8},
+		{ID: 194, Flags: 0x22, Value: 64, Worst: 45, Raw: 36},
+	}
+	if !reflect.DeepEqual(attrs, want) {
+		t.Errorf("want %+v, got %+v", want, attrs)
+	}
+
+	if _, err := parseSMARTAttributes(b[:10]); err == nil {
+		t.Error("expected error for truncated data")
+	}
+}
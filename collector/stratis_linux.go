@@ -0,0 +1,287 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nostratis
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/godbus/dbus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	stratisSubsystem = "stratis"
+
+	stratisDbusObject = "org.storage.stratis3"
+	stratisDbusPath   = "/org/storage/stratis3"
+)
+
+// stratisObjects are the objects exported by stratisd with the properties
+// of all their interfaces.
+type stratisObjects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+
+// stratisPool is a pool with the filesystems allocated from it.
+type stratisPool struct {
+	name             string
+	uuid             string
+	availableActions string
+	size             float64
+	used             float64
+	allocated        float64
+	hasCache         bool
+	overprovisioning bool
+	noAllocSpace     bool
+	filesystems      []stratisFilesystem
+}
+
+type stratisFilesystem struct {
+	name string
+	size float64
+	used float64
+}
+
+type stratisCollector struct {
+	info             *prometheus.Desc
+	size             *prometheus.Desc
+	used             *prometheus.Desc
+	allocated        *prometheus.Desc
+	hasCache         *prometheus.Desc
+	overprovisioning *prometheus.Desc
+	noAllocSpace     *prometheus.Desc
+	fsSize           *prometheus.Desc
+	fsUsed           *prometheus.Desc
+	logger           log.Logger
+}
+
+func init() {
+	registerCollector("stratis", defaultDisabled, NewStratisCollector)
+}
+
+// NewStratisCollector returns a new Collector exposing the size and usage of
+// Stratis pools and filesystems from the D-Bus API of stratisd.
+func NewStratisCollector(logger log.Logger) (Collector, error) {
+	labels := []string{"pool"}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, stratisSubsystem, name),
+			help, labels, nil,
+		)
+	}
+	fsLabels := []string{"pool", "filesystem"}
+	return &stratisCollector{
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, stratisSubsystem, "pool_info"),
+			"Non-numeric data of Stratis pools, value is always 1.",
+			[]string{"pool", "uuid", "available_actions"}, nil,
+		),
+		size:             desc("pool_size_bytes", "Size of the block devices of the pool."),
+		used:             desc("pool_used_bytes", "Amount of the block devices of the pool in use, including metadata."),
+		allocated:        desc("pool_allocated_bytes", "Amount of the block devices allocated to the thin pool."),
+		hasCache:         desc("pool_cache_enabled", "Whether the pool has a cache tier."),
+		overprovisioning: desc("pool_overprovisioning_enabled", "Whether the filesystems of the pool may be larger than the pool."),
+		noAllocSpace:     desc("pool_no_alloc_space", "Whether the pool ran out of space to allocate."),
+		fsSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, stratisSubsystem, "filesystem_size_bytes"),
+			"Thin provisioned size of the filesystem.",
+			fsLabels, nil,
+		),
+		fsUsed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, stratisSubsystem, "filesystem_used_bytes"),
+			"Amount of the pool used by the filesystem.",
+			fsLabels, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *stratisCollector) Update(ch chan<- prometheus.Metric) error {
+	objects, err := getStratisObjects()
+	if err != nil {
+		var dbusErr dbus.Error
+		if errors.As(err, &dbusErr) && dbusErr.Name == "org.freedesktop.DBus.Error.ServiceUnknown" {
+			level.Debug(c.logger).Log("msg", "stratisd is not running, skipping")
+			return ErrNoData
+		}
+		return fmt.Errorf("couldn't get Stratis objects: %w", err)
+	}
+
+	pools := parseStratisObjects(objects)
+	if len(pools) == 0 {
+		level.Debug(c.logger).Log("msg", "no Stratis pools found, skipping")
+		return ErrNoData
+	}
+
+	for _, p := range pools {
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, p.name, p.uuid, p.availableActions)
+		for desc, v := range map[*prometheus.Desc]float64{
+			c.size:      p.size,
+			c.used:      p.used,
+			c.allocated: p.allocated,
+		} {
+			// Sizes are unknown while the pool is being set up.
+			if !math.IsNaN(v) {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, p.name)
+			}
+		}
+		for desc, enabled := range map[*prometheus.Desc]bool{
+			c.hasCache:         p.hasCache,
+			c.overprovisioning: p.overprovisioning,
+			c.noAllocSpace:     p.noAllocSpace,
+		} {
+			v := 0.0
+			if enabled {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, p.name)
+		}
+		for _, fs := range p.filesystems {
+			if !math.IsNaN(fs.size) {
+				ch <- prometheus.MustNewConstMetric(c.fsSize, prometheus.GaugeValue, fs.size, p.name, fs.name)
+			}
+			if !math.IsNaN(fs.used) {
+				ch <- prometheus.MustNewConstMetric(c.fsUsed, prometheus.GaugeValue, fs.used, p.name, fs.name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func getStratisObjects() (stratisObjects, error) {
+	conn, err := dbus.SystemBusPrivate()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	methods := []dbus.Auth{dbus.AuthExternal(strconv.Itoa(os.Getuid()))}
+	if err := conn.Auth(methods); err != nil {
+		return nil, err
+	}
+	if err := conn.Hello(); err != nil {
+		return nil, err
+	}
+
+	var objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	err = conn.Object(stratisDbusObject, stratisDbusPath).
+		Call("org.freedesktop.DBus.ObjectManager.GetManagedObjects", 0).
+		Store(&objects)
+	return objects, err
+}
+
+// parseStratisObjects returns the pools with their filesystems. Each object
+// implements one interface per revision of the API, like
+// org.storage.stratis3.pool.r1, with newer revisions adding properties.
+func parseStratisObjects(objects stratisObjects) []*stratisPool {
+	props := func(ifaces map[string]map[string]dbus.Variant, kind string) map[string]dbus.Variant {
+		var merged map[string]dbus.Variant
+		for name, p := range ifaces {
+			if !strings.HasPrefix(name, stratisDbusObject+"."+kind+".") {
+				continue
+			}
+			if merged == nil {
+				merged = make(map[string]dbus.Variant)
+			}
+			for k, v := range p {
+				merged[k] = v
+			}
+		}
+		return merged
+	}
+
+	pools := make(map[dbus.ObjectPath]*stratisPool)
+	for path, ifaces := range objects {
+		p := props(ifaces, "pool")
+		if p == nil {
+			continue
+		}
+		pools[path] = &stratisPool{
+			name:             stratisString(p["Name"]),
+			uuid:             stratisString(p["Uuid"]),
+			availableActions: stratisString(p["AvailableActions"]),
+			size:             stratisBytes(p["TotalPhysicalSize"]),
+			used:             stratisBytes(p["TotalPhysicalUsed"]),
+			allocated:        stratisBytes(p["AllocatedSize"]),
+			hasCache:         stratisBool(p["HasCache"]),
+			overprovisioning: stratisBool(p["Overprovisioning"]),
+			noAllocSpace:     stratisBool(p["NoAllocSpace"]),
+		}
+	}
+	for _, ifaces := range objects {
+		p := props(ifaces, "filesystem")
+		if p == nil {
+			continue
+		}
+		poolPath, _ := p["Pool"].Value().(dbus.ObjectPath)
+		pool, ok := pools[poolPath]
+		if !ok {
+			continue
+		}
+		pool.filesystems = append(pool.filesystems, stratisFilesystem{
+			name: stratisString(p["Name"]),
+			size: stratisBytes(p["Size"]),
+			used: stratisBytes(p["Used"]),
+		})
+	}
+
+	result := make([]*stratisPool, 0, len(pools))
+	for _, p := range pools {
+		result = append(result, p)
+	}
+	return result
+}
+
+func stratisString(v dbus.Variant) string {
+	s, _ := v.Value().(string)
+	return s
+}
+
+func stratisBool(v dbus.Variant) bool {
+	b, _ := v.Value().(bool)
+	return b
+}
+
+// stratisBytes returns a size, which stratisd passes as a decimal string to
+// avoid overflows, optionally in a (valid, size) struct for sizes which can
+// be unknown. It returns NaN for unknown sizes.
+func stratisBytes(v dbus.Variant) float64 {
+	value := v.Value()
+	if s, ok := value.([]interface{}); ok {
+		if len(s) != 2 {
+			return math.NaN()
+		}
+		if valid, _ := s[0].(bool); !valid {
+			return math.NaN()
+		}
+		value = s[1]
+	}
+	s, ok := value.(string)
+	if !ok {
+		return math.NaN()
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return f
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nostratis
+
+package collector
+
+import (
+	"math"
+	"testing"
+
+	"github.com/godbus/dbus"
+)
+
+func TestParseStratisObjects(t *testing.T) {
+	objects := stratisObjects{
+		"/org/storage/stratis3/1": {
+			"org.storage.stratis3.pool.r0": {
+				"Name":              dbus.MakeVariant("data"),
+				"Uuid":              dbus.MakeVariant("0b6e5c4dd0b44ad1b5d3e2e1b4b7c0a1"),
+				"AvailableActions":  dbus.MakeVariant("fully_operational"),
+				"TotalPhysicalSize": dbus.MakeVariant("1099511627776"),
+				"TotalPhysicalUsed": dbus.MakeVariant([]interface{}{true, "5905580032"}),
+				"HasCache":          dbus.MakeVariant(true),
+			},
+			"org.storage.stratis3.pool.r1": {
+				"Overprovisioning": dbus.MakeVariant(true),
+				"NoAllocSpace":     dbus.MakeVariant(false),
+			},
+			"org.freedesktop.DBus.Properties": {},
+		},
+		"/org/storage/stratis3/2": {
+			"org.storage.stratis3.filesystem.r0": {
+				"Name": dbus.MakeVariant("backups"),
+				"Pool": dbus.MakeVariant(dbus.ObjectPath("/org/storage/stratis3/1")),
+				"Size": dbus.MakeVariant("2199023255552"),
+				"Used": dbus.MakeVariant([]interface{}{false, ""}),
+			},
+		},
+		"/org/storage/stratis3/3": {
+			"org.storage.stratis3.blockdev.r0": {
+				"Devnode": dbus.MakeVariant("/dev/sdb"),
+			},
+		},
+	}
+
+	pools := parseStratisObjects(objects)
+	if len(pools) != 1 {
+		t.Fatalf("want 1 pool, got %d", len(pools))
+	}
+	p := pools[0]
+	if p.name != "data" || p.size != 1099511627776 || p.used != 5905580032 || !p.hasCache || !p.overprovisioning || p.noAllocSpace {
+		t.Errorf("unexpected pool %+v", p)
+	}
+	if !math.IsNaN(p.allocated) {
+		t.Errorf("want unknown allocated size, got %v", p.allocated)
+	}
+	if len(p.filesystems) != 1 {
+		t.Fatalf("want 1 filesystem, got %d", len(p.filesystems))
+	}
+	if fs := p.filesystems[0]; fs.name != "backups" || fs.size != 2199023255552 || !math.IsNaN(fs.used) {
+		t.Errorf("unexpected filesystem %+v", fs)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noswap
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+const (
+	swapSubsystem = "swap"
+
+	// Sectors in /sys/class/block/<dev>/stat are always 512 bytes.
+	swapSectorSize = 512
+)
+
+// swapIO is the amount of data swapped in and out of a swap area.
+type swapIO struct {
+	inBytes  float64
+	outBytes float64
+}
+
+type swapCollector struct {
+	fs       procfs.FS
+	info     *prometheus.Desc
+	size     *prometheus.Desc
+	used     *prometheus.Desc
+	priority *prometheus.Desc
+	in       *prometheus.Desc
+	out      *prometheus.Desc
+	logger   log.Logger
+}
+
+func init() {
+	registerCollector("swap", defaultDisabled, NewSwapCollector)
+}
+
+// NewSwapCollector returns a new Collector exposing usage and I/O of each
+// swap area.
+func NewSwapCollector(logger log.Logger) (Collector, error) {
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open procfs: %w", err)
+	}
+
+	labels := []string{"device"}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, swapSubsystem, name),
+			help, labels, nil,
+		)
+	}
+	return &swapCollector{
+		fs: fs,
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, swapSubsystem, "info"),
+			"Non-numeric data from /proc/swaps, value is always 1.",
+			[]string{"device", "type"}, nil,
+		),
+		size:     desc("size_bytes", "Size of the swap area."),
+		used:     desc("used_bytes", "Amount of the swap area in use."),
+		priority: desc("priority", "Priority of the swap area, areas with higher priority are used first."),
+		in:       desc("in_bytes_total", "Amount of data swapped in from the swap area."),
+		out:      desc("out_bytes_total", "Amount of data swapped out to the swap area."),
+		logger:   logger,
+	}, nil
+}
+
+func (c *swapCollector) Update(ch chan<- prometheus.Metric) error {
+	swaps, err := c.fs.Swaps()
+	if err != nil {
+		return fmt.Errorf("couldn't read swaps: %w", err)
+	}
+	if len(swaps) == 0 {
+		level.Debug(c.logger).Log("msg", "no swap areas found, skipping")
+		return ErrNoData
+	}
+
+	for _, s := range swaps {
+		device := s.Filename
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, device, s.Type)
+		ch <- prometheus.MustNewConstMetric(c.size, prometheus.GaugeValue, float64(s.Size)*1024, device)
+		ch <- prometheus.MustNewConstMetric(c.used, prometheus.GaugeValue, float64(s.Used)*1024, device)
+		ch <- prometheus.MustNewConstMetric(c.priority, prometheus.GaugeValue, float64(s.Priority), device)
+
+		io, err := readSwapIO(s, len(swaps) == 1)
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "couldn't read swap I/O", "device", device, "err", err)
+			continue
+		}
+		if io == nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.in, prometheus.CounterValue, io.inBytes, device)
+		ch <- prometheus.MustNewConstMetric(c.out, prometheus.CounterValue, io.outBytes, device)
+	}
+
+	return nil
+}
+
+// readSwapIO returns the I/O of a swap area, or nil if it can't be told
+// apart from other I/O. The kernel only counts swapped pages globally, so
+// they are taken from the block device statistics of swap partitions. The
+// global counters are used for a single swap area, like a swap file.
+func readSwapIO(s *procfs.Swap, single bool) (*swapIO, error) {
+	if s.Type == "partition" {
+		return readSwapPartitionIO(s.Filename)
+	}
+	if !single {
+		return nil, nil
+	}
+
+	f, err := os.Open(procFilePath("vmstat"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		io       swapIO
+		pageSize = float64(os.Getpagesize())
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value in line %q: %w", scanner.Text(), err)
+		}
+		switch fields[0] {
+		case "pswpin":
+			io.inBytes = v * pageSize
+		case "pswpout":
+			io.outBytes = v * pageSize
+		}
+	}
+	return &io, scanner.Err()
+}
+
+// readSwapPartitionIO returns the data read from and written to the block
+// device of a swap partition.
+func readSwapPartitionIO(path string) (*swapIO, error) {
+	name := filepath.Base(path)
+	if _, err := os.Stat(sysFilePath(filepath.Join("class/block", name))); err != nil {
+		// Resolve names like /dev/mapper/swap to the kernel name.
+		target, err := filepath.EvalSymlinks(rootfsFilePath(path))
+		if err != nil {
+			return nil, err
+		}
+		name = filepath.Base(target)
+	}
+
+	stat, err := readStringFromFile(sysFilePath(filepath.Join("class/block", name, "stat")))
+	if err != nil {
+		return nil, err
+	}
+	// Fields 3 and 7 are the sectors read and written.
+	fields := strings.Fields(stat)
+	if len(fields) < 7 {
+		return nil, fmt.Errorf("too few fields in block device stat: %q", stat)
+	}
+	read, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sectors read %q: %w", fields[2], err)
+	}
+	written, err := strconv.ParseFloat(fields[6], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sectors written %q: %w", fields[6], err)
+	}
+	return &swapIO{
+		inBytes:  read * swapSectorSize,
+		outBytes: written * swapSectorSize,
+	}, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noswap
+
+package collector
+
+import (
+	"os"
+	"testing"
+
+	"github.com/prometheus/procfs"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func TestReadSwapIO(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{
+		"--path.procfs", "fixtures/proc",
+		"--path.sysfs", "fixtures/sys",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	pageSize := float64(os.Getpagesize())
+	for _, tc := range []struct {
+		swap   procfs.Swap
+		single bool
+		want   *swapIO
+	}{
+		{
+			swap: procfs.Swap{Filename: "/dev/dm-1", Type: "partition"},
+			want: &swapIO{inBytes: 3104 * 512, outBytes: 592 * 512},
+		},
+		{
+			swap:   procfs.Swap{Filename: "/swapfile", Type: "file"},
+			single: true,
+			want:   &swapIO{inBytes: 1476 * pageSize, outBytes: 35045 * pageSize},
+		},
+		{
+			swap: procfs.Swap{Filename: "/swapfile", Type: "file"},
+		},
+	} {
+		got, err := readSwapIO(&tc.swap, tc.single)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+			t.Errorf("%s: want %+v, got %+v", tc.swap.Filename, tc.want, got)
+		}
+	}
+}
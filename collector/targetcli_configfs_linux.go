@@ -0,0 +1,545 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !notargetcli
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/procfs"
+)
+
+// findLIOConfigfs returns the LIO directory of the first configfs mount
+// that has one, or root if there is none.
+func findLIOConfigfs(root string, mounts []*procfs.MountInfo) string {
+	for _, m := range mounts {
+		if m.FSType != "configfs" {
+			continue
+		}
+		path := filepath.Join(m.MountPoint, "target")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return root
+}
+
+// lioTPG is a target portal group of a fabric module in the LIO configfs
+// tree, like iscsi/<iqn>/tpgt_1. TPGs of fabrics without an enable attribute,
+// like loopback, are always enabled. Nexus is the initiator WWN of the I_T
+// nexus of loopback and vhost TPGs.
+type lioTPG struct {
+	Fabric  string
+	Target  string
+	TPGT    string
+	Enabled bool
+	Nexus   string
+	LUNs    []lioLUN
+	path    string
+}
+
+// lioLUN is a LUN of a TPG and the backstore it links to. Created is the
+// change time of its configfs directory, which is set when the LUN is created
+// and its statistics start from zero. err is set for a LUN whose backstore
+// can't be resolved, e.g. one targetcli has created but not linked yet.
+type lioLUN struct {
+	Index         string
+	BackstoreType string
+	Backstore     string
+	Created       time.Time
+	path          string
+	err           error
+}
+
+// lioACL is a node ACL of a TPG. The traffic of the initiator is summed over
+// the LUNs mapped to it. Params are the parameters negotiated by the session
+// of the initiator, nil without one.
+type lioACL struct {
+	Initiator  string
+	Sessions   uint64
+	ReadBytes  uint64
+	WriteBytes uint64
+	Commands   uint64
+	Params     map[string]uint64
+	LUNs       []lioMappedLUN
+}
+
+// lioMappedLUN is the traffic of an initiator to a LUN mapped to it, by the
+// LUN number the initiator sees.
+type lioMappedLUN struct {
+	Index      string
+	ReadBytes  uint64
+	WriteBytes uint64
+	Commands   uint64
+}
+
+// lioSessionParams are the session parameters read from the param/ group of
+// iSCSI node ACLs. MaxRecvDataSegmentLength is negotiated per connection and
+// not exposed.
+var lioSessionParams = []string{"MaxBurstLength", "FirstBurstLength", "ImmediateData"}
+
+// lioLUNStats are the statistics of a TPG LUN. The kernel only keeps the
+// traffic in megabytes.
+type lioLUNStats struct {
+	ReadBytes  uint64
+	WriteBytes uint64
+	Commands   uint64
+	BusyErrors uint64
+}
+
+// lioBackstore is a storage object of a target core HBA, like
+// core/iblock_0/disk1. Type is the backstore plugin name used by targetcli.
+// UdevPath is the device or file backing it, Config is the dev_config
+// attribute of tcmu-runner backstores, like rbd/<pool>/<image>, which starts
+// with the handler.
+type lioBackstore struct {
+	Type     string
+	Name     string
+	UdevPath string
+	Config   string
+	path     string
+}
+
+// readLIOBackstores returns the storage objects of all target core HBAs below
+// root.
+func readLIOBackstores(root string) ([]lioBackstore, error) {
+	hbas, err := filepath.Glob(filepath.Join(root, "core", "*_[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var backstores []lioBackstore
+	for _, hba := range hbas {
+		plugin, ok := targetcliPlugin(filepath.Base(hba))
+		if !ok {
+			continue
+		}
+		entries, err := ioutil.ReadDir(hba)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				continue
+			}
+			b := lioBackstore{
+				Type: plugin,
+				Name: e.Name(),
+				path: filepath.Join(hba, e.Name()),
+			}
+			b.UdevPath, err = readStringFromFile(filepath.Join(b.path, "udev_path"))
+			if err != nil {
+				return nil, err
+			}
+			if plugin == "user" {
+				b.Config, err = readStringFromFile(filepath.Join(b.path, "attrib", "dev_config"))
+				if err != nil {
+					return nil, err
+				}
+			}
+			backstores = append(backstores, b)
+		}
+	}
+	return backstores, nil
+}
+
+// lioALUAGroup is an ALUA target port group of a backstore.
+type lioALUAGroup struct {
+	Name  string
+	State uint64
+}
+
+// readLIOALUAGroups returns the ALUA target port groups of a backstore.
+// Passthrough backstores have none.
+func readLIOALUAGroups(b lioBackstore) ([]lioALUAGroup, error) {
+	files, err := filepath.Glob(filepath.Join(b.path, "alua", "*", "alua_access_state"))
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]lioALUAGroup, 0, len(files))
+	for _, file := range files {
+		state, err := readUintFromFile(file)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, lioALUAGroup{
+			Name:  filepath.Base(filepath.Dir(file)),
+			State: state,
+		})
+	}
+	return groups, nil
+}
+
+// lioWWN is the identification a backstore reports to initiators in its
+// INQUIRY data.
+type lioWWN struct {
+	Serial   string
+	Vendor   string
+	Model    string
+	Revision string
+}
+
+// readLIOWWN reads the wwn/ attributes of a backstore. The serial has the
+// form "T10 VPD Unit Serial Number: <serial>". Older kernels lack vendor_id,
+// product_id and revision, which are left empty.
+func readLIOWWN(b lioBackstore) (lioWWN, error) {
+	dir := filepath.Join(b.path, "wwn")
+	serial, err := readStringFromFile(filepath.Join(dir, "vpd_unit_serial"))
+	if err != nil {
+		return lioWWN{}, err
+	}
+	wwn := lioWWN{Serial: strings.TrimSpace(strings.TrimPrefix(serial, "T10 VPD Unit Serial Number:"))}
+	for file, value := range map[string]*string{
+		"vendor_id":  &wwn.Vendor,
+		"product_id": &wwn.Model,
+		"revision":   &wwn.Revision,
+	} {
+		*value, err = readStringFromFile(filepath.Join(dir, file))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return lioWWN{}, err
+		}
+	}
+	return wwn, nil
+}
+
+// lioReservation is the persistent reservation state of a backstore. Holder
+// is nil if no initiator holds a reservation.
+type lioReservation struct {
+	Holder        *lioRegistration
+	Type          string
+	Registrations []lioRegistration
+}
+
+// lioRegistration is an initiator port registered for persistent
+// reservations. Initiator includes the ISID of iSCSI initiators, like
+// iqn.1994-05.com.redhat:client1,i,0x00023d000003.
+type lioRegistration struct {
+	Fabric    string
+	Initiator string
+	Key       string
+}
+
+// readLIOReservation parses the res_holder and res_pr_registered_i_pts
+// attributes of a backstore. It returns nil for passthrough backstores, whose
+// reservations are handled by the device.
+func readLIOReservation(b lioBackstore) (*lioReservation, error) {
+	holder, err := readStringFromFile(filepath.Join(b.path, "pr", "res_holder"))
+	if err != nil {
+		return nil, err
+	}
+	if holder == "Passthrough" {
+		return nil, nil
+	}
+
+	var res lioReservation
+	// The holder has the form "SPC-3 Reservation: <fabric> Initiator:
+	// <initiator>", or "No SPC-3 Reservation holder" without one.
+	if i := strings.Index(holder, " Reservation: "); i >= 0 && !strings.HasPrefix(holder, "No ") {
+		fields := strings.Fields(holder[i+len(" Reservation: "):])
+		if len(fields) != 3 || fields[1] != "Initiator:" {
+			return nil, fmt.Errorf("invalid reservation holder %q", holder)
+		}
+		res.Type = strings.ToLower(strings.Replace(holder[:i], "-", "", -1))
+		res.Holder = &lioRegistration{Fabric: fields[0], Initiator: fields[2]}
+	}
+
+	// The registrations are listed as "<fabric> Node: <initiator> Key: <key>
+	// PRgen: <generation>" below a header line.
+	registrations, err := ioutil.ReadFile(filepath.Join(b.path, "pr", "res_pr_registered_i_pts"))
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(registrations), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 7 || fields[1] != "Node:" || fields[3] != "Key:" {
+			continue
+		}
+		reg := lioRegistration{Fabric: fields[0], Initiator: fields[2], Key: fields[4]}
+		if res.Holder != nil && res.Holder.Fabric == reg.Fabric && res.Holder.Initiator == reg.Initiator {
+			res.Holder.Key = reg.Key
+		}
+		res.Registrations = append(res.Registrations, reg)
+	}
+	return &res, nil
+}
+
+// readLIOTPGs returns the TPGs of all fabric modules below root.
+func readLIOTPGs(root string) ([]lioTPG, error) {
+	paths, err := filepath.Glob(filepath.Join(root, "*", "*", "tpgt_*"))
+	if err != nil {
+		return nil, err
+	}
+
+	tpgs := make([]lioTPG, 0, len(paths))
+	for _, path := range paths {
+		wwn := filepath.Dir(path)
+		tpg := lioTPG{
+			Fabric:  filepath.Base(filepath.Dir(wwn)),
+			Target:  filepath.Base(wwn),
+			TPGT:    strings.TrimPrefix(filepath.Base(path), "tpgt_"),
+			Enabled: true,
+			path:    path,
+		}
+
+		enable, err := readUintFromFile(filepath.Join(path, "enable"))
+		switch {
+		case err == nil:
+			tpg.Enabled = enable == 1
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, err
+		}
+
+		tpg.Nexus, err = readStringFromFile(filepath.Join(path, "nexus"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		luns, err := filepath.Glob(filepath.Join(path, "lun", "lun_*"))
+		if err != nil {
+			return nil, err
+		}
+		for _, lun := range luns {
+			tpg.LUNs = append(tpg.LUNs, readLIOLUN(lun))
+		}
+		tpgs = append(tpgs, tpg)
+	}
+	return tpgs, nil
+}
+
+// readLIOLUN reads a LUN of a TPG. A LUN that can't be read is returned with
+// its error, so it doesn't hide the other LUNs of the TPG.
+func readLIOLUN(path string) lioLUN {
+	lun := lioLUN{
+		Index: strings.TrimPrefix(filepath.Base(path), "lun_"),
+		path:  path,
+	}
+	lun.BackstoreType, lun.Backstore, lun.err = readLIOLUNBackstore(path)
+	if lun.err != nil {
+		return lun
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		lun.err = err
+		return lun
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		lun.Created = time.Unix(st.Ctim.Unix())
+	}
+	return lun
+}
+
+// readLIOLUNBackstore returns the plugin and name of the backstore a LUN
+// links to.
+func readLIOLUNBackstore(lun string) (string, string, error) {
+	entries, err := ioutil.ReadDir(lun)
+	if err != nil {
+		return "", "", err
+	}
+	for _, e := range entries {
+		if e.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		dest, err := os.Readlink(filepath.Join(lun, e.Name()))
+		if err != nil {
+			return "", "", err
+		}
+		plugin, ok := targetcliPlugin(filepath.Base(filepath.Dir(dest)))
+		if !ok {
+			return "", "", fmt.Errorf("unknown backstore %s", dest)
+		}
+		return plugin, filepath.Base(dest), nil
+	}
+	return "", "", fmt.Errorf("no backstore linked in %s", lun)
+}
+
+// readLIOACLs returns the node ACLs of a TPG. The info attribute of iSCSI
+// ACLs has a "LIO Session ID:" line per session of the initiator, the traffic
+// comes from the scsi_auth_intr statistics of the mapped LUNs, which the
+// kernel only keeps in megabytes.
+func readLIOACLs(tpg lioTPG) ([]lioACL, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(tpg.path, "acls"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	acls := make([]lioACL, 0, len(entries))
+	for _, e := range entries {
+		path := filepath.Join(tpg.path, "acls", e.Name())
+		acl := lioACL{Initiator: e.Name()}
+
+		info, err := ioutil.ReadFile(filepath.Join(path, "info"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(info), "\n") {
+			if strings.HasPrefix(line, "LIO Session ID:") {
+				acl.Sessions++
+			}
+		}
+
+		if acl.Sessions > 0 {
+			acl.Params, err = readLIOSessionParams(filepath.Join(path, "param"))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		dirs, err := filepath.Glob(filepath.Join(path, "lun_*", "statistics", "scsi_auth_intr"))
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			stats, err := readLIOStatistics(dir, "read_mbytes", "write_mbytes", "num_cmds")
+			if err != nil {
+				return nil, err
+			}
+			lun := lioMappedLUN{
+				Index:      strings.TrimPrefix(filepath.Base(filepath.Dir(filepath.Dir(dir))), "lun_"),
+				ReadBytes:  stats["read_mbytes"] << 20,
+				WriteBytes: stats["write_mbytes"] << 20,
+				Commands:   stats["num_cmds"],
+			}
+			acl.ReadBytes += lun.ReadBytes
+			acl.WriteBytes += lun.WriteBytes
+			acl.Commands += lun.Commands
+			acl.LUNs = append(acl.LUNs, lun)
+		}
+		acls = append(acls, acl)
+	}
+	return acls, nil
+}
+
+// readLIOLUNStats reads the scsi_tgt_port and scsi_port statistics of a LUN.
+func readLIOLUNStats(lun lioLUN) (lioLUNStats, error) {
+	port, err := readLIOStatistics(filepath.Join(lun.path, "statistics", "scsi_tgt_port"), "read_mbytes", "write_mbytes", "in_cmds")
+	if err != nil {
+		return lioLUNStats{}, err
+	}
+	busy, err := readUintFromFile(filepath.Join(lun.path, "statistics", "scsi_port", "busy_count"))
+	if err != nil {
+		return lioLUNStats{}, err
+	}
+	return lioLUNStats{
+		ReadBytes:  port["read_mbytes"] << 20,
+		WriteBytes: port["write_mbytes"] << 20,
+		Commands:   port["in_cmds"],
+		BusyErrors: busy,
+	}, nil
+}
+
+// lioISCSITargetStats are the fabric statistics of an iSCSI target, keyed by
+// attribute name.
+type lioISCSITargetStats struct {
+	Logins        map[string]uint64
+	Logouts       map[string]uint64
+	SessionErrors map[string]uint64
+}
+
+// readLIOISCSITargetStats reads the iscsi_login_stats, iscsi_logout_stats and
+// iscsi_sess_err groups of the fabric statistics of an iSCSI target.
+func readLIOISCSITargetStats(target string) (lioISCSITargetStats, error) {
+	dir := filepath.Join(target, "fabric_statistics")
+	var (
+		stats lioISCSITargetStats
+		err   error
+	)
+	stats.Logins, err = readLIOStatistics(filepath.Join(dir, "iscsi_login_stats"),
+		"accepts", "redirects", "authenticate_fails", "authorize_fails", "negotiate_fails", "other_fails")
+	if err != nil {
+		return stats, err
+	}
+	stats.Logouts, err = readLIOStatistics(filepath.Join(dir, "iscsi_logout_stats"), "normal_logouts", "abnormal_logouts")
+	if err != nil {
+		return stats, err
+	}
+	stats.SessionErrors, err = readLIOStatistics(filepath.Join(dir, "iscsi_sess_err"), "digest_errors", "cxn_timeout_errors", "format_errors")
+	return stats, err
+}
+
+// readLIOAttrib reads an attribute of a backstore. Passthrough backstores
+// only have the hw_ variant of attributes like queue_depth and block_size.
+func readLIOAttrib(b lioBackstore, name string) (uint64, error) {
+	value, err := readUintFromFile(filepath.Join(b.path, "attrib", name))
+	if errors.Is(err, os.ErrNotExist) {
+		return readUintFromFile(filepath.Join(b.path, "attrib", "hw_"+name))
+	}
+	return value, err
+}
+
+// readLIODynamicSessions counts the sessions of initiators without a node
+// ACL, which the dynamic_sessions attribute of a TPG lists one per line.
+func readLIODynamicSessions(tpg lioTPG) (uint64, error) {
+	data, err := ioutil.ReadFile(filepath.Join(tpg.path, "dynamic_sessions"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var sessions uint64
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			sessions++
+		}
+	}
+	return sessions, nil
+}
+
+// readLIOSessionParams reads the session parameters of a node ACL. The
+// attributes read "No Active iSCSI Session" if the session went away since
+// the info attribute was read, in which case nil is returned.
+func readLIOSessionParams(dir string) (map[string]uint64, error) {
+	params := make(map[string]uint64, len(lioSessionParams))
+	for _, name := range lioSessionParams {
+		value, err := readStringFromFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(value, "No Active") {
+			return nil, nil
+		}
+		params[name], err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", name, value, err)
+		}
+	}
+	return params, nil
+}
+
+// readLIOStatistics reads the named attributes of a configfs statistics
+// group.
+func readLIOStatistics(dir string, names ...string) (map[string]uint64, error) {
+	stats := make(map[string]uint64, len(names))
+	for _, name := range names {
+		value, err := readUintFromFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		stats[name] = value
+	}
+	return stats, nil
+}
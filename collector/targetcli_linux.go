@@ -0,0 +1,1119 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !notargetcli
+
+package collector
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	targetcliSaveconfig           = kingpin.Flag("collector.targetcli.saveconfig", "Path of the targetcli saveconfig file, relative to the rootfs.").Default("/etc/target/saveconfig.json").String()
+	targetcliACLLUNs              = kingpin.Flag("collector.targetcli.acl-luns", "Export the traffic of each initiator to each LUN mapped to it, not only the sum over its LUNs.").Default("false").Bool()
+	targetcliTargetInclude        = kingpin.Flag("collector.targetcli.target-include", "Regexp of target IQNs or WWNs to include. Targets must both match include and not match exclude to be included.").Default(".+").String()
+	targetcliTargetExclude        = kingpin.Flag("collector.targetcli.target-exclude", "Regexp of target IQNs or WWNs to exclude. Targets must both match include and not match exclude to be included.").Default("").String()
+	targetcliBackstoreTypeInclude = kingpin.Flag("collector.targetcli.backstore-type-include", "Regexp of backstore types to include, like block or fileio. Backstore types must both match include and not match exclude to be included.").Default(".+").String()
+	targetcliBackstoreTypeExclude = kingpin.Flag("collector.targetcli.backstore-type-exclude", "Regexp of backstore types to exclude, like block or fileio. Backstore types must both match include and not match exclude to be included.").Default("").String()
+)
+
+// The metrics are named after the iSCSI target they describe, not the tool.
+const targetcliSubsystem = "iscsi"
+
+var (
+	targetcliTPGLabels       = []string{"iqn", "tpgt"}
+	targetcliPortalLabels    = []string{"iqn", "tpgt", "address", "port"}
+	targetcliLUNLabels       = []string{"fabric", "target", "tpgt", "lun", "backstore_type", "backstore"}
+	targetcliBackstoreLabels = []string{"backstore_type", "backstore"}
+	targetcliACLLabels       = []string{"iqn", "tpgt", "initiator"}
+	targetcliACLLUNLabels    = []string{"iqn", "tpgt", "initiator", "mapped_lun"}
+)
+
+// The error counts are shared by all instances of the collector.
+var (
+	targetcliErrors    = make(map[targetcliErrorKey]uint64)
+	targetcliErrorsMtx sync.Mutex
+)
+
+// targetcliErrorKey identifies the TPG and stage of the update that failed.
+type targetcliErrorKey struct {
+	fabric string
+	target string
+	tpgt   string
+	stage  string
+}
+
+// targetcliLoginResults maps the attributes of the iscsi_login_stats group to
+// the result label of the login counter.
+var targetcliLoginResults = []struct {
+	file   string
+	result string
+}{
+	{"accepts", "accepted"},
+	{"redirects", "redirected"},
+	{"authenticate_fails", "authentication_failed"},
+	{"authorize_fails", "authorization_failed"},
+	{"negotiate_fails", "negotiation_failed"},
+	{"other_fails", "other_failure"},
+}
+
+// targetcliALUAStates are the ALUA access states by their value in the
+// alua_access_state attribute of a target port group.
+var targetcliALUAStates = []struct {
+	value uint64
+	name  string
+}{
+	{0, "active_optimized"},
+	{1, "active_nonoptimized"},
+	{2, "standby"},
+	{3, "unavailable"},
+	{4, "lba_dependent"},
+	{14, "offline"},
+	{15, "transitioning"},
+}
+
+// targetcliPlugins maps the configfs HBA name prefixes to the backstore
+// plugin names used by targetcli.
+var targetcliPlugins = map[string]string{
+	"iblock": "block",
+	"fileio": "fileio",
+	"rd_mcp": "ramdisk",
+	"pscsi":  "pscsi",
+	"rbd":    "rbd",
+	"user":   "user",
+}
+
+type targetcliCollector struct {
+	inSync     *prometheus.Desc
+	mtime      *prometheus.Desc
+	listening  *prometheus.Desc
+	portalInfo *prometheus.Desc
+	iser       *prometheus.Desc
+	hbaInfo    *prometheus.Desc
+
+	scrapeDuration *prometheus.Desc
+	scrapeErrors   *prometheus.Desc
+
+	targets       *prometheus.Desc
+	logins        *prometheus.Desc
+	logouts       *prometheus.Desc
+	sessionErrors *prometheus.Desc
+	tpgEnabled    *prometheus.Desc
+	tpgLUNCount   *prometheus.Desc
+	tpgNexus      *prometheus.Desc
+	tpgSessions   *prometheus.Desc
+
+	lunReadBytes  *prometheus.Desc
+	lunWriteBytes *prometheus.Desc
+	lunCommands   *prometheus.Desc
+	lunBusyErrors *prometheus.Desc
+	lunCreated    *prometheus.Desc
+
+	backstoreInfo        *prometheus.Desc
+	userBackstoreInfo    *prometheus.Desc
+	backstoreQueueDepth  *prometheus.Desc
+	backstoreBlockSize   *prometheus.Desc
+	backstoreEmulateTPU  *prometheus.Desc
+	backstoreEmulateTPWS *prometheus.Desc
+	backstoreWWN         *prometheus.Desc
+	backstoreALUAState   *prometheus.Desc
+	backstoreReserved    *prometheus.Desc
+	backstoreReservation *prometheus.Desc
+	backstoreRegistered  *prometheus.Desc
+	backstoreAbortErrors *prometheus.Desc
+	backstoreResetErrors *prometheus.Desc
+
+	aclSessions   *prometheus.Desc
+	aclReadBytes  *prometheus.Desc
+	aclWriteBytes *prometheus.Desc
+	aclCommands   *prometheus.Desc
+	aclMaxBurst   *prometheus.Desc
+	aclFirstBurst *prometheus.Desc
+	aclImmediate  *prometheus.Desc
+
+	aclLUNReadBytes  *prometheus.Desc
+	aclLUNWriteBytes *prometheus.Desc
+	aclLUNCommands   *prometheus.Desc
+
+	targetInclude        *regexp.Regexp
+	targetExclude        *regexp.Regexp
+	backstoreTypeInclude *regexp.Regexp
+	backstoreTypeExclude *regexp.Regexp
+
+	logger log.Logger
+}
+
+// targetcliHBA is a target core HBA from /sys/kernel/config/target/core.
+type targetcliHBA struct {
+	Index   string
+	Plugin  string
+	Version string
+}
+
+// targetcliPortal is a network portal of a TPG from the LIO configfs tree.
+// ISER is set if the portal accepts iSER logins in addition to TCP.
+type targetcliPortal struct {
+	Target  string
+	TPGT    string
+	Address string
+	Port    string
+	ISER    bool
+}
+
+// targetcliSaveconfigFile is the subset of saveconfig.json describing the
+// LIO topology.
+type targetcliSaveconfigFile struct {
+	StorageObjects []struct {
+		Plugin string `json:"plugin"`
+		Name   string `json:"name"`
+	} `json:"storage_objects"`
+	Targets []struct {
+		Fabric string `json:"fabric"`
+		WWN    string `json:"wwn"`
+		TPGs   []struct {
+			Tag  int `json:"tag"`
+			LUNs []struct {
+				Index         int    `json:"index"`
+				StorageObject string `json:"storage_object"`
+			} `json:"luns"`
+			NodeACLs []struct {
+				NodeWWN string `json:"node_wwn"`
+			} `json:"node_acls"`
+			Portals []struct {
+				IPAddress string `json:"ip_address"`
+				Port      int    `json:"port"`
+			} `json:"portals"`
+		} `json:"tpgs"`
+	} `json:"targets"`
+}
+
+func init() {
+	registerCollector("targetcli", defaultDisabled, NewTargetcliCollector)
+}
+
+// NewTargetcliCollector returns a new Collector exposing whether the running
+// LIO configuration matches the targetcli saveconfig file.
+func NewTargetcliCollector(logger log.Logger) (Collector, error) {
+	return &targetcliCollector{
+		inSync: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "saveconfig_in_sync"),
+			"Whether the running LIO configuration matches the saveconfig file.",
+			nil, nil,
+		),
+		mtime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "saveconfig_mtime_seconds"),
+			"Modification time of the saveconfig file.",
+			nil, nil,
+		),
+		listening: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "portal_listening"),
+			"Whether a TCP socket is listening on the address and port of the network portal.",
+			[]string{"address", "port"}, nil,
+		),
+		portalInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "portal_info"),
+			"Network portal of the TPG from /sys/kernel/config/target/iscsi/<iqn>/tpgt_<tpgt>/np/<address>:<port>, value is always 1.",
+			targetcliPortalLabels, nil,
+		),
+		iser: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "portal_iser_enabled"),
+			"Whether the network portal of the TPG accepts iSER logins in addition to TCP.",
+			targetcliPortalLabels, nil,
+		),
+		hbaInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "hba_info"),
+			"Non-numeric data from /sys/kernel/config/target/core/<hba>/hba_info, value is always 1.",
+			[]string{"hba_index", "plugin", "version"}, nil,
+		),
+		scrapeDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "collector_scrape_duration_seconds"),
+			"Time it took to read the statistics of the TPG.",
+			[]string{"fabric", "target", "tpgt"}, nil,
+		),
+		scrapeErrors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "collector_errors_total"),
+			"Number of failures to read the statistics of a TPG, target or backstore, by stage.",
+			[]string{"fabric", "target", "tpgt", "stage"}, nil,
+		),
+		targets: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "target_count"),
+			"Number of iSCSI targets with at least one TPG.",
+			nil, nil,
+		),
+		logins: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "target_logins_total"),
+			"Number of login attempts to the iSCSI target, by result.",
+			[]string{"iqn", "result"}, nil,
+		),
+		logouts: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "target_logouts_total"),
+			"Number of logouts from the iSCSI target, abnormal logouts are dropped connections.",
+			[]string{"iqn", "type"}, nil,
+		),
+		sessionErrors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "target_session_errors_total"),
+			"Number of session errors of the iSCSI target, by type. Digest errors are header or data CRC32C mismatches.",
+			[]string{"iqn", "type"}, nil,
+		),
+		tpgEnabled: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "tpgt_enabled"),
+			"Whether the target portal group is enabled.",
+			targetcliTPGLabels, nil,
+		),
+		tpgLUNCount: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "lun_count"),
+			"Number of LUNs of the target portal group.",
+			targetcliTPGLabels, nil,
+		),
+		lunReadBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "lun_read_bytes_total"),
+			"Number of bytes read from the LUN, in megabyte resolution.",
+			targetcliLUNLabels, nil,
+		),
+		lunWriteBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "lun_write_bytes_total"),
+			"Number of bytes written to the LUN, in megabyte resolution.",
+			targetcliLUNLabels, nil,
+		),
+		lunCommands: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "lun_commands_total"),
+			"Number of SCSI commands to the LUN.",
+			targetcliLUNLabels, nil,
+		),
+		lunBusyErrors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "lun_busy_errors_total"),
+			"Number of commands to the LUN completed with BUSY status.",
+			targetcliLUNLabels, nil,
+		),
+		backstoreInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "backstore_info"),
+			"Device or file of the backstore from its udev_path attribute, value is always 1.",
+			[]string{"backstore_type", "backstore", "device"}, nil,
+		),
+		userBackstoreInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "user_backstore_info"),
+			"Handler and configuration of tcmu-runner backstores, value is always 1.",
+			[]string{"backstore", "handler", "config"}, nil,
+		),
+		backstoreQueueDepth: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "backstore_queue_depth"),
+			"Configured queue depth of the backstore.",
+			targetcliBackstoreLabels, nil,
+		),
+		backstoreBlockSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "backstore_block_size_bytes"),
+			"Logical block size of the backstore.",
+			targetcliBackstoreLabels, nil,
+		),
+		backstoreEmulateTPU: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "backstore_emulate_tpu"),
+			"Whether the backstore advertises thin provisioning UNMAP support to initiators.",
+			targetcliBackstoreLabels, nil,
+		),
+		backstoreEmulateTPWS: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "backstore_emulate_tpws"),
+			"Whether the backstore advertises thin provisioning WRITE SAME with UNMAP support to initiators.",
+			targetcliBackstoreLabels, nil,
+		),
+		backstoreWWN: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "backstore_wwn_info"),
+			"Unit serial number, vendor, model and revision the backstore reports to initiators, value is always 1.",
+			[]string{"backstore_type", "backstore", "serial", "vendor", "model", "revision"}, nil,
+		),
+		backstoreALUAState: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "backstore_alua_access_state"),
+			"ALUA access state of the target port group of the backstore.",
+			[]string{"backstore_type", "backstore", "tg_pt_gp", "state"}, nil,
+		),
+		backstoreReserved: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "backstore_reserved"),
+			"Whether an initiator holds a SCSI reservation of the backstore.",
+			targetcliBackstoreLabels, nil,
+		),
+		backstoreReservation: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "backstore_reservation_info"),
+			"Holder of the SCSI reservation of the backstore, value is always 1.",
+			[]string{"backstore_type", "backstore", "type", "fabric", "initiator", "key"}, nil,
+		),
+		backstoreRegistered: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "backstore_pr_registrations"),
+			"Number of initiator ports registered for persistent reservations of the backstore.",
+			targetcliBackstoreLabels, nil,
+		),
+		lunCreated: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "lun_created_timestamp_seconds"),
+			"Time the LUN was created in configfs, its counters start from zero at that time.",
+			targetcliLUNLabels, nil,
+		),
+		backstoreAbortErrors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "backstore_abort_errors_total"),
+			"Number of task aborts of the backstore, by whether the task was found and aborted.",
+			[]string{"backstore_type", "backstore", "status"}, nil,
+		),
+		backstoreResetErrors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "backstore_reset_errors_total"),
+			"Number of LUN resets of the backstore.",
+			targetcliBackstoreLabels, nil,
+		),
+		tpgSessions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "tpgt_sessions"),
+			"Number of sessions of the TPG, including those of initiators without a node ACL.",
+			targetcliTPGLabels, nil,
+		),
+		tpgNexus: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "tpgt_nexus_info"),
+			"Initiator of the I_T nexus of a loopback or vhost TPG, value is always 1.",
+			[]string{"fabric", "target", "tpgt", "initiator"}, nil,
+		),
+		aclSessions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "acl_sessions"),
+			"Number of sessions of the initiator of the node ACL.",
+			targetcliACLLabels, nil,
+		),
+		aclReadBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "acl_read_bytes_total"),
+			"Number of bytes read by the initiator from the LUNs mapped to it, in megabyte resolution.",
+			targetcliACLLabels, nil,
+		),
+		aclWriteBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "acl_write_bytes_total"),
+			"Number of bytes written by the initiator to the LUNs mapped to it, in megabyte resolution.",
+			targetcliACLLabels, nil,
+		),
+		aclCommands: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "acl_commands_total"),
+			"Number of SCSI commands of the initiator to the LUNs mapped to it.",
+			targetcliACLLabels, nil,
+		),
+		aclMaxBurst: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "acl_session_max_burst_length_bytes"),
+			"MaxBurstLength negotiated by the session of the initiator.",
+			targetcliACLLabels, nil,
+		),
+		aclFirstBurst: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "acl_session_first_burst_length_bytes"),
+			"FirstBurstLength negotiated by the session of the initiator.",
+			targetcliACLLabels, nil,
+		),
+		aclImmediate: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "acl_session_immediate_data"),
+			"Whether the session of the initiator negotiated ImmediateData.",
+			targetcliACLLabels, nil,
+		),
+		aclLUNReadBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "acl_lun_read_bytes_total"),
+			"Number of bytes read by the initiator from the mapped LUN, in megabyte resolution.",
+			targetcliACLLUNLabels, nil,
+		),
+		aclLUNWriteBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "acl_lun_write_bytes_total"),
+			"Number of bytes written by the initiator to the mapped LUN, in megabyte resolution.",
+			targetcliACLLUNLabels, nil,
+		),
+		aclLUNCommands: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, targetcliSubsystem, "acl_lun_commands_total"),
+			"Number of SCSI commands of the initiator to the mapped LUN.",
+			targetcliACLLUNLabels, nil,
+		),
+		targetInclude:        regexp.MustCompile(fmt.Sprintf("^(?:%s)$", *targetcliTargetInclude)),
+		targetExclude:        regexp.MustCompile(fmt.Sprintf("^(?:%s)$", *targetcliTargetExclude)),
+		backstoreTypeInclude: regexp.MustCompile(fmt.Sprintf("^(?:%s)$", *targetcliBackstoreTypeInclude)),
+		backstoreTypeExclude: regexp.MustCompile(fmt.Sprintf("^(?:%s)$", *targetcliBackstoreTypeExclude)),
+		logger:               logger,
+	}, nil
+}
+
+func (c *targetcliCollector) Update(ch chan<- prometheus.Metric) error {
+	root := c.configfsRoot()
+	running, err := readTargetcliConfigfs(root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "LIO configfs not found, skipping")
+			return ErrNoData
+		}
+		return fmt.Errorf("couldn't read LIO configfs: %w", err)
+	}
+
+	hbas, err := readTargetcliHBAs(filepath.Join(root, "core"))
+	if err != nil {
+		return fmt.Errorf("couldn't get HBAs: %w", err)
+	}
+	for _, hba := range hbas {
+		ch <- prometheus.MustNewConstMetric(c.hbaInfo, prometheus.GaugeValue, 1, hba.Index, hba.Plugin, hba.Version)
+	}
+
+	if err := c.updatePortals(ch, root); err != nil {
+		return err
+	}
+
+	// The objects in configfs, their errors are dropped once they're gone.
+	live := map[targetcliErrorKey]bool{}
+	if err := c.updateTPGs(ch, root, live); err != nil {
+		return err
+	}
+
+	if err := c.updateBackstores(ch, root, live); err != nil {
+		return err
+	}
+
+	c.updateErrors(ch, live)
+
+	path := rootfsFilePath(*targetcliSaveconfig)
+	fi, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "saveconfig file not found", "file", path)
+			// Anything configured at runtime is lost on reboot.
+			ch <- prometheus.MustNewConstMetric(c.inSync, prometheus.GaugeValue, boolToFloat(len(running) == 0))
+			return nil
+		}
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(c.mtime, prometheus.GaugeValue, float64(fi.ModTime().UnixNano())/1e9)
+
+	saved, err := readTargetcliSaveconfig(path)
+	if err != nil {
+		return fmt.Errorf("couldn't parse saveconfig file %s: %w", path, err)
+	}
+	ch <- prometheus.MustNewConstMetric(c.inSync, prometheus.GaugeValue, boolToFloat(reflect.DeepEqual(running, saved)))
+
+	return nil
+}
+
+// configfsRoot returns the LIO directory of configfs. Containers may have
+// configfs bind mounted somewhere else than below the sysfs path, so it is
+// looked up in the mount table if it's not there.
+func (c *targetcliCollector) configfsRoot() string {
+	root := sysFilePath("kernel/config/target")
+	if _, err := os.Stat(root); err == nil {
+		return root
+	}
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return root
+	}
+	proc, err := fs.Self()
+	if err != nil {
+		return root
+	}
+	mounts, err := proc.MountInfo()
+	if err != nil {
+		level.Debug(c.logger).Log("msg", "couldn't read mountinfo", "err", err)
+		return root
+	}
+	return findLIOConfigfs(root, mounts)
+}
+
+func (c *targetcliCollector) updatePortals(ch chan<- prometheus.Metric, root string) error {
+	portals, err := readTargetcliPortals(root)
+	if err != nil {
+		return fmt.Errorf("couldn't get network portals: %w", err)
+	}
+	if len(portals) == 0 {
+		return nil
+	}
+	for _, p := range portals {
+		if !c.targetIncluded(p.Target) {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.portalInfo, prometheus.GaugeValue, 1, p.Target, p.TPGT, p.Address, p.Port)
+		ch <- prometheus.MustNewConstMetric(c.iser, prometheus.GaugeValue, boolToFloat(p.ISER), p.Target, p.TPGT, p.Address, p.Port)
+	}
+
+	listeners := map[string]bool{}
+	for _, file := range []string{"net/tcp", "net/tcp6"} {
+		if err := readTCPListeners(procFilePath(file), listeners); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("couldn't get listening sockets: %w", err)
+		}
+	}
+
+	// Several TPGs commonly share a portal like 0.0.0.0:3260.
+	seen := map[string]bool{}
+	for _, p := range portals {
+		if seen[p.Address+" "+p.Port] {
+			continue
+		}
+		seen[p.Address+" "+p.Port] = true
+
+		ip := net.ParseIP(p.Address)
+		listening := false
+		if ip != nil {
+			// A socket bound to the unspecified address accepts connections on any address.
+			listening = listeners[net.JoinHostPort(ip.String(), p.Port)] ||
+				listeners[net.JoinHostPort(net.IPv4zero.String(), p.Port)] ||
+				listeners[net.JoinHostPort(net.IPv6unspecified.String(), p.Port)]
+		}
+		ch <- prometheus.MustNewConstMetric(c.listening, prometheus.GaugeValue, boolToFloat(listening), p.Address, p.Port)
+	}
+	return nil
+}
+
+func (c *targetcliCollector) updateTPGs(ch chan<- prometheus.Metric, root string, live map[targetcliErrorKey]bool) error {
+	tpgs, err := readLIOTPGs(root)
+	if err != nil {
+		return fmt.Errorf("couldn't get TPGs: %w", err)
+	}
+
+	// The paths of the iSCSI targets by IQN.
+	targets := map[string]string{}
+	for _, tpg := range tpgs {
+		live[targetcliErrorKey{fabric: tpg.Fabric, target: tpg.Target, tpgt: tpg.TPGT}] = true
+		if tpg.Fabric == "iscsi" {
+			live[targetcliErrorKey{fabric: tpg.Fabric, target: tpg.Target}] = true
+		}
+		if !c.targetIncluded(tpg.Target) {
+			continue
+		}
+		// The iSCSI metrics are labeled with the IQNs of targets and initiators.
+		if tpg.Fabric == "iscsi" {
+			targets[tpg.Target] = filepath.Dir(tpg.path)
+			ch <- prometheus.MustNewConstMetric(c.tpgEnabled, prometheus.GaugeValue, boolToFloat(tpg.Enabled), tpg.Target, tpg.TPGT)
+			ch <- prometheus.MustNewConstMetric(c.tpgLUNCount, prometheus.GaugeValue, float64(len(tpg.LUNs)), tpg.Target, tpg.TPGT)
+		}
+		if tpg.Nexus != "" {
+			ch <- prometheus.MustNewConstMetric(c.tpgNexus, prometheus.GaugeValue, 1, tpg.Fabric, tpg.Target, tpg.TPGT, tpg.Nexus)
+		}
+		// The counters of disabled TPGs don't change.
+		if !tpg.Enabled {
+			continue
+		}
+
+		// A broken TPG doesn't stop the others from being reported.
+		begin := time.Now()
+		key := targetcliErrorKey{fabric: tpg.Fabric, target: tpg.Target, tpgt: tpg.TPGT}
+		c.updateLUNs(ch, tpg, key)
+		if tpg.Fabric == "iscsi" {
+			c.countError(key, "acls", c.updateACLs(ch, tpg))
+		}
+		ch <- prometheus.MustNewConstMetric(c.scrapeDuration, prometheus.GaugeValue, time.Since(begin).Seconds(), tpg.Fabric, tpg.Target, tpg.TPGT)
+	}
+	ch <- prometheus.MustNewConstMetric(c.targets, prometheus.GaugeValue, float64(len(targets)))
+
+	// The fabric statistics of iSCSI targets are shared by their TPGs.
+	for iqn, path := range targets {
+		key := targetcliErrorKey{fabric: "iscsi", target: iqn}
+		c.countError(key, "fabric_statistics", c.updateISCSITarget(ch, iqn, path))
+	}
+	return nil
+}
+
+// updateErrors reports the error counts of the objects in live and forgets
+// those of objects that were deleted.
+func (c *targetcliCollector) updateErrors(ch chan<- prometheus.Metric, live map[targetcliErrorKey]bool) {
+	targetcliErrorsMtx.Lock()
+	defer targetcliErrorsMtx.Unlock()
+	for key, count := range targetcliErrors {
+		object := key
+		object.stage = ""
+		if !live[object] {
+			delete(targetcliErrors, key)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.scrapeErrors, prometheus.CounterValue, float64(count), key.fabric, key.target, key.tpgt, key.stage)
+	}
+}
+
+// countError counts a failed stage of the update of a TPG, target or
+// backstore, a nil error is ignored.
+func (c *targetcliCollector) countError(key targetcliErrorKey, stage string, err error) {
+	if err == nil {
+		return
+	}
+	key.stage = stage
+
+	targetcliErrorsMtx.Lock()
+	defer targetcliErrorsMtx.Unlock()
+	level.Warn(c.logger).Log("msg", "couldn't update target", "fabric", key.fabric, "target", key.target, "tpgt", key.tpgt, "stage", stage, "err", err)
+	targetcliErrors[key]++
+}
+
+func (c *targetcliCollector) updateISCSITarget(ch chan<- prometheus.Metric, iqn, path string) error {
+	stats, err := readLIOISCSITargetStats(path)
+	if err != nil {
+		return err
+	}
+	for _, l := range targetcliLoginResults {
+		ch <- prometheus.MustNewConstMetric(c.logins, prometheus.CounterValue, float64(stats.Logins[l.file]), iqn, l.result)
+	}
+	ch <- prometheus.MustNewConstMetric(c.logouts, prometheus.CounterValue, float64(stats.Logouts["normal_logouts"]), iqn, "normal")
+	ch <- prometheus.MustNewConstMetric(c.logouts, prometheus.CounterValue, float64(stats.Logouts["abnormal_logouts"]), iqn, "abnormal")
+	ch <- prometheus.MustNewConstMetric(c.sessionErrors, prometheus.CounterValue, float64(stats.SessionErrors["digest_errors"]), iqn, "digest")
+	ch <- prometheus.MustNewConstMetric(c.sessionErrors, prometheus.CounterValue, float64(stats.SessionErrors["cxn_timeout_errors"]), iqn, "connection_timeout")
+	ch <- prometheus.MustNewConstMetric(c.sessionErrors, prometheus.CounterValue, float64(stats.SessionErrors["format_errors"]), iqn, "format")
+	return nil
+}
+
+// updateLUNs reports the LUNs of a TPG. A LUN that can't be read is counted
+// as an error of the TPG and doesn't stop the other LUNs from being reported.
+func (c *targetcliCollector) updateLUNs(ch chan<- prometheus.Metric, tpg lioTPG, key targetcliErrorKey) {
+	for _, lun := range tpg.LUNs {
+		if lun.err != nil {
+			c.countError(key, "luns", fmt.Errorf("couldn't get backstore of %s TPG %s LUN %s: %w", tpg.Target, tpg.TPGT, lun.Index, lun.err))
+			continue
+		}
+		if !c.backstoreTypeIncluded(lun.BackstoreType) {
+			continue
+		}
+		c.countError(key, "luns", c.updateLUN(ch, tpg, lun))
+	}
+}
+
+func (c *targetcliCollector) updateLUN(ch chan<- prometheus.Metric, tpg lioTPG, lun lioLUN) error {
+	stats, err := readLIOLUNStats(lun)
+	if err != nil {
+		return fmt.Errorf("couldn't get statistics of %s TPG %s LUN %s: %w", tpg.Target, tpg.TPGT, lun.Index, err)
+	}
+	labels := []string{tpg.Fabric, tpg.Target, tpg.TPGT, lun.Index, lun.BackstoreType, lun.Backstore}
+	ch <- prometheus.MustNewConstMetric(c.lunReadBytes, prometheus.CounterValue, float64(stats.ReadBytes), labels...)
+	ch <- prometheus.MustNewConstMetric(c.lunWriteBytes, prometheus.CounterValue, float64(stats.WriteBytes), labels...)
+	ch <- prometheus.MustNewConstMetric(c.lunCommands, prometheus.CounterValue, float64(stats.Commands), labels...)
+	ch <- prometheus.MustNewConstMetric(c.lunBusyErrors, prometheus.CounterValue, float64(stats.BusyErrors), labels...)
+	ch <- prometheus.MustNewConstMetric(c.lunCreated, prometheus.GaugeValue, float64(lun.Created.UnixNano())/1e9, labels...)
+	return nil
+}
+
+func (c *targetcliCollector) updateACLs(ch chan<- prometheus.Metric, tpg lioTPG) error {
+	acls, err := readLIOACLs(tpg)
+	if err != nil {
+		return fmt.Errorf("couldn't get ACLs of %s TPG %s: %w", tpg.Target, tpg.TPGT, err)
+	}
+	sessions, err := readLIODynamicSessions(tpg)
+	if err != nil {
+		return fmt.Errorf("couldn't get dynamic sessions of %s TPG %s: %w", tpg.Target, tpg.TPGT, err)
+	}
+	for _, acl := range acls {
+		sessions += acl.Sessions
+	}
+	ch <- prometheus.MustNewConstMetric(c.tpgSessions, prometheus.GaugeValue, float64(sessions), tpg.Target, tpg.TPGT)
+
+	for _, acl := range acls {
+		ch <- prometheus.MustNewConstMetric(c.aclSessions, prometheus.GaugeValue, float64(acl.Sessions), tpg.Target, tpg.TPGT, acl.Initiator)
+		ch <- prometheus.MustNewConstMetric(c.aclReadBytes, prometheus.CounterValue, float64(acl.ReadBytes), tpg.Target, tpg.TPGT, acl.Initiator)
+		ch <- prometheus.MustNewConstMetric(c.aclWriteBytes, prometheus.CounterValue, float64(acl.WriteBytes), tpg.Target, tpg.TPGT, acl.Initiator)
+		ch <- prometheus.MustNewConstMetric(c.aclCommands, prometheus.CounterValue, float64(acl.Commands), tpg.Target, tpg.TPGT, acl.Initiator)
+		if *targetcliACLLUNs {
+			for _, lun := range acl.LUNs {
+				labels := []string{tpg.Target, tpg.TPGT, acl.Initiator, lun.Index}
+				ch <- prometheus.MustNewConstMetric(c.aclLUNReadBytes, prometheus.CounterValue, float64(lun.ReadBytes), labels...)
+				ch <- prometheus.MustNewConstMetric(c.aclLUNWriteBytes, prometheus.CounterValue, float64(lun.WriteBytes), labels...)
+				ch <- prometheus.MustNewConstMetric(c.aclLUNCommands, prometheus.CounterValue, float64(lun.Commands), labels...)
+			}
+		}
+		if acl.Params != nil {
+			ch <- prometheus.MustNewConstMetric(c.aclMaxBurst, prometheus.GaugeValue, float64(acl.Params["MaxBurstLength"]), tpg.Target, tpg.TPGT, acl.Initiator)
+			ch <- prometheus.MustNewConstMetric(c.aclFirstBurst, prometheus.GaugeValue, float64(acl.Params["FirstBurstLength"]), tpg.Target, tpg.TPGT, acl.Initiator)
+			ch <- prometheus.MustNewConstMetric(c.aclImmediate, prometheus.GaugeValue, float64(acl.Params["ImmediateData"]), tpg.Target, tpg.TPGT, acl.Initiator)
+		}
+	}
+	return nil
+}
+
+func (c *targetcliCollector) updateBackstores(ch chan<- prometheus.Metric, root string, live map[targetcliErrorKey]bool) error {
+	backstores, err := readLIOBackstores(root)
+	if err != nil {
+		return fmt.Errorf("couldn't get backstores: %w", err)
+	}
+
+	// A broken backstore doesn't stop the others from being reported. Its
+	// errors are counted under the core fabric, like its configfs directory.
+	for _, b := range backstores {
+		key := targetcliErrorKey{fabric: "core", target: b.Type + "/" + b.Name}
+		live[key] = true
+		if !c.backstoreTypeIncluded(b.Type) {
+			continue
+		}
+		c.countError(key, "backstores", c.updateBackstore(ch, b))
+	}
+	return nil
+}
+
+func (c *targetcliCollector) updateBackstore(ch chan<- prometheus.Metric, b lioBackstore) error {
+	// targetcli sets the udev_path of block, fileio and pscsi backstores.
+	if b.UdevPath != "" {
+		ch <- prometheus.MustNewConstMetric(c.backstoreInfo, prometheus.GaugeValue, 1, b.Type, b.Name, b.UdevPath)
+	}
+	if b.Type == "user" {
+		handler := strings.SplitN(b.Config, "/", 2)[0]
+		ch <- prometheus.MustNewConstMetric(c.userBackstoreInfo, prometheus.GaugeValue, 1, b.Name, handler, b.Config)
+	}
+
+	depth, err := readLIOAttrib(b, "queue_depth")
+	if err != nil {
+		return fmt.Errorf("couldn't get queue depth of backstore %s/%s: %w", b.Type, b.Name, err)
+	}
+	ch <- prometheus.MustNewConstMetric(c.backstoreQueueDepth, prometheus.GaugeValue, float64(depth), b.Type, b.Name)
+
+	blockSize, err := readLIOAttrib(b, "block_size")
+	if err != nil {
+		return fmt.Errorf("couldn't get block size of backstore %s/%s: %w", b.Type, b.Name, err)
+	}
+	ch <- prometheus.MustNewConstMetric(c.backstoreBlockSize, prometheus.GaugeValue, float64(blockSize), b.Type, b.Name)
+
+	// Passthrough backstores leave thin provisioning to the device.
+	if b.Type != "pscsi" {
+		for _, attr := range []struct {
+			name string
+			desc *prometheus.Desc
+		}{
+			{"emulate_tpu", c.backstoreEmulateTPU},
+			{"emulate_tpws", c.backstoreEmulateTPWS},
+		} {
+			value, err := readLIOAttrib(b, attr.name)
+			if err != nil {
+				return fmt.Errorf("couldn't get %s of backstore %s/%s: %w", attr.name, b.Type, b.Name, err)
+			}
+			ch <- prometheus.MustNewConstMetric(attr.desc, prometheus.GaugeValue, float64(value), b.Type, b.Name)
+		}
+	}
+
+	wwn, err := readLIOWWN(b)
+	if err != nil {
+		return fmt.Errorf("couldn't get WWN of backstore %s/%s: %w", b.Type, b.Name, err)
+	}
+	ch <- prometheus.MustNewConstMetric(c.backstoreWWN, prometheus.GaugeValue, 1, b.Type, b.Name, wwn.Serial, wwn.Vendor, wwn.Model, wwn.Revision)
+
+	groups, err := readLIOALUAGroups(b)
+	if err != nil {
+		return fmt.Errorf("couldn't get ALUA target port groups of backstore %s/%s: %w", b.Type, b.Name, err)
+	}
+	for _, g := range groups {
+		for _, state := range targetcliALUAStates {
+			ch <- prometheus.MustNewConstMetric(c.backstoreALUAState, prometheus.GaugeValue, boolToFloat(state.value == g.State), b.Type, b.Name, g.Name, state.name)
+		}
+	}
+
+	res, err := readLIOReservation(b)
+	if err != nil {
+		return fmt.Errorf("couldn't get reservation of backstore %s/%s: %w", b.Type, b.Name, err)
+	}
+	if res != nil {
+		ch <- prometheus.MustNewConstMetric(c.backstoreReserved, prometheus.GaugeValue, boolToFloat(res.Holder != nil), b.Type, b.Name)
+		if h := res.Holder; h != nil {
+			ch <- prometheus.MustNewConstMetric(c.backstoreReservation, prometheus.GaugeValue, 1, b.Type, b.Name, res.Type, h.Fabric, h.Initiator, h.Key)
+		}
+		ch <- prometheus.MustNewConstMetric(c.backstoreRegistered, prometheus.GaugeValue, float64(len(res.Registrations)), b.Type, b.Name)
+	}
+
+	dir := filepath.Join(b.path, "statistics", "scsi_tgt_dev")
+	resets, err := readUintFromFile(filepath.Join(dir, "resets"))
+	if err != nil {
+		return fmt.Errorf("couldn't get statistics of backstore %s/%s: %w", b.Type, b.Name, err)
+	}
+	ch <- prometheus.MustNewConstMetric(c.backstoreResetErrors, prometheus.CounterValue, float64(resets), b.Type, b.Name)
+
+	// The abort counters were added in Linux 4.13.
+	for _, status := range []string{"complete", "no_task"} {
+		aborts, err := readUintFromFile(filepath.Join(dir, "aborts_"+status))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("couldn't get statistics of backstore %s/%s: %w", b.Type, b.Name, err)
+		}
+		ch <- prometheus.MustNewConstMetric(c.backstoreAbortErrors, prometheus.CounterValue, float64(aborts), b.Type, b.Name, status)
+	}
+	return nil
+}
+
+func (c *targetcliCollector) targetIncluded(target string) bool {
+	return c.targetInclude.MatchString(target) && !c.targetExclude.MatchString(target)
+}
+
+func (c *targetcliCollector) backstoreTypeIncluded(backstoreType string) bool {
+	return c.backstoreTypeInclude.MatchString(backstoreType) && !c.backstoreTypeExclude.MatchString(backstoreType)
+}
+
+// readTargetcliSaveconfig returns the set of backstores, targets, TPGs, LUNs,
+// ACLs and portals described by a saveconfig file.
+func readTargetcliSaveconfig(path string) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config targetcliSaveconfigFile
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	objects := map[string]bool{}
+	for _, so := range config.StorageObjects {
+		objects[fmt.Sprintf("backstore /backstores/%s/%s", so.Plugin, so.Name)] = true
+	}
+	for _, t := range config.Targets {
+		target := t.Fabric + "/" + t.WWN
+		objects["target "+target] = true
+		for _, tpg := range t.TPGs {
+			prefix := fmt.Sprintf("%s/%d", target, tpg.Tag)
+			objects["tpg "+prefix] = true
+			for _, lun := range tpg.LUNs {
+				objects[fmt.Sprintf("lun %s/%d %s", prefix, lun.Index, lun.StorageObject)] = true
+			}
+			for _, acl := range tpg.NodeACLs {
+				objects[fmt.Sprintf("acl %s/%s", prefix, acl.NodeWWN)] = true
+			}
+			for _, p := range tpg.Portals {
+				address := p.IPAddress
+				if strings.Contains(address, ":") {
+					address = "[" + address + "]"
+				}
+				objects[fmt.Sprintf("portal %s/%s:%d", prefix, address, p.Port)] = true
+			}
+		}
+	}
+	return objects, nil
+}
+
+// readTargetcliConfigfs returns the same set as readTargetcliSaveconfig for
+// the running configuration in the LIO configfs tree.
+func readTargetcliConfigfs(root string) (map[string]bool, error) {
+	if _, err := os.Stat(root); err != nil {
+		return nil, err
+	}
+
+	objects := map[string]bool{}
+	backstores, err := readLIOBackstores(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range backstores {
+		objects[fmt.Sprintf("backstore /backstores/%s/%s", b.Type, b.Name)] = true
+	}
+
+	tpgs, err := filepath.Glob(filepath.Join(root, "*", "*", "tpgt_*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, tpgPath := range tpgs {
+		wwnPath := filepath.Dir(tpgPath)
+		fabric := filepath.Base(filepath.Dir(wwnPath))
+		target := fabric + "/" + targetcliWWN(fabric, filepath.Base(wwnPath))
+		prefix := target + "/" + strings.TrimPrefix(filepath.Base(tpgPath), "tpgt_")
+		objects["target "+target] = true
+		objects["tpg "+prefix] = true
+
+		luns, err := filepath.Glob(filepath.Join(tpgPath, "lun", "lun_*"))
+		if err != nil {
+			return nil, err
+		}
+		for _, lun := range luns {
+			// LUNs without a backstore are counted as errors of their TPG
+			// by updateLUNs and left out here.
+			storageObject, err := targetcliLUNStorageObject(lun)
+			if err != nil {
+				continue
+			}
+			objects[fmt.Sprintf("lun %s/%s %s", prefix, strings.TrimPrefix(filepath.Base(lun), "lun_"), storageObject)] = true
+		}
+
+		for _, kind := range []string{"acls", "np"} {
+			entries, err := ioutil.ReadDir(filepath.Join(tpgPath, kind))
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				return nil, err
+			}
+			for _, e := range entries {
+				if kind == "acls" {
+					objects[fmt.Sprintf("acl %s/%s", prefix, e.Name())] = true
+				} else {
+					objects[fmt.Sprintf("portal %s/%s", prefix, e.Name())] = true
+				}
+			}
+		}
+	}
+	return objects, nil
+}
+
+// targetcliLUNStorageObject resolves the backstore a LUN links to, in the
+// /backstores/<plugin>/<name> form used by saveconfig.
+func targetcliLUNStorageObject(lun string) (string, error) {
+	plugin, name, err := readLIOLUNBackstore(lun)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("/backstores/%s/%s", plugin, name), nil
+}
+
+// readTargetcliHBAs parses the hba_info attribute of each HBA, which has the
+// form "HBA Index: 0 plugin: iblock version: v5.0".
+func readTargetcliHBAs(root string) ([]targetcliHBA, error) {
+	files, err := filepath.Glob(filepath.Join(root, "*", "hba_info"))
+	if err != nil {
+		return nil, err
+	}
+
+	hbas := make([]targetcliHBA, 0, len(files))
+	for _, file := range files {
+		info, err := readStringFromFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var hba targetcliHBA
+		fields := strings.Fields(info)
+		for i := 0; i+1 < len(fields); i++ {
+			switch fields[i] {
+			case "Index:":
+				hba.Index = fields[i+1]
+			case "plugin:":
+				hba.Plugin = fields[i+1]
+			case "version:":
+				hba.Version = fields[i+1]
+			}
+		}
+		if hba.Index == "" {
+			return nil, fmt.Errorf("invalid hba_info %q in %s", info, file)
+		}
+		hbas = append(hbas, hba)
+	}
+	return hbas, nil
+}
+
+// readTargetcliPortals returns the network portals of all TPGs, parsed from
+// the <address>:<port> names of the np/ entries.
+func readTargetcliPortals(root string) ([]targetcliPortal, error) {
+	nps, err := filepath.Glob(filepath.Join(root, "*", "*", "tpgt_*", "np", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	portals := make([]targetcliPortal, 0, len(nps))
+	for _, np := range nps {
+		host, port, err := net.SplitHostPort(filepath.Base(np))
+		if err != nil {
+			return nil, fmt.Errorf("invalid network portal %s: %w", np, err)
+		}
+		// The iser attribute was added in Linux 3.10.
+		iser, err := readUintFromFile(filepath.Join(np, "iser"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		tpgPath := filepath.Dir(filepath.Dir(np))
+		portals = append(portals, targetcliPortal{
+			Target:  filepath.Base(filepath.Dir(tpgPath)),
+			TPGT:    strings.TrimPrefix(filepath.Base(tpgPath), "tpgt_"),
+			Address: host,
+			Port:    port,
+			ISER:    iser == 1,
+		})
+	}
+	return portals, nil
+}
+
+// readTCPListeners adds the local address of every socket in the LISTEN state
+// of a /proc/net/tcp{,6} file to listeners, in host:port form.
+func readTCPListeners(path string, listeners map[string]bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// Skip the header line.
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[3] != "0A" {
+			continue
+		}
+		parts := strings.Split(fields[1], ":")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid local address %q", fields[1])
+		}
+		ip, err := parseProcNetIP(parts[0])
+		if err != nil {
+			return err
+		}
+		port, err := strconv.ParseUint(parts[1], 16, 16)
+		if err != nil {
+			return err
+		}
+		listeners[net.JoinHostPort(ip.String(), strconv.FormatUint(port, 10))] = true
+	}
+	return scanner.Err()
+}
+
+// parseProcNetIP decodes an address from /proc/net/tcp{,6}. The kernel prints
+// it as 32-bit words, which hold the address in network byte order in memory,
+// so the printed value depends on the byte order of the host.
+func parseProcNetIP(s string) (net.IP, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != net.IPv4len && len(b) != net.IPv6len {
+		return nil, fmt.Errorf("invalid address %q", s)
+	}
+	ip := make(net.IP, len(b))
+	for i := 0; i < len(b); i += 4 {
+		nativeEndian.PutUint32(ip[i:], binary.BigEndian.Uint32(b[i:]))
+	}
+	return ip, nil
+}
+
+// targetcliWWN returns the WWN of a target as written to saveconfig. The FC
+// fabrics name their configfs directories after the colon separated port
+// name, targetcli saves it as naa.<hex>.
+func targetcliWWN(fabric, name string) string {
+	switch fabric {
+	case "fc", "qla2xxx":
+		return "naa." + strings.Replace(name, ":", "", -1)
+	}
+	return name
+}
+
+// targetcliPlugin returns the backstore plugin of an HBA directory named
+// <prefix>_<index>. Plugins targetcli doesn't know are named after the prefix.
+func targetcliPlugin(hba string) (string, bool) {
+	i := strings.LastIndex(hba, "_")
+	if i <= 0 {
+		return "", false
+	}
+	if plugin, ok := targetcliPlugins[hba[:i]]; ok {
+		return plugin, true
+	}
+	return hba[:i], true
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
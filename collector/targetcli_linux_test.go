@@ -0,0 +1,507 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func TestTargetcliSaveconfigDrift(t *testing.T) {
+	running, err := readTargetcliConfigfs("fixtures/sys/kernel/config/target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 20; len(running) != want {
+		t.Errorf("want %d configfs objects, got %d: %v", want, len(running), running)
+	}
+
+	for _, tt := range []struct {
+		file   string
+		inSync bool
+	}{
+		{"fixtures/targetcli/saveconfig.json", true},
+		{"fixtures/targetcli/saveconfig_drift.json", false},
+	} {
+		saved, err := readTargetcliSaveconfig(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := reflect.DeepEqual(running, saved); got != tt.inSync {
+			t.Errorf("%s: want in sync %t, got %t: running %v, saved %v", tt.file, tt.inSync, got, running, saved)
+		}
+	}
+}
+
+func TestTargetcliPortals(t *testing.T) {
+	portals, err := readTargetcliPortals("fixtures/sys/kernel/config/target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []targetcliPortal{
+		{Target: "iqn.2003-01.org.linux-iscsi.gw1:storage", TPGT: "1", Address: "192.168.1.10", Port: "3260", ISER: true},
+	}
+	if !reflect.DeepEqual(portals, want) {
+		t.Errorf("want portals %v, got %v", want, portals)
+	}
+}
+
+func TestReadTCPListeners(t *testing.T) {
+	if nativeEndian != binary.LittleEndian {
+		t.Skip("fixtures are from a little endian host")
+	}
+	listeners := map[string]bool{}
+	for _, file := range []string{"fixtures/targetcli/tcp", "fixtures/targetcli/tcp6"} {
+		if err := readTCPListeners(file, listeners); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]bool{
+		"0.0.0.0:22":        true,
+		"192.168.1.10:3260": true,
+		"[::]:9100":         true,
+		"10.0.0.10:3260":    true,
+	}
+	if !reflect.DeepEqual(listeners, want) {
+		t.Errorf("want listeners %v, got %v", want, listeners)
+	}
+}
+
+func TestTargetcliHBAs(t *testing.T) {
+	hbas, err := readTargetcliHBAs("fixtures/sys/kernel/config/target/core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []targetcliHBA{
+		{Index: "1", Plugin: "fileio", Version: "v5.0"},
+		{Index: "0", Plugin: "iblock", Version: "v5.0"},
+		{Index: "3", Plugin: "pscsi", Version: "v5.0"},
+		{Index: "2", Plugin: "user", Version: "v5.0"},
+	}
+	if !reflect.DeepEqual(hbas, want) {
+		t.Errorf("want HBAs %v, got %v", want, hbas)
+	}
+}
+
+func TestTargetcliPlugin(t *testing.T) {
+	for hba, want := range map[string]string{
+		"iblock_0":  "block",
+		"rd_mcp_1":  "ramdisk",
+		"rbd_2":     "rbd",
+		"newplug_3": "newplug",
+		"bogus":     "",
+		"_4":        "",
+	} {
+		plugin, ok := targetcliPlugin(hba)
+		if plugin != want || ok != (want != "") {
+			t.Errorf("%s: want plugin %q, got %q", hba, want, plugin)
+		}
+	}
+}
+
+func TestTargetcliBackstores(t *testing.T) {
+	backstores, err := readLIOBackstores("fixtures/sys/kernel/config/target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []lioBackstore{
+		{Type: "fileio", Name: "file1", UdevPath: "/srv/iscsi/file1.img"},
+		{Type: "block", Name: "disk1", UdevPath: "/dev/sdb"},
+		{Type: "pscsi", Name: "sdc", UdevPath: "/dev/sdc"},
+		{Type: "user", Name: "rbd1", Config: "rbd/rbd/disk2"},
+	}
+	if len(backstores) != len(want) {
+		t.Fatalf("want backstores %v, got %v", want, backstores)
+	}
+	for i := range want {
+		backstores[i].path = ""
+		if backstores[i] != want[i] {
+			t.Errorf("want backstore %v, got %v", want[i], backstores[i])
+		}
+	}
+}
+
+func TestTargetcliTPGs(t *testing.T) {
+	tpgs, err := readLIOTPGs("fixtures/sys/kernel/config/target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tpgs) != 5 {
+		t.Fatalf("want 5 TPGs, got %v", tpgs)
+	}
+	fc, iscsi, disabled, loopback, vhost := tpgs[0], tpgs[1], tpgs[2], tpgs[3], tpgs[4]
+	if fc.Fabric != "fc" || fc.Target != "21:00:00:24:ff:31:a3:a8" || !fc.Enabled || len(fc.LUNs) != 1 {
+		t.Fatalf("want enabled FC TPG with 1 LUN, got %v", fc)
+	}
+	if lun := fc.LUNs[0]; lun.BackstoreType != "block" || lun.Backstore != "disk1" || lun.Created.IsZero() {
+		t.Errorf("want FC LUN backed by block/disk1 with creation time, got %v", lun)
+	}
+	if iscsi.Fabric != "iscsi" || !iscsi.Enabled || len(iscsi.LUNs) != 2 {
+		t.Errorf("want enabled iSCSI TPG with 2 LUNs, got %v", iscsi)
+	}
+	if disabled.TPGT != "2" || disabled.Enabled || len(disabled.LUNs) != 0 {
+		t.Errorf("want disabled iSCSI TPG 2 without LUNs, got %v", disabled)
+	}
+	if loopback.Fabric != "loopback" || !loopback.Enabled || loopback.Nexus != "naa.5001405e4d3c2b1a" || len(loopback.LUNs) != 1 {
+		t.Errorf("want enabled loopback TPG with nexus and 1 LUN, got %v", loopback)
+	}
+	if vhost.Fabric != "vhost" || !vhost.Enabled || vhost.Nexus != "naa.5001405b9c8d7e6f" || len(vhost.LUNs) != 1 {
+		t.Errorf("want enabled vhost TPG with nexus and 1 LUN, got %v", vhost)
+	}
+
+	stats, err := readLIOLUNStats(fc.LUNs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantStats := lioLUNStats{ReadBytes: 2048 << 20, WriteBytes: 512 << 20, Commands: 309117}
+	if stats != wantStats {
+		t.Errorf("want LUN statistics %v, got %v", wantStats, stats)
+	}
+
+	sessions, err := readLIODynamicSessions(iscsi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessions != 2 {
+		t.Errorf("want 2 dynamic sessions, got %d", sessions)
+	}
+
+	acls, err := readLIOACLs(iscsi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []lioACL{
+		{
+			Initiator:  "iqn.1994-05.com.redhat:client1",
+			Sessions:   1,
+			ReadBytes:  123 << 20,
+			WriteBytes: 52 << 20,
+			Commands:   49711,
+			Params: map[string]uint64{
+				"MaxBurstLength":   262144,
+				"FirstBurstLength": 65536,
+				"ImmediateData":    1,
+			},
+			LUNs: []lioMappedLUN{
+				{Index: "0", ReadBytes: 120 << 20, WriteBytes: 45 << 20, Commands: 48421},
+				{Index: "1", ReadBytes: 3 << 20, WriteBytes: 7 << 20, Commands: 1290},
+			},
+		},
+	}
+	if !reflect.DeepEqual(acls, want) {
+		t.Errorf("want ACLs %v, got %v", want, acls)
+	}
+}
+
+func TestTargetcliBrokenLUN(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewTargetcliCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpgs, err := readLIOTPGs("fixtures/sys/kernel/config/target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpg := tpgs[0]
+	tpg.LUNs = append([]lioLUN{{Index: "9", BackstoreType: "block", Backstore: "gone", path: "fixtures/nonexistent"}}, tpg.LUNs...)
+
+	key := targetcliErrorKey{fabric: tpg.Fabric, target: tpg.Target, tpgt: tpg.TPGT, stage: "luns"}
+	before := targetcliErrors[key]
+	ch := make(chan prometheus.Metric, 100)
+	c.(*targetcliCollector).updateLUNs(ch, tpg, key)
+	close(ch)
+
+	var commands int
+	for m := range ch {
+		if m.Desc() == c.(*targetcliCollector).lunCommands {
+			commands++
+		}
+	}
+	if commands != 1 {
+		t.Errorf("want commands of the healthy LUN, got %d series", commands)
+	}
+	if errors := targetcliErrors[key] - before; errors != 1 {
+		t.Errorf("want 1 LUN error, got %d", errors)
+	}
+}
+
+func TestTargetcliUnlinkedLUN(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewTargetcliCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		link string
+	}{
+		{name: "no backstore link"},
+		{name: "unknown HBA", link: "../../../../../core/bogus/disk2"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "targetcli")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(root)
+
+			tpgPath := filepath.Join(root, "iscsi", "iqn.2003-01.org.linux-iscsi.gw2:storage", "tpgt_1")
+			healthy := filepath.Join(tpgPath, "lun", "lun_0")
+			broken := filepath.Join(tpgPath, "lun", "lun_1")
+			for _, dir := range []string{
+				filepath.Join(root, "core", "iblock_0", "disk1"),
+				filepath.Join(healthy, "statistics", "scsi_tgt_port"),
+				filepath.Join(healthy, "statistics", "scsi_port"),
+				broken,
+			} {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for file, value := range map[string]string{
+				filepath.Join(tpgPath, "enable"):                                      "1",
+				filepath.Join(root, "core", "iblock_0", "disk1", "udev_path"):         "/dev/sdb",
+				filepath.Join(healthy, "statistics", "scsi_tgt_port", "read_mbytes"):  "1",
+				filepath.Join(healthy, "statistics", "scsi_tgt_port", "write_mbytes"): "2",
+				filepath.Join(healthy, "statistics", "scsi_tgt_port", "in_cmds"):      "3",
+				filepath.Join(healthy, "statistics", "scsi_port", "busy_count"):       "0",
+			} {
+				if err := ioutil.WriteFile(file, []byte(value+"\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Symlink("../../../../../core/iblock_0/disk1", filepath.Join(healthy, "0123456789")); err != nil {
+				t.Fatal(err)
+			}
+			if tc.link != "" {
+				if err := os.Symlink(tc.link, filepath.Join(broken, "9876543210")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tpgs, err := readLIOTPGs(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tpgs) != 1 || len(tpgs[0].LUNs) != 2 {
+				t.Fatalf("want 1 TPG with 2 LUNs, got %v", tpgs)
+			}
+			tpg := tpgs[0]
+
+			key := targetcliErrorKey{fabric: tpg.Fabric, target: tpg.Target, tpgt: tpg.TPGT, stage: "luns"}
+			before := targetcliErrors[key]
+			ch := make(chan prometheus.Metric, 100)
+			c.(*targetcliCollector).updateLUNs(ch, tpg, key)
+			close(ch)
+			var commands int
+			for m := range ch {
+				if m.Desc() == c.(*targetcliCollector).lunCommands {
+					commands++
+				}
+			}
+			if commands != 1 {
+				t.Errorf("want commands of the healthy LUN, got %d series", commands)
+			}
+			if errors := targetcliErrors[key] - before; errors != 1 {
+				t.Errorf("want 1 LUN error, got %d", errors)
+			}
+
+			running, err := readTargetcliConfigfs(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !running["lun iscsi/iqn.2003-01.org.linux-iscsi.gw2:storage/1/0 /backstores/block/disk1"] {
+				t.Errorf("want healthy LUN in running configuration, got %v", running)
+			}
+			if len(running) != 4 {
+				t.Errorf("want backstore, target, TPG and healthy LUN in running configuration, got %v", running)
+			}
+		})
+	}
+}
+
+func TestTargetcliErrors(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewTargetcliCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := c.(*targetcliCollector)
+
+	kept := targetcliErrorKey{fabric: "core", target: "block/kept"}
+	deleted := targetcliErrorKey{fabric: "core", target: "block/deleted"}
+	healthy := targetcliErrorKey{fabric: "core", target: "block/healthy"}
+	tc.countError(kept, "backstores", os.ErrPermission)
+	tc.countError(deleted, "backstores", os.ErrPermission)
+	tc.countError(healthy, "backstores", nil)
+
+	ch := make(chan prometheus.Metric, 100)
+	tc.updateErrors(ch, map[targetcliErrorKey]bool{kept: true, healthy: true})
+	close(ch)
+	if n := len(ch); n != 1 {
+		t.Errorf("want 1 error series, got %d", n)
+	}
+
+	kept.stage, deleted.stage, healthy.stage = "backstores", "backstores", "backstores"
+	if _, ok := targetcliErrors[kept]; !ok {
+		t.Errorf("want errors of %v", kept)
+	}
+	if _, ok := targetcliErrors[deleted]; ok {
+		t.Errorf("want no errors of deleted %v", deleted)
+	}
+	if _, ok := targetcliErrors[healthy]; ok {
+		t.Errorf("want no errors of healthy %v", healthy)
+	}
+	delete(targetcliErrors, kept)
+}
+
+func TestTargetcliISCSITargetStats(t *testing.T) {
+	stats, err := readLIOISCSITargetStats("fixtures/sys/kernel/config/target/iscsi/iqn.2003-01.org.linux-iscsi.gw1:storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := lioISCSITargetStats{
+		Logins: map[string]uint64{
+			"accepts":            42,
+			"redirects":          0,
+			"authenticate_fails": 3,
+			"authorize_fails":    1,
+			"negotiate_fails":    0,
+			"other_fails":        2,
+		},
+		Logouts:       map[string]uint64{"normal_logouts": 37, "abnormal_logouts": 4},
+		SessionErrors: map[string]uint64{"digest_errors": 5, "cxn_timeout_errors": 1, "format_errors": 0},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("want target statistics %v, got %v", want, stats)
+	}
+}
+
+func TestTargetcliALUAGroups(t *testing.T) {
+	groups, err := readLIOALUAGroups(lioBackstore{path: "fixtures/sys/kernel/config/target/core/iblock_0/disk1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []lioALUAGroup{
+		{Name: "default_tg_pt_gp", State: 0},
+		{Name: "gw2", State: 2},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("want ALUA groups %v, got %v", want, groups)
+	}
+}
+
+func TestTargetcliReservation(t *testing.T) {
+	for _, tt := range []struct {
+		backstore string
+		want      *lioReservation
+	}{
+		{
+			backstore: "iblock_0/disk1",
+			want: &lioReservation{
+				Holder: &lioRegistration{Fabric: "iSCSI", Initiator: "iqn.1994-05.com.redhat:client1,i,0x00023d000003", Key: "0x0000000000001234"},
+				Type:   "spc3",
+				Registrations: []lioRegistration{
+					{Fabric: "iSCSI", Initiator: "iqn.1994-05.com.redhat:client1,i,0x00023d000003", Key: "0x0000000000001234"},
+					{Fabric: "iSCSI", Initiator: "iqn.1994-05.com.redhat:client2,i,0x00023d000001", Key: "0x0000000000005678"},
+				},
+			},
+		},
+		{backstore: "fileio_1/file1", want: &lioReservation{}},
+		{backstore: "pscsi_3/sdc", want: nil},
+	} {
+		res, err := readLIOReservation(lioBackstore{path: "fixtures/sys/kernel/config/target/core/" + tt.backstore})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(res, tt.want) {
+			t.Errorf("%s: want reservation %+v, got %+v", tt.backstore, tt.want, res)
+		}
+	}
+}
+
+func TestTargetcliWWN(t *testing.T) {
+	for _, tt := range []struct {
+		backstore string
+		want      lioWWN
+	}{
+		{"iblock_0/disk1", lioWWN{Serial: "4f3c5f8e-0f4a-4c1b-9a1e-2e5b8a0d7c11", Vendor: "LIO-ORG", Model: "disk1", Revision: "4.0"}},
+		{"pscsi_3/sdc", lioWWN{}},
+	} {
+		wwn, err := readLIOWWN(lioBackstore{path: "fixtures/sys/kernel/config/target/core/" + tt.backstore})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wwn != tt.want {
+			t.Errorf("%s: want WWN %v, got %v", tt.backstore, tt.want, wwn)
+		}
+	}
+}
+
+func TestTargetcliAttrib(t *testing.T) {
+	for _, tt := range []struct {
+		backstore string
+		want      uint64
+	}{
+		{"iblock_0/disk1", 128},
+		{"pscsi_3/sdc", 32},
+	} {
+		b := lioBackstore{path: "fixtures/sys/kernel/config/target/core/" + tt.backstore}
+		depth, err := readLIOAttrib(b, "queue_depth")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if depth != tt.want {
+			t.Errorf("%s: want queue depth %d, got %d", tt.backstore, tt.want, depth)
+		}
+		blockSize, err := readLIOAttrib(b, "block_size")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blockSize != 512 {
+			t.Errorf("%s: want block size 512, got %d", tt.backstore, blockSize)
+		}
+	}
+}
+
+func TestFindLIOConfigfs(t *testing.T) {
+	mounts := []*procfs.MountInfo{
+		{MountPoint: "/sys", FSType: "sysfs"},
+		{MountPoint: "fixtures/sys/kernel", FSType: "configfs"},
+		{MountPoint: "fixtures/sys/kernel/config", FSType: "configfs"},
+	}
+	if got, want := findLIOConfigfs("/nonexistent", mounts), "fixtures/sys/kernel/config/target"; got != want {
+		t.Errorf("want LIO configfs %s, got %s", want, got)
+	}
+	if got, want := findLIOConfigfs("/nonexistent", mounts[:2]), "/nonexistent"; got != want {
+		t.Errorf("want LIO configfs %s, got %s", want, got)
+	}
+}
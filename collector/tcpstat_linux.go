@@ -16,15 +16,40 @@
 package collector
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
 	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	tcpDestinationGrouping   = kingpin.Flag("collector.tcpstat.destination-grouping", "Group RTT and retransmits of established connections by remote subnet or service port, one of subnet, port. Disabled if empty.").Default("").String()
+	tcpDestinationIPv4Prefix = kingpin.Flag("collector.tcpstat.destination-ipv4-prefix", "Prefix length of the remote IPv4 subnets grouping connections.").Default("24").Int()
+	tcpDestinationIPv6Prefix = kingpin.Flag("collector.tcpstat.destination-ipv6-prefix", "Prefix length of the remote IPv6 subnets grouping connections.").Default("64").Int()
+	tcpDestinationLimit      = kingpin.Flag("collector.tcpstat.destination-limit", "Maximum number of destinations, connections to further destinations are accounted to the destination \"other\".").Default("64").Int()
+	tcpDestinationIdle       = kingpin.Flag("collector.tcpstat.destination-idle-timeout", "How long a destination without established connections is kept before it is dropped. Kept forever if 0.").Default("1h").Duration()
+)
+
+// The destination tracker is shared by all instances of the collector, so the
+// counters don't restart on filtered scrapes.
+var (
+	tcpDestinations    *tcpDestinationTracker
+	tcpDestinationsMtx sync.Mutex
 )
 
 type tcpConnectionState int
@@ -58,9 +83,104 @@ const (
 	tcpTxQueuedBytes
 )
 
+const (
+	// SOCK_DIAG_BY_FAMILY from <linux/sock_diag.h>.
+	sockDiagByFamily = 20
+
+	// Lengths of struct inet_diag_req_v2 and struct inet_diag_msg from
+	// <linux/inet_diag.h>.
+	inetDiagReqLen = 56
+	inetDiagMsgLen = 72
+
+	// INET_DIAG_INFO attribute holding the struct tcp_info.
+	inetDiagInfo = 2
+
+	// tcpDestinationOther is the destination of the connections exceeding
+	// the destination limit.
+	tcpDestinationOther = "other"
+)
+
+// tcpSocket is a TCP socket from an inet_diag_msg.
+type tcpSocket struct {
+	state      tcpConnectionState
+	localPort  uint16
+	remote     net.IP
+	remotePort uint16
+	rqueue     uint32
+	wqueue     uint32
+	// Unique for the lifetime of the socket.
+	cookie uint64
+	// Only set if requested.
+	info *tcpInfo
+}
+
+// tcpInfo are the fields of struct tcp_info from <linux/tcp.h> used to
+// assess the network path of a connection.
+type tcpInfo struct {
+	// Smoothed RTT in microseconds.
+	rtt          uint32
+	totalRetrans uint32
+	// Only reported since Linux 4.2.
+	segsOut *uint32
+}
+
+// tcpDestinationStats are the statistics of the established connections to
+// a destination. The segments are counted since the destination was first
+// seen.
+type tcpDestinationStats struct {
+	connections  float64
+	rttSum       float64
+	segsOut      float64
+	hasSegsOut   bool
+	totalRetrans float64
+}
+
+// tcpSocketCounters are the counters of a connection at the last scrape.
+type tcpSocketCounters struct {
+	segsOut      uint32
+	totalRetrans uint32
+}
+
+// tcpDestinationTracker groups the established connections by destination
+// and keeps the counters of each connection between scrapes, so the
+// segments sent and retransmitted to a destination only ever increase,
+// even as connections come and go. Segments sent on a connection after the
+// last scrape before it was closed are not accounted. Destinations without
+// connections for longer than idleTimeout are dropped and free their slot.
+type tcpDestinationTracker struct {
+	grouping    string
+	ipv4Mask    net.IPMask
+	ipv6Mask    net.IPMask
+	limit       int
+	idleTimeout time.Duration
+
+	mtx      sync.Mutex
+	sockets  map[uint64]tcpSocketCounters
+	stats    map[string]*tcpDestinationStats
+	lastSeen map[string]time.Time
+	groups   int
+}
+
+// tcpPortStats are the statistics of the connections to a listening port.
+type tcpPortStats struct {
+	states map[tcpConnectionState]float64
+	// Length and limit of the accept queue, summed over the listening
+	// sockets of the port.
+	acceptQueue      float64
+	acceptQueueLimit float64
+}
+
 type tcpStatCollector struct {
-	desc   typedDesc
-	logger log.Logger
+	desc             typedDesc
+	portStates       typedDesc
+	acceptQueue      typedDesc
+	acceptQueueLimit typedDesc
+	destinations     *tcpDestinationTracker
+	destConnections  typedDesc
+	destRTT          typedDesc
+	destSegsOut      typedDesc
+	destRetrans      typedDesc
+	logger           log.Logger
 }
 
 func init() {
@@ -69,17 +189,110 @@ func init() {
 
 // NewTCPStatCollector returns a new Collector exposing network stats.
 func NewTCPStatCollector(logger log.Logger) (Collector, error) {
+	switch *tcpDestinationGrouping {
+	case "", "subnet", "port":
+	default:
+		return nil, fmt.Errorf("invalid destination grouping: %q", *tcpDestinationGrouping)
+	}
+	if *tcpDestinationIPv4Prefix < 0 || *tcpDestinationIPv4Prefix > 32 {
+		return nil, fmt.Errorf("invalid IPv4 prefix length: %d", *tcpDestinationIPv4Prefix)
+	}
+	if *tcpDestinationIPv6Prefix < 0 || *tcpDestinationIPv6Prefix > 128 {
+		return nil, fmt.Errorf("invalid IPv6 prefix length: %d", *tcpDestinationIPv6Prefix)
+	}
+	if *tcpDestinationLimit < 0 {
+		return nil, fmt.Errorf("invalid destination limit: %d", *tcpDestinationLimit)
+	}
+	if *tcpDestinationIdle < 0 {
+		return nil, fmt.Errorf("invalid destination idle timeout: %s", *tcpDestinationIdle)
+	}
+
+	var destinations *tcpDestinationTracker
+	if *tcpDestinationGrouping != "" {
+		tcpDestinationsMtx.Lock()
+		if tcpDestinations == nil {
+			tcpDestinations = newTCPDestinationTracker(*tcpDestinationGrouping,
+				net.CIDRMask(*tcpDestinationIPv4Prefix, 32), net.CIDRMask(*tcpDestinationIPv6Prefix, 128),
+				*tcpDestinationLimit, *tcpDestinationIdle)
+		}
+		destinations = tcpDestinations
+		tcpDestinationsMtx.Unlock()
+	}
+	destDesc := func(name, help string, valueType prometheus.ValueType) typedDesc {
+		return typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tcp", name),
+			help, []string{"destination"}, nil,
+		), valueType}
+	}
 	return &tcpStatCollector{
 		desc: typedDesc{prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "tcp", "connection_states"),
 			"Number of connection states.",
 			[]string{"state"}, nil,
 		), prometheus.GaugeValue},
-		logger: logger,
+		portStates: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tcp", "listen_port_connection_states"),
+			"Number of connection states of the connections to a listening port.",
+			[]string{"port", "state"}, nil,
+		), prometheus.GaugeValue},
+		acceptQueue: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tcp", "listen_port_accept_queue"),
+			"Number of established connections waiting to be accepted on a listening port.",
+			[]string{"port"}, nil,
+		), prometheus.GaugeValue},
+		acceptQueueLimit: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tcp", "listen_port_accept_queue_limit"),
+			"Maximum number of established connections waiting to be accepted on a listening port.",
+			[]string{"port"}, nil,
+		), prometheus.GaugeValue},
+		destinations:    destinations,
+		destConnections: destDesc("destination_connections", "Number of established connections to the destination.", prometheus.GaugeValue),
+		destRTT:         destDesc("destination_rtt_seconds", "Average smoothed round trip time of the established connections to the destination.", prometheus.GaugeValue),
+		destSegsOut:     destDesc("destination_segments_sent_total", "Number of segments sent on the established connections to the destination.", prometheus.CounterValue),
+		destRetrans:     destDesc("destination_retransmitted_segments_total", "Number of segments retransmitted on the established connections to the destination.", prometheus.CounterValue),
+		logger:          logger,
 	}, nil
 }
 
 func (c *tcpStatCollector) Update(ch chan<- prometheus.Metric) error {
+	sockets, err := getTCPSockets(c.destinations != nil)
+	if err != nil {
+		// The inet_diag module may be missing, fall back to the much
+		// slower /proc/net/tcp.
+		level.Debug(c.logger).Log("msg", "couldn't dump TCP sockets with inet_diag, falling back to /proc", "err", err)
+		return c.updateFromProc(ch)
+	}
+
+	tcpStats, portStats := aggregateTCPSockets(sockets)
+	for st, value := range tcpStats {
+		ch <- c.desc.mustNewConstMetric(value, st.String())
+	}
+	for port, ps := range portStats {
+		p := strconv.Itoa(int(port))
+		for st, value := range ps.states {
+			ch <- c.portStates.mustNewConstMetric(value, p, st.String())
+		}
+		ch <- c.acceptQueue.mustNewConstMetric(ps.acceptQueue, p)
+		ch <- c.acceptQueueLimit.mustNewConstMetric(ps.acceptQueueLimit, p)
+	}
+
+	if c.destinations == nil {
+		return nil
+	}
+	for dest, ds := range c.destinations.update(sockets, time.Now()) {
+		ch <- c.destConnections.mustNewConstMetric(ds.connections, dest)
+		if ds.connections > 0 {
+			ch <- c.destRTT.mustNewConstMetric(ds.rttSum/ds.connections, dest)
+		}
+		ch <- c.destRetrans.mustNewConstMetric(ds.totalRetrans, dest)
+		if ds.hasSegsOut {
+			ch <- c.destSegsOut.mustNewConstMetric(ds.segsOut, dest)
+		}
+	}
+	return nil
+}
+
+func (c *tcpStatCollector) updateFromProc(ch chan<- prometheus.Metric) error {
 	tcpStats, err := getTCPStats(procFilePath("net/tcp"))
 	if err != nil {
 		return fmt.Errorf("couldn't get tcpstats: %w", err)
@@ -104,6 +317,140 @@ func (c *tcpStatCollector) Update(ch chan<- prometheus.Metric) error {
 	return nil
 }
 
+// getTCPSockets dumps the IPv4 and IPv6 TCP sockets in all states using the
+// inet_diag netlink API, optionally with their tcp_info.
+func getTCPSockets(withInfo bool) ([]tcpSocket, error) {
+	c, err := netlink.Dial(unix.NETLINK_INET_DIAG, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial netlink: %w", err)
+	}
+	defer c.Close()
+
+	var sockets []tcpSocket
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		req := netlink.Message{
+			Header: netlink.Header{
+				Flags: netlink.Request | netlink.Dump,
+				Type:  sockDiagByFamily,
+			},
+			Data: make([]byte, inetDiagReqLen),
+		}
+		req.Data[0] = family
+		req.Data[1] = unix.IPPROTO_TCP
+		if withInfo {
+			req.Data[2] = 1 << (inetDiagInfo - 1)
+		}
+		nlenc.PutUint32(req.Data[4:8], ^uint32(0))
+
+		msgs, err := c.Execute(req)
+		if err != nil {
+			// The kernel has no handler for IPv6 if it is disabled.
+			if family == unix.AF_INET6 && errors.Is(err, unix.ENOENT) {
+				break
+			}
+			return nil, err
+		}
+		for _, msg := range msgs {
+			s, err := parseInetDiagMsg(msg.Data)
+			if err != nil {
+				return nil, err
+			}
+			sockets = append(sockets, *s)
+		}
+	}
+	return sockets, nil
+}
+
+// parseInetDiagMsg parses a struct inet_diag_msg followed by its attributes.
+func parseInetDiagMsg(b []byte) (*tcpSocket, error) {
+	if len(b) < inetDiagMsgLen {
+		return nil, fmt.Errorf("short inet_diag message, len=%d", len(b))
+	}
+	addrLen := net.IPv6len
+	if b[0] == unix.AF_INET {
+		addrLen = net.IPv4len
+	}
+	s := tcpSocket{
+		state: tcpConnectionState(b[1]),
+		// Ports are in network byte order.
+		localPort:  binary.BigEndian.Uint16(b[4:6]),
+		remotePort: binary.BigEndian.Uint16(b[6:8]),
+		remote:     append(net.IP(nil), b[24:24+addrLen]...),
+		rqueue:     nlenc.Uint32(b[56:60]),
+		wqueue:     nlenc.Uint32(b[60:64]),
+		cookie:     uint64(nlenc.Uint32(b[44:48])) | uint64(nlenc.Uint32(b[48:52]))<<32,
+	}
+
+	ad, err := netlink.NewAttributeDecoder(b[inetDiagMsgLen:])
+	if err != nil {
+		return nil, err
+	}
+	for ad.Next() {
+		if ad.Type() == inetDiagInfo {
+			ad.Do(func(b []byte) error {
+				info, err := parseTCPInfo(b)
+				s.info = info
+				return err
+			})
+		}
+	}
+	if err := ad.Err(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// parseTCPInfo parses a struct tcp_info, which grew over time.
+func parseTCPInfo(b []byte) (*tcpInfo, error) {
+	if len(b) < 104 {
+		return nil, fmt.Errorf("short tcp_info, len=%d", len(b))
+	}
+	info := tcpInfo{
+		rtt:          nlenc.Uint32(b[68:72]),
+		totalRetrans: nlenc.Uint32(b[100:104]),
+	}
+	if len(b) >= 140 {
+		v := nlenc.Uint32(b[136:140])
+		info.segsOut = &v
+	}
+	return &info, nil
+}
+
+// aggregateTCPSockets counts the sockets by state like /proc/net/tcp, and the
+// connections to each listening port by state. For listening sockets the
+// queues are the length and limit of the accept queue.
+func aggregateTCPSockets(sockets []tcpSocket) (map[tcpConnectionState]float64, map[uint16]*tcpPortStats) {
+	tcpStats := map[tcpConnectionState]float64{}
+	portStats := map[uint16]*tcpPortStats{}
+	for _, s := range sockets {
+		tcpStats[s.state]++
+		if s.state != tcpListen {
+			tcpStats[tcpRxQueuedBytes] += float64(s.rqueue)
+			tcpStats[tcpTxQueuedBytes] += float64(s.wqueue)
+			continue
+		}
+		tcpStats[tcpRxQueuedBytes] += float64(s.rqueue)
+		ps, ok := portStats[s.localPort]
+		if !ok {
+			ps = &tcpPortStats{states: map[tcpConnectionState]float64{}}
+			portStats[s.localPort] = ps
+		}
+		ps.acceptQueue += float64(s.rqueue)
+		ps.acceptQueueLimit += float64(s.wqueue)
+	}
+
+	// Connections are accounted to a listening port by their local port.
+	for _, s := range sockets {
+		if s.state == tcpListen {
+			continue
+		}
+		if ps, ok := portStats[s.localPort]; ok {
+			ps.states[s.state]++
+		}
+	}
+	return tcpStats, portStats
+}
+
 func getTCPStats(statsFile string) (map[tcpConnectionState]float64, error) {
 	file, err := os.Open(statsFile)
 	if err != nil {
@@ -191,3 +538,113 @@ func (st tcpConnectionState) String() string {
 		return "unknown"
 	}
 }
+
+func newTCPDestinationTracker(grouping string, ipv4Mask, ipv6Mask net.IPMask, limit int, idleTimeout time.Duration) *tcpDestinationTracker {
+	return &tcpDestinationTracker{
+		grouping:    grouping,
+		ipv4Mask:    ipv4Mask,
+		ipv6Mask:    ipv6Mask,
+		limit:       limit,
+		idleTimeout: idleTimeout,
+		sockets:     map[uint64]tcpSocketCounters{},
+		stats:       map[string]*tcpDestinationStats{},
+		lastSeen:    map[string]time.Time{},
+	}
+}
+
+// update groups the established connections by remote subnet, or by service
+// port, which is the local port for connections to a listening port and the
+// remote port otherwise. The segments sent and retransmitted since the last
+// scrape are added to the counters of the destinations, and the statistics
+// of all destinations that weren't idle for too long are returned.
+func (t *tcpDestinationTracker) update(sockets []tcpSocket, now time.Time) map[string]tcpDestinationStats {
+	listening := map[uint16]bool{}
+	for _, s := range sockets {
+		if s.state == tcpListen {
+			listening[s.localPort] = true
+		}
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for _, ds := range t.stats {
+		ds.connections = 0
+		ds.rttSum = 0
+	}
+	seen := make(map[uint64]tcpSocketCounters, len(t.sockets))
+	for _, s := range sockets {
+		if s.state != tcpEstablished || s.info == nil {
+			continue
+		}
+		ds := t.destination(s, listening)
+		ds.connections++
+		ds.rttSum += float64(s.info.rtt) / 1e6
+
+		// Connections opened since the last scrape count from zero. The
+		// counters of struct tcp_info are 32 bit and wrap around.
+		last := t.sockets[s.cookie]
+		current := tcpSocketCounters{totalRetrans: s.info.totalRetrans}
+		ds.totalRetrans += float64(current.totalRetrans - last.totalRetrans)
+		if s.info.segsOut != nil {
+			current.segsOut = *s.info.segsOut
+			ds.segsOut += float64(current.segsOut - last.segsOut)
+			ds.hasSegsOut = true
+		}
+		seen[s.cookie] = current
+	}
+	t.sockets = seen
+
+	stats := make(map[string]tcpDestinationStats, len(t.stats))
+	for dest, ds := range t.stats {
+		if ds.connections > 0 {
+			t.lastSeen[dest] = now
+		} else if t.idleTimeout > 0 && now.Sub(t.lastSeen[dest]) > t.idleTimeout {
+			delete(t.stats, dest)
+			delete(t.lastSeen, dest)
+			if dest != tcpDestinationOther {
+				t.groups--
+			}
+			continue
+		}
+		stats[dest] = *ds
+	}
+	return stats
+}
+
+// destination returns the statistics of the destination of a connection.
+// Once the limit of destinations is reached, connections to new
+// destinations are accounted to tcpDestinationOther.
+func (t *tcpDestinationTracker) destination(s tcpSocket, listening map[uint16]bool) *tcpDestinationStats {
+	var dest string
+	switch t.grouping {
+	case "subnet":
+		ip, mask := s.remote, t.ipv6Mask
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, mask = ip4, t.ipv4Mask
+		}
+		ones, _ := mask.Size()
+		dest = fmt.Sprintf("%s/%d", ip.Mask(mask), ones)
+	case "port":
+		port := s.remotePort
+		if listening[s.localPort] {
+			port = s.localPort
+		}
+		dest = strconv.Itoa(int(port))
+	}
+
+	if ds, ok := t.stats[dest]; ok {
+		return ds
+	}
+	if t.groups >= t.limit {
+		dest = tcpDestinationOther
+		if ds, ok := t.stats[dest]; ok {
+			return ds
+		}
+	} else {
+		t.groups++
+	}
+	ds := &tcpDestinationStats{}
+	t.stats[dest] = ds
+	return ds
+}
@@ -14,9 +14,16 @@
 package collector
 
 import (
+	"net"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"golang.org/x/sys/unix"
 )
 
 func Test_parseTCPStatsError(t *testing.T) {
@@ -121,3 +128,170 @@ func Test_getTCPStats(t *testing.T) {
 		})
 	}
 }
+
+func TestParseInetDiagMsg(t *testing.T) {
+	b := make([]byte, inetDiagMsgLen)
+	b[0] = unix.AF_INET
+	b[1] = byte(tcpTimeWait)
+	// Ports in network byte order.
+	b[4], b[5] = 0x01, 0xbb
+	b[6], b[7] = 0xc8, 0x22
+	copy(b[24:28], []byte{192, 0, 2, 7})
+	nlenc.PutUint32(b[44:48], 0x2a)
+	nlenc.PutUint32(b[48:52], 1)
+	nlenc.PutUint32(b[56:60], 3)
+	nlenc.PutUint32(b[60:64], 42)
+
+	s, err := parseInetDiagMsg(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &tcpSocket{
+		state:      tcpTimeWait,
+		localPort:  443,
+		remote:     net.IP{192, 0, 2, 7},
+		remotePort: 51234,
+		rqueue:     3,
+		wqueue:     42,
+		cookie:     1<<32 | 0x2a,
+	}
+	if !reflect.DeepEqual(want, s) {
+		t.Errorf("want socket %+v, got %+v", want, s)
+	}
+
+	// struct tcp_info of Linux 4.2 in an INET_DIAG_INFO attribute.
+	info := make([]byte, 144)
+	nlenc.PutUint32(info[68:72], 1500)
+	nlenc.PutUint32(info[100:104], 5)
+	nlenc.PutUint32(info[136:140], 1000)
+	attrs, err := netlink.MarshalAttributes([]netlink.Attribute{{Type: inetDiagInfo, Data: info}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = parseInetDiagMsg(append(b, attrs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	segsOut := uint32(1000)
+	wantInfo := &tcpInfo{rtt: 1500, totalRetrans: 5, segsOut: &segsOut}
+	if !reflect.DeepEqual(wantInfo, s.info) {
+		t.Errorf("want tcp_info %+v, got %+v", wantInfo, s.info)
+	}
+
+	if _, err := parseInetDiagMsg(b[:inetDiagMsgLen-1]); err == nil {
+		t.Error("expected error for short message")
+	}
+}
+
+func TestAggregateTCPSockets(t *testing.T) {
+	sockets := []tcpSocket{
+		{state: tcpListen, localPort: 22, rqueue: 1, wqueue: 128},
+		{state: tcpListen, localPort: 22, rqueue: 0, wqueue: 128},
+		{state: tcpEstablished, localPort: 22, rqueue: 10, wqueue: 20},
+		{state: tcpTimeWait, localPort: 22},
+		{state: tcpSynRecv, localPort: 22},
+		{state: tcpEstablished, localPort: 51234, wqueue: 5},
+	}
+	tcpStats, portStats := aggregateTCPSockets(sockets)
+
+	wantStats := map[tcpConnectionState]float64{
+		tcpListen:        2,
+		tcpEstablished:   2,
+		tcpTimeWait:      1,
+		tcpSynRecv:       1,
+		tcpRxQueuedBytes: 11,
+		tcpTxQueuedBytes: 25,
+	}
+	if !reflect.DeepEqual(wantStats, tcpStats) {
+		t.Errorf("want tcpstats %v, got %v", wantStats, tcpStats)
+	}
+
+	if want, got := 1, len(portStats); want != got {
+		t.Fatalf("want %d listening ports, got %d", want, got)
+	}
+	want := &tcpPortStats{
+		states: map[tcpConnectionState]float64{
+			tcpEstablished: 1,
+			tcpTimeWait:    1,
+			tcpSynRecv:     1,
+		},
+		acceptQueue:      1,
+		acceptQueueLimit: 256,
+	}
+	if !reflect.DeepEqual(want, portStats[22]) {
+		t.Errorf("want port stats %+v, got %+v", want, portStats[22])
+	}
+}
+
+func TestTCPDestinationTracker(t *testing.T) {
+	segsOut := func(v uint32) *uint32 { return &v }
+	sockets := []tcpSocket{
+		{state: tcpListen, localPort: 3260},
+		{state: tcpEstablished, cookie: 1, localPort: 3260, remote: net.ParseIP("192.0.2.10").To4(), remotePort: 40000, info: &tcpInfo{rtt: 1000, totalRetrans: 1, segsOut: segsOut(100)}},
+		{state: tcpEstablished, cookie: 2, localPort: 3260, remote: net.ParseIP("::ffff:192.0.2.20"), remotePort: 40001, info: &tcpInfo{rtt: 3000, totalRetrans: 2, segsOut: segsOut(100)}},
+		{state: tcpEstablished, cookie: 3, localPort: 51234, remote: net.ParseIP("2001:db8::1"), remotePort: 443, info: &tcpInfo{rtt: 500}},
+		{state: tcpTimeWait, cookie: 4, localPort: 3260, remote: net.ParseIP("192.0.2.30").To4(), remotePort: 40002},
+	}
+
+	for _, tt := range []struct {
+		grouping string
+		want     map[string]tcpDestinationStats
+	}{
+		{
+			grouping: "subnet",
+			want: map[string]tcpDestinationStats{
+				"192.0.2.0/24":  {connections: 2, rttSum: 0.004, segsOut: 200, hasSegsOut: true, totalRetrans: 3},
+				"2001:db8::/64": {connections: 1, rttSum: 0.0005},
+			},
+		},
+		{
+			grouping: "port",
+			want: map[string]tcpDestinationStats{
+				"3260": {connections: 2, rttSum: 0.004, segsOut: 200, hasSegsOut: true, totalRetrans: 3},
+				"443":  {connections: 1, rttSum: 0.0005},
+			},
+		},
+	} {
+		tracker := newTCPDestinationTracker(tt.grouping, net.CIDRMask(24, 32), net.CIDRMask(64, 128), 64, time.Hour)
+		got := tracker.update(sockets, time.Unix(0, 0))
+		if !reflect.DeepEqual(tt.want, got) {
+			t.Errorf("grouping %s: want %v, got %v", tt.grouping, tt.want, got)
+		}
+	}
+
+	// Counters keep increasing as connections are closed and opened, and
+	// destinations beyond the limit are accounted to other.
+	tracker := newTCPDestinationTracker("port", nil, nil, 2, time.Hour)
+	tracker.update(sockets, time.Unix(0, 0))
+	got := tracker.update([]tcpSocket{
+		{state: tcpListen, localPort: 3260},
+		{state: tcpEstablished, cookie: 2, localPort: 3260, remotePort: 40001, info: &tcpInfo{rtt: 2000, totalRetrans: 4, segsOut: segsOut(150)}},
+		{state: tcpEstablished, cookie: 5, localPort: 3260, remotePort: 40003, info: &tcpInfo{rtt: 1000, totalRetrans: 1, segsOut: segsOut(10)}},
+		{state: tcpEstablished, cookie: 6, localPort: 51235, remotePort: 22, info: &tcpInfo{rtt: 1000, totalRetrans: 7, segsOut: segsOut(20)}},
+	}, time.Unix(60, 0))
+	want := map[string]tcpDestinationStats{
+		"3260":  {connections: 2, rttSum: 0.003, segsOut: 260, hasSegsOut: true, totalRetrans: 6},
+		"443":   {},
+		"other": {connections: 1, rttSum: 0.001, segsOut: 20, hasSegsOut: true, totalRetrans: 7},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	// Idle destinations expire and free their slot for new destinations.
+	got = tracker.update([]tcpSocket{
+		{state: tcpEstablished, cookie: 7, localPort: 51236, remotePort: 22, info: &tcpInfo{rtt: 1000, totalRetrans: 1, segsOut: segsOut(5)}},
+	}, time.Unix(60, 0).Add(2*time.Hour))
+	want = map[string]tcpDestinationStats{
+		"other": {connections: 1, rttSum: 0.001, segsOut: 25, hasSegsOut: true, totalRetrans: 8},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	got = tracker.update([]tcpSocket{
+		{state: tcpEstablished, cookie: 8, localPort: 51237, remotePort: 443, info: &tcpInfo{rtt: 1000}},
+	}, time.Unix(60, 0).Add(2*time.Hour))
+	if _, ok := got["443"]; !ok {
+		t.Errorf("want expired slot reused by 443, got %v", got)
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noteam
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	teamSubsystem = "team"
+
+	// Commands and attributes of the team generic netlink family from
+	// <linux/if_team.h>.
+	teamCmdOptionsGet  = 2
+	teamCmdPortListGet = 3
+
+	teamAttrTeamIfindex = 1
+	teamAttrListOption  = 2
+	teamAttrListPort    = 3
+
+	teamAttrOptionName        = 1
+	teamAttrOptionData        = 4
+	teamAttrOptionPortIfindex = 6
+
+	teamAttrPortIfindex = 1
+	teamAttrPortLinkup  = 3
+	teamAttrPortSpeed   = 4
+)
+
+// teamDevice is a team device with the options set by the runner of teamd.
+type teamDevice struct {
+	name string
+	mode string
+	// Interface index of the active port, only set by the activebackup
+	// runner.
+	activePort *uint32
+	ports      map[uint32]*teamPort
+}
+
+type teamPort struct {
+	linkUp bool
+	// Speed in Mbps.
+	speed   uint32
+	enabled *bool
+}
+
+type teamCollector struct {
+	info       *prometheus.Desc
+	portActive *prometheus.Desc
+	linkUp     *prometheus.Desc
+	enabled    *prometheus.Desc
+	speed      *prometheus.Desc
+	logger     log.Logger
+}
+
+func init() {
+	registerCollector("team", defaultDisabled, NewTeamCollector)
+}
+
+// NewTeamCollector returns a new Collector exposing the state of team devices
+// and their ports.
+func NewTeamCollector(logger log.Logger) (Collector, error) {
+	labels := []string{"team", "port"}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, teamSubsystem, name),
+			help, labels, nil,
+		)
+	}
+	return &teamCollector{
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, teamSubsystem, "info"),
+			"Non-numeric data of team devices, value is always 1. The mode is set by the runner of teamd.",
+			[]string{"team", "mode"}, nil,
+		),
+		portActive: desc("port_active", "Whether the port is the active port of an active-backup team."),
+		linkUp:     desc("port_link_up", "Whether the link of the port is up."),
+		enabled:    desc("port_enabled", "Whether the port is enabled to transmit and receive by the runner."),
+		speed:      desc("port_speed_bytes_per_second", "Speed of the port in bytes per second."),
+		logger:     logger,
+	}, nil
+}
+
+func (c *teamCollector) Update(ch chan<- prometheus.Metric) error {
+	teams, err := getTeamDevices()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "team driver is not loaded, skipping")
+			return ErrNoData
+		}
+		return fmt.Errorf("couldn't get team devices: %w", err)
+	}
+	if len(teams) == 0 {
+		level.Debug(c.logger).Log("msg", "no team devices found, skipping")
+		return ErrNoData
+	}
+
+	names, err := interfaceNames()
+	if err != nil {
+		return err
+	}
+	for _, t := range teams {
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, t.name, t.mode)
+		for ifindex, p := range t.ports {
+			port, ok := names[ifindex]
+			if !ok {
+				// The port was removed in the meantime.
+				continue
+			}
+			if t.activePort != nil {
+				ch <- prometheus.MustNewConstMetric(c.portActive, prometheus.GaugeValue, teamBool(ifindex == *t.activePort), t.name, port)
+			}
+			ch <- prometheus.MustNewConstMetric(c.linkUp, prometheus.GaugeValue, teamBool(p.linkUp), t.name, port)
+			if p.enabled != nil {
+				ch <- prometheus.MustNewConstMetric(c.enabled, prometheus.GaugeValue, teamBool(*p.enabled), t.name, port)
+			}
+			ch <- prometheus.MustNewConstMetric(c.speed, prometheus.GaugeValue, float64(p.speed)*1000*1000/8, t.name, port)
+		}
+	}
+
+	return nil
+}
+
+// getTeamDevices asks the team driver for the options and ports of each
+// network device, which it rejects for devices other than teams.
+func getTeamDevices() ([]*teamDevice, error) {
+	c, err := genetlink.Dial(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial generic netlink: %w", err)
+	}
+	defer c.Close()
+
+	family, err := c.GetFamily("team")
+	if err != nil {
+		return nil, err
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var teams []*teamDevice
+	for _, iface := range ifaces {
+		options, err := executeTeamCmd(c, family, teamCmdOptionsGet, iface.Index)
+		if errors.Is(err, unix.EINVAL) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get options of %s: %w", iface.Name, err)
+		}
+		ports, err := executeTeamCmd(c, family, teamCmdPortListGet, iface.Index)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get ports of %s: %w", iface.Name, err)
+		}
+
+		t := &teamDevice{name: iface.Name, ports: make(map[uint32]*teamPort)}
+		for _, msg := range ports {
+			if err := parseTeamPorts(msg.Data, t); err != nil {
+				return nil, fmt.Errorf("couldn't parse ports of %s: %w", iface.Name, err)
+			}
+		}
+		for _, msg := range options {
+			if err := parseTeamOptions(msg.Data, t); err != nil {
+				return nil, fmt.Errorf("couldn't parse options of %s: %w", iface.Name, err)
+			}
+		}
+		teams = append(teams, t)
+	}
+	return teams, nil
+}
+
+func executeTeamCmd(c *genetlink.Conn, family genetlink.Family, cmd uint8, ifindex int) ([]genetlink.Message, error) {
+	ae := netlink.NewAttributeEncoder()
+	ae.Uint32(teamAttrTeamIfindex, uint32(ifindex))
+	data, err := ae.Encode()
+	if err != nil {
+		return nil, err
+	}
+	req := genetlink.Message{
+		Header: genetlink.Header{
+			Command: cmd,
+			Version: family.Version,
+		},
+		Data: data,
+	}
+	return c.Execute(req, family.ID, netlink.Request)
+}
+
+// parseTeamPorts parses the ports in the reply to TEAM_CMD_PORT_LIST_GET.
+func parseTeamPorts(b []byte, t *teamDevice) error {
+	ad, err := netlink.NewAttributeDecoder(b)
+	if err != nil {
+		return err
+	}
+	for ad.Next() {
+		if ad.Type() != teamAttrListPort {
+			continue
+		}
+		ad.Nested(func(nad *netlink.AttributeDecoder) error {
+			for nad.Next() {
+				var (
+					ifindex uint32
+					p       teamPort
+				)
+				nad.Nested(func(pad *netlink.AttributeDecoder) error {
+					for pad.Next() {
+						switch pad.Type() {
+						case teamAttrPortIfindex:
+							ifindex = pad.Uint32()
+						case teamAttrPortLinkup:
+							p.linkUp = true
+						case teamAttrPortSpeed:
+							p.speed = pad.Uint32()
+						}
+					}
+					return nil
+				})
+				t.ports[ifindex] = &p
+			}
+			return nil
+		})
+	}
+	return ad.Err()
+}
+
+// parseTeamOptions parses the options in the reply to TEAM_CMD_OPTIONS_GET.
+// Options of ports refer to the ports parsed before. The data of boolean
+// options is only present if they are true.
+func parseTeamOptions(b []byte, t *teamDevice) error {
+	ad, err := netlink.NewAttributeDecoder(b)
+	if err != nil {
+		return err
+	}
+	for ad.Next() {
+		if ad.Type() != teamAttrListOption {
+			continue
+		}
+		ad.Nested(func(nad *netlink.AttributeDecoder) error {
+			for nad.Next() {
+				var (
+					name string
+					data []byte
+					port *uint32
+				)
+				nad.Nested(func(oad *netlink.AttributeDecoder) error {
+					for oad.Next() {
+						switch oad.Type() {
+						case teamAttrOptionName:
+							name = oad.String()
+						case teamAttrOptionData:
+							data = oad.Bytes()
+						case teamAttrOptionPortIfindex:
+							v := oad.Uint32()
+							port = &v
+						}
+					}
+					return nil
+				})
+
+				switch {
+				case port == nil && name == "mode":
+					t.mode = strings.TrimRight(string(data), "\x00")
+				case port == nil && name == "activeport" && len(data) == 4:
+					v := nlenc.Uint32(data)
+					t.activePort = &v
+				case port != nil && name == "enabled":
+					if p, ok := t.ports[*port]; ok {
+						enabled := data != nil
+						p.enabled = &enabled
+					}
+				}
+			}
+			return nil
+		})
+	}
+	return ad.Err()
+}
+
+func teamBool(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// interfaceNames returns the names of the network interfaces by index.
+func interfaceNames() (map[uint32]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint32]string, len(ifaces))
+	for _, iface := range ifaces {
+		names[uint32(iface.Index)] = iface.Name
+	}
+	return names, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noteam
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mdlayher/netlink"
+)
+
+func TestParseTeam(t *testing.T) {
+	ae := netlink.NewAttributeEncoder()
+	ae.Nested(teamAttrListPort, func(nae *netlink.AttributeEncoder) error {
+		nae.Nested(1, func(pae *netlink.AttributeEncoder) error {
+			pae.Uint32(teamAttrPortIfindex, 3)
+			pae.Flag(teamAttrPortLinkup, true)
+			pae.Uint32(teamAttrPortSpeed, 10000)
+			return nil
+		})
+		nae.Nested(1, func(pae *netlink.AttributeEncoder) error {
+			pae.Uint32(teamAttrPortIfindex, 4)
+			return nil
+		})
+		return nil
+	})
+	ports, err := ae.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ae = netlink.NewAttributeEncoder()
+	ae.Nested(teamAttrListOption, func(nae *netlink.AttributeEncoder) error {
+		nae.Nested(1, func(oae *netlink.AttributeEncoder) error {
+			oae.String(teamAttrOptionName, "mode")
+			oae.String(teamAttrOptionData, "activebackup")
+			return nil
+		})
+		nae.Nested(1, func(oae *netlink.AttributeEncoder) error {
+			oae.String(teamAttrOptionName, "activeport")
+			oae.Uint32(teamAttrOptionData, 3)
+			return nil
+		})
+		nae.Nested(1, func(oae *netlink.AttributeEncoder) error {
+			oae.String(teamAttrOptionName, "enabled")
+			oae.Flag(teamAttrOptionData, true)
+			oae.Uint32(teamAttrOptionPortIfindex, 3)
+			return nil
+		})
+		// Boolean options which are false come without data.
+		nae.Nested(1, func(oae *netlink.AttributeEncoder) error {
+			oae.String(teamAttrOptionName, "enabled")
+			oae.Uint32(teamAttrOptionPortIfindex, 4)
+			return nil
+		})
+		return nil
+	})
+	options, err := ae.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	team := &teamDevice{name: "team0", ports: make(map[uint32]*teamPort)}
+	if err := parseTeamPorts(ports, team); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseTeamOptions(options, team); err != nil {
+		t.Fatal(err)
+	}
+
+	activePort := uint32(3)
+	enabled, disabled := true, false
+	want := &teamDevice{
+		name:       "team0",
+		mode:       "activebackup",
+		activePort: &activePort,
+		ports: map[uint32]*teamPort{
+			3: {linkUp: true, speed: 10000, enabled: &enabled},
+			4: {enabled: &disabled},
+		},
+	}
+	if !reflect.DeepEqual(want, team) {
+		t.Errorf("want team %+v, got %+v", want, team)
+	}
+}
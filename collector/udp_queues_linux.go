@@ -16,21 +16,63 @@
 package collector
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/procfs"
+	"gopkg.in/alecthomas/kingpin.v2"
 )
 
+var udpPortClassesFlag = kingpin.Flag("collector.udp_queues.port-class", "Class of UDP sockets by local port to break down drops by, like dns=53 or ceph=3300,6789,6800-7300. Can be repeated.").Strings()
+
 type (
 	udpQueuesCollector struct {
-		fs     procfs.FS
-		desc   *prometheus.Desc
-		logger log.Logger
+		fs           procfs.FS
+		desc         *prometheus.Desc
+		portClasses  []udpPortClass
+		classSockets *prometheus.Desc
+		classQueue   *prometheus.Desc
+		classDrops   *prometheus.Desc
+		drops        *udpDropCounter
+		logger       log.Logger
+	}
+
+	// udpPortClass is a named set of port ranges.
+	udpPortClass struct {
+		name   string
+		ranges [][2]uint16
+	}
+
+	// udpSocket is a line of /proc/net/udp or /proc/net/udp6.
+	udpSocket struct {
+		localPort uint16
+		rxQueue   uint64
+		inode     uint64
+		drops     uint64
+	}
+
+	udpPortClassStats struct {
+		sockets uint64
+		rxQueue uint64
+	}
+
+	// udpDropCounter keeps the drops of each socket between scrapes, so the
+	// drops of a class only ever increase, even as sockets are closed. Drops
+	// of a socket after the last scrape before it was closed are not
+	// accounted.
+	udpDropCounter struct {
+		mtx     sync.Mutex
+		sockets map[uint64]uint64
+		classes map[string]float64
 	}
 )
 
@@ -44,6 +86,12 @@ func NewUDPqueuesCollector(logger log.Logger) (Collector, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to open procfs: %w", err)
 	}
+	classes, err := parseUDPPortClasses(*udpPortClassesFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	classLabels := []string{"class"}
 	return &udpQueuesCollector{
 		fs: fs,
 		desc: prometheus.NewDesc(
@@ -51,6 +99,23 @@ func NewUDPqueuesCollector(logger log.Logger) (Collector, error) {
 			"Number of allocated memory in the kernel for UDP datagrams in bytes.",
 			[]string{"queue", "ip"}, nil,
 		),
+		portClasses: classes,
+		classSockets: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "udp", "port_class_sockets"),
+			"Number of UDP sockets bound to a port of the class.",
+			classLabels, nil,
+		),
+		classQueue: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "udp", "port_class_rx_queue_bytes"),
+			"Number of bytes allocated for datagrams waiting in the receive queues of the UDP sockets of the class.",
+			classLabels, nil,
+		),
+		classDrops: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "udp", "port_class_drops_total"),
+			"Number of datagrams dropped by the UDP sockets of the class, mostly due to full receive buffers.",
+			classLabels, nil,
+		),
+		drops:  newUDPDropCounter(classes),
 		logger: logger,
 	}, nil
 }
@@ -84,5 +149,181 @@ func (c *udpQueuesCollector) Update(ch chan<- prometheus.Metric) error {
 	if errors.Is(errIPv4, os.ErrNotExist) && errors.Is(errIPv6, os.ErrNotExist) {
 		return ErrNoData
 	}
+
+	if len(c.portClasses) > 0 {
+		return c.updatePortClasses(ch)
+	}
 	return nil
 }
+
+// updatePortClasses exports the drops of the UDP sockets by the class of
+// their local port. The kernel only counts receive buffer errors globally, but
+// counts them as drops of the socket as well.
+func (c *udpQueuesCollector) updatePortClasses(ch chan<- prometheus.Metric) error {
+	var sockets []udpSocket
+	for _, file := range []string{"net/udp", "net/udp6"} {
+		s, err := getUDPSockets(procFilePath(file))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't get UDP sockets: %w", err)
+		}
+		sockets = append(sockets, s...)
+	}
+
+	for class, s := range aggregateUDPPortClasses(sockets, c.portClasses) {
+		ch <- prometheus.MustNewConstMetric(c.classSockets, prometheus.GaugeValue, float64(s.sockets), class)
+		ch <- prometheus.MustNewConstMetric(c.classQueue, prometheus.GaugeValue, float64(s.rxQueue), class)
+	}
+	for class, drops := range c.drops.add(sockets, c.portClasses) {
+		ch <- prometheus.MustNewConstMetric(c.classDrops, prometheus.CounterValue, drops, class)
+	}
+	return nil
+}
+
+// parseUDPPortClasses parses classes like "ceph=3300,6789,6800-7300".
+func parseUDPPortClasses(specs []string) ([]udpPortClass, error) {
+	var classes []udpPortClass
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[0] == "other" {
+			return nil, fmt.Errorf("invalid UDP port class: %q", spec)
+		}
+		class := udpPortClass{name: parts[0]}
+		for _, r := range strings.Split(parts[1], ",") {
+			bounds := strings.SplitN(r, "-", 2)
+			first, err := strconv.ParseUint(bounds[0], 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port in UDP port class %q: %w", spec, err)
+			}
+			last := first
+			if len(bounds) == 2 {
+				if last, err = strconv.ParseUint(bounds[1], 10, 16); err != nil || last < first {
+					return nil, fmt.Errorf("invalid port range in UDP port class %q", spec)
+				}
+			}
+			class.ranges = append(class.ranges, [2]uint16{uint16(first), uint16(last)})
+		}
+		classes = append(classes, class)
+	}
+	return classes, nil
+}
+
+// udpPortClassOf returns the first class matching the port, or "other".
+func udpPortClassOf(port uint16, classes []udpPortClass) string {
+	for _, c := range classes {
+		for _, r := range c.ranges {
+			if port >= r[0] && port <= r[1] {
+				return c.name
+			}
+		}
+	}
+	return "other"
+}
+
+// aggregateUDPPortClasses sums the sockets by the class of their local port.
+func aggregateUDPPortClasses(sockets []udpSocket, classes []udpPortClass) map[string]*udpPortClassStats {
+	stats := map[string]*udpPortClassStats{"other": {}}
+	for _, c := range classes {
+		stats[c.name] = &udpPortClassStats{}
+	}
+	for _, s := range sockets {
+		class := udpPortClassOf(s.localPort, classes)
+		stats[class].sockets++
+		stats[class].rxQueue += s.rxQueue
+	}
+	return stats
+}
+
+func newUDPDropCounter(classes []udpPortClass) *udpDropCounter {
+	d := &udpDropCounter{
+		sockets: map[uint64]uint64{},
+		classes: map[string]float64{"other": 0},
+	}
+	for _, c := range classes {
+		d.classes[c.name] = 0
+	}
+	return d
+}
+
+// add adds the drops of the sockets since the last scrape, identified by
+// their inode, to the class of their local port and returns the drops of
+// all classes.
+func (d *udpDropCounter) add(sockets []udpSocket, classes []udpPortClass) map[string]float64 {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	seen := make(map[uint64]uint64, len(sockets))
+	for _, s := range sockets {
+		drops := s.drops
+		// A lower count means the inode belongs to a new socket.
+		if last, ok := d.sockets[s.inode]; ok && last <= drops {
+			drops -= last
+		}
+		d.classes[udpPortClassOf(s.localPort, classes)] += float64(drops)
+		seen[s.inode] = s.drops
+	}
+	d.sockets = seen
+
+	drops := make(map[string]float64, len(d.classes))
+	for class, v := range d.classes {
+		drops[class] = v
+	}
+	return drops
+}
+
+func getUDPSockets(file string) ([]udpSocket, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseUDPSockets(f)
+}
+
+// parseUDPSockets parses the local port, receive queue, inode and drops of
+// the sockets in /proc/net/udp. The drops are the last field, older kernels
+// don't report them.
+func parseUDPSockets(r io.Reader) ([]udpSocket, error) {
+	var sockets []udpSocket
+	scanner := bufio.NewScanner(r)
+	// Skip the header.
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 10 {
+			return nil, fmt.Errorf("invalid UDP socket line: %q", scanner.Text())
+		}
+
+		local := strings.Split(fields[1], ":")
+		queues := strings.Split(fields[4], ":")
+		if len(local) != 2 || len(queues) != 2 {
+			return nil, fmt.Errorf("invalid UDP socket line: %q", scanner.Text())
+		}
+		port, err := strconv.ParseUint(local[1], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid local port: %w", err)
+		}
+		rxQueue, err := strconv.ParseUint(queues[1], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rx_queue: %w", err)
+		}
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid inode: %w", err)
+		}
+		var drops uint64
+		if len(fields) >= 13 {
+			if drops, err = strconv.ParseUint(fields[len(fields)-1], 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid drops: %w", err)
+			}
+		}
+		sockets = append(sockets, udpSocket{localPort: uint16(port), rxQueue: rxQueue, inode: inode, drops: drops})
+	}
+	return sockets, scanner.Err()
+}
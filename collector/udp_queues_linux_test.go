@@ -0,0 +1,89 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noudp_queues
+
+package collector
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseUDPPortClasses(t *testing.T) {
+	classes, err := parseUDPPortClasses([]string{"dns=53", "ceph=3300,6789,6800-7300"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []udpPortClass{
+		{name: "dns", ranges: [][2]uint16{{53, 53}}},
+		{name: "ceph", ranges: [][2]uint16{{3300, 3300}, {6789, 6789}, {6800, 7300}}},
+	}
+	if !reflect.DeepEqual(want, classes) {
+		t.Errorf("want port classes %+v, got %+v", want, classes)
+	}
+
+	for _, spec := range []string{"dns", "=53", "other=53", "dns=domain", "dns=70000", "ceph=7300-6800"} {
+		if _, err := parseUDPPortClasses([]string{spec}); err == nil {
+			t.Errorf("expected error for port class %q", spec)
+		}
+	}
+}
+
+func TestUDPPortClasses(t *testing.T) {
+	file, err := os.Open("fixtures/proc/net/udp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	sockets, err := parseUDPSockets(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 5, len(sockets); want != got {
+		t.Fatalf("want %d sockets, got %d", want, got)
+	}
+
+	classes := []udpPortClass{
+		{name: "dns", ranges: [][2]uint16{{53, 53}}},
+		{name: "vxlan", ranges: [][2]uint16{{4789, 4789}}},
+	}
+	want := map[string]*udpPortClassStats{
+		"dns":   {sockets: 2},
+		"vxlan": {sockets: 1},
+		"other": {sockets: 2},
+	}
+	if got := aggregateUDPPortClasses(sockets, classes); !reflect.DeepEqual(want, got) {
+		t.Errorf("want port class stats %v, got %v", want, got)
+	}
+
+	drops := newUDPDropCounter(classes)
+	wantDrops := map[string]float64{"dns": 9, "vxlan": 0, "other": 1}
+	if got := drops.add(sockets, classes); !reflect.DeepEqual(wantDrops, got) {
+		t.Errorf("want port class drops %v, got %v", wantDrops, got)
+	}
+
+	// Drops keep increasing as sockets are closed, and a reused inode with
+	// fewer drops is a new socket.
+	sockets = []udpSocket{
+		{localPort: 53, inode: 2741, drops: 10},
+		{localPort: 4789, inode: 2742, drops: 1},
+		{localPort: 53, inode: 2745, drops: 2},
+	}
+	wantDrops = map[string]float64{"dns": 14, "vxlan": 1, "other": 1}
+	if got := drops.add(sockets, classes); !reflect.DeepEqual(wantDrops, got) {
+		t.Errorf("want port class drops %v, got %v", wantDrops, got)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !novdo
+
+package collector
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const vdoSubsystem = "vdo"
+
+// vdoStat is a file in /sys/kvdo/<volume>/statistics.
+type vdoStat struct {
+	file      string
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	// Whether the value is counted in blocks of the volume.
+	blocks bool
+}
+
+type vdoCollector struct {
+	info   *prometheus.Desc
+	stats  []vdoStat
+	logger log.Logger
+}
+
+func init() {
+	registerCollector("vdo", defaultDisabled, NewVDOCollector)
+}
+
+// NewVDOCollector returns a new Collector exposing space usage, compression
+// and slab statistics of VDO volumes.
+func NewVDOCollector(logger log.Logger) (Collector, error) {
+	labels := []string{"volume"}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, vdoSubsystem, name),
+			help, labels, nil,
+		)
+	}
+	return &vdoCollector{
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, vdoSubsystem, "info"),
+			"Non-numeric data from /sys/kvdo/<volume>/statistics, value is always 1.",
+			[]string{"volume", "mode", "write_policy"}, nil,
+		),
+		stats: []vdoStat{
+			{"logical_blocks", desc("logical_size_bytes", "Logical size of the volume."), prometheus.GaugeValue, true},
+			{"logical_blocks_used", desc("logical_used_bytes", "Amount of logical space in use, before deduplication and compression."), prometheus.GaugeValue, true},
+			{"physical_blocks", desc("physical_size_bytes", "Size of the storage backing the volume."), prometheus.GaugeValue, true},
+			{"data_blocks_used", desc("data_used_bytes", "Amount of physical space storing data, after deduplication and compression."), prometheus.GaugeValue, true},
+			{"overhead_blocks_used", desc("overhead_used_bytes", "Amount of physical space used for metadata."), prometheus.GaugeValue, true},
+			{"packer_compressed_fragments_written", desc("compressed_fragments_written_total", "Number of compressed fragments written."), prometheus.CounterValue, false},
+			{"packer_compressed_blocks_written", desc("compressed_blocks_written_total", "Number of blocks written holding compressed fragments."), prometheus.CounterValue, false},
+			{"packer_compressed_fragments_in_packer", desc("compressed_fragments_in_packer", "Number of compressed fragments waiting to be packed into a block."), prometheus.GaugeValue, false},
+			{"allocator_slab_count", desc("slabs", "Number of slabs of the volume."), prometheus.GaugeValue, false},
+			{"allocator_slabs_opened", desc("slabs_opened_total", "Number of slabs opened for allocation."), prometheus.CounterValue, false},
+			{"allocator_slabs_reopened", desc("slabs_reopened_total", "Number of slabs reopened for allocation."), prometheus.CounterValue, false},
+			{"complete_recoveries", desc("recoveries_total", "Number of recoveries after unclean shutdowns."), prometheus.CounterValue, false},
+			{"read_only_recoveries", desc("read_only_recoveries_total", "Number of recoveries from read-only mode."), prometheus.CounterValue, false},
+		},
+		logger: logger,
+	}, nil
+}
+
+func (c *vdoCollector) Update(ch chan<- prometheus.Metric) error {
+	paths, err := filepath.Glob(sysFilePath("kvdo/*/statistics"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		level.Debug(c.logger).Log("msg", "no VDO volumes found, skipping")
+		return ErrNoData
+	}
+
+	for _, path := range paths {
+		volume := filepath.Base(filepath.Dir(path))
+		blockSize, err := readUintFromFile(filepath.Join(path, "block_size"))
+		if err != nil {
+			return fmt.Errorf("couldn't read block size of %s: %w", volume, err)
+		}
+
+		mode, _ := readStringFromFile(filepath.Join(path, "mode"))
+		writePolicy, _ := readStringFromFile(filepath.Join(path, "write_policy"))
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, volume, mode, writePolicy)
+
+		for _, s := range c.stats {
+			v, err := readUintFromFile(filepath.Join(path, s.file))
+			if err != nil {
+				level.Debug(c.logger).Log("msg", "couldn't read VDO statistic", "volume", volume, "file", s.file, "err", err)
+				continue
+			}
+			value := float64(v)
+			if s.blocks {
+				value *= float64(blockSize)
+			}
+			ch <- prometheus.MustNewConstMetric(s.desc, s.valueType, value, volume)
+		}
+	}
+
+	return nil
+}
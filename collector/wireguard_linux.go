@@ -0,0 +1,250 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nowireguard
+
+package collector
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	wireguardSubsystem = "wireguard"
+
+	// Command and attributes of the wireguard generic netlink family from
+	// <linux/wireguard.h>.
+	wgCmdGetDevice = 0
+
+	wgDeviceAIfindex    = 1
+	wgDeviceAPublicKey  = 4
+	wgDeviceAListenPort = 6
+	wgDeviceAPeers      = 8
+
+	wgPeerAPublicKey         = 1
+	wgPeerALastHandshakeTime = 6
+	wgPeerARxBytes           = 7
+	wgPeerATxBytes           = 8
+	wgPeerAAllowedIPs        = 9
+)
+
+type wireguardDevice struct {
+	name       string
+	publicKey  string
+	listenPort uint16
+	peers      []*wireguardPeer
+}
+
+type wireguardPeer struct {
+	publicKey string
+	// Unix time of the last handshake, 0 if there was none.
+	lastHandshake float64
+	rxBytes       uint64
+	txBytes       uint64
+	allowedIPs    int
+}
+
+type wireguardCollector struct {
+	info          *prometheus.Desc
+	lastHandshake *prometheus.Desc
+	rxBytes       *prometheus.Desc
+	txBytes       *prometheus.Desc
+	allowedIPs    *prometheus.Desc
+	logger        log.Logger
+}
+
+func init() {
+	registerCollector("wireguard", defaultDisabled, NewWireguardCollector)
+}
+
+// NewWireguardCollector returns a new Collector exposing the peers of
+// WireGuard interfaces.
+func NewWireguardCollector(logger log.Logger) (Collector, error) {
+	labels := []string{"device", "public_key"}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, wireguardSubsystem, name),
+			help, labels, nil,
+		)
+	}
+	return &wireguardCollector{
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, wireguardSubsystem, "device_info"),
+			"Non-numeric data of WireGuard interfaces, value is always 1.",
+			[]string{"device", "public_key", "listen_port"}, nil,
+		),
+		lastHandshake: desc("peer_last_handshake_seconds", "Unix time of the last handshake with the peer, 0 if there was none."),
+		rxBytes:       desc("peer_receive_bytes_total", "Number of bytes received from the peer."),
+		txBytes:       desc("peer_transmit_bytes_total", "Number of bytes transmitted to the peer."),
+		allowedIPs:    desc("peer_allowed_ips", "Number of allowed IP ranges of the peer."),
+		logger:        logger,
+	}, nil
+}
+
+func (c *wireguardCollector) Update(ch chan<- prometheus.Metric) error {
+	devices, err := getWireguardDevices()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "wireguard module is not loaded, skipping")
+			return ErrNoData
+		}
+		return fmt.Errorf("couldn't get WireGuard devices: %w", err)
+	}
+	if len(devices) == 0 {
+		level.Debug(c.logger).Log("msg", "no WireGuard interfaces found, skipping")
+		return ErrNoData
+	}
+
+	for _, d := range devices {
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, d.name, d.publicKey, strconv.Itoa(int(d.listenPort)))
+		for _, p := range d.peers {
+			ch <- prometheus.MustNewConstMetric(c.lastHandshake, prometheus.GaugeValue, p.lastHandshake, d.name, p.publicKey)
+			ch <- prometheus.MustNewConstMetric(c.rxBytes, prometheus.CounterValue, float64(p.rxBytes), d.name, p.publicKey)
+			ch <- prometheus.MustNewConstMetric(c.txBytes, prometheus.CounterValue, float64(p.txBytes), d.name, p.publicKey)
+			ch <- prometheus.MustNewConstMetric(c.allowedIPs, prometheus.GaugeValue, float64(p.allowedIPs), d.name, p.publicKey)
+		}
+	}
+
+	return nil
+}
+
+// getWireguardDevices asks the wireguard module for each network device,
+// which it rejects for devices other than WireGuard interfaces.
+func getWireguardDevices() ([]*wireguardDevice, error) {
+	c, err := genetlink.Dial(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial generic netlink: %w", err)
+	}
+	defer c.Close()
+
+	family, err := c.GetFamily("wireguard")
+	if err != nil {
+		return nil, err
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []*wireguardDevice
+	for _, iface := range ifaces {
+		ae := netlink.NewAttributeEncoder()
+		ae.Uint32(wgDeviceAIfindex, uint32(iface.Index))
+		data, err := ae.Encode()
+		if err != nil {
+			return nil, err
+		}
+		req := genetlink.Message{
+			Header: genetlink.Header{
+				Command: wgCmdGetDevice,
+				Version: family.Version,
+			},
+			Data: data,
+		}
+		msgs, err := c.Execute(req, family.ID, netlink.Request|netlink.Dump)
+		if errors.Is(err, unix.EOPNOTSUPP) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get WireGuard device %s: %w", iface.Name, err)
+		}
+
+		d := &wireguardDevice{name: iface.Name}
+		for _, msg := range msgs {
+			if err := parseWireguardDevice(msg.Data, d); err != nil {
+				return nil, fmt.Errorf("couldn't parse WireGuard device %s: %w", iface.Name, err)
+			}
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// parseWireguardDevice parses a message of the reply to WG_CMD_GET_DEVICE.
+// Devices with many peers are split over several messages, with a peer being
+// continued in the next message with its public key and the rest of its
+// allowed IPs.
+func parseWireguardDevice(b []byte, d *wireguardDevice) error {
+	ad, err := netlink.NewAttributeDecoder(b)
+	if err != nil {
+		return err
+	}
+	for ad.Next() {
+		switch ad.Type() {
+		case wgDeviceAPublicKey:
+			d.publicKey = base64.StdEncoding.EncodeToString(ad.Bytes())
+		case wgDeviceAListenPort:
+			d.listenPort = ad.Uint16()
+		case wgDeviceAPeers:
+			ad.Nested(func(nad *netlink.AttributeDecoder) error {
+				for nad.Next() {
+					nad.Nested(func(pad *netlink.AttributeDecoder) error {
+						return parseWireguardPeer(pad, d)
+					})
+				}
+				return nil
+			})
+		}
+	}
+	return ad.Err()
+}
+
+func parseWireguardPeer(ad *netlink.AttributeDecoder, d *wireguardDevice) error {
+	var p wireguardPeer
+	for ad.Next() {
+		switch ad.Type() {
+		case wgPeerAPublicKey:
+			p.publicKey = base64.StdEncoding.EncodeToString(ad.Bytes())
+		case wgPeerALastHandshakeTime:
+			// struct __kernel_timespec.
+			ad.Do(func(b []byte) error {
+				if len(b) < 16 {
+					return fmt.Errorf("short handshake time, len=%d", len(b))
+				}
+				p.lastHandshake = float64(int64(nlenc.Uint64(b[0:8]))) + float64(int64(nlenc.Uint64(b[8:16])))/1e9
+				return nil
+			})
+		case wgPeerARxBytes:
+			p.rxBytes = ad.Uint64()
+		case wgPeerATxBytes:
+			p.txBytes = ad.Uint64()
+		case wgPeerAAllowedIPs:
+			ad.Nested(func(nad *netlink.AttributeDecoder) error {
+				for nad.Next() {
+					p.allowedIPs++
+				}
+				return nil
+			})
+		}
+	}
+
+	if n := len(d.peers); n > 0 && d.peers[n-1].publicKey == p.publicKey {
+		d.peers[n-1].allowedIPs += p.allowedIPs
+		return nil
+	}
+	d.peers = append(d.peers, &p)
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !nowireguard
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+)
+
+func TestParseWireguardDevice(t *testing.T) {
+	key := func(b byte) []byte {
+		k := make([]byte, 32)
+		k[0] = b
+		return k
+	}
+	allowedIPs := func(ae *netlink.AttributeEncoder, n int) {
+		ae.Nested(wgPeerAAllowedIPs, func(nae *netlink.AttributeEncoder) error {
+			for i := 0; i < n; i++ {
+				nae.Nested(0, func(iae *netlink.AttributeEncoder) error {
+					iae.Uint16(1, 2)
+					iae.Bytes(2, []byte{10, 0, 0, byte(i)})
+					iae.Uint8(3, 32)
+					return nil
+				})
+			}
+			return nil
+		})
+	}
+
+	// The second peer is continued in the second message.
+	ae := netlink.NewAttributeEncoder()
+	ae.Uint32(wgDeviceAIfindex, 5)
+	ae.Bytes(wgDeviceAPublicKey, key(1))
+	ae.Uint16(wgDeviceAListenPort, 51820)
+	ae.Nested(wgDeviceAPeers, func(nae *netlink.AttributeEncoder) error {
+		nae.Nested(0, func(pae *netlink.AttributeEncoder) error {
+			pae.Bytes(wgPeerAPublicKey, key(2))
+			handshake := make([]byte, 16)
+			nlenc.PutUint64(handshake[0:8], 1600000000)
+			nlenc.PutUint64(handshake[8:16], 500000000)
+			pae.Bytes(wgPeerALastHandshakeTime, handshake)
+			pae.Uint64(wgPeerARxBytes, 1024)
+			pae.Uint64(wgPeerATxBytes, 2048)
+			allowedIPs(pae, 1)
+			return nil
+		})
+		nae.Nested(1, func(pae *netlink.AttributeEncoder) error {
+			pae.Bytes(wgPeerAPublicKey, key(3))
+			pae.Bytes(wgPeerALastHandshakeTime, make([]byte, 16))
+			allowedIPs(pae, 2)
+			return nil
+		})
+		return nil
+	})
+	first, err := ae.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ae = netlink.NewAttributeEncoder()
+	ae.Uint32(wgDeviceAIfindex, 5)
+	ae.Nested(wgDeviceAPeers, func(nae *netlink.AttributeEncoder) error {
+		nae.Nested(0, func(pae *netlink.AttributeEncoder) error {
+			pae.Bytes(wgPeerAPublicKey, key(3))
+			allowedIPs(pae, 3)
+			return nil
+		})
+		return nil
+	})
+	second, err := ae.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &wireguardDevice{name: "wg0"}
+	for _, b := range [][]byte{first, second} {
+		if err := parseWireguardDevice(b, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := &wireguardDevice{
+		name:       "wg0",
+		publicKey:  "AQAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=",
+		listenPort: 51820,
+		peers: []*wireguardPeer{
+			{
+				publicKey:     "AgAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=",
+				lastHandshake: 1600000000.5,
+				rxBytes:       1024,
+				txBytes:       2048,
+				allowedIPs:    1,
+			},
+			{
+				publicKey:  "AwAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=",
+				allowedIPs: 5,
+			},
+		},
+	}
+	if !reflect.DeepEqual(want, d) {
+		t.Errorf("want device %+v, got %+v", want, d)
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noxfrm
+
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	xfrmSubsystem = "xfrm"
+
+	// Message types and attributes from <linux/xfrm.h>.
+	xfrmMsgGetSAInfo  = 35
+	xfrmMsgGetSPDInfo = 37
+	xfrmaSADCnt       = 1
+	xfrmaSPDInfo      = 1
+)
+
+// xfrmSPDInfo is a struct xfrmu_spdinfo.
+type xfrmSPDInfo struct {
+	in, out, fwd                   uint32
+	socketIn, socketOut, socketFwd uint32
+}
+
+type xfrmCollector struct {
+	states         *prometheus.Desc
+	policies       *prometheus.Desc
+	socketPolicies *prometheus.Desc
+	logger         log.Logger
+}
+
+func init() {
+	registerCollector("xfrm", defaultDisabled, NewXfrmCollector)
+}
+
+// NewXfrmCollector returns a new Collector exposing IPsec statistics and the
+// number of IPsec states and policies.
+func NewXfrmCollector(logger log.Logger) (Collector, error) {
+	return &xfrmCollector{
+		states: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, xfrmSubsystem, "states"),
+			"Number of IPsec security associations in the security association database.",
+			nil, nil,
+		),
+		policies: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, xfrmSubsystem, "policies"),
+			"Number of IPsec policies in the security policy database by direction.",
+			[]string{"direction"}, nil,
+		),
+		socketPolicies: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, xfrmSubsystem, "socket_policies"),
+			"Number of IPsec policies of sockets by direction.",
+			[]string{"direction"}, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *xfrmCollector) Update(ch chan<- prometheus.Metric) error {
+	statsErr := c.updateStats(ch)
+	if statsErr != nil {
+		// Only available with CONFIG_XFRM_STATISTICS.
+		if !errors.Is(statsErr, os.ErrNotExist) {
+			return statsErr
+		}
+		level.Debug(c.logger).Log("msg", "not collecting xfrm statistics", "err", statsErr)
+	}
+
+	countsErr := c.updateCounts(ch)
+	if countsErr != nil {
+		level.Debug(c.logger).Log("msg", "couldn't get number of xfrm states and policies", "err", countsErr)
+	}
+
+	if statsErr != nil && countsErr != nil {
+		return ErrNoData
+	}
+	return nil
+}
+
+func (c *xfrmCollector) updateStats(ch chan<- prometheus.Metric) error {
+	file, err := os.Open(procFilePath("net/xfrm_stat"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stats, err := parseXfrmStats(file)
+	if err != nil {
+		return fmt.Errorf("couldn't parse xfrm statistics: %w", err)
+	}
+	for name, value := range stats {
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, xfrmSubsystem, xfrmMetricName(name)+"_total"),
+				fmt.Sprintf("Statistic %s from /proc/net/xfrm_stat.", name),
+				nil, nil,
+			),
+			prometheus.CounterValue,
+			value,
+		)
+	}
+	return nil
+}
+
+func (c *xfrmCollector) updateCounts(ch chan<- prometheus.Metric) error {
+	conn, err := netlink.Dial(unix.NETLINK_XFRM, nil)
+	if err != nil {
+		return fmt.Errorf("failed to dial netlink: %w", err)
+	}
+	defer conn.Close()
+
+	sad, err := executeXfrmInfo(conn, xfrmMsgGetSAInfo)
+	if err != nil {
+		return err
+	}
+	states, err := parseXfrmSAInfo(sad)
+	if err != nil {
+		return err
+	}
+	spd, err := executeXfrmInfo(conn, xfrmMsgGetSPDInfo)
+	if err != nil {
+		return err
+	}
+	policies, err := parseXfrmSPDInfo(spd)
+	if err != nil {
+		return err
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.states, prometheus.GaugeValue, float64(states))
+	for direction, v := range map[string][2]uint32{
+		"in":  {policies.in, policies.socketIn},
+		"out": {policies.out, policies.socketOut},
+		"fwd": {policies.fwd, policies.socketFwd},
+	} {
+		ch <- prometheus.MustNewConstMetric(c.policies, prometheus.GaugeValue, float64(v[0]), direction)
+		ch <- prometheus.MustNewConstMetric(c.socketPolicies, prometheus.GaugeValue, float64(v[1]), direction)
+	}
+	return nil
+}
+
+// executeXfrmInfo requests the information about the SAD or SPD, which takes
+// and returns flags preceding the attributes.
+func executeXfrmInfo(conn *netlink.Conn, typ netlink.HeaderType) ([]byte, error) {
+	req := netlink.Message{
+		Header: netlink.Header{
+			Flags: netlink.Request,
+			Type:  typ,
+		},
+		Data: make([]byte, 4),
+	}
+	msgs, err := conn.Execute(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) != 1 {
+		return nil, fmt.Errorf("expected 1 message, got %d", len(msgs))
+	}
+	if len(msgs[0].Data) < 4 {
+		return nil, fmt.Errorf("short message, len=%d", len(msgs[0].Data))
+	}
+	return msgs[0].Data[4:], nil
+}
+
+func parseXfrmSAInfo(b []byte) (uint32, error) {
+	ad, err := netlink.NewAttributeDecoder(b)
+	if err != nil {
+		return 0, err
+	}
+	var count uint32
+	for ad.Next() {
+		if ad.Type() == xfrmaSADCnt {
+			count = ad.Uint32()
+		}
+	}
+	return count, ad.Err()
+}
+
+func parseXfrmSPDInfo(b []byte) (*xfrmSPDInfo, error) {
+	ad, err := netlink.NewAttributeDecoder(b)
+	if err != nil {
+		return nil, err
+	}
+	var info xfrmSPDInfo
+	for ad.Next() {
+		if ad.Type() != xfrmaSPDInfo {
+			continue
+		}
+		ad.Do(func(b []byte) error {
+			if len(b) < 24 {
+				return fmt.Errorf("short SPD info, len=%d", len(b))
+			}
+			info = xfrmSPDInfo{
+				in:        nlenc.Uint32(b[0:4]),
+				out:       nlenc.Uint32(b[4:8]),
+				fwd:       nlenc.Uint32(b[8:12]),
+				socketIn:  nlenc.Uint32(b[12:16]),
+				socketOut: nlenc.Uint32(b[16:20]),
+				socketFwd: nlenc.Uint32(b[20:24]),
+			}
+			return nil
+		})
+	}
+	return &info, ad.Err()
+}
+
+func parseXfrmStats(r io.Reader) (map[string]float64, error) {
+	stats := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid line: %q", scanner.Text())
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %w", fields[0], err)
+		}
+		stats[fields[0]] = v
+	}
+	return stats, scanner.Err()
+}
+
+// xfrmMetricName converts a statistic like XfrmOutBundleGenError to
+// out_bundle_gen_error.
+func xfrmMetricName(stat string) string {
+	var b strings.Builder
+	for i, r := range strings.TrimPrefix(stat, "Xfrm") {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
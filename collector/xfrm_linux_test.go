@@ -0,0 +1,79 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noxfrm
+
+package collector
+
+import (
+	"os"
+	"testing"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+)
+
+func TestXfrmStats(t *testing.T) {
+	file, err := os.Open("fixtures/proc/net/xfrm_stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	stats, err := parseXfrmStats(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 28, len(stats); want != got {
+		t.Errorf("want %d statistics, got %d", want, got)
+	}
+	for stat, want := range map[string]float64{
+		"XfrmInNoStates":        12,
+		"XfrmOutBundleGenError": 3,
+		"XfrmAcquireError":      0,
+	} {
+		if got, ok := stats[stat]; !ok || want != got {
+			t.Errorf("want %s %f, got %f", stat, want, got)
+		}
+	}
+
+	for stat, want := range map[string]string{
+		"XfrmInNoStates":        "in_no_states",
+		"XfrmOutBundleGenError": "out_bundle_gen_error",
+		"XfrmFwdHdrError":       "fwd_hdr_error",
+	} {
+		if got := xfrmMetricName(stat); want != got {
+			t.Errorf("want metric name %s for %s, got %s", want, stat, got)
+		}
+	}
+}
+
+func TestParseXfrmSPDInfo(t *testing.T) {
+	info := make([]byte, 24)
+	for i, v := range []uint32{2, 3, 1, 0, 4, 0} {
+		nlenc.PutUint32(info[i*4:(i+1)*4], v)
+	}
+	attrs, err := netlink.MarshalAttributes([]netlink.Attribute{{Type: xfrmaSPDInfo, Data: info}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spd, err := parseXfrmSPDInfo(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := xfrmSPDInfo{in: 2, out: 3, fwd: 1, socketOut: 4}
+	if *spd != want {
+		t.Errorf("want SPD info %+v, got %+v", want, *spd)
+	}
+}
@@ -244,6 +244,91 @@ func (c *xfsCollector) updateXFSStats(ch chan<- prometheus.Metric, s *xfs.Stats)
 			desc:  "Number of times vn_remove called for a filesystem.",
 			value: float64(s.Vnode.Remove),
 		},
+		{
+			name:  "transaction_sync_total",
+			desc:  "Number of meta-data transactions which waited to be committed to the on-disk log before allowing the process to continue for a filesystem.",
+			value: float64(s.Transaction.Sync),
+		},
+		{
+			name:  "transaction_async_total",
+			desc:  "Number of meta-data transactions which did not wait to be committed to the on-disk log for a filesystem.",
+			value: float64(s.Transaction.Async),
+		},
+		{
+			name:  "transaction_empty_total",
+			desc:  "Number of meta-data transactions which did not actually change anything for a filesystem.",
+			value: float64(s.Transaction.Empty),
+		},
+		{
+			name:  "inode_operation_attempts_total",
+			desc:  "Number of times the operating system looked for an XFS inode in the inode cache for a filesystem.",
+			value: float64(s.InodeOperation.Attempts),
+		},
+		{
+			name:  "inode_operation_found_total",
+			desc:  "Number of times the operating system looked for and found an XFS inode in the inode cache for a filesystem.",
+			value: float64(s.InodeOperation.Found),
+		},
+		{
+			name:  "inode_operation_recycled_total",
+			desc:  "Number of times the operating system found an XFS inode in the cache, but could not use it as it was being recycled for a filesystem.",
+			value: float64(s.InodeOperation.Recycle),
+		},
+		{
+			name:  "inode_operation_missed_total",
+			desc:  "Number of times the operating system looked for an XFS inode in the inode cache, but did not find it for a filesystem.",
+			value: float64(s.InodeOperation.Missed),
+		},
+		{
+			name:  "inode_operation_duplicates_total",
+			desc:  "Number of times the operating system tried to add a missing XFS inode to the inode cache, but found it had already been added by another process for a filesystem.",
+			value: float64(s.InodeOperation.Duplicate),
+		},
+		{
+			name:  "inode_operation_reclaims_total",
+			desc:  "Number of times the operating system reclaimed an XFS inode from the inode cache to free memory for a filesystem.",
+			value: float64(s.InodeOperation.Reclaims),
+		},
+		{
+			name:  "inode_operation_attribute_changes_total",
+			desc:  "Number of times the operating system explicitly changed the attributes of an XFS inode for a filesystem.",
+			value: float64(s.InodeOperation.AttributeChange),
+		},
+		{
+			name:  "log_operation_writes_total",
+			desc:  "Number of log buffer writes going to the physical log partitions of a filesystem.",
+			value: float64(s.LogOperation.Writes),
+		},
+		{
+			name:  "log_operation_blocks_total",
+			desc:  "Number of 512 byte blocks written to the physical log partitions of a filesystem.",
+			value: float64(s.LogOperation.Blocks),
+		},
+		{
+			name:  "log_operation_no_internal_buffers_total",
+			desc:  "Number of times a log write had to wait for an available in-core log buffer for a filesystem.",
+			value: float64(s.LogOperation.NoInternalBuffers),
+		},
+		{
+			name:  "log_operation_force_total",
+			desc:  "Number of times the in-core log was forced to disk for a filesystem.",
+			value: float64(s.LogOperation.Force),
+		},
+		{
+			name:  "log_operation_force_sleep_total",
+			desc:  "Number of times a process had to wait for a log force to complete for a filesystem.",
+			value: float64(s.LogOperation.ForceSleep),
+		},
+		{
+			name:  "buffer_get_locked_waited_total",
+			desc:  "Number of times a buffer lookup had to wait for the buffer lock for a filesystem.",
+			value: float64(s.Buffer.GetLockedWaited),
+		},
+		{
+			name:  "buffer_busy_locked_total",
+			desc:  "Number of times a buffer lookup found the buffer locked and did not wait for a filesystem.",
+			value: float64(s.Buffer.BusyLocked),
+		},
 	}
 
 	for _, m := range metrics {
@@ -37,6 +37,7 @@ type zfsCollector struct {
 	linuxProcpathBase    string
 	linuxZpoolIoPath     string
 	linuxZpoolObjsetPath string
+	linuxZpoolStatePath  string
 	linuxPathMap         map[string]string
 	logger               log.Logger
 }
@@ -47,6 +48,7 @@ func NewZFSCollector(logger log.Logger) (Collector, error) {
 		linuxProcpathBase:    "spl/kstat/zfs",
 		linuxZpoolIoPath:     "/*/io",
 		linuxZpoolObjsetPath: "/*/objset-*",
+		linuxZpoolStatePath:  "/*/state",
 		linuxPathMap: map[string]string{
 			"zfs_abd":         "abdstats",
 			"zfs_arc":         "arcstats",
@@ -132,3 +134,23 @@ func (c *zfsCollector) constPoolObjsetMetric(poolName string, datasetName string
 		datasetName,
 	)
 }
+
+func (c *zfsCollector) constPoolStateMetric(poolName string, state string, isActive bool) prometheus.Metric {
+	var value float64
+	if isActive {
+		value = 1
+	}
+
+	return prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "zfs_zpool", "state"),
+			"Indicates the state of the zpool.",
+			[]string{"zpool", "state"},
+			nil,
+		),
+		prometheus.GaugeValue,
+		value,
+		poolName,
+		state,
+	)
+}
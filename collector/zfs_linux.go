@@ -41,6 +41,10 @@ const (
 	// kstatDataString = "7"
 )
 
+// zpoolStates are the pool states reported in /proc/spl/kstat/zfs/<pool>/state,
+// see zpool_state_to_name() in the ZFS sources.
+var zpoolStates = []string{"online", "degraded", "faulted", "offline", "removed", "unavail", "suspended"}
+
 func (c *zfsCollector) openProcFile(path string) (*os.File, error) {
 	file, err := os.Open(procFilePath(path))
 	if err != nil {
@@ -66,6 +70,10 @@ func (c *zfsCollector) updateZfsStats(subsystem string, ch chan<- prometheus.Met
 }
 
 func (c *zfsCollector) updatePoolStats(ch chan<- prometheus.Metric) error {
+	if err := c.updatePoolState(ch); err != nil {
+		return err
+	}
+
 	zpoolPaths, err := filepath.Glob(procFilePath(filepath.Join(c.linuxProcpathBase, c.linuxZpoolIoPath)))
 	if err != nil {
 		return err
@@ -120,6 +128,29 @@ func (c *zfsCollector) updatePoolStats(ch chan<- prometheus.Metric) error {
 	return nil
 }
 
+func (c *zfsCollector) updatePoolState(ch chan<- prometheus.Metric) error {
+	// The state file was added in ZFS on Linux 0.8.
+	zpoolStatePaths, err := filepath.Glob(procFilePath(filepath.Join(c.linuxProcpathBase, c.linuxZpoolStatePath)))
+	if err != nil {
+		return err
+	}
+
+	for _, zpoolPath := range zpoolStatePaths {
+		state, err := readStringFromFile(zpoolPath)
+		if err != nil {
+			// this file should exist, but there is a race where an exporting pool can remove the files -- ok to ignore
+			level.Debug(c.logger).Log("msg", "Cannot open file for reading", "path", zpoolPath)
+			return errZFSNotAvailable
+		}
+
+		poolName := filepath.Base(filepath.Dir(zpoolPath))
+		for _, s := range zpoolStates {
+			ch <- c.constPoolStateMetric(poolName, s, strings.EqualFold(state, s))
+		}
+	}
+	return nil
+}
+
 func (c *zfsCollector) parseProcfsFile(reader io.Reader, fmtExt string, handler func(zfsSysctl, uint64)) error {
 	scanner := bufio.NewScanner(reader)
 
@@ -5,8 +5,14 @@ set -euf -o pipefail
 enabled_collectors=$(cat << COLLECTORS
   arp
   bcache
+  bdi
+  blk_mq
+  bridge
   btrfs
   buddyinfo
+  ceph_client
+  cgroup_io
+  cifs
   conntrack
   cpu
   cpufreq
@@ -14,27 +20,43 @@ enabled_collectors=$(cat << COLLECTORS
   drbd
   edac
   entropy
+  ext4
+  f2fs
+  fibrechannel
   filefd
+  fsnotify
+  fuse
   hwmon
   infiniband
   interrupts
+  io_uring
   ipvs
+  iscsi_host
+  iscsi_session
   ksmd
   loadavg
+  loop
+  lvm
   mdadm
   meminfo
   meminfo_numa
   mountstats
+  nbd
   netdev
   netstat
   nfs
   nfsd
+  nvmet
+  openfiles
   pressure
   qdisc
   rapl
+  rbd
   schedstat
+  scsi_host
   sockstat
   stat
+  swap
   thermal_zone
   textfile
   bonding
@@ -44,6 +66,7 @@ enabled_collectors=$(cat << COLLECTORS
   xfs
   zfs
   processes
+  vdo
 COLLECTORS
 )
 disabled_collectors=$(cat << COLLECTORS
@@ -100,12 +123,19 @@ fi
 ./node_exporter \
   --path.procfs="collector/fixtures/proc" \
   --path.sysfs="collector/fixtures/sys" \
+  --path.udev.data="collector/fixtures/udev/data" \
   $(for c in ${enabled_collectors}; do echo --collector.${c}  ; done) \
   $(for c in ${disabled_collectors}; do echo --no-collector.${c}  ; done) \
   --collector.textfile.directory="collector/fixtures/textfile/two_metric_files/" \
   --collector.wifi.fixtures="collector/fixtures/wifi" \
   --collector.qdisc.fixtures="collector/fixtures/qdisc/" \
-  --collector.netclass.ignored-devices="(bond0|dmz|int)" \
+  --collector.netclass.ignored-devices="(br0|bond0|dmz|int)" \
+  --collector.nfsd.clients \
+  --collector.conntrack.entries-breakdown \
+  --collector.diskstats.udev-properties \
+  --collector.diskstats.queue-attributes \
+  --collector.udp_queues.port-class="dns=53" \
+  --collector.udp_queues.port-class="vxlan=4789" \
   --collector.cpu.info \
   --collector.cpu.info.flags-include="^(aes|avx.?|constant_tsc)$" \
   --collector.cpu.info.bugs-include="^(cpu_meltdown|spectre_.*|mds)$" \
@@ -12,8 +12,8 @@ require (
 	github.com/jpillora/backoff v1.0.0 // indirect
 	github.com/lufia/iostat v1.1.0
 	github.com/mattn/go-xmlrpc v0.0.3
-	github.com/mdlayher/genetlink v1.0.0 // indirect
-	github.com/mdlayher/netlink v1.1.0 // indirect
+	github.com/mdlayher/genetlink v1.0.0
+	github.com/mdlayher/netlink v1.1.0
 	github.com/mdlayher/wifi v0.0.0-20190303161829-b1436901ddee
 	github.com/mwitkow/go-conntrack v0.0.0-20190716064945-2f068394615f // indirect
 	github.com/pkg/errors v0.9.1